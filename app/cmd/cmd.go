@@ -2,26 +2,51 @@ package cmd
 
 import (
 	"saymow/version-manager/app/handlers"
+	"saymow/version-manager/app/repositories"
+	"time"
 
 	"github.com/alecthomas/kong"
 )
 
 var CLI struct {
+	Directory string `short:"C" name:"directory" type:"existingdir" placeholder:"DIR" help:"Run as if vcs was started in DIR. The repository is found by walking up from the working directory, unless VCS_DIR is set."`
+	Jobs      int    `short:"j" name:"jobs" env:"VCS_JOBS" placeholder:"N" help:"Number of files hashed, written or restored concurrently. Defaults to the number of CPUs."`
+	Format    string `name:"format" enum:"text,json,porcelain" default:"text" help:"Output format of status, diff, logs, refs, save, merge, gc, repack, fsck and check-ignore: text, json or porcelain. The json and porcelain schemas are versioned, see the readme."`
+	Porcelain bool   `name:"porcelain" help:"Shorthand for --format porcelain."`
+
 	Init struct {
+		ObjectStore string `name:"object-store" placeholder:"URL" help:"Store the objects in the S3 compatible bucket at URL, http(s)://host[:port]/bucket[/prefix], which can be shared by many repositories. Credentials are read from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN and AWS_REGION."`
 	} `cmd:"" help:"Initialize a repository in the current directory."`
 	Add struct {
-		Paths []string `arg:"" name:"path" help:"List of files paths." type:"path"`
+		All    bool     `short:"A" name:"all" xor:"mode" help:"Add every created, modified and removed file, under the paths when given."`
+		Update bool     `short:"u" name:"update" xor:"mode" help:"Add the modified and removed tracked files, under the paths when given."`
+		Patch  bool     `short:"p" name:"patch" xor:"mode" help:"Interactively choose the hunks of the tracked files to add, or of every modified file when no path is given. The working files are not changed."`
+		Paths  []string `arg:"" optional:"" name:"path" help:"List of files, directories or glob patterns. Quoted globs are expanded by vcs, \"**\" matches any number of directories."`
 	} `cmd:"" help:"Add files to the index."`
 	Rm struct {
-		Paths []string `arg:"" name:"path" help:"List of files paths." type:"path"`
+		Cached    bool     `name:"cached" help:"Only remove the files from the index, the working files are kept."`
+		Force     bool     `short:"f" name:"force" help:"Remove the files even if they have unsaved modifications."`
+		Recursive bool     `short:"r" name:"recursive" help:"Remove the tracked files under the given directories."`
+		Paths     []string `arg:"" name:"path" help:"List of files or directories paths."`
 	} `cmd:"" help:"Remove files from the index and working directory."`
+	Mv struct {
+		Source      string `arg:"" name:"source" help:"Tracked file or directory."`
+		Destination string `arg:"" name:"destination" help:"New path, or an existing directory to move the source into."`
+	} `cmd:"" help:"Move or rename a tracked file or directory, and stage it as a rename."`
+	Unstage struct {
+		Paths []string `arg:"" name:"path" help:"List of files or directories."`
+	} `cmd:"" aliases:"reset" help:"Remove changes from the index. The working directory is not changed."`
 	Save struct {
-		Message string `short="m" name:"message" help:"Save message."`
+		Message string `short:"m" name:"message" help:"Save message."`
 	} `cmd:"" help:"Create a save point with the current index."`
 	Status struct {
 	} `cmd:"" help:"Show the index and working directory status."`
+	Diff struct {
+		Staged bool     `name:"staged" help:"Show the index changes against HEAD."`
+		Refs   []string `arg:"" optional:"" name:"ref" help:"Two Refs or Save hashes to compare."`
+	} `cmd:"" help:"Show changes between the working directory and the index, the index and HEAD (--staged), or two saves."`
 	Restore struct {
-		Ref  string `optional:"" short="r" default:"HEAD" name:"ref" help:"The Ref or Save hash to restore from. If omitted, HEAD is used."`
+		Ref  string `optional:"" short:"r" default:"HEAD" name:"ref" help:"The Ref or Save hash to restore from. If omitted, HEAD is used."`
 		Path string `arg:"" name:"path" help:"Path to be restored."`
 	} `cmd:"" help:"Restore files from index or file tree.\n\nRestore cover 2 usecases: \n\n 1. Restore HEAD + index (...and remove the index change). \n\n It can be used to restore the current head + index changes. Index changes have higher priorities. \n Initialy Restore will look for your change in the index, if found, the index change is applied. Otherwise, \n Restore will apply the HEAD changes. \n\n 2. Restore Save \n\n It can be used to restore existing Saves to the current working directory. \n\nCaveats: \n\n - Restore will remove the existing changes in the path (forever) and restore reference. \n\n - You can use Restore to recover a deleted file from the index or from a Save. \n\n - The HEAD is not changed during Restore."`
 	Logs struct {
@@ -37,24 +62,54 @@ var CLI struct {
 	Merge struct {
 		Name string `arg:"" name:"name" help:"Reference name."`
 	} `cmd:"" help:"Merge name files tree to the current file tree."`
+	Gc struct {
+		DryRun      bool          `name:"dry-run" help:"Show what would be removed without removing it."`
+		GracePeriod time.Duration `name:"grace-period" default:"${gc_grace_period}" help:"Keep objects and saves written within this period."`
+	} `cmd:"" help:"Remove objects and saves unreachable from refs, HEAD and the index."`
+	Repack struct {
+	} `cmd:"" help:"Combine the reachable loose objects and saves, and the existing packs, into a single pack. Unreachable entries are left to gc."`
+	Migrate struct {
+		From string `name:"from" help:"Where the repository was located before being moved. Defaults to the current directory."`
+	} `cmd:"" help:"Upgrade a repository created by an older version to the current storage format."`
+	CheckIgnore struct {
+		Paths []string `arg:"" name:"path" help:"List of paths to check."`
+	} `cmd:"" help:"Show the .vcsignore or .repository/exclude rule matching each path."`
+	Fsck struct {
+	} `cmd:"" help:"Verify the integrity of objects, saves and refs. Problems are printed as tab separated \"kind name message\" lines."`
 }
 
 func Start() {
-	ctx := kong.Parse(&CLI)
+	ctx := kong.Parse(&CLI, kong.Vars{"gc_grace_period": repositories.GC_GRACE_PERIOD.String()})
+
+	handlers.SetParallelism(CLI.Jobs)
+	if CLI.Porcelain {
+		CLI.Format = handlers.PORCELAIN_FORMAT
+	}
+	handlers.SetFormat(CLI.Format)
+
+	if CLI.Directory != "" {
+		handlers.SetDirectory(CLI.Directory)
+	}
 
 	switch ctx.Command() {
 	case "init":
-		handlers.Init()
+		handlers.Init(CLI.Init.ObjectStore)
 	case "status":
 		handlers.ShowStatus()
+	case "diff", "diff <ref>":
+		handlers.ShowDiff(CLI.Diff.Staged, CLI.Diff.Refs)
 	case "logs":
 		handlers.ShowLogs()
 	case "refs":
 		handlers.ShowRefs()
-	case "add <path>":
-		handlers.Add(CLI.Add.Paths)
+	case "add", "add <path>":
+		handlers.Add(CLI.Add.Paths, CLI.Add.All, CLI.Add.Update, CLI.Add.Patch)
 	case "rm <path>":
-		handlers.Remove(CLI.Rm.Paths)
+		handlers.Remove(CLI.Rm.Paths, CLI.Rm.Cached, CLI.Rm.Force, CLI.Rm.Recursive)
+	case "mv <source> <destination>":
+		handlers.Move(CLI.Mv.Source, CLI.Mv.Destination)
+	case "unstage <path>":
+		handlers.Unstage(CLI.Unstage.Paths)
 	case "save":
 		handlers.Save(CLI.Save.Message)
 	case "restore <path>":
@@ -65,6 +120,16 @@ func Start() {
 		handlers.Load(CLI.Load.Name)
 	case "merge <name>":
 		handlers.Merge(CLI.Merge.Name)
+	case "gc":
+		handlers.CollectGarbage(CLI.Gc.DryRun, CLI.Gc.GracePeriod)
+	case "repack":
+		handlers.Repack()
+	case "migrate":
+		handlers.Migrate(CLI.Migrate.From)
+	case "check-ignore <path>":
+		handlers.CheckIgnore(CLI.CheckIgnore.Paths)
+	case "fsck":
+		handlers.CheckIntegrity()
 	default:
 		panic(ctx.Command())
 	}
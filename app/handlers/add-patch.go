@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	Path "path/filepath"
+	"saymow/version-manager/app/pkg/errors"
+	"saymow/version-manager/app/repositories"
+	"saymow/version-manager/app/repositories/diffs"
+	"slices"
+	"strings"
+)
+
+const DEFAULT_EDITOR = "vi"
+
+const PATCH_HELP = `y - stage this hunk
+n - do not stage this hunk
+q - quit; do not stage this hunk or any of the remaining ones
+a - stage this hunk and all later hunks in the file
+d - do not stage this hunk or any of the later hunks in the file
+s - split the current hunk into smaller hunks
+e - manually edit the current hunk
+? - print help`
+
+const EDIT_HUNK_HEADER = `# Manual hunk edit mode.
+# To remove '-' lines, make them ' ' lines (context).
+# To remove '+' lines, delete them.
+# Lines starting with # will be removed.
+`
+
+func formatHunk(hunk *diffs.UnifiedHunk) string {
+	var builder strings.Builder
+
+	for _, line := range hunk.Lines {
+		switch line.LineType {
+		case diffs.DeletedLine:
+			builder.WriteString("-")
+		case diffs.InsertedLine:
+			builder.WriteString("+")
+		default:
+			builder.WriteString(" ")
+		}
+
+		builder.WriteString(line.Content)
+
+		if !strings.HasSuffix(line.Content, "\n") {
+			builder.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+
+	return builder.String()
+}
+
+// editHunk opens the hunk in $VISUAL or $EDITOR and reads the edited hunk back.
+func editHunk(hunk *diffs.UnifiedHunk) (*diffs.UnifiedHunk, error) {
+	file, err := os.CreateTemp("", "vcs-hunk-*.diff")
+	errors.Check(err)
+	defer os.Remove(file.Name())
+
+	_, err = file.WriteString(EDIT_HUNK_HEADER + formatHunk(hunk))
+	errors.Check(err)
+	errors.Check(file.Close())
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = DEFAULT_EDITOR
+	}
+
+	args := append(strings.Fields(editor), file.Name())
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("editor failed: %s.", err.Error())
+	}
+
+	content, err := os.ReadFile(file.Name())
+	errors.Check(err)
+
+	return diffs.ParseHunk(hunk, string(content))
+}
+
+// selectHunks prompts for each hunk of the patch and returns the selected hunks, and whether the user quit.
+func selectHunks(reader *bufio.Reader, patch *repositories.Patch) ([]*diffs.UnifiedHunk, bool) {
+	selectedHunks := []*diffs.UnifiedHunk{}
+	hunks := slices.Clone(patch.Hunks)
+
+	for len(hunks) > 0 {
+		hunk := hunks[0]
+		options := "y,n,q,a,d"
+		if hunk.IsSplittable() {
+			options += ",s"
+		}
+		options += ",e,?"
+
+		printHunk(hunk)
+		fmt.Fprintf(os.Stdout, "\033[34mStage this hunk [%s]? \033[0m", options)
+
+		answer, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			errors.Error(err.Error())
+		}
+		if err == io.EOF && answer == "" {
+			fmt.Fprintln(os.Stdout)
+			return selectedHunks, true
+		}
+
+		switch strings.TrimSpace(answer) {
+		case "y":
+			selectedHunks = append(selectedHunks, hunk)
+			hunks = hunks[1:]
+		case "n":
+			hunks = hunks[1:]
+		case "q":
+			return selectedHunks, true
+		case "a":
+			return append(selectedHunks, hunks...), false
+		case "d":
+			return selectedHunks, false
+		case "s":
+			if !hunk.IsSplittable() {
+				fmt.Fprintln(os.Stdout, "Sorry, cannot split this hunk.")
+				continue
+			}
+
+			splitHunks := diffs.SplitHunk(hunk)
+			fmt.Fprintf(os.Stdout, "Split into %d hunks.\n", len(splitHunks))
+			hunks = append(splitHunks, hunks[1:]...)
+		case "e":
+			editedHunk, err := editHunk(hunk)
+			if err == nil {
+				err = patch.CheckHunk(editedHunk)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stdout, "Your edited hunk does not apply: %s\n", err.Error())
+				continue
+			}
+
+			selectedHunks = append(selectedHunks, editedHunk)
+			hunks = hunks[1:]
+		default:
+			fmt.Fprintln(os.Stdout, PATCH_HELP)
+		}
+	}
+
+	return selectedHunks, false
+}
+
+// addPatch interactively stages hunks of the given files, or of every modified tracked file when no path is given.
+// Conflicted files are skipped.
+func addPatch(paths []string) {
+	root := getRoot()
+	repository := lockRepository(root)
+
+	if len(paths) == 0 {
+		status, err := repository.GetStatus()
+		checkError(err)
+
+		paths = status.WorkingDir.ModifiedFilePaths
+		slices.Sort(paths)
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+
+	for _, path := range paths {
+		patch, err := repository.GetPatch(path)
+		if conflictErr, ok := err.(*repositories.ConflictError); ok {
+			// Conflicts are resolved by adding the whole file, the hunks selected for other files are kept
+			filepath, err := Path.Rel(root, path)
+			errors.Check(err)
+
+			fmt.Fprintf(os.Stdout, "Skipping %s: %s\n", filepath, conflictErr.Message)
+			continue
+		}
+		checkError(err)
+
+		if len(patch.Hunks) == 0 {
+			continue
+		}
+
+		filepath, err := Path.Rel(root, patch.Filepath)
+		errors.Check(err)
+
+		fmt.Fprintf(os.Stdout, "\033[1mdiff a/%s b/%s\n--- a/%s\n+++ b/%s\033[0m\n", filepath, filepath, filepath, filepath)
+
+		hunks, quit := selectHunks(reader, patch)
+		checkError(repository.AddPatch(patch, hunks))
+
+		if quit {
+			break
+		}
+	}
+
+	checkError(repository.SaveIndex())
+	commitRepository(repository)
+}
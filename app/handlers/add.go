@@ -1,20 +1,26 @@
 package handlers
 
-import (
-	"os"
-	"saymow/version-manager/app/pkg/errors"
-	"saymow/version-manager/app/repositories"
-)
+import "saymow/version-manager/app/repositories"
 
-func Add(paths []string) {
-	dir, err := os.Getwd()
-	errors.Check(err)
+func Add(paths []string, all bool, update bool, patch bool) {
+	if patch {
+		addPatch(resolvePaths(paths))
+		return
+	}
 
-	repository := repositories.GetRepository(dir)
+	repository := lockRepository(getRoot())
 
-	for _, path := range paths {
-		checkError(repository.IndexFile(path))
+	switch {
+	case all:
+		checkError(repository.AddAll(resolvePaths(paths)))
+	case update:
+		checkError(repository.AddUpdated(resolvePaths(paths)))
+	case len(paths) == 0:
+		checkError(&repositories.ValidationError{Message: "nothing specified, nothing added."})
+	default:
+		checkError(repository.AddFiles(resolvePaths(paths)))
 	}
 
 	checkError(repository.SaveIndex())
+	commitRepository(repository)
 }
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+)
+
+// ignoreRuleOutput is a rule of the "check-ignore" json schema, Path is the path as given.
+type ignoreRuleOutput struct {
+	Path    string `json:"path"`
+	Source  string `json:"source"`
+	Line    int    `json:"line"`
+	Pattern string `json:"pattern"`
+	Negated bool   `json:"negated"`
+}
+
+// CheckIgnore prints the rule matching each path as "source:line:pattern<tab>path". A negated rule means
+// the path is not ignored. It exits with 1 when no path is ignored.
+func CheckIgnore(paths []string) {
+	repository := getRepository()
+	ignored := false
+	rules := []ignoreRuleOutput{}
+
+	for _, path := range paths {
+		rule, err := repository.CheckIgnore(resolvePath(path))
+		checkError(err)
+
+		if rule == nil {
+			continue
+		}
+
+		ignored = ignored || !rule.Negated
+		if !isMachineFormat() {
+			fmt.Fprintf(os.Stdout, "%s\t%s\n", rule, path)
+			continue
+		}
+
+		rules = append(rules, ignoreRuleOutput{Path: path, Source: rule.Source, Line: rule.Line, Pattern: rule.Pattern, Negated: rule.Negated})
+	}
+
+	switch format {
+	case JSON_FORMAT:
+		printJSON("check-ignore", struct {
+			Rules []ignoreRuleOutput `json:"rules"`
+		}{rules})
+	case PORCELAIN_FORMAT:
+		printPorcelainHeader()
+		for _, rule := range rules {
+			printPorcelainLine("rule", rule.Path, rule.Source, fmt.Sprint(rule.Line), rule.Pattern, fmt.Sprint(rule.Negated))
+		}
+	}
+
+	if !ignored {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"saymow/version-manager/app/repositories"
+)
+
+type integrityProblemOutput struct {
+	Kind    string `json:"kind"`
+	Name    string `json:"name"`
+	Message string `json:"message"`
+}
+
+type integrityOutput struct {
+	CheckedSaves   int                      `json:"checked_saves"`
+	CheckedObjects int                      `json:"checked_objects"`
+	Problems       []integrityProblemOutput `json:"problems"`
+}
+
+// CheckIntegrity prints one tab separated "kind name message" line per problem. The summary goes to
+// stderr so that stdout stays machine-readable.
+func CheckIntegrity() {
+	report, err := repositories.CheckIntegrity(getRoot())
+	checkError(err)
+
+	switch format {
+	case JSON_FORMAT:
+		output := integrityOutput{CheckedSaves: report.CheckedSaves, CheckedObjects: report.CheckedObjects, Problems: []integrityProblemOutput{}}
+		for _, problem := range report.Problems {
+			output.Problems = append(output.Problems, integrityProblemOutput{Kind: problem.Kind, Name: problem.Name, Message: problem.Message})
+		}
+
+		printJSON("fsck", output)
+	case PORCELAIN_FORMAT:
+		printPorcelainHeader()
+		printPorcelainLine("checked", fmt.Sprint(report.CheckedSaves), fmt.Sprint(report.CheckedObjects))
+		for _, problem := range report.Problems {
+			printPorcelainLine("problem", problem.Kind, problem.Name, problem.Message)
+		}
+	default:
+		for _, problem := range report.Problems {
+			fmt.Fprintf(os.Stdout, "%s\t%s\t%s\n", problem.Kind, problem.Name, problem.Message)
+		}
+
+		fmt.Fprintf(os.Stderr, "Checked %d saves and %d objects, found %d problems.\n", report.CheckedSaves, report.CheckedObjects, len(report.Problems))
+	}
+
+	if report.HasProblems() {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+)
+
+type garbageCollectionOutput struct {
+	DryRun           bool     `json:"dry_run"`
+	RemovedSaves     []string `json:"removed_saves"`
+	RemovedObjects   []string `json:"removed_objects"`
+	RemovedTempFiles []string `json:"removed_temp_files"`
+}
+
+func CollectGarbage(dryRun bool, gracePeriod time.Duration) {
+	repository := lockRepository(getRoot())
+	collection, err := repository.CollectGarbage(dryRun, gracePeriod)
+	checkError(err)
+	commitRepository(repository)
+
+	if isMachineFormat() {
+		output := garbageCollectionOutput{
+			DryRun:           collection.DryRun,
+			RemovedSaves:     append([]string{}, collection.RemovedSaves...),
+			RemovedObjects:   append([]string{}, collection.RemovedObjects...),
+			RemovedTempFiles: append([]string{}, collection.RemovedTempFiles...),
+		}
+
+		if format == JSON_FORMAT {
+			printJSON("gc", output)
+			return
+		}
+
+		printPorcelainHeader()
+		printPorcelainLine("dry_run", fmt.Sprint(output.DryRun))
+		for _, saveName := range output.RemovedSaves {
+			printPorcelainLine("save", saveName)
+		}
+		for _, objectName := range output.RemovedObjects {
+			printPorcelainLine("object", objectName)
+		}
+		for _, name := range output.RemovedTempFiles {
+			printPorcelainLine("temp", name)
+		}
+		return
+	}
+
+	action := "Removed"
+	if collection.DryRun {
+		action = "Would remove"
+	}
+
+	for _, saveName := range collection.RemovedSaves {
+		fmt.Printf("%s save %s\n", action, saveName)
+	}
+	for _, objectName := range collection.RemovedObjects {
+		fmt.Printf("%s object %s\n", action, objectName)
+	}
+	for _, name := range collection.RemovedTempFiles {
+		fmt.Printf("%s temporary file %s\n", action, name)
+	}
+
+	fmt.Printf("%s %d saves and %d objects.\n", action, len(collection.RemovedSaves), len(collection.RemovedObjects))
+}
@@ -3,19 +3,164 @@ package handlers
 import (
 	"fmt"
 	"os"
+	Path "path/filepath"
 	"saymow/version-manager/app/pkg/errors"
 	"saymow/version-manager/app/repositories"
+	"saymow/version-manager/app/repositories/filesystems"
+	"strings"
 )
 
+// REPOSITORY_DIR_ENV sets the repository root, skipping the discovery from the working directory.
+const REPOSITORY_DIR_ENV = "VCS_DIR"
+
+var parallelism int
+
+// SetParallelism bounds the number of files processed concurrently by the repositories. A non positive
+// parallelism uses the number of CPUs.
+func SetParallelism(jobs int) {
+	parallelism = jobs
+}
+
+// SetDirectory runs the commands as if they were started in dir. The output format must be set first, a
+// directory that cannot be entered is reported as the other errors.
+func SetDirectory(dir string) {
+	if err := os.Chdir(dir); err != nil {
+		// os.Chdir errors are *os.PathError, only the cause is kept as dir is already in the message
+		checkError(&repositories.ValidationError{
+			Message: fmt.Sprintf("cannot change to directory \"%s\": %s.", dir, err.(*os.PathError).Err),
+		})
+	}
+}
+
+// Exit statuses of the failed commands, scripts can tell the errors apart without parsing messages.
+const (
+	EXIT_FAILURE        = 1
+	EXIT_VALIDATION     = 2
+	EXIT_NOT_REPOSITORY = 3
+	EXIT_INVALID_REF    = 4
+	EXIT_CONFLICT       = 5
+	EXIT_CORRUPT        = 6
+	EXIT_LOCKED         = 7
+)
+
+type errorOutput struct {
+	Message string `json:"message"`
+	Kind    string `json:"kind"`
+}
+
+// describeError returns the error message without its kind prefix, the kind name and the exit status.
+func describeError(err error) (string, string, int) {
+	switch typedErr := err.(type) {
+	case *repositories.ValidationError:
+		return typedErr.Message, "validation", EXIT_VALIDATION
+	case *repositories.NotRepositoryError:
+		return "not a repository (or any of the parent directories).", "not-repository", EXIT_NOT_REPOSITORY
+	case *repositories.InvalidRefError:
+		return fmt.Sprintf("invalid ref \"%s\".", typedErr.Ref), "invalid-ref", EXIT_INVALID_REF
+	case *repositories.ConflictError:
+		return typedErr.Message, "conflict", EXIT_CONFLICT
+	case *filesystems.CorruptError:
+		return fmt.Sprintf("%s %s", typedErr.Name, typedErr.Message), "corrupt", EXIT_CORRUPT
+	case *filesystems.LockedError:
+		return strings.TrimPrefix(typedErr.Error(), "Lock Error: "), "locked", EXIT_LOCKED
+	default:
+		return err.Error(), "failure", EXIT_FAILURE
+	}
+}
+
 func checkError(err error) {
 	if err == nil {
 		return
 	}
 
-	if _, ok := err.(*repositories.ValidationError); ok {
+	if lockedRepository != nil {
+		lockedRepository.Unlock()
+	}
+
+	message, kind, status := describeError(err)
+
+	switch format {
+	case JSON_FORMAT:
+		printJSON("error", errorOutput{Message: message, Kind: kind})
+	case PORCELAIN_FORMAT:
+		printPorcelainHeader()
+		printPorcelainLine("error", message, kind)
+	default:
 		fmt.Println(err.Error())
-		os.Exit(1)
 	}
 
-	errors.Error("unexpected error")
+	os.Exit(status)
+}
+
+// getRoot returns the root of the repository containing the working directory.
+func getRoot() string {
+	if dir := os.Getenv(REPOSITORY_DIR_ENV); dir != "" {
+		dir = resolvePath(dir)
+
+		root, err := repositories.FindRoot(dir)
+		if err == nil && root != dir {
+			err = &repositories.ValidationError{Message: fmt.Sprintf("%s is not a repository.", REPOSITORY_DIR_ENV)}
+		}
+		checkError(err)
+
+		return root
+	}
+
+	dir, err := os.Getwd()
+	errors.Check(err)
+
+	root, err := repositories.FindRoot(dir)
+	checkError(err)
+
+	return root
+}
+
+func getRepository() *repositories.Repository {
+	return openRepository(getRoot())
+}
+
+func openRepository(root string) *repositories.Repository {
+	repository, err := repositories.GetRepository(root)
+	checkError(err)
+	repository.SetParallelism(parallelism)
+
+	return repository
+}
+
+// lockedRepository is the repository locked by the running command, checkError releases its lock.
+var lockedRepository *repositories.Repository
+
+// lockRepository reads the repository for a command modifying it, the repository files it writes are only
+// visible to other commands after commitRepository.
+func lockRepository(root string) *repositories.Repository {
+	repository, err := repositories.LockRepository(root)
+	checkError(err)
+	repository.SetParallelism(parallelism)
+	lockedRepository = repository
+
+	return repository
+}
+
+func commitRepository(repository *repositories.Repository) {
+	checkError(repository.Commit())
+	lockedRepository = nil
+}
+
+// resolvePath makes a path argument absolute, relative paths are resolved against the working directory
+// and not the repository root.
+func resolvePath(path string) string {
+	path, err := Path.Abs(path)
+	errors.Check(err)
+
+	return path
+}
+
+func resolvePaths(paths []string) []string {
+	resolvedPaths := []string{}
+
+	for _, path := range paths {
+		resolvedPaths = append(resolvedPaths, resolvePath(path))
+	}
+
+	return resolvedPaths
 }
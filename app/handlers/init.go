@@ -4,11 +4,28 @@ import (
 	"os"
 	"saymow/version-manager/app/pkg/errors"
 	"saymow/version-manager/app/repositories"
+	"saymow/version-manager/app/repositories/objectstores"
 )
 
-func Init() {
+func Init(objectStoreURL string) {
 	currentDir, err := os.Getwd()
 	errors.Check(err)
 
-	repositories.CreateRepository(currentDir)
+	if dir := os.Getenv(REPOSITORY_DIR_ENV); dir != "" {
+		currentDir = resolvePath(dir)
+	}
+
+	// Checked first, so an invalid url does not leave a repository behind
+	if objectStoreURL != "" {
+		if _, err := objectstores.ParseS3URL(objectStoreURL); err != nil {
+			checkError(&repositories.ValidationError{Message: err.Error()})
+		}
+	}
+
+	repository, err := repositories.CreateRepository(currentDir)
+	checkError(err)
+
+	if objectStoreURL != "" {
+		checkError(repository.SetObjectStoreURL(objectStoreURL))
+	}
 }
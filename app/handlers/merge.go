@@ -2,22 +2,53 @@ package handlers
 
 import (
 	"fmt"
-	"os"
-	"saymow/version-manager/app/pkg/errors"
-	"saymow/version-manager/app/repositories"
 )
 
-func Merge(name string) {
-	root, err := os.Getwd()
-	errors.Check(err)
+// mergeOutput is the "merge" json schema. Save is the save HEAD points to after the merge, conflicted merges
+// leave HEAD unchanged and the status holds the conflicts to resolve.
+type mergeOutput struct {
+	Ref        string        `json:"ref"`
+	Save       string        `json:"save"`
+	Conflicted bool          `json:"conflicted"`
+	Status     *statusOutput `json:"status"`
+}
 
-	repository := repositories.GetRepository(root)
-	_, err = repository.Merge(name)
-	errors.Check(err)
+func Merge(name string) {
+	root := getRoot()
+	repository := lockRepository(root)
+	save, err := repository.Merge(name)
+	checkError(err)
+	commitRepository(repository)
 
 	// Reload the file tree
-	repository = repositories.GetRepository(root)
-	status := repository.GetStatus()
+	repository = openRepository(root)
+	status, err := repository.GetStatus()
+	checkError(err)
+
+	if isMachineFormat() {
+		output := mergeOutput{
+			Ref:        name,
+			Save:       save.Id,
+			Conflicted: len(status.Staged.ConflictedFilesPaths) > 0,
+			Status:     makeStatusOutput(root, status),
+		}
+
+		if format == JSON_FORMAT {
+			printJSON("merge", output)
+			return
+		}
+
+		result := "merged"
+		if output.Conflicted {
+			result = "conflicted"
+		}
+
+		printPorcelainHeader()
+		printPorcelainLine("merge", output.Ref, output.Save, result)
+		printStatusPorcelain(output.Status)
+
+		return
+	}
 
 	fmt.Printf("Ref \"%s\" merged succesfully.\n", name)
 
@@ -25,6 +56,4 @@ func Merge(name string) {
 		fmt.Print("But you have conflicts to resolve:\n\n")
 		printStatus(status)
 	}
-
-	checkError(err)
 }
@@ -0,0 +1,15 @@
+package handlers
+
+import "saymow/version-manager/app/repositories"
+
+func Migrate(from string) {
+	root := getRoot()
+
+	if from == "" {
+		from = root
+	} else {
+		from = resolvePath(from)
+	}
+
+	checkError(repositories.Migrate(root, from))
+}
@@ -0,0 +1,9 @@
+package handlers
+
+func Move(src string, dst string) {
+	repository := lockRepository(getRoot())
+
+	checkError(repository.MoveFile(resolvePath(src), resolvePath(dst)))
+	checkError(repository.SaveIndex())
+	commitRepository(repository)
+}
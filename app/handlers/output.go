@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	Path "path/filepath"
+	"saymow/version-manager/app/pkg/errors"
+	"strings"
+)
+
+const (
+	TEXT_FORMAT      = "text"
+	JSON_FORMAT      = "json"
+	PORCELAIN_FORMAT = "porcelain"
+
+	// OUTPUT_SCHEMA_VERSION is bumped whenever a json field or porcelain column is removed, renamed or
+	// changes meaning. New fields, columns and line kinds may be added within a version.
+	OUTPUT_SCHEMA_VERSION = 1
+)
+
+var format = TEXT_FORMAT
+
+// SetFormat selects how commands print their results: text for humans, or json and porcelain for scripts.
+func SetFormat(outputFormat string) {
+	format = outputFormat
+}
+
+func isMachineFormat() bool {
+	return format == JSON_FORMAT || format == PORCELAIN_FORMAT
+}
+
+// jsonDocument is the envelope of every json output, kind tells the schema of data.
+type jsonDocument struct {
+	Version int    `json:"version"`
+	Kind    string `json:"kind"`
+	Data    any    `json:"data"`
+}
+
+// printJSON writes a single line json document to stdout.
+func printJSON(kind string, data any) {
+	content, err := json.Marshal(jsonDocument{Version: OUTPUT_SCHEMA_VERSION, Kind: kind, Data: data})
+	errors.Check(err)
+
+	fmt.Fprintf(os.Stdout, "%s\n", content)
+}
+
+// printPorcelainHeader starts every porcelain output, so scripts can check the version they parse.
+func printPorcelainHeader() {
+	fmt.Fprintf(os.Stdout, "# porcelain v%d\n", OUTPUT_SCHEMA_VERSION)
+}
+
+// printPorcelainLine writes the fields tab separated. Tabs and newlines in fields are escaped, so each
+// record is a single line.
+func printPorcelainLine(fields ...string) {
+	escaper := strings.NewReplacer("\\", "\\\\", "\t", "\\t", "\n", "\\n", "\r", "\\r")
+
+	for idx, field := range fields {
+		fields[idx] = escaper.Replace(field)
+	}
+
+	fmt.Fprintf(os.Stdout, "%s\n", strings.Join(fields, "\t"))
+}
+
+// outputPath converts a path to the form used in machine-readable outputs: relative to the repository
+// root and slash separated.
+func outputPath(root string, filepath string) string {
+	if filepath == "" {
+		return ""
+	}
+
+	relativePath, err := Path.Rel(root, filepath)
+	errors.Check(err)
+
+	return Path.ToSlash(relativePath)
+}
+
+func outputPaths(root string, filepaths []string) []string {
+	paths := []string{}
+
+	for _, filepath := range filepaths {
+		paths = append(paths, outputPath(root, filepath))
+	}
+
+	return paths
+}
@@ -1,20 +1,9 @@
 package handlers
 
-import (
-	"os"
-	"saymow/version-manager/app/pkg/errors"
-	"saymow/version-manager/app/repositories"
-)
-
-func Remove(paths []string) {
-	dir, err := os.Getwd()
-	errors.Check(err)
-
-	repository := repositories.GetRepository(dir)
-
-	for _, path := range paths {
-		checkError(repository.RemoveFile(path))
-	}
+func Remove(paths []string, cached bool, force bool, recursive bool) {
+	repository := lockRepository(getRoot())
 
+	checkError(repository.RemoveFiles(resolvePaths(paths), cached, force, recursive))
 	checkError(repository.SaveIndex())
+	commitRepository(repository)
 }
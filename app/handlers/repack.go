@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"fmt"
+)
+
+// repackOutput is the "repack" json schema, Pack is empty when there was nothing to pack.
+type repackOutput struct {
+	Pack    string `json:"pack"`
+	Saves   int    `json:"saves"`
+	Objects int    `json:"objects"`
+}
+
+func Repack() {
+	repository := lockRepository(getRoot())
+	repack, err := repository.Repack()
+	checkError(err)
+	commitRepository(repository)
+
+	if isMachineFormat() {
+		output := repackOutput{}
+		if repack != nil {
+			output = repackOutput{Pack: repack.PackName, Saves: repack.PackedSaves, Objects: repack.PackedObjects}
+		}
+
+		if format == JSON_FORMAT {
+			printJSON("repack", output)
+			return
+		}
+
+		printPorcelainHeader()
+		if repack != nil {
+			printPorcelainLine("pack", output.Pack, fmt.Sprint(output.Saves), fmt.Sprint(output.Objects))
+		}
+		return
+	}
+
+	if repack == nil {
+		fmt.Println("Nothing to pack.")
+		return
+	}
+
+	fmt.Printf("Packed %d saves and %d objects into pack %s.\n", repack.PackedSaves, repack.PackedObjects, repack.PackName)
+}
@@ -1,16 +1,20 @@
 package handlers
 
-import (
-	"os"
-	"saymow/version-manager/app/pkg/errors"
-	"saymow/version-manager/app/repositories"
-)
+import "saymow/version-manager/app/repositories"
 
 func Save(message string) {
-	dir, err := os.Getwd()
-	errors.Check(err)
-
-	repository := repositories.GetRepository(dir)
-	_, err = repository.CreateSave(message)
+	repository := lockRepository(getRoot())
+	checkpoint, err := repository.CreateSave(message)
 	checkError(err)
+	commitRepository(repository)
+
+	save := makeSaveOutput(&repositories.SaveLog{Checkpoint: checkpoint, Refs: []string{repository.GetRefs().Head}})
+
+	switch format {
+	case JSON_FORMAT:
+		printJSON("save", save)
+	case PORCELAIN_FORMAT:
+		printPorcelainHeader()
+		printSavePorcelain(save)
+	}
 }
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	Path "path/filepath"
+	"saymow/version-manager/app/pkg/errors"
+	"saymow/version-manager/app/repositories"
+	"saymow/version-manager/app/repositories/diffs"
+	"saymow/version-manager/app/repositories/directories"
+	"strings"
+)
+
+type lineOutput struct {
+	Type    string `json:"type"`
+	Content string `json:"content"`
+}
+
+type hunkOutput struct {
+	OldStart int          `json:"old_start"`
+	OldLines int          `json:"old_lines"`
+	NewStart int          `json:"new_start"`
+	NewLines int          `json:"new_lines"`
+	Lines    []lineOutput `json:"lines"`
+}
+
+// fileDiffOutput is a file of the "diff" json schema. Objects and modes are empty when the file does not
+// exist on that side, OldPath is only set for renames.
+type fileDiffOutput struct {
+	Change    string       `json:"change"`
+	Path      string       `json:"path"`
+	OldPath   string       `json:"old_path"`
+	OldObject string       `json:"old_object"`
+	NewObject string       `json:"new_object"`
+	OldMode   string       `json:"old_mode"`
+	NewMode   string       `json:"new_mode"`
+	Binary    bool         `json:"binary"`
+	Hunks     []hunkOutput `json:"hunks"`
+}
+
+type diffOutput struct {
+	Files []fileDiffOutput `json:"files"`
+}
+
+func makeFileDiffOutput(root string, fileDiff *repositories.FileDiff) fileDiffOutput {
+	output := fileDiffOutput{
+		Change:    "modified",
+		Path:      outputPath(root, fileDiff.Filepath),
+		OldPath:   outputPath(root, fileDiff.OldFilepath),
+		OldObject: fileDiff.OldObjectName,
+		NewObject: fileDiff.NewObjectName,
+		Binary:    fileDiff.IsBinary,
+		Hunks:     []hunkOutput{},
+	}
+
+	if fileDiff.OldObjectName != "" {
+		output.OldMode = fileDiff.OldMode.String()
+	}
+	if fileDiff.NewObjectName != "" {
+		output.NewMode = fileDiff.NewMode.String()
+	}
+
+	switch {
+	case fileDiff.OldFilepath != "":
+		output.Change = "renamed"
+	case fileDiff.OldObjectName == "":
+		output.Change = "created"
+	case fileDiff.NewObjectName == "":
+		output.Change = "removed"
+	}
+
+	for _, hunk := range fileDiff.Hunks {
+		hunkOutput := hunkOutput{
+			OldStart: hunk.OldStart,
+			OldLines: hunk.OldLines,
+			NewStart: hunk.NewStart,
+			NewLines: hunk.NewLines,
+			Lines:    []lineOutput{},
+		}
+
+		for _, line := range hunk.Lines {
+			lineType := "context"
+			switch line.LineType {
+			case diffs.DeletedLine:
+				lineType = "deleted"
+			case diffs.InsertedLine:
+				lineType = "inserted"
+			}
+
+			hunkOutput.Lines = append(hunkOutput.Lines, lineOutput{Type: lineType, Content: line.Content})
+		}
+
+		output.Hunks = append(output.Hunks, hunkOutput)
+	}
+
+	return output
+}
+
+func printFileDiff(root string, fileDiff *repositories.FileDiff) {
+	filepath, err := Path.Rel(root, fileDiff.Filepath)
+	errors.Check(err)
+
+	oldFilepath := filepath
+	if fileDiff.OldFilepath != "" {
+		oldFilepath, err = Path.Rel(root, fileDiff.OldFilepath)
+		errors.Check(err)
+	}
+
+	oldName, newName := "a/"+oldFilepath, "b/"+filepath
+	if fileDiff.OldObjectName == "" {
+		oldName = "/dev/null"
+	}
+	if fileDiff.NewObjectName == "" {
+		newName = "/dev/null"
+	}
+
+	fmt.Fprintf(os.Stdout, "\033[1mdiff a/%s b/%s\n", oldFilepath, filepath)
+
+	// Regular files modes are only shown when they change
+	switch {
+	case fileDiff.OldObjectName == "" && fileDiff.NewMode != directories.RegularMode:
+		fmt.Fprintf(os.Stdout, "new file mode %s\n", fileDiff.NewMode)
+	case fileDiff.NewObjectName == "" && fileDiff.OldMode != directories.RegularMode:
+		fmt.Fprintf(os.Stdout, "deleted file mode %s\n", fileDiff.OldMode)
+	case fileDiff.OldObjectName != "" && fileDiff.NewObjectName != "" && fileDiff.OldMode != fileDiff.NewMode:
+		fmt.Fprintf(os.Stdout, "old mode %s\nnew mode %s\n", fileDiff.OldMode, fileDiff.NewMode)
+	}
+
+	if fileDiff.OldFilepath != "" {
+		fmt.Fprintf(os.Stdout, "rename from %s\nrename to %s\n", oldFilepath, filepath)
+	}
+
+	if fileDiff.OldObjectName == fileDiff.NewObjectName {
+		// Only renamed or its mode changed
+		fmt.Fprint(os.Stdout, "\033[0m")
+		return
+	}
+
+	if fileDiff.IsBinary {
+		fmt.Fprintf(os.Stdout, "Binary files %s and %s differ\033[0m\n", oldName, newName)
+		return
+	}
+
+	fmt.Fprintf(os.Stdout, "--- %s\n+++ %s\033[0m\n", oldName, newName)
+
+	for _, hunk := range fileDiff.Hunks {
+		printHunk(hunk)
+	}
+}
+
+func printHunk(hunk *diffs.UnifiedHunk) {
+	fmt.Fprintf(os.Stdout, "\033[36m@@ -%d,%d +%d,%d @@\033[0m\n", hunk.OldStart, hunk.OldLines, hunk.NewStart, hunk.NewLines)
+
+	for _, line := range hunk.Lines {
+		switch line.LineType {
+		case diffs.DeletedLine:
+			fmt.Fprint(os.Stdout, "\033[31m-")
+		case diffs.InsertedLine:
+			fmt.Fprint(os.Stdout, "\033[32m+")
+		default:
+			fmt.Fprint(os.Stdout, " ")
+		}
+
+		fmt.Fprintf(os.Stdout, "%s\033[0m\n", strings.TrimSuffix(line.Content, "\n"))
+
+		if !strings.HasSuffix(line.Content, "\n") {
+			fmt.Fprint(os.Stdout, "\\ No newline at end of file\n")
+		}
+	}
+}
+
+func ShowDiff(staged bool, refs []string) {
+	root := getRoot()
+	repository := openRepository(root)
+	var fileDiffs []*repositories.FileDiff
+	var err error
+
+	switch {
+	case len(refs) == 2:
+		fileDiffs, err = repository.GetSavesDiff(refs[0], refs[1])
+		checkError(err)
+	case len(refs) > 0:
+		checkError(&repositories.ValidationError{Message: "expected two refs to compare."})
+	case staged:
+		fileDiffs, err = repository.GetStagedDiff()
+		checkError(err)
+	default:
+		fileDiffs, err = repository.GetWorkingDirDiff()
+		checkError(err)
+	}
+
+	if isMachineFormat() {
+		output := diffOutput{Files: []fileDiffOutput{}}
+		for _, fileDiff := range fileDiffs {
+			output.Files = append(output.Files, makeFileDiffOutput(root, fileDiff))
+		}
+
+		if format == JSON_FORMAT {
+			printJSON("diff", output)
+			return
+		}
+
+		// The porcelain diff only lists the changed files, hunks are part of the json output
+		printPorcelainHeader()
+		for _, file := range output.Files {
+			printPorcelainLine("file", file.Change, file.Path, file.OldPath, file.OldMode, file.NewMode)
+		}
+
+		return
+	}
+
+	for _, fileDiff := range fileDiffs {
+		printFileDiff(root, fileDiff)
+	}
+}
@@ -3,19 +3,81 @@ package handlers
 import (
 	"fmt"
 	"os"
-	"saymow/version-manager/app/pkg/errors"
 	"saymow/version-manager/app/repositories"
+	"slices"
+	"strings"
+	"time"
 )
 
 // Wed, Nov 18, 2024, 2:35 PM
 const DATE_LAYOUT = "Mon, Jan 06, 2006, 3:04 PM"
 
+type saveOutput struct {
+	Id        string   `json:"id"`
+	Message   string   `json:"message"`
+	CreatedAt string   `json:"created_at"`
+	Parents   []string `json:"parents"`
+	Refs      []string `json:"refs"`
+}
+
+// logOutput is the "log" json schema, saves are sorted from the most recent. Head is a ref name, or a save id
+// in detached mode.
+type logOutput struct {
+	Head  string       `json:"head"`
+	Saves []saveOutput `json:"saves"`
+}
+
+func makeSaveOutput(saveLog *repositories.SaveLog) saveOutput {
+	refs := slices.Clone(saveLog.Refs)
+	if refs == nil {
+		refs = []string{}
+	}
+	slices.Sort(refs)
+
+	parents := slices.Clone(saveLog.Checkpoint.Parents)
+	if parents == nil {
+		parents = []string{}
+	}
+
+	return saveOutput{
+		Id:        saveLog.Checkpoint.Id,
+		Message:   saveLog.Checkpoint.Message,
+		CreatedAt: saveLog.Checkpoint.CreatedAt.Format(time.RFC3339),
+		Parents:   parents,
+		Refs:      refs,
+	}
+}
+
+// printSavePorcelain prints "save<tab>id<tab>created at<tab>parents<tab>refs<tab>message", parents are space
+// separated and refs comma separated.
+func printSavePorcelain(save saveOutput) {
+	printPorcelainLine("save", save.Id, save.CreatedAt, strings.Join(save.Parents, " "), strings.Join(save.Refs, ","), save.Message)
+}
+
 func ShowLogs() {
-	root, err := os.Getwd()
-	errors.Check(err)
+	repository := getRepository()
+	log, err := repository.GetLogs()
+	checkError(err)
+
+	if isMachineFormat() {
+		output := logOutput{Head: log.Head, Saves: []saveOutput{}}
+		for _, saveLog := range log.History {
+			output.Saves = append(output.Saves, makeSaveOutput(saveLog))
+		}
+
+		if format == JSON_FORMAT {
+			printJSON("log", output)
+			return
+		}
+
+		printPorcelainHeader()
+		printPorcelainLine("head", output.Head)
+		for _, save := range output.Saves {
+			printSavePorcelain(save)
+		}
 
-	repository := repositories.GetRepository(root)
-	log := repository.GetLogs()
+		return
+	}
 
 	if len(log.History) == 0 {
 		fmt.Println("Empty saves history.")
@@ -3,17 +3,51 @@ package handlers
 import (
 	"fmt"
 	"os"
-	"saymow/version-manager/app/pkg/errors"
-	"saymow/version-manager/app/repositories"
+	"slices"
 )
 
-func ShowRefs() {
-	root, err := os.Getwd()
-	errors.Check(err)
+type refOutput struct {
+	Name string `json:"name"`
+	Save string `json:"save"`
+}
+
+// refsOutput is the "refs" json schema, refs are sorted by name. The save of a ref without saves is empty.
+type refsOutput struct {
+	Head string      `json:"head"`
+	Refs []refOutput `json:"refs"`
+}
 
-	repository := repositories.GetRepository(root)
+func ShowRefs() {
+	repository := getRepository()
 	refs := repository.GetRefs()
 
+	if isMachineFormat() {
+		output := refsOutput{Head: refs.Head, Refs: []refOutput{}}
+
+		names := []string{}
+		for name := range refs.Refs {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+
+		for _, name := range names {
+			output.Refs = append(output.Refs, refOutput{Name: name, Save: refs.Refs[name]})
+		}
+
+		if format == JSON_FORMAT {
+			printJSON("refs", output)
+			return
+		}
+
+		printPorcelainHeader()
+		printPorcelainLine("head", output.Head)
+		for _, ref := range output.Refs {
+			printPorcelainLine("ref", ref.Name, ref.Save)
+		}
+
+		return
+	}
+
 	for name, saveName := range refs.Refs {
 		if refs.Head == name {
 			fmt.Fprint(os.Stdout, "\033[0mHEAD \033[0m-> ")
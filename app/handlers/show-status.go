@@ -2,16 +2,17 @@ package handlers
 
 import (
 	"fmt"
-	"os"
-	"saymow/version-manager/app/pkg/errors"
 	"saymow/version-manager/app/repositories"
+	"slices"
+	"strings"
 )
 
 func printStatus(status *repositories.Status) {
 	stagedChangesCount := len(status.Staged.ConflictedFilesPaths) +
 		len(status.Staged.CreatedFilesPaths) +
 		len(status.Staged.ModifiedFilePaths) +
-		len(status.Staged.RemovedFilePaths)
+		len(status.Staged.RemovedFilePaths) +
+		len(status.Staged.RenamedFiles)
 	workingDirChangesCount := len(status.WorkingDir.UntrackedFilePaths) +
 		len(status.WorkingDir.ModifiedFilePaths) +
 		len(status.WorkingDir.RemovedFilePaths)
@@ -36,6 +37,9 @@ func printStatus(status *repositories.Status) {
 		for _, path := range status.Staged.RemovedFilePaths {
 			fmt.Printf("\t- %s (removed)\r\n", path)
 		}
+		for _, renamedFile := range status.Staged.RenamedFiles {
+			fmt.Printf("\t- %s -> %s (renamed)\r\n", renamedFile.FromFilepath, renamedFile.Filepath)
+		}
 	}
 
 	if workingDirChangesCount > 0 {
@@ -52,11 +56,114 @@ func printStatus(status *repositories.Status) {
 	}
 }
 
+type conflictedFileOutput struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+type renamedFileOutput struct {
+	From string `json:"from"`
+	Path string `json:"path"`
+}
+
+// statusOutput is the "status" json schema, paths are sorted.
+type statusOutput struct {
+	Staged struct {
+		Conflicted []conflictedFileOutput `json:"conflicted"`
+		Created    []string               `json:"created"`
+		Modified   []string               `json:"modified"`
+		Removed    []string               `json:"removed"`
+		Renamed    []renamedFileOutput    `json:"renamed"`
+	} `json:"staged"`
+	WorkingDir struct {
+		Untracked []string `json:"untracked"`
+		Modified  []string `json:"modified"`
+		Removed   []string `json:"removed"`
+	} `json:"working_dir"`
+}
+
+func makeStatusOutput(root string, status *repositories.Status) *statusOutput {
+	output := &statusOutput{}
+
+	output.Staged.Conflicted = []conflictedFileOutput{}
+	for _, conflictedFile := range status.Staged.ConflictedFilesPaths {
+		output.Staged.Conflicted = append(output.Staged.Conflicted, conflictedFileOutput{
+			Path:    outputPath(root, conflictedFile.Filepath),
+			Message: conflictedFile.Message,
+		})
+	}
+	output.Staged.Renamed = []renamedFileOutput{}
+	for _, renamedFile := range status.Staged.RenamedFiles {
+		output.Staged.Renamed = append(output.Staged.Renamed, renamedFileOutput{
+			From: outputPath(root, renamedFile.FromFilepath),
+			Path: outputPath(root, renamedFile.Filepath),
+		})
+	}
+	output.Staged.Created = outputPaths(root, status.Staged.CreatedFilesPaths)
+	output.Staged.Modified = outputPaths(root, status.Staged.ModifiedFilePaths)
+	output.Staged.Removed = outputPaths(root, status.Staged.RemovedFilePaths)
+	output.WorkingDir.Untracked = outputPaths(root, status.WorkingDir.UntrackedFilePaths)
+	output.WorkingDir.Modified = outputPaths(root, status.WorkingDir.ModifiedFilePaths)
+	output.WorkingDir.Removed = outputPaths(root, status.WorkingDir.RemovedFilePaths)
+
+	slices.SortFunc(output.Staged.Conflicted, func(a, b conflictedFileOutput) int { return strings.Compare(a.Path, b.Path) })
+	slices.SortFunc(output.Staged.Renamed, func(a, b renamedFileOutput) int { return strings.Compare(a.Path, b.Path) })
+	for _, paths := range [][]string{
+		output.Staged.Created,
+		output.Staged.Modified,
+		output.Staged.Removed,
+		output.WorkingDir.Untracked,
+		output.WorkingDir.Modified,
+		output.WorkingDir.Removed,
+	} {
+		slices.Sort(paths)
+	}
+
+	return output
+}
+
+// printStatusPorcelain prints one "area<tab>change<tab>path" line per change. Conflicts add their message and
+// renames their source path as a last column.
+func printStatusPorcelain(output *statusOutput) {
+	for _, conflictedFile := range output.Staged.Conflicted {
+		printPorcelainLine("staged", "conflicted", conflictedFile.Path, conflictedFile.Message)
+	}
+	for _, path := range output.Staged.Created {
+		printPorcelainLine("staged", "created", path)
+	}
+	for _, path := range output.Staged.Modified {
+		printPorcelainLine("staged", "modified", path)
+	}
+	for _, path := range output.Staged.Removed {
+		printPorcelainLine("staged", "removed", path)
+	}
+	for _, renamedFile := range output.Staged.Renamed {
+		printPorcelainLine("staged", "renamed", renamedFile.Path, renamedFile.From)
+	}
+	for _, path := range output.WorkingDir.Untracked {
+		printPorcelainLine("working", "untracked", path)
+	}
+	for _, path := range output.WorkingDir.Modified {
+		printPorcelainLine("working", "modified", path)
+	}
+	for _, path := range output.WorkingDir.Removed {
+		printPorcelainLine("working", "removed", path)
+	}
+}
+
 func ShowStatus() {
-	dir, err := os.Getwd()
-	errors.Check(err)
+	root := getRoot()
+	repository := openRepository(root)
+	status, err := repository.GetStatus()
+	checkError(err)
 
-	repository := repositories.GetRepository(dir)
-	status := repository.GetStatus()
-	printStatus(status)
+	switch format {
+	case JSON_FORMAT:
+		printJSON("status", makeStatusOutput(root, status))
+	case PORCELAIN_FORMAT:
+		printPorcelainHeader()
+		printStatusPorcelain(makeStatusOutput(root, status))
+	default:
+		printStatus(status)
+	}
 }
@@ -0,0 +1,9 @@
+package handlers
+
+func Unstage(paths []string) {
+	repository := lockRepository(getRoot())
+
+	checkError(repository.Unstage(resolvePaths(paths)))
+	checkError(repository.SaveIndex())
+	commitRepository(repository)
+}
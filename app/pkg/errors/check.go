@@ -1,24 +1,40 @@
 package errors
 
 import (
-	"runtime/debug"
+	"errors"
+	"runtime"
 )
 
+// Check panics with err when it is not nil. Recover turns the panic back into the returned error, so
+// packages can bail out of deep call chains and still return typed errors from their exported functions.
 func Check(err error) {
 	if err != nil {
-		Error(err.Error())
+		panic(err)
 	}
 }
 
 func CheckFn(fn func() error) {
-	err := fn()
-
-	if err != nil {
-		Error(err.Error())
-	}
+	Check(fn())
 }
 
 func Error(message string) {
-	debug.PrintStack()
-	panic(message)
+	panic(errors.New(message))
+}
+
+// Recover must be deferred, it stores the error raised by Check or Error in err. Other panics, such as runtime
+// errors, are bugs and are not recovered.
+func Recover(err *error) {
+	value := recover()
+	if value == nil {
+		return
+	}
+
+	if recoveredErr, ok := value.(error); ok {
+		if _, isRuntimeError := recoveredErr.(runtime.Error); !isRuntimeError {
+			*err = recoveredErr
+			return
+		}
+	}
+
+	panic(value)
 }
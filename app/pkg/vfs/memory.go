@@ -0,0 +1,646 @@
+package vfs
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	Path "path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Symlinks chains longer than this are reported as loops
+const MAX_SYMLINK_HOPS = 40
+
+type memoryNode struct {
+	mode     fs.FileMode
+	modTime  time.Time
+	content  []byte
+	children map[string]*memoryNode
+}
+
+// Memory is a file system held in memory, safe for concurrent use. Permissions are stored but not enforced.
+type Memory struct {
+	lock     sync.Mutex
+	root     *memoryNode
+	tempSeed uint32
+}
+
+// NewMemory returns an empty in-memory file system, only the root directory exists.
+func NewMemory() *Memory {
+	return &Memory{root: &memoryNode{mode: fs.ModeDir | 0755, modTime: time.Now(), children: map[string]*memoryNode{}}}
+}
+
+type memoryInfo struct {
+	name string
+	node *memoryNode
+}
+
+func (info *memoryInfo) Name() string       { return info.name }
+func (info *memoryInfo) Size() int64        { return int64(len(info.node.content)) }
+func (info *memoryInfo) Mode() fs.FileMode  { return info.node.mode }
+func (info *memoryInfo) ModTime() time.Time { return info.node.modTime }
+func (info *memoryInfo) IsDir() bool        { return info.node.mode.IsDir() }
+func (info *memoryInfo) Sys() any           { return nil }
+
+func pathError(op string, name string, err error) error {
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+func (memory *Memory) info(name string, node *memoryNode) fs.FileInfo {
+	// The node is copied, so infos do not change with the file
+	nodeCopy := *node
+
+	return &memoryInfo{name: Path.Base(name), node: &nodeCopy}
+}
+
+// find returns the node at a path without symlinks.
+func (memory *Memory) find(components []string) *memoryNode {
+	node := memory.root
+
+	for _, component := range components {
+		if node.children == nil {
+			return nil
+		}
+
+		node = node.children[component]
+		if node == nil {
+			return nil
+		}
+	}
+
+	return node
+}
+
+// resolve returns the components of name once its symlinks are replaced by their targets. The last
+// component is only resolved with followLast, and it does not have to exist.
+func (memory *Memory) resolve(name string, followLast bool) ([]string, error) {
+	if !Path.IsAbs(name) {
+		return nil, fs.ErrInvalid
+	}
+
+	components := splitPath(name)
+
+	for hops := 0; ; hops++ {
+		if hops > MAX_SYMLINK_HOPS {
+			return nil, syscall.ELOOP
+		}
+
+		resolved, remaining, err := memory.resolveOnce(components, followLast)
+		if err != nil || remaining == nil {
+			return resolved, err
+		}
+
+		components = remaining
+	}
+}
+
+// resolveOnce replaces the first symlink of components, remaining is nil when there are none left.
+func (memory *Memory) resolveOnce(components []string, followLast bool) ([]string, []string, error) {
+	node := memory.root
+
+	for idx, component := range components {
+		isLast := idx == len(components)-1
+
+		if !node.mode.IsDir() {
+			return nil, nil, syscall.ENOTDIR
+		}
+
+		child := node.children[component]
+		if child == nil {
+			if isLast {
+				return components, nil, nil
+			}
+
+			return nil, nil, fs.ErrNotExist
+		}
+
+		if child.mode&fs.ModeSymlink != 0 && (!isLast || followLast) {
+			target := string(child.content)
+			if !Path.IsAbs(target) {
+				target = Path.Join(string(Path.Separator), Path.Join(components[:idx]...), target)
+			}
+
+			return nil, append(splitPath(target), components[idx+1:]...), nil
+		}
+
+		node = child
+	}
+
+	return components, nil, nil
+}
+
+// lookup returns the node at name, and its parent directory.
+func (memory *Memory) lookup(op string, name string, followLast bool) (*memoryNode, *memoryNode, string, error) {
+	components, err := memory.resolve(name, followLast)
+	if err != nil {
+		return nil, nil, "", pathError(op, name, err)
+	}
+	if len(components) == 0 {
+		return memory.root, nil, "", nil
+	}
+
+	parent := memory.find(components[:len(components)-1])
+	base := components[len(components)-1]
+
+	return parent.children[base], parent, base, nil
+}
+
+func (memory *Memory) Open(name string) (File, error) {
+	return memory.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (memory *Memory) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	memory.lock.Lock()
+	defer memory.lock.Unlock()
+
+	file, err := memory.openFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+func (memory *Memory) openFile(name string, flag int, perm fs.FileMode) (*memoryFile, error) {
+	node, parent, base, err := memory.lookup("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+
+	switch {
+	case node == nil && flag&os.O_CREATE == 0:
+		return nil, pathError("open", name, fs.ErrNotExist)
+	case node == nil:
+		node = &memoryNode{mode: perm.Perm(), modTime: time.Now()}
+		parent.children[base] = node
+	case flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, pathError("open", name, fs.ErrExist)
+	case node.mode.IsDir() && writable:
+		return nil, pathError("open", name, syscall.EISDIR)
+	case flag&os.O_TRUNC != 0 && writable:
+		node.content = nil
+		node.modTime = time.Now()
+	}
+
+	return &memoryFile{memory: memory, node: node, name: name, flag: flag}, nil
+}
+
+func (memory *Memory) CreateTemp(dir, pattern string) (File, error) {
+	memory.lock.Lock()
+	defer memory.lock.Unlock()
+
+	prefix, suffix, _ := strings.Cut(pattern, "*")
+
+	for {
+		memory.tempSeed++
+		name := Path.Join(dir, prefix+strconv.FormatUint(uint64(memory.tempSeed), 10)+suffix)
+
+		file, err := memory.openFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return file, nil
+	}
+}
+
+func (memory *Memory) ReadFile(name string) ([]byte, error) {
+	file, err := memory.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return io.ReadAll(file)
+}
+
+func (memory *Memory) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	file, err := memory.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+func (memory *Memory) ReadDir(name string) ([]fs.DirEntry, error) {
+	memory.lock.Lock()
+	defer memory.lock.Unlock()
+
+	node, _, _, err := memory.lookup("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if node == nil {
+		return nil, pathError("readdir", name, fs.ErrNotExist)
+	}
+	if !node.mode.IsDir() {
+		return nil, pathError("readdir", name, syscall.ENOTDIR)
+	}
+
+	entries := []fs.DirEntry{}
+	for childName, child := range node.children {
+		entries = append(entries, fs.FileInfoToDirEntry(memory.info(childName, child)))
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+
+	return entries, nil
+}
+
+func (memory *Memory) stat(op string, name string, followLast bool) (fs.FileInfo, error) {
+	memory.lock.Lock()
+	defer memory.lock.Unlock()
+
+	node, _, _, err := memory.lookup(op, name, followLast)
+	if err != nil {
+		return nil, err
+	}
+	if node == nil {
+		return nil, pathError(op, name, fs.ErrNotExist)
+	}
+
+	return memory.info(name, node), nil
+}
+
+func (memory *Memory) Stat(name string) (fs.FileInfo, error) {
+	return memory.stat("stat", name, true)
+}
+
+func (memory *Memory) Lstat(name string) (fs.FileInfo, error) {
+	return memory.stat("lstat", name, false)
+}
+
+func (memory *Memory) Readlink(name string) (string, error) {
+	memory.lock.Lock()
+	defer memory.lock.Unlock()
+
+	node, _, _, err := memory.lookup("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if node == nil {
+		return "", pathError("readlink", name, fs.ErrNotExist)
+	}
+	if node.mode&fs.ModeSymlink == 0 {
+		return "", pathError("readlink", name, syscall.EINVAL)
+	}
+
+	return string(node.content), nil
+}
+
+// create adds a node at name, its parent directory must exist.
+func (memory *Memory) create(op string, name string, newNode *memoryNode) error {
+	node, parent, base, err := memory.lookup(op, name, false)
+	if err != nil {
+		return err
+	}
+	if node != nil {
+		return pathError(op, name, fs.ErrExist)
+	}
+
+	parent.children[base] = newNode
+
+	return nil
+}
+
+func (memory *Memory) Symlink(oldname, newname string) error {
+	memory.lock.Lock()
+	defer memory.lock.Unlock()
+
+	err := memory.create("symlink", newname, &memoryNode{mode: fs.ModeSymlink | 0777, modTime: time.Now(), content: []byte(oldname)})
+	if pathErr, ok := err.(*fs.PathError); ok {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: pathErr.Err}
+	}
+
+	return err
+}
+
+func (memory *Memory) Mkdir(name string, perm fs.FileMode) error {
+	memory.lock.Lock()
+	defer memory.lock.Unlock()
+
+	return memory.create("mkdir", name, &memoryNode{mode: fs.ModeDir | perm.Perm(), modTime: time.Now(), children: map[string]*memoryNode{}})
+}
+
+func (memory *Memory) MkdirAll(name string, perm fs.FileMode) error {
+	memory.lock.Lock()
+	defer memory.lock.Unlock()
+
+	if !Path.IsAbs(name) {
+		return pathError("mkdir", name, fs.ErrInvalid)
+	}
+
+	dirpath := Path.VolumeName(name) + string(Path.Separator)
+	for _, component := range splitPath(name) {
+		dirpath = Path.Join(dirpath, component)
+
+		node, _, _, err := memory.lookup("mkdir", dirpath, true)
+		if err != nil {
+			return err
+		}
+		if node != nil && !node.mode.IsDir() {
+			return pathError("mkdir", dirpath, syscall.ENOTDIR)
+		}
+		if node != nil {
+			continue
+		}
+
+		err = memory.create("mkdir", dirpath, &memoryNode{mode: fs.ModeDir | perm.Perm(), modTime: time.Now(), children: map[string]*memoryNode{}})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (memory *Memory) Remove(name string) error {
+	memory.lock.Lock()
+	defer memory.lock.Unlock()
+
+	node, parent, base, err := memory.lookup("remove", name, false)
+	if err != nil {
+		return err
+	}
+	if node == nil {
+		return pathError("remove", name, fs.ErrNotExist)
+	}
+	if parent == nil || len(node.children) > 0 {
+		return pathError("remove", name, syscall.ENOTEMPTY)
+	}
+
+	delete(parent.children, base)
+
+	return nil
+}
+
+func (memory *Memory) RemoveAll(name string) error {
+	memory.lock.Lock()
+	defer memory.lock.Unlock()
+
+	node, parent, base, err := memory.lookup("removeall", name, false)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	if node == nil {
+		return nil
+	}
+	if parent == nil {
+		node.children = map[string]*memoryNode{}
+		return nil
+	}
+
+	delete(parent.children, base)
+
+	return nil
+}
+
+func (memory *Memory) Rename(oldpath, newpath string) error {
+	memory.lock.Lock()
+	defer memory.lock.Unlock()
+
+	linkError := func(err error) error {
+		if pathErr, ok := err.(*fs.PathError); ok {
+			err = pathErr.Err
+		}
+
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+	}
+
+	node, oldParent, oldBase, err := memory.lookup("rename", oldpath, false)
+	if err != nil {
+		return linkError(err)
+	}
+	if node == nil {
+		return linkError(fs.ErrNotExist)
+	}
+
+	target, newParent, newBase, err := memory.lookup("rename", newpath, false)
+	if err != nil {
+		return linkError(err)
+	}
+
+	oldComponents, _ := memory.resolve(oldpath, false)
+	newComponents, _ := memory.resolve(newpath, false)
+	if len(newComponents) > len(oldComponents) && slices.Equal(newComponents[:len(oldComponents)], oldComponents) {
+		return linkError(syscall.EINVAL)
+	}
+
+	switch {
+	case target == node:
+		return nil
+	case target != nil && target.mode.IsDir() && !node.mode.IsDir():
+		return linkError(syscall.EISDIR)
+	case target != nil && target.mode.IsDir() && len(target.children) > 0:
+		return linkError(syscall.ENOTEMPTY)
+	case target != nil && !target.mode.IsDir() && node.mode.IsDir():
+		return linkError(syscall.ENOTDIR)
+	}
+
+	delete(oldParent.children, oldBase)
+	newParent.children[newBase] = node
+
+	return nil
+}
+
+func (memory *Memory) Chmod(name string, mode fs.FileMode) error {
+	memory.lock.Lock()
+	defer memory.lock.Unlock()
+
+	node, _, _, err := memory.lookup("chmod", name, true)
+	if err != nil {
+		return err
+	}
+	if node == nil {
+		return pathError("chmod", name, fs.ErrNotExist)
+	}
+
+	node.mode = node.mode.Type() | mode.Perm()
+
+	return nil
+}
+
+func (memory *Memory) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	memory.lock.Lock()
+	defer memory.lock.Unlock()
+
+	node, _, _, err := memory.lookup("chtimes", name, true)
+	if err != nil {
+		return err
+	}
+	if node == nil {
+		return pathError("chtimes", name, fs.ErrNotExist)
+	}
+
+	node.modTime = mtime
+
+	return nil
+}
+
+type memoryFile struct {
+	memory *Memory
+	node   *memoryNode
+	name   string
+	flag   int
+	offset int64
+	closed bool
+}
+
+func (file *memoryFile) check(op string, write bool) error {
+	switch {
+	case file.closed:
+		return pathError(op, file.name, fs.ErrClosed)
+	case file.node.mode.IsDir():
+		return pathError(op, file.name, syscall.EISDIR)
+	case write && file.flag&(os.O_WRONLY|os.O_RDWR) == 0:
+		return pathError(op, file.name, syscall.EBADF)
+	case !write && file.flag&os.O_WRONLY != 0:
+		return pathError(op, file.name, syscall.EBADF)
+	}
+
+	return nil
+}
+
+func (file *memoryFile) Read(buffer []byte) (int, error) {
+	file.memory.lock.Lock()
+	defer file.memory.lock.Unlock()
+
+	if err := file.check("read", false); err != nil {
+		return 0, err
+	}
+	if file.offset >= int64(len(file.node.content)) {
+		return 0, io.EOF
+	}
+
+	read := copy(buffer, file.node.content[file.offset:])
+	file.offset += int64(read)
+
+	return read, nil
+}
+
+func (file *memoryFile) ReadAt(buffer []byte, offset int64) (int, error) {
+	file.memory.lock.Lock()
+	defer file.memory.lock.Unlock()
+
+	if err := file.check("read", false); err != nil {
+		return 0, err
+	}
+	if offset < 0 {
+		return 0, pathError("read", file.name, fs.ErrInvalid)
+	}
+	if offset >= int64(len(file.node.content)) {
+		return 0, io.EOF
+	}
+
+	read := copy(buffer, file.node.content[offset:])
+	if read < len(buffer) {
+		return read, io.EOF
+	}
+
+	return read, nil
+}
+
+func (file *memoryFile) Write(buffer []byte) (int, error) {
+	file.memory.lock.Lock()
+	defer file.memory.lock.Unlock()
+
+	if err := file.check("write", true); err != nil {
+		return 0, err
+	}
+	if file.flag&os.O_APPEND != 0 {
+		file.offset = int64(len(file.node.content))
+	}
+
+	if end := file.offset + int64(len(buffer)); end > int64(len(file.node.content)) {
+		file.node.content = append(file.node.content, make([]byte, end-int64(len(file.node.content)))...)
+	}
+	copy(file.node.content[file.offset:], buffer)
+	file.offset += int64(len(buffer))
+	file.node.modTime = time.Now()
+
+	return len(buffer), nil
+}
+
+func (file *memoryFile) Seek(offset int64, whence int) (int64, error) {
+	file.memory.lock.Lock()
+	defer file.memory.lock.Unlock()
+
+	if file.closed {
+		return 0, pathError("seek", file.name, fs.ErrClosed)
+	}
+
+	switch whence {
+	case io.SeekCurrent:
+		offset += file.offset
+	case io.SeekEnd:
+		offset += int64(len(file.node.content))
+	}
+	if offset < 0 {
+		return 0, pathError("seek", file.name, fs.ErrInvalid)
+	}
+
+	file.offset = offset
+
+	return offset, nil
+}
+
+func (file *memoryFile) Close() error {
+	file.memory.lock.Lock()
+	defer file.memory.lock.Unlock()
+
+	if file.closed {
+		return pathError("close", file.name, fs.ErrClosed)
+	}
+	file.closed = true
+
+	return nil
+}
+
+func (file *memoryFile) Name() string {
+	return file.name
+}
+
+func (file *memoryFile) Stat() (fs.FileInfo, error) {
+	file.memory.lock.Lock()
+	defer file.memory.lock.Unlock()
+
+	if file.closed {
+		return nil, pathError("stat", file.name, fs.ErrClosed)
+	}
+
+	return file.memory.info(file.name, file.node), nil
+}
+
+func (file *memoryFile) Chmod(mode fs.FileMode) error {
+	file.memory.lock.Lock()
+	defer file.memory.lock.Unlock()
+
+	if file.closed {
+		return pathError("chmod", file.name, fs.ErrClosed)
+	}
+	file.node.mode = file.node.mode.Type() | mode.Perm()
+
+	return nil
+}
@@ -0,0 +1,206 @@
+package vfs
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	Path "path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// FS is the file system of the working directory and of the repository folder. Paths are absolute, and
+// errors behave as the os package ones: os.IsNotExist and os.IsExist can be used on them.
+type FS interface {
+	Open(name string) (File, error)
+	OpenFile(name string, flag int, perm fs.FileMode) (File, error)
+	CreateTemp(dir, pattern string) (File, error)
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+	ReadDir(name string) ([]fs.DirEntry, error)
+	Stat(name string) (fs.FileInfo, error)
+	Lstat(name string) (fs.FileInfo, error)
+	Readlink(name string) (string, error)
+	Symlink(oldname, newname string) error
+	Mkdir(name string, perm fs.FileMode) error
+	MkdirAll(name string, perm fs.FileMode) error
+	Remove(name string) error
+	RemoveAll(name string) error
+	Rename(oldpath, newpath string) error
+	Chmod(name string, mode fs.FileMode) error
+	Chtimes(name string, atime time.Time, mtime time.Time) error
+}
+
+// File is an open file, *os.File implements it.
+type File interface {
+	io.Reader
+	io.ReaderAt
+	io.Writer
+	io.Seeker
+	io.Closer
+	Name() string
+	Stat() (fs.FileInfo, error)
+	Chmod(mode fs.FileMode) error
+}
+
+type osFS struct{}
+
+// NewOS returns the file system of the os package.
+func NewOS() FS {
+	return osFS{}
+}
+
+func (osFS) Open(name string) (File, error) {
+	return openOSFile(os.Open(name))
+}
+
+func (osFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	return openOSFile(os.OpenFile(name, flag, perm))
+}
+
+func (osFS) CreateTemp(dir, pattern string) (File, error) {
+	return openOSFile(os.CreateTemp(dir, pattern))
+}
+
+// openOSFile avoids returning a nil *os.File as a non nil File.
+func openOSFile(file *os.File, err error) (File, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+func (osFS) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+func (osFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return os.WriteFile(name, data, perm)
+}
+
+func (osFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+func (osFS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (osFS) Lstat(name string) (fs.FileInfo, error) {
+	return os.Lstat(name)
+}
+
+func (osFS) Readlink(name string) (string, error) {
+	return os.Readlink(name)
+}
+
+func (osFS) Symlink(oldname, newname string) error {
+	return os.Symlink(oldname, newname)
+}
+
+func (osFS) Mkdir(name string, perm fs.FileMode) error {
+	return os.Mkdir(name, perm)
+}
+
+func (osFS) MkdirAll(name string, perm fs.FileMode) error {
+	return os.MkdirAll(name, perm)
+}
+
+func (osFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (osFS) RemoveAll(name string) error {
+	return os.RemoveAll(name)
+}
+
+func (osFS) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+func (osFS) Chmod(name string, mode fs.FileMode) error {
+	return os.Chmod(name, mode)
+}
+
+func (osFS) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return os.Chtimes(name, atime, mtime)
+}
+
+// Walk walks the tree rooted at root as filepath.Walk does: in lexical order, without following symlinks,
+// and fn can return filepath.SkipDir or filepath.SkipAll.
+func Walk(files FS, root string, fn Path.WalkFunc) error {
+	info, err := files.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walk(files, root, info, fn)
+	}
+
+	if err == Path.SkipDir || err == Path.SkipAll {
+		return nil
+	}
+
+	return err
+}
+
+func walk(files FS, path string, info fs.FileInfo, fn Path.WalkFunc) error {
+	if !info.IsDir() {
+		return fn(path, info, nil)
+	}
+
+	entries, readErr := files.ReadDir(path)
+	err := fn(path, info, readErr)
+	// A directory that cannot be read is reported twice, as filepath.Walk does
+	if readErr != nil || err != nil {
+		return err
+	}
+
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		filepath := Path.Join(path, name)
+
+		fileInfo, err := files.Lstat(filepath)
+		if err != nil {
+			if err := fn(filepath, fileInfo, err); err != nil && err != Path.SkipDir {
+				return err
+			}
+
+			continue
+		}
+
+		if err := walk(files, filepath, fileInfo, fn); err != nil {
+			if !fileInfo.IsDir() || err != Path.SkipDir {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// IsEmptyDir tells whether the directory has no entries.
+func IsEmptyDir(files FS, dirpath string) (bool, error) {
+	entries, err := files.ReadDir(dirpath)
+	if err != nil {
+		return false, err
+	}
+
+	return len(entries) == 0, nil
+}
+
+// splitPath returns the names of the path components, the path must be absolute.
+func splitPath(name string) []string {
+	name = Path.Clean(name)
+	name = name[len(Path.VolumeName(name)):]
+
+	return strings.FieldsFunc(name, func(char rune) bool {
+		return char == Path.Separator
+	})
+}
@@ -0,0 +1,205 @@
+package vfs
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	Path "path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testFS runs the same checks on both implementations, so the in-memory one behaves as the os one.
+func testFS(t *testing.T, test func(t *testing.T, files FS, root string)) {
+	t.Run("os", func(t *testing.T) {
+		test(t, NewOS(), t.TempDir())
+	})
+	t.Run("memory", func(t *testing.T) {
+		files := NewMemory()
+		root := Path.Join(string(Path.Separator), "project")
+		assert.Nil(t, files.MkdirAll(root, 0755))
+
+		test(t, files, root)
+	})
+}
+
+func TestFiles(t *testing.T) {
+	testFS(t, func(t *testing.T, files FS, root string) {
+		filepath := Path.Join(root, "a.txt")
+
+		assert.Nil(t, files.WriteFile(filepath, []byte("a content"), 0644))
+		content, err := files.ReadFile(filepath)
+		assert.Nil(t, err)
+		assert.Equal(t, string(content), "a content")
+
+		info, err := files.Stat(filepath)
+		assert.Nil(t, err)
+		assert.Equal(t, info.Name(), "a.txt")
+		assert.Equal(t, info.Size(), int64(9))
+		assert.Equal(t, info.Mode(), fs.FileMode(0644))
+
+		// Truncated by WriteFile
+		assert.Nil(t, files.WriteFile(filepath, []byte("a"), 0644))
+		content, err = files.ReadFile(filepath)
+		assert.Nil(t, err)
+		assert.Equal(t, string(content), "a")
+
+		file, err := files.OpenFile(filepath, os.O_WRONLY|os.O_APPEND, 0)
+		assert.Nil(t, err)
+		_, err = file.Write([]byte("bc"))
+		assert.Nil(t, err)
+		assert.Nil(t, file.Chmod(0755))
+		assert.Nil(t, file.Close())
+
+		file, err = files.Open(filepath)
+		assert.Nil(t, err)
+		buffer := make([]byte, 2)
+		read, err := file.ReadAt(buffer, 1)
+		assert.Nil(t, err)
+		assert.Equal(t, string(buffer[:read]), "bc")
+		_, err = file.Seek(2, io.SeekStart)
+		assert.Nil(t, err)
+		content, err = io.ReadAll(file)
+		assert.Nil(t, err)
+		assert.Equal(t, string(content), "c")
+		info, err = file.Stat()
+		assert.Nil(t, err)
+		assert.Equal(t, info.Mode(), fs.FileMode(0755))
+		assert.Nil(t, file.Close())
+
+		_, err = files.OpenFile(filepath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		assert.True(t, os.IsExist(err))
+		_, err = files.Open(Path.Join(root, "missing.txt"))
+		assert.True(t, os.IsNotExist(err))
+		_, err = files.Stat(Path.Join(root, "missing", "a.txt"))
+		assert.True(t, os.IsNotExist(err))
+
+		modTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		assert.Nil(t, files.Chtimes(filepath, modTime, modTime))
+		info, err = files.Stat(filepath)
+		assert.Nil(t, err)
+		assert.True(t, info.ModTime().Equal(modTime))
+
+		assert.Nil(t, files.Chmod(filepath, 0600))
+		info, err = files.Lstat(filepath)
+		assert.Nil(t, err)
+		assert.Equal(t, info.Mode(), fs.FileMode(0600))
+
+		temp, err := files.CreateTemp(root, "tmp-")
+		assert.Nil(t, err)
+		assert.Equal(t, Path.Dir(temp.Name()), root)
+		assert.Nil(t, temp.Close())
+		assert.Nil(t, files.Rename(temp.Name(), Path.Join(root, "b.txt")))
+		_, err = files.Stat(temp.Name())
+		assert.True(t, os.IsNotExist(err))
+
+		assert.Nil(t, files.Remove(filepath))
+		assert.True(t, os.IsNotExist(files.Remove(filepath)))
+	})
+}
+
+func TestDirs(t *testing.T) {
+	testFS(t, func(t *testing.T, files FS, root string) {
+		assert.Nil(t, files.MkdirAll(Path.Join(root, "a", "b"), 0755))
+		assert.Nil(t, files.MkdirAll(Path.Join(root, "a", "b"), 0755))
+		assert.True(t, os.IsExist(files.Mkdir(Path.Join(root, "a"), 0755)))
+		assert.True(t, os.IsNotExist(files.Mkdir(Path.Join(root, "c", "d"), 0755)))
+		assert.Nil(t, files.WriteFile(Path.Join(root, "a", "2.txt"), []byte("2"), 0644))
+		assert.Nil(t, files.WriteFile(Path.Join(root, "a", "1.txt"), []byte("1"), 0644))
+
+		entries, err := files.ReadDir(Path.Join(root, "a"))
+		assert.Nil(t, err)
+		assert.Equal(t, len(entries), 3)
+		assert.Equal(t, entries[0].Name(), "1.txt")
+		assert.Equal(t, entries[2].Name(), "b")
+		assert.True(t, entries[2].IsDir())
+
+		empty, err := IsEmptyDir(files, Path.Join(root, "a", "b"))
+		assert.Nil(t, err)
+		assert.True(t, empty)
+
+		assert.NotNil(t, files.Remove(Path.Join(root, "a")))
+		assert.NotNil(t, files.Rename(Path.Join(root, "a"), Path.Join(root, "a", "b", "c")))
+
+		assert.Nil(t, files.Rename(Path.Join(root, "a"), Path.Join(root, "c")))
+		content, err := files.ReadFile(Path.Join(root, "c", "1.txt"))
+		assert.Nil(t, err)
+		assert.Equal(t, string(content), "1")
+
+		assert.Nil(t, files.RemoveAll(Path.Join(root, "c")))
+		assert.Nil(t, files.RemoveAll(Path.Join(root, "c")))
+		_, err = files.Stat(Path.Join(root, "c"))
+		assert.True(t, os.IsNotExist(err))
+	})
+}
+
+func TestSymlinks(t *testing.T) {
+	testFS(t, func(t *testing.T, files FS, root string) {
+		assert.Nil(t, files.MkdirAll(Path.Join(root, "a"), 0755))
+		assert.Nil(t, files.WriteFile(Path.Join(root, "a", "1.txt"), []byte("1"), 0644))
+		assert.Nil(t, files.Symlink("a", Path.Join(root, "link")))
+		assert.Nil(t, files.Symlink(Path.Join("..", "missing"), Path.Join(root, "a", "broken")))
+		assert.True(t, os.IsExist(files.Symlink("a", Path.Join(root, "link"))))
+
+		target, err := files.Readlink(Path.Join(root, "link"))
+		assert.Nil(t, err)
+		assert.Equal(t, target, "a")
+
+		info, err := files.Lstat(Path.Join(root, "link"))
+		assert.Nil(t, err)
+		assert.Equal(t, info.Mode().Type(), fs.ModeSymlink)
+		info, err = files.Stat(Path.Join(root, "link"))
+		assert.Nil(t, err)
+		assert.True(t, info.IsDir())
+
+		content, err := files.ReadFile(Path.Join(root, "link", "1.txt"))
+		assert.Nil(t, err)
+		assert.Equal(t, string(content), "1")
+
+		_, err = files.Stat(Path.Join(root, "a", "broken"))
+		assert.True(t, os.IsNotExist(err))
+		_, err = files.Lstat(Path.Join(root, "a", "broken"))
+		assert.Nil(t, err)
+
+		// Removing a symlink keeps its target
+		assert.Nil(t, files.Remove(Path.Join(root, "link")))
+		_, err = files.Stat(Path.Join(root, "a", "1.txt"))
+		assert.Nil(t, err)
+	})
+}
+
+func TestWalk(t *testing.T) {
+	testFS(t, func(t *testing.T, files FS, root string) {
+		assert.Nil(t, files.MkdirAll(Path.Join(root, "b", "c"), 0755))
+		assert.Nil(t, files.MkdirAll(Path.Join(root, "skipped"), 0755))
+		assert.Nil(t, files.WriteFile(Path.Join(root, "skipped", "1.txt"), []byte("1"), 0644))
+		assert.Nil(t, files.WriteFile(Path.Join(root, "b", "2.txt"), []byte("2"), 0644))
+		assert.Nil(t, files.WriteFile(Path.Join(root, "a.txt"), []byte("a"), 0644))
+		assert.Nil(t, files.Symlink("b", Path.Join(root, "link")))
+
+		paths := []string{}
+		err := Walk(files, root, func(filepath string, info fs.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.Name() == "skipped" {
+				return Path.SkipDir
+			}
+
+			relativePath, err := Path.Rel(root, filepath)
+			assert.Nil(t, err)
+			paths = append(paths, relativePath)
+
+			return nil
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, paths, []string{".", "a.txt", "b", Path.Join("b", "2.txt"), Path.Join("b", "c"), "link"})
+
+		err = Walk(files, Path.Join(root, "missing"), func(filepath string, info fs.FileInfo, err error) error {
+			return err
+		})
+		assert.True(t, os.IsNotExist(err))
+	})
+}
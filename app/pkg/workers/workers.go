@@ -0,0 +1,96 @@
+package workers
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// DefaultParallelism is used when the parallelism is not positive.
+func DefaultParallelism() int {
+	return runtime.NumCPU()
+}
+
+// Run calls fn for every index in [0, count) on at most parallelism goroutines.
+//
+// Indexes are handed out in order and no new index is handed out once a call fails, so the returned error is
+// the one of the lowest failing index, the same error a sequential loop would return. Panics are recovered
+// and returned as errors, keeping the panic error value, except runtime errors: they are bugs, Run panics
+// again with them once the running calls return.
+func Run(count int, parallelism int, fn func(idx int) error) error {
+	if parallelism <= 0 {
+		parallelism = DefaultParallelism()
+	}
+	parallelism = min(parallelism, count)
+
+	var lock sync.Mutex
+	var group sync.WaitGroup
+	nextIdx := 0
+	failedIdx := count
+	errs := make([]error, count)
+	var runtimeErr runtime.Error
+
+	next := func() (int, bool) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if nextIdx >= count || failedIdx < count || runtimeErr != nil {
+			return 0, false
+		}
+
+		nextIdx++
+
+		return nextIdx - 1, true
+	}
+
+	fail := func(idx int, err error) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		errs[idx] = err
+		failedIdx = min(failedIdx, idx)
+	}
+
+	call := func(idx int) (err error) {
+		defer func() {
+			if value := recover(); value != nil {
+				if panicErr, ok := value.(runtime.Error); ok {
+					lock.Lock()
+					runtimeErr = panicErr
+					lock.Unlock()
+				} else if panicErr, ok := value.(error); ok {
+					err = panicErr
+				} else {
+					err = fmt.Errorf("%v", value)
+				}
+			}
+		}()
+
+		return fn(idx)
+	}
+
+	for range parallelism {
+		group.Add(1)
+
+		go func() {
+			defer group.Done()
+
+			for idx, ok := next(); ok; idx, ok = next() {
+				if err := call(idx); err != nil {
+					fail(idx, err)
+				}
+			}
+		}()
+	}
+
+	group.Wait()
+
+	if runtimeErr != nil {
+		panic(runtimeErr)
+	}
+	if failedIdx < count {
+		return errs[failedIdx]
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package workers
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	var calls atomic.Int32
+	results := make([]int, 100)
+
+	err := Run(len(results), 8, func(idx int) error {
+		calls.Add(1)
+		results[idx] = idx * 2
+
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, int(calls.Load()), 100)
+
+	for idx, result := range results {
+		assert.Equal(t, result, idx*2)
+	}
+
+	assert.Nil(t, Run(0, 8, func(idx int) error { return fmt.Errorf("unreachable") }))
+}
+
+func TestRunErrors(t *testing.T) {
+	// The lowest failing index is reported, even when it fails last
+	for range 20 {
+		err := Run(50, 8, func(idx int) error {
+			switch idx {
+			case 3:
+				time.Sleep(5 * time.Millisecond)
+				return fmt.Errorf("error %d", idx)
+			case 4, 10, 40:
+				return fmt.Errorf("error %d", idx)
+			}
+
+			return nil
+		})
+		assert.EqualError(t, err, "error 3")
+	}
+
+	err := Run(10, 1, func(idx int) error {
+		if idx == 5 {
+			panic("worker panic")
+		}
+
+		return nil
+	})
+	assert.EqualError(t, err, "worker panic")
+
+	// Errors raised with a panic keep their type
+	panicErr := &os.PathError{Op: "open", Path: "file", Err: os.ErrNotExist}
+	err = Run(10, 4, func(idx int) error {
+		panic(panicErr)
+	})
+	assert.Equal(t, err, error(panicErr))
+
+	// Runtime errors are bugs, they are not recovered
+	assert.PanicsWithError(t, "runtime error: index out of range [10] with length 10", func() {
+		values := make([]int, 10)
+		Run(11, 4, func(idx int) error {
+			values[idx] = idx
+			return nil
+		})
+	})
+}
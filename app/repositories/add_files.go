@@ -0,0 +1,212 @@
+package repositories
+
+import (
+	"fmt"
+	"os"
+	Path "path/filepath"
+	"saymow/version-manager/app/pkg/errors"
+	"saymow/version-manager/app/repositories/ignores"
+	"slices"
+	"strings"
+)
+
+func hasGlobMeta(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+func isSubpath(dirpath string, filepath string) bool {
+	return filepath == dirpath || strings.HasPrefix(filepath, dirpath+string(Path.Separator))
+}
+
+// expandPath returns the existing files and the deleted tracked files matched by path.
+//
+// Directories match the files under them that are tracked or not ignored. Paths that do not exist but contain
+// "*", "?" or "[" are globs matched against the same files, relative to the root.
+func (repository *Repository) expandPath(path string) ([]string, []string, error) {
+	filepath, err := repository.dir.AbsPath(path)
+	if err != nil {
+		return nil, nil, &ValidationError{err.Error()}
+	}
+
+	info, statErr := repository.fs.Files.Lstat(filepath)
+	if statErr != nil && !os.IsNotExist(statErr) {
+		errors.Error(statErr.Error())
+	}
+	isDir := statErr == nil && info.IsDir()
+
+	if statErr == nil && !isDir {
+		return []string{filepath}, []string{}, nil
+	}
+
+	var matches func(string) bool
+	searchDir := repository.fs.Root
+
+	if isDir {
+		searchDir = filepath
+		matches = func(candidatePath string) bool { return isSubpath(filepath, candidatePath) }
+	} else if hasGlobMeta(path) {
+		relativePath, err := Path.Rel(repository.fs.Root, filepath)
+		errors.Check(err)
+
+		glob, err := ignores.CompileGlob(Path.ToSlash(relativePath))
+		if err != nil {
+			return nil, nil, &ValidationError{fmt.Sprintf("invalid pattern \"%s\".", path)}
+		}
+
+		matches = func(candidatePath string) bool {
+			relativePath, err := Path.Rel(repository.fs.Root, candidatePath)
+			errors.Check(err)
+
+			return glob.MatchString(Path.ToSlash(relativePath))
+		}
+	} else {
+		matches = func(candidatePath string) bool { return candidatePath == filepath }
+	}
+
+	filepaths := []string{}
+	removedPaths := []string{}
+	matchedPaths := make(map[string]bool)
+
+	tracked := repository.getTrackedFiles()
+
+	for _, candidatePath := range repository.listWorkingDirFiles(searchDir, tracked) {
+		if matches(candidatePath) {
+			filepaths = append(filepaths, candidatePath)
+			matchedPaths[candidatePath] = true
+		}
+	}
+
+	for _, trackedPath := range tracked.paths {
+		if !matches(trackedPath) || matchedPaths[trackedPath] {
+			continue
+		}
+
+		if _, err := repository.fs.Files.Lstat(trackedPath); os.IsNotExist(err) {
+			removedPaths = append(removedPaths, trackedPath)
+		}
+	}
+
+	if len(filepaths)+len(removedPaths) == 0 && !isDir {
+		return nil, nil, &ValidationError{fmt.Sprintf("path \"%s\" did not match any files.", path)}
+	}
+
+	slices.Sort(removedPaths)
+
+	return filepaths, removedPaths, nil
+}
+
+// stageFiles indexes the existing files and stages the removal of the deleted ones.
+func (repository *Repository) stageFiles(filepaths []string, removedPaths []string) error {
+	if err := repository.IndexFiles(filepaths); err != nil {
+		return err
+	}
+
+	for _, filepath := range removedPaths {
+		if err := repository.RemoveFile(filepath); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AddFiles stages the files matched by paths, see expandPath. The removal of deleted tracked files is staged.
+func (repository *Repository) AddFiles(paths []string) (err error) {
+	defer errors.Recover(&err)
+
+	if repository.isDetachedMode() {
+		return &ValidationError{"cannot make changes in detached mode."}
+	}
+
+	filepaths := []string{}
+	removedPaths := []string{}
+	addedPaths := make(map[string]bool)
+
+	for _, path := range paths {
+		matchedPaths, matchedRemovedPaths, err := repository.expandPath(path)
+		if err != nil {
+			return err
+		}
+
+		for _, filepath := range matchedPaths {
+			if !addedPaths[filepath] {
+				filepaths = append(filepaths, filepath)
+				addedPaths[filepath] = true
+			}
+		}
+		for _, filepath := range matchedRemovedPaths {
+			if !addedPaths[filepath] {
+				removedPaths = append(removedPaths, filepath)
+				addedPaths[filepath] = true
+			}
+		}
+	}
+
+	return repository.stageFiles(filepaths, removedPaths)
+}
+
+// stageStatus stages the working directory changes under paths, or the whole working directory when paths
+// is empty.
+func (repository *Repository) stageStatus(paths []string, includeUntracked bool) error {
+	if repository.isDetachedMode() {
+		return &ValidationError{"cannot make changes in detached mode."}
+	}
+
+	dirpaths := []string{}
+	for _, path := range paths {
+		dirpath, err := repository.dir.AbsPath(path)
+		if err != nil {
+			return &ValidationError{err.Error()}
+		}
+
+		dirpaths = append(dirpaths, dirpath)
+	}
+
+	inScope := func(filepath string) bool {
+		return len(dirpaths) == 0 || slices.ContainsFunc(dirpaths, func(dirpath string) bool {
+			return isSubpath(dirpath, filepath)
+		})
+	}
+
+	status, err := repository.GetStatus()
+	errors.Check(err)
+
+	filepaths := []string{}
+	removedPaths := []string{}
+
+	changedPaths := status.WorkingDir.ModifiedFilePaths
+	if includeUntracked {
+		changedPaths = append(changedPaths, status.WorkingDir.UntrackedFilePaths...)
+	}
+
+	for _, filepath := range changedPaths {
+		if inScope(filepath) {
+			filepaths = append(filepaths, filepath)
+		}
+	}
+
+	for _, filepath := range status.WorkingDir.RemovedFilePaths {
+		if inScope(filepath) {
+			removedPaths = append(removedPaths, filepath)
+		}
+	}
+
+	slices.Sort(filepaths)
+	slices.Sort(removedPaths)
+
+	return repository.stageFiles(filepaths, removedPaths)
+}
+
+// AddAll stages every creation, modification and removal in the working directory, under paths when given.
+func (repository *Repository) AddAll(paths []string) (err error) {
+	defer errors.Recover(&err)
+
+	return repository.stageStatus(paths, true)
+}
+
+// AddUpdated stages the modifications and removals of the tracked files, under paths when given.
+func (repository *Repository) AddUpdated(paths []string) (err error) {
+	defer errors.Recover(&err)
+
+	return repository.stageStatus(paths, false)
+}
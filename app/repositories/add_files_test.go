@@ -0,0 +1,117 @@
+package repositories
+
+import (
+	Path "path/filepath"
+	"saymow/version-manager/app/pkg/collections"
+	"saymow/version-manager/app/pkg/fixtures"
+	"saymow/version-manager/app/repositories/directories"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func getIndexPaths(repository *Repository) []string {
+	return collections.Map(repository.index, func(change *directories.Change, _ int) string {
+		return change.GetPath()
+	})
+}
+
+func TestAddFiles(t *testing.T) {
+	dir, repository := fixtureGetBaseProject(t)
+	defer dir.Remove()
+
+	fixtures.WriteFile(dir.Join(".vcsignore"), []byte("7.txt\n"))
+
+	// Directories are added recursively, without the ignored files
+	{
+		assert.Nil(t, repository.AddFiles([]string{"a"}))
+		assert.Equal(t, getIndexPaths(repository), []string{dir.Join("a", "4.txt"), dir.Join("a", "5.txt"), dir.Join("a", "b", "6.txt")})
+	}
+
+	// Globs
+	{
+		repository.index = []*directories.Change{}
+
+		assert.Nil(t, repository.AddFiles([]string{"[12].txt", Path.Join("**", "8.txt")}))
+		assert.Equal(t, getIndexPaths(repository), []string{dir.Join("1.txt"), dir.Join("2.txt"), dir.Join("c", "8.txt")})
+
+		err := repository.AddFiles([]string{"*.md"})
+		assert.EqualError(t, err, "Validation Error: path \"*.md\" did not match any files.")
+
+		err = repository.AddFiles([]string{"missing.txt"})
+		assert.EqualError(t, err, "Validation Error: path \"missing.txt\" did not match any files.")
+	}
+
+	// Deleted tracked files are staged for removal
+	{
+		repository.SaveIndex()
+		repository.CreateSave("initial save")
+		repository = fixtureGetRepository(t, dir.Path())
+
+		fixtures.RemoveFile(dir.Join("c", "8.txt"))
+		fixtures.WriteFile(dir.Join("1.txt"), []byte("1 new content"))
+
+		assert.Nil(t, repository.AddFiles([]string{"c", "*.txt"}))
+		assert.Equal(t, repository.index[0].ChangeType, directories.Creation)
+		assert.Equal(t, repository.index[0].GetPath(), dir.Join("c", "9.txt"))
+
+		status, err := repository.GetStatus()
+		assert.NoError(t, err)
+		assert.Equal(t, status.Staged.CreatedFilesPaths, []string{dir.Join("3.txt"), dir.Join("c", "9.txt")})
+		assert.Equal(t, status.Staged.ModifiedFilePaths, []string{dir.Join("1.txt")})
+		assert.Equal(t, status.Staged.RemovedFilePaths, []string{dir.Join("c", "8.txt")})
+	}
+}
+
+func TestAddAllAndUpdated(t *testing.T) {
+	dir, repository := fixtureGetBaseProject(t)
+	defer dir.Remove()
+
+	repository.IndexFiles([]string{"1.txt", "2.txt", Path.Join("a", "4.txt"), Path.Join("c", "8.txt")})
+	repository.SaveIndex()
+	repository.CreateSave("initial save")
+	repository = fixtureGetRepository(t, dir.Path())
+
+	fixtures.WriteFile(dir.Join("1.txt"), []byte("1 new content"))
+	fixtures.WriteFile(dir.Join("a", "4.txt"), []byte("4 new content"))
+	fixtures.RemoveFile(dir.Join("2.txt"))
+	fixtures.RemoveFile(dir.Join("c", "8.txt"))
+
+	// Only tracked files under the paths
+	{
+		assert.Nil(t, repository.AddUpdated([]string{"a", "c"}))
+
+		status, err := repository.GetStatus()
+		assert.NoError(t, err)
+		assert.Equal(t, status.Staged.ModifiedFilePaths, []string{dir.Join("a", "4.txt")})
+		assert.Equal(t, status.Staged.RemovedFilePaths, []string{dir.Join("c", "8.txt")})
+		assert.Equal(t, status.WorkingDir.ModifiedFilePaths, []string{dir.Join("1.txt")})
+		assert.Equal(t, status.WorkingDir.RemovedFilePaths, []string{dir.Join("2.txt")})
+	}
+
+	// Only tracked files
+	{
+		assert.Nil(t, repository.AddUpdated([]string{}))
+
+		status, err := repository.GetStatus()
+		assert.NoError(t, err)
+		assert.Equal(t, len(status.WorkingDir.ModifiedFilePaths), 0)
+		assert.Equal(t, len(status.WorkingDir.RemovedFilePaths), 0)
+		assert.Equal(t, len(status.WorkingDir.UntrackedFilePaths), 5)
+		assert.Equal(t, len(status.Staged.CreatedFilesPaths), 0)
+	}
+
+	// Every change
+	{
+		assert.Nil(t, repository.AddAll([]string{}))
+
+		status, err := repository.GetStatus()
+		assert.NoError(t, err)
+		assert.False(t, len(status.WorkingDir.UntrackedFilePaths) > 0)
+		assert.Equal(t, status.Staged.CreatedFilesPaths, []string{
+			dir.Join("3.txt"), dir.Join("a", "5.txt"), dir.Join("a", "b", "6.txt"), dir.Join("a", "b", "7.txt"), dir.Join("c", "9.txt"),
+		})
+		assert.Equal(t, status.Staged.ModifiedFilePaths, []string{dir.Join("1.txt"), dir.Join("a", "4.txt")})
+		assert.ElementsMatch(t, status.Staged.RemovedFilePaths, []string{dir.Join("2.txt"), dir.Join("c", "8.txt")})
+	}
+}
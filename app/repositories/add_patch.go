@@ -0,0 +1,110 @@
+package repositories
+
+import (
+	"os"
+	"saymow/version-manager/app/pkg/errors"
+	"saymow/version-manager/app/repositories/diffs"
+	"saymow/version-manager/app/repositories/directories"
+	"saymow/version-manager/app/repositories/filesystems"
+	"strings"
+)
+
+// Patch holds the working directory changes of a tracked file, relative to its staged or saved version.
+type Patch struct {
+	Filepath string
+	Hunks    []*diffs.UnifiedHunk
+	oldLines []string
+	mode     directories.FileMode
+}
+
+// GetPatch diffs the working file against its staged version, or its saved version when nothing is staged.
+func (repository *Repository) GetPatch(path string) (_ *Patch, err error) {
+	defer errors.Recover(&err)
+
+	filepath, err := repository.dir.AbsPath(path)
+	if err != nil {
+		return nil, &ValidationError{err.Error()}
+	}
+
+	var baseFile *directories.File
+
+	if stagedChange := repository.findStagedChange(filepath); stagedChange != nil {
+		switch stagedChange.ChangeType {
+		case directories.Removal:
+			return nil, &ValidationError{"file removal is staged."}
+		case directories.Conflict:
+			return nil, &ConflictError{"file has conflicts."}
+		}
+
+		baseFile = stagedChange.File
+	} else {
+		baseFile = repository.findSavedFile(filepath)
+	}
+
+	if baseFile == nil {
+		return nil, &ValidationError{"path is not tracked."}
+	}
+
+	info, err := repository.fs.Files.Lstat(filepath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, &ValidationError{"file does not exist."}
+		}
+
+		errors.Error(err.Error())
+	}
+
+	mode := filesystems.GetFileMode(info)
+	if !isContentMode(baseFile.Mode) || !isContentMode(mode) {
+		return nil, &ValidationError{"symlinks and directories cannot be patched."}
+	}
+
+	content, err := repository.fs.Files.ReadFile(filepath)
+	errors.Check(err)
+
+	oldContent := repository.readObjectContent(baseFile)
+	if diffs.IsBinary(oldContent) || diffs.IsBinary(content) {
+		return nil, &ValidationError{"binary files cannot be patched."}
+	}
+
+	oldLines := diffs.SplitLines(oldContent)
+
+	return &Patch{
+		Filepath: filepath,
+		Hunks:    diffs.Unified(oldLines, diffs.SplitLines(content), DIFF_CONTEXT_LINES),
+		oldLines: oldLines,
+		mode:     mode,
+	}, nil
+}
+
+// AddPatch stages the patch base content with the selected hunks applied. The hunks may be split or edited
+// versions of the patch hunks. The working file is left untouched.
+func (repository *Repository) AddPatch(patch *Patch, hunks []*diffs.UnifiedHunk) (err error) {
+	defer errors.Recover(&err)
+
+	if repository.isDetachedMode() {
+		return &ValidationError{"cannot make changes in detached mode."}
+	}
+	if len(hunks) == 0 {
+		return nil
+	}
+
+	lines, err := diffs.ApplyHunks(patch.oldLines, hunks)
+	if err != nil {
+		return &ValidationError{err.Error()}
+	}
+
+	object, err := repository.fs.WriteObject(patch.Filepath, strings.NewReader(strings.Join(lines, "")))
+	errors.Check(err)
+	object.Mode = patch.mode
+	repository.indexObjects([]*directories.File{object})
+
+	return nil
+}
+
+// CheckHunk tells whether the hunk applies to the patch base content, used to validate edited hunks.
+func (patch *Patch) CheckHunk(hunk *diffs.UnifiedHunk) error {
+	_, err := diffs.ApplyHunks(patch.oldLines, []*diffs.UnifiedHunk{hunk})
+
+	return err
+}
@@ -0,0 +1,94 @@
+package repositories
+
+import (
+	"saymow/version-manager/app/pkg/fixtures"
+	"saymow/version-manager/app/repositories/diffs"
+	"saymow/version-manager/app/repositories/directories"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddPatch(t *testing.T) {
+	dir, repository := fixtureGetBaseProject(t)
+	defer dir.Remove()
+
+	lines := []string{}
+	for idx := 1; idx <= 20; idx++ {
+		lines = append(lines, strings.Repeat("x", idx)+"\n")
+	}
+
+	fixtures.WriteFile(dir.Join("1.txt"), []byte(strings.Join(lines, "")))
+	repository.IndexFile("1.txt")
+	repository.SaveIndex()
+	repository.CreateSave("initial save")
+	repository = fixtureGetRepository(t, dir.Path())
+
+	lines[1] = "two\n"
+	lines[17] = "eighteen\n"
+	workingContent := strings.Join(lines, "")
+	fixtures.WriteFile(dir.Join("1.txt"), []byte(workingContent))
+
+	// Only the selected hunk is staged, the working file is untouched
+	{
+		patch, err := repository.GetPatch("1.txt")
+		assert.Nil(t, err)
+		assert.Equal(t, len(patch.Hunks), 2)
+
+		assert.Nil(t, repository.AddPatch(patch, patch.Hunks[1:]))
+		assert.Equal(t, fixtures.ReadFile(dir.Join("1.txt")), workingContent)
+
+		change := repository.findStagedChange(dir.Join("1.txt"))
+		assert.Equal(t, change.ChangeType, directories.Modification)
+
+		stagedContent := string(repository.readObjectContent(change.File))
+		assert.Contains(t, stagedContent, "eighteen\n")
+		assert.NotContains(t, stagedContent, "two\n")
+	}
+
+	// The next patch is relative to the staged version
+	{
+		patch, err := repository.GetPatch("1.txt")
+		assert.Nil(t, err)
+		assert.Equal(t, len(patch.Hunks), 1)
+		assert.Equal(t, patch.Hunks[0].OldStart, 1)
+
+		editedHunk, err := diffs.ParseHunk(patch.Hunks[0], " x\n-xx\n+TWO\n xxx\n xxxx\n xxxxx\n")
+		assert.Nil(t, err)
+		assert.Nil(t, patch.CheckHunk(editedHunk))
+		assert.Nil(t, repository.AddPatch(patch, []*diffs.UnifiedHunk{editedHunk}))
+
+		change := repository.findStagedChange(dir.Join("1.txt"))
+		stagedContent := string(repository.readObjectContent(change.File))
+		assert.Contains(t, stagedContent, "TWO\n")
+		assert.Contains(t, stagedContent, "eighteen\n")
+		assert.Equal(t, fixtures.ReadFile(dir.Join("1.txt")), workingContent)
+	}
+
+	// Staging every hunk matches the working file
+	{
+		patch, err := repository.GetPatch("1.txt")
+		assert.Nil(t, err)
+		assert.Nil(t, repository.AddPatch(patch, patch.Hunks))
+
+		change := repository.findStagedChange(dir.Join("1.txt"))
+		assert.Equal(t, string(repository.readObjectContent(change.File)), workingContent)
+
+		patch, err = repository.GetPatch("1.txt")
+		assert.Nil(t, err)
+		assert.Equal(t, len(patch.Hunks), 0)
+	}
+
+	// Untracked and binary files are rejected
+	{
+		_, err := repository.GetPatch("2.txt")
+		assert.EqualError(t, err, "Validation Error: path is not tracked.")
+
+		repository.IndexFile("2.txt")
+		fixtures.WriteFile(dir.Join("2.txt"), []byte("binary\x00content"))
+
+		_, err = repository.GetPatch("2.txt")
+		assert.EqualError(t, err, "Validation Error: binary files cannot be patched.")
+	}
+}
@@ -0,0 +1,66 @@
+package repositories
+
+import (
+	"os"
+	Path "path/filepath"
+	"saymow/version-manager/app/pkg/errors"
+	"saymow/version-manager/app/repositories/filesystems"
+	"saymow/version-manager/app/repositories/ignores"
+)
+
+func (repository *Repository) getIgnores() *ignores.Matcher {
+	if repository.ignores == nil {
+		matcher, err := ignores.New(
+			repository.fs.Files,
+			repository.fs.Root,
+			Path.Join(repository.fs.Root, filesystems.REPOSITORY_FOLDER_NAME, filesystems.EXCLUDE_FILE_NAME),
+		)
+		errors.Check(err)
+
+		repository.ignores = matcher
+	}
+
+	return repository.ignores
+}
+
+func (repository *Repository) isIgnored(filepath string, isDir bool) bool {
+	ignored, err := repository.getIgnores().IsIgnored(filepath, isDir)
+	errors.Check(err)
+
+	return ignored
+}
+
+func (repository *Repository) isTracked(filepath string) bool {
+	if repository.findStagedChange(filepath) != nil {
+		return true
+	}
+
+	return repository.findSavedFile(filepath) != nil && repository.findRenameSource(filepath) == nil
+}
+
+// CheckIgnore returns the last ignore rule matching path, nil when no rule matches.
+//
+// A negated rule means the path is not ignored. Tracked files are never ignored.
+func (repository *Repository) CheckIgnore(path string) (_ *ignores.Rule, err error) {
+	defer errors.Recover(&err)
+
+	filepath, err := repository.dir.AbsPath(path)
+	if err != nil {
+		return nil, &ValidationError{err.Error()}
+	}
+
+	if repository.isTracked(filepath) {
+		return nil, nil
+	}
+
+	info, err := repository.fs.Files.Stat(filepath)
+	if err != nil && !os.IsNotExist(err) {
+		errors.Error(err.Error())
+	}
+	isDir := err == nil && info.IsDir()
+
+	rule, err := repository.getIgnores().Match(filepath, isDir)
+	errors.Check(err)
+
+	return rule, nil
+}
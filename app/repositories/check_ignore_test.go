@@ -0,0 +1,69 @@
+package repositories
+
+import (
+	Path "path/filepath"
+	"saymow/version-manager/app/pkg/fixtures"
+	"saymow/version-manager/app/repositories/filesystems"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckIgnore(t *testing.T) {
+	dir, repository := fixtureGetBaseProject(t)
+	defer dir.Remove()
+
+	fixtures.WriteFile(dir.Join(".vcsignore"), []byte("*.log\nb/\n"))
+	fixtures.WriteFile(dir.Join("a", ".vcsignore"), []byte("!keep.log\n"))
+	fixtures.WriteFile(dir.Join(filesystems.REPOSITORY_FOLDER_NAME, filesystems.EXCLUDE_FILE_NAME), []byte("3.txt\n"))
+	fixtures.WriteFile(dir.Join("1.log"), []byte("log"))
+	fixtures.WriteFile(dir.Join("a", "keep.log"), []byte("log"))
+
+	rule, err := repository.CheckIgnore("1.log")
+	assert.Nil(t, err)
+	assert.Equal(t, rule.String(), ".vcsignore:1:*.log")
+
+	rule, err = repository.CheckIgnore(dir.Join("a", "keep.log"))
+	assert.Nil(t, err)
+	assert.True(t, rule.Negated)
+	assert.Equal(t, rule.String(), "a/.vcsignore:1:!keep.log")
+
+	rule, err = repository.CheckIgnore(Path.Join("a", "b"))
+	assert.Nil(t, err)
+	assert.Equal(t, rule.String(), ".vcsignore:2:b/")
+
+	rule, err = repository.CheckIgnore(Path.Join("a", "b", "6.txt"))
+	assert.Nil(t, err)
+	assert.Equal(t, rule.String(), ".vcsignore:2:b/")
+
+	rule, err = repository.CheckIgnore("3.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, rule.String(), ".repository/exclude:1:3.txt")
+
+	rule, err = repository.CheckIgnore("1.txt")
+	assert.Nil(t, err)
+	assert.Nil(t, rule)
+
+	_, err = repository.CheckIgnore(dir.Join("..", "1.log"))
+	assert.EqualError(t, err, "Validation Error: invalid path.")
+
+	// Ignored files cannot be indexed, unless they are already tracked
+	{
+		assert.EqualError(t, repository.IndexFile("1.log"), "Validation Error: path is ignored.")
+		assert.EqualError(t, repository.IndexFile(Path.Join("a", "b", "6.txt")), "Validation Error: path is ignored.")
+		assert.Nil(t, repository.IndexFile(Path.Join("a", "keep.log")))
+
+		fixtures.WriteFile(dir.Join(".vcsignore"), []byte(""))
+		repository = fixtureGetRepository(t, dir.Path())
+		assert.Nil(t, repository.IndexFile("1.log"))
+		repository.SaveIndex()
+
+		fixtures.WriteFile(dir.Join(".vcsignore"), []byte("*.log\n"))
+		repository = fixtureGetRepository(t, dir.Path())
+		assert.Nil(t, repository.IndexFile("1.log"))
+
+		rule, err = repository.CheckIgnore("1.log")
+		assert.Nil(t, err)
+		assert.Nil(t, rule)
+	}
+}
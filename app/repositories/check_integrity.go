@@ -0,0 +1,215 @@
+package repositories
+
+import (
+	"fmt"
+	"os"
+	"saymow/version-manager/app/pkg/errors"
+	"saymow/version-manager/app/pkg/vfs"
+	"saymow/version-manager/app/repositories/directories"
+	"saymow/version-manager/app/repositories/filesystems"
+	"sort"
+)
+
+const (
+	CORRUPTED_OBJECT_PROBLEM = "corrupted-object"
+	MISSING_OBJECT_PROBLEM   = "missing-object"
+	CORRUPTED_SAVE_PROBLEM   = "corrupted-save"
+	MISSING_SAVE_PROBLEM     = "missing-save"
+	CORRUPTED_PACK_PROBLEM   = "corrupted-pack"
+	NEEDS_MIGRATION_PROBLEM  = "needs-migration"
+)
+
+// IntegrityProblem is a single corruption found in the repository.
+//
+// Kind is one of the *_PROBLEM constants and Name is the object or save name the problem is about.
+type IntegrityProblem struct {
+	Kind    string
+	Name    string
+	Message string
+}
+
+type IntegrityReport struct {
+	CheckedObjects int
+	CheckedSaves   int
+	Problems       []*IntegrityProblem
+}
+
+func (report *IntegrityReport) HasProblems() bool {
+	return len(report.Problems) > 0
+}
+
+func (report *IntegrityReport) addProblem(kind, name, message string) {
+	for _, problem := range report.Problems {
+		if problem.Kind == kind && problem.Name == name && problem.Message == message {
+			return
+		}
+	}
+
+	report.Problems = append(report.Problems, &IntegrityProblem{Kind: kind, Name: name, Message: message})
+}
+
+// CheckIntegrity verifies the repository at root.
+//
+// The current file tree is not built, so a corrupted history does not prevent the check from running.
+// Repositories from older versions are reported as needing a migration, they are not migrated.
+func CheckIntegrity(root string) (_ *IntegrityReport, err error) {
+	defer errors.Recover(&err)
+
+	repository := openRepositoryFS(vfs.NewOS(), root)
+	version, err := repository.fs.ReadVersion()
+	errors.Check(err)
+	repository.readState()
+
+	report, err := repository.CheckIntegrity()
+	errors.Check(err)
+
+	if version < filesystems.REPOSITORY_VERSION {
+		report.addProblem(
+			NEEDS_MIGRATION_PROBLEM,
+			filesystems.VERSION_FILE_NAME,
+			fmt.Sprintf("the repository version %d is older than %d, run \"vcs migrate\".", version, filesystems.REPOSITORY_VERSION),
+		)
+	}
+
+	return report, nil
+}
+
+// CheckIntegrity verifies that every object and save content matches its name, and that the saves parents,
+// the refs, the head, the merge head and the objects referenced by the saves and the index exist.
+//
+// A shared store may hold the objects of many repositories, only the objects referenced by this one are
+// verified then.
+func (repository *Repository) CheckIntegrity() (_ *IntegrityReport, err error) {
+	defer errors.Recover(&err)
+
+	report := &IntegrityReport{Problems: []*IntegrityProblem{}}
+	objects := make(map[string]bool)
+	saves := make(map[string]bool)
+
+	loadedPacks, err := repository.fs.ListPacks()
+	errors.Check(err)
+
+	for _, pack := range loadedPacks {
+		if err := pack.Verify(); err != nil {
+			report.addProblem(CORRUPTED_PACK_PROBLEM, pack.Name, err.Error())
+		}
+	}
+
+	saveNames, err := repository.fs.ListPackedSaves()
+	errors.Check(err)
+	saveInfos, err := repository.fs.ListSaves()
+	errors.Check(err)
+
+	for _, info := range saveInfos {
+		saveNames = append(saveNames, info.Name())
+	}
+
+	sort.Strings(saveNames)
+
+	checkpoints := []*filesystems.Checkpoint{}
+	for idx, name := range saveNames {
+		saves[name] = true
+
+		if idx > 0 && saveNames[idx-1] == name {
+			continue
+		}
+
+		report.CheckedSaves++
+
+		checkpoint, err := repository.fs.VerifyCheckpoint(name)
+		if err != nil {
+			report.addProblem(CORRUPTED_SAVE_PROBLEM, name, err.Error())
+			continue
+		}
+
+		checkpoints = append(checkpoints, checkpoint)
+	}
+
+	objectNames, err := repository.fs.ListPackedObjects()
+	errors.Check(err)
+
+	if repository.fs.SharesObjects() {
+		for _, checkpoint := range checkpoints {
+			for _, change := range checkpoint.Changes {
+				if hash := change.GetHash(); hash != "" {
+					objectNames = append(objectNames, hash)
+				}
+			}
+		}
+		for _, change := range repository.index {
+			if hash := change.GetHash(); hash != "" {
+				objectNames = append(objectNames, hash)
+			}
+		}
+	} else {
+		objectInfos, err := repository.fs.ListObjects()
+		errors.Check(err)
+
+		for _, info := range objectInfos {
+			objectNames = append(objectNames, info.Name())
+		}
+	}
+
+	sort.Strings(objectNames)
+
+	for idx, name := range objectNames {
+		if idx > 0 && objectNames[idx-1] == name {
+			continue
+		}
+
+		err := repository.fs.VerifyObject(name)
+		if os.IsNotExist(err) {
+			// Reported as missing by its referrers
+			continue
+		}
+
+		objects[name] = true
+		report.CheckedObjects++
+
+		if err != nil {
+			report.addProblem(CORRUPTED_OBJECT_PROBLEM, name, err.Error())
+		}
+	}
+
+	checkObject := func(change *directories.Change, referrer string) {
+		if hash := change.GetHash(); hash != "" && !objects[hash] {
+			report.addProblem(MISSING_OBJECT_PROBLEM, hash, fmt.Sprintf("referenced by %s.", referrer))
+		}
+	}
+	checkSave := func(saveName string, referrer string) {
+		if saveName != "" && !saves[saveName] {
+			report.addProblem(MISSING_SAVE_PROBLEM, saveName, fmt.Sprintf("referenced by %s.", referrer))
+		}
+	}
+
+	for _, checkpoint := range checkpoints {
+		for _, parent := range checkpoint.Parents {
+			checkSave(parent, fmt.Sprintf("save %s", checkpoint.Id))
+		}
+		for _, change := range checkpoint.Changes {
+			checkObject(change, fmt.Sprintf("save %s", checkpoint.Id))
+		}
+	}
+
+	refNames := []string{}
+	for name := range *repository.refs {
+		refNames = append(refNames, name)
+	}
+	sort.Strings(refNames)
+
+	for _, name := range refNames {
+		checkSave((*repository.refs)[name], fmt.Sprintf("ref %s", name))
+	}
+
+	if repository.isDetachedMode() {
+		checkSave(repository.head, "head")
+	}
+
+	checkSave(repository.mergeHead, "merge head")
+
+	for _, change := range repository.index {
+		checkObject(change, "index")
+	}
+
+	return report, nil
+}
@@ -0,0 +1,149 @@
+package repositories
+
+import (
+	"fmt"
+	Path "path/filepath"
+	"saymow/version-manager/app/pkg/fixtures"
+	"saymow/version-manager/app/repositories/filesystems"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gotest.tools/v3/fs"
+)
+
+func TestCheckIntegrity(t *testing.T) {
+	dir, repository := fixtureGetBaseProject(t)
+	defer dir.Remove()
+
+	repository.IndexFile("1.txt")
+	repository.SaveIndex()
+	s0, _ := repository.CreateSave("s0")
+
+	repository = fixtureGetRepository(t, dir.Path())
+
+	repository.IndexFile("2.txt")
+	repository.SaveIndex()
+	s1, _ := repository.CreateSave("s1")
+
+	repository = fixtureGetRepository(t, dir.Path())
+
+	repository.IndexFile("3.txt")
+	repository.SaveIndex()
+
+	objectPath := func(name string) string {
+		return dir.Join(filesystems.REPOSITORY_FOLDER_NAME, filesystems.OBJECTS_FOLDER_NAME, name)
+	}
+	savePath := func(name string) string {
+		return dir.Join(filesystems.REPOSITORY_FOLDER_NAME, filesystems.SAVES_FOLDER_NAME, name)
+	}
+
+	// Temporary files of interrupted writes are not objects
+	fixtures.WriteFile(objectPath(filesystems.TEMP_FILE_PREFIX+"12345"), []byte("partial"))
+
+	// Healthy repository
+	{
+		report, err := CheckIntegrity(dir.Path())
+		assert.NoError(t, err)
+
+		assert.False(t, report.HasProblems())
+		assert.Equal(t, report.CheckedObjects, 3)
+		assert.Equal(t, report.CheckedSaves, 2)
+	}
+
+	object1 := s0.Changes[0].File.ObjectName
+	object1Content := fixtures.ReadFile(objectPath(object1))
+	object3 := repository.index[0].File.ObjectName
+
+	// Corrupted and missing objects
+	{
+		fixtures.WriteFile(objectPath(object1), []byte("not gzip"))
+		fixtures.RemoveFile(objectPath(object3))
+
+		report, err := CheckIntegrity(dir.Path())
+		assert.NoError(t, err)
+
+		assert.True(t, report.HasProblems())
+		assert.Equal(t, len(report.Problems), 2)
+		assert.Equal(t, report.Problems[0].Kind, CORRUPTED_OBJECT_PROBLEM)
+		assert.Equal(t, report.Problems[0].Name, object1)
+		assert.Equal(t, *report.Problems[1], IntegrityProblem{Kind: MISSING_OBJECT_PROBLEM, Name: object3, Message: "referenced by index."})
+
+		fixtures.WriteFile(objectPath(object1), []byte(object1Content))
+		repository.IndexFile("3.txt")
+		repository.SaveIndex()
+	}
+
+	s0Content := fixtures.ReadFile(savePath(s0.Id))
+
+	// Edited save
+	{
+		fixtures.WriteFile(savePath(s0.Id), []byte("edited "+s0Content))
+
+		report, err := CheckIntegrity(dir.Path())
+		assert.NoError(t, err)
+
+		assert.Equal(t, len(report.Problems), 1)
+		assert.Equal(t, report.Problems[0].Kind, CORRUPTED_SAVE_PROBLEM)
+		assert.Equal(t, report.Problems[0].Name, s0.Id)
+	}
+
+	// Missing saves
+	{
+		fixtures.RemoveFile(savePath(s0.Id))
+		fixtures.RemoveFile(savePath(s1.Id))
+
+		report, err := CheckIntegrity(dir.Path())
+		assert.NoError(t, err)
+
+		assert.Equal(
+			t,
+			report.Problems,
+			[]*IntegrityProblem{
+				{Kind: MISSING_SAVE_PROBLEM, Name: s1.Id, Message: "referenced by ref master."},
+			},
+		)
+
+		fixtures.WriteFile(savePath(s1.Id), []byte("not a save"))
+		report, err = CheckIntegrity(dir.Path())
+		assert.NoError(t, err)
+
+		assert.Equal(t, len(report.Problems), 1)
+		assert.Equal(t, report.Problems[0].Kind, CORRUPTED_SAVE_PROBLEM)
+		assert.Equal(t, report.Problems[0].Name, s1.Id)
+
+		repository.setHead(s0.Id)
+		fixtures.RemoveFile(savePath(s1.Id))
+
+		report, err = CheckIntegrity(dir.Path())
+		assert.NoError(t, err)
+
+		assert.Equal(
+			t,
+			report.Problems,
+			[]*IntegrityProblem{
+				{Kind: MISSING_SAVE_PROBLEM, Name: s1.Id, Message: "referenced by ref master."},
+				{Kind: MISSING_SAVE_PROBLEM, Name: s0.Id, Message: "referenced by head."},
+			},
+		)
+	}
+}
+
+func TestCheckIntegrityLegacyRepository(t *testing.T) {
+	oldRoot := Path.Join(string(Path.Separator), "old", "project")
+
+	dir := fs.NewDir(t, "project", fixtureMakeLegacyRepositoryFs(oldRoot))
+	defer dir.Remove()
+
+	report, err := CheckIntegrity(dir.Path())
+	assert.NoError(t, err)
+
+	assert.Contains(t, report.Problems, &IntegrityProblem{
+		Kind:    NEEDS_MIGRATION_PROBLEM,
+		Name:    filesystems.VERSION_FILE_NAME,
+		Message: fmt.Sprintf("the repository version 1 is older than %d, run \"vcs migrate\".", filesystems.REPOSITORY_VERSION),
+	})
+
+	// The repository is left as is
+	assert.False(t, fixtures.FileExists(dir.Join(filesystems.REPOSITORY_FOLDER_NAME, filesystems.VERSION_FILE_NAME)))
+	assert.True(t, fixtures.FileExists(dir.Join(filesystems.REPOSITORY_FOLDER_NAME, filesystems.SAVES_FOLDER_NAME, "legacy-s0")))
+}
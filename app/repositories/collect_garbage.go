@@ -0,0 +1,141 @@
+package repositories
+
+import (
+	"io/fs"
+	"saymow/version-manager/app/pkg/errors"
+	"saymow/version-manager/app/repositories/directories"
+	"sort"
+	"time"
+)
+
+// Objects and saves written during the grace period are never collected, they may belong to an operation
+// running concurrently (e.g. an add that did not write the index yet).
+const GC_GRACE_PERIOD = 15 * time.Minute
+
+type GarbageCollection struct {
+	DryRun         bool
+	RemovedObjects []string
+	RemovedSaves   []string
+	// Temporary files left by interrupted writes, relative to the repository folder
+	RemovedTempFiles []string
+}
+
+func markChangeObjects(change *directories.Change, objects map[string]bool) {
+	if hash := change.GetHash(); hash != "" {
+		objects[hash] = true
+	}
+}
+
+// markReachable returns the saves reachable from the refs, the head and the merge head, and the objects
+// referenced by them or by the index.
+func (repository *Repository) markReachable() (map[string]bool, map[string]bool) {
+	saves := make(map[string]bool)
+	objects := make(map[string]bool)
+	roots := []string{repository.mergeHead}
+
+	for _, saveName := range *repository.refs {
+		roots = append(roots, saveName)
+	}
+
+	if repository.isDetachedMode() {
+		roots = append(roots, repository.head)
+	}
+
+	for _, root := range roots {
+		if root == "" || saves[root] {
+			continue
+		}
+
+		save, err := repository.fs.ReadSave(root)
+		errors.Check(err)
+		if save == nil {
+			continue
+		}
+
+		for _, checkpoint := range save.Checkpoints {
+			if saves[checkpoint.Id] {
+				continue
+			}
+
+			saves[checkpoint.Id] = true
+
+			for _, change := range checkpoint.Changes {
+				markChangeObjects(change, objects)
+			}
+		}
+	}
+
+	for _, change := range repository.index {
+		markChangeObjects(change, objects)
+	}
+
+	return saves, objects
+}
+
+// CollectGarbage removes the objects and saves that are not reachable from the refs, the head or the index.
+//
+// Only loose entries are collected, packed entries and the objects of a shared store are kept. The
+// temporary files of interrupted writes are removed too. Entries modified in the last gracePeriod are
+// kept. When dryRun is set, nothing is removed and the entries that would be removed are reported.
+func (repository *Repository) CollectGarbage(dryRun bool, gracePeriod time.Duration) (_ *GarbageCollection, err error) {
+	defer errors.Recover(&err)
+
+	reachableSaves, reachableObjects := repository.markReachable()
+	expiration := time.Now().Add(-gracePeriod)
+	collection := &GarbageCollection{DryRun: dryRun, RemovedObjects: []string{}, RemovedSaves: []string{}, RemovedTempFiles: []string{}}
+
+	saveInfos, err := repository.fs.ListSaves()
+	errors.Check(err)
+	objectInfos := []fs.FileInfo{}
+	if !repository.fs.SharesObjects() {
+		objectInfos, err = repository.fs.ListObjects()
+		errors.Check(err)
+	}
+
+	for _, info := range saveInfos {
+		if reachableSaves[info.Name()] || info.ModTime().After(expiration) {
+			continue
+		}
+
+		collection.RemovedSaves = append(collection.RemovedSaves, info.Name())
+	}
+
+	for _, info := range objectInfos {
+		if reachableObjects[info.Name()] || info.ModTime().After(expiration) {
+			continue
+		}
+
+		collection.RemovedObjects = append(collection.RemovedObjects, info.Name())
+	}
+
+	tempFiles, err := repository.fs.ListTempFiles()
+	errors.Check(err)
+
+	for _, tempFile := range tempFiles {
+		if tempFile.ModTime.Before(expiration) {
+			collection.RemovedTempFiles = append(collection.RemovedTempFiles, tempFile.Name)
+		}
+	}
+
+	sort.Strings(collection.RemovedSaves)
+	sort.Strings(collection.RemovedObjects)
+	sort.Strings(collection.RemovedTempFiles)
+
+	if dryRun {
+		return collection, nil
+	}
+
+	for _, saveName := range collection.RemovedSaves {
+		errors.Check(repository.fs.RemoveSave(saveName))
+	}
+
+	for _, objectName := range collection.RemovedObjects {
+		errors.Check(repository.fs.RemoveObject(objectName))
+	}
+
+	for _, name := range collection.RemovedTempFiles {
+		errors.Check(repository.fs.RemoveTempFile(name))
+	}
+
+	return collection, nil
+}
@@ -0,0 +1,115 @@
+package repositories
+
+import (
+	"os"
+	Path "path/filepath"
+	"saymow/version-manager/app/pkg/errors"
+	"saymow/version-manager/app/pkg/fixtures"
+	"saymow/version-manager/app/repositories/filesystems"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectGarbage(t *testing.T) {
+	dir, repository := fixtureGetBaseProject(t)
+	defer dir.Remove()
+
+	objectsPath := dir.Join(filesystems.REPOSITORY_FOLDER_NAME, filesystems.OBJECTS_FOLDER_NAME)
+	savesPath := dir.Join(filesystems.REPOSITORY_FOLDER_NAME, filesystems.SAVES_FOLDER_NAME)
+
+	repository.IndexFile("1.txt")
+	repository.SaveIndex()
+	s0, _ := repository.CreateSave("s0")
+
+	repository = fixtureGetRepository(t, dir.Path())
+
+	repository.IndexFile("2.txt")
+	repository.SaveIndex()
+	s1, _ := repository.CreateSave("s1")
+
+	repository = fixtureGetRepository(t, dir.Path())
+
+	repository.IndexFile("3.txt")
+	repository.SaveIndex()
+
+	// Unreachable entries
+	fixtures.WriteFile(dir.Join(filesystems.REPOSITORY_FOLDER_NAME, filesystems.OBJECTS_FOLDER_NAME, "unreachable-object"), []byte{})
+	fixtures.WriteFile(dir.Join(filesystems.REPOSITORY_FOLDER_NAME, filesystems.SAVES_FOLDER_NAME, "unreachable-save"), []byte{})
+	// Temporary files of interrupted writes
+	tempFiles := []string{Path.Join(filesystems.OBJECTS_FOLDER_NAME, filesystems.TEMP_FILE_PREFIX+"12345"), filesystems.TEMP_FILE_PREFIX + "67890"}
+	for _, tempFile := range tempFiles {
+		fixtures.WriteFile(dir.Join(filesystems.REPOSITORY_FOLDER_NAME, tempFile), []byte("partial"))
+	}
+
+	// Recently written entries are kept
+	{
+		collection, err := repository.CollectGarbage(false, time.Hour)
+		assert.NoError(t, err)
+
+		assert.Equal(t, collection.RemovedObjects, []string{})
+		assert.Equal(t, collection.RemovedSaves, []string{})
+		assert.Equal(t, collection.RemovedTempFiles, []string{})
+		assert.True(t, fixtures.FileExists(dir.Join(filesystems.REPOSITORY_FOLDER_NAME, filesystems.OBJECTS_FOLDER_NAME, "unreachable-object")))
+	}
+
+	past := time.Now().Add(-2 * time.Hour)
+	errors.Check(os.Chtimes(dir.Join(filesystems.REPOSITORY_FOLDER_NAME, filesystems.OBJECTS_FOLDER_NAME, "unreachable-object"), past, past))
+	errors.Check(os.Chtimes(dir.Join(filesystems.REPOSITORY_FOLDER_NAME, filesystems.SAVES_FOLDER_NAME, "unreachable-save"), past, past))
+	for _, tempFile := range tempFiles {
+		errors.Check(os.Chtimes(dir.Join(filesystems.REPOSITORY_FOLDER_NAME, tempFile), past, past))
+	}
+
+	// Dry run
+	{
+		collection, err := repository.CollectGarbage(true, time.Hour)
+		assert.NoError(t, err)
+
+		assert.True(t, collection.DryRun)
+		assert.Equal(t, collection.RemovedObjects, []string{"unreachable-object"})
+		assert.Equal(t, collection.RemovedSaves, []string{"unreachable-save"})
+		assert.Equal(t, collection.RemovedTempFiles, tempFiles)
+		assert.True(t, fixtures.FileExists(dir.Join(filesystems.REPOSITORY_FOLDER_NAME, filesystems.OBJECTS_FOLDER_NAME, "unreachable-object")))
+		assert.True(t, fixtures.FileExists(dir.Join(filesystems.REPOSITORY_FOLDER_NAME, filesystems.SAVES_FOLDER_NAME, "unreachable-save")))
+	}
+
+	// Sweep
+	{
+		collection, err := repository.CollectGarbage(false, time.Hour)
+		assert.NoError(t, err)
+
+		assert.False(t, collection.DryRun)
+		assert.Equal(t, collection.RemovedObjects, []string{"unreachable-object"})
+		assert.Equal(t, collection.RemovedSaves, []string{"unreachable-save"})
+		assert.Equal(t, collection.RemovedTempFiles, tempFiles)
+		assert.False(t, fixtures.FileExists(dir.Join(filesystems.REPOSITORY_FOLDER_NAME, tempFiles[1])))
+
+		objects, err := os.ReadDir(objectsPath)
+		errors.Check(err)
+		saves, err := os.ReadDir(savesPath)
+		errors.Check(err)
+
+		// 1.txt, 2.txt and 3.txt (index) objects are kept
+		assert.Equal(t, len(objects), 3)
+		assert.Equal(t, len(saves), 2)
+	}
+
+	// Saves only reachable from a detached head are kept
+	{
+		saveInfos, err := repository.fs.ListSaves()
+		assert.NoError(t, err)
+
+		for _, info := range saveInfos {
+			errors.Check(os.Chtimes(Path.Join(savesPath, info.Name()), past, past))
+		}
+
+		// To make it easier to test, i'm updating the refs and head in place
+		repository.refs = &filesystems.Refs{filesystems.INITIAL_REF_NAME: ""}
+		repository.head = s0.Id
+		collection, err := repository.CollectGarbage(true, time.Hour)
+		assert.NoError(t, err)
+
+		assert.Equal(t, collection.RemovedSaves, []string{s1.Id})
+	}
+}
@@ -1,6 +1,10 @@
 package repositories
 
-func (repository *Repository) CreateRef(name string) error {
+import "saymow/version-manager/app/pkg/errors"
+
+func (repository *Repository) CreateRef(name string) (err error) {
+	defer errors.Recover(&err)
+
 	currentSaveName := repository.getCurrentSaveName()
 
 	if repository.hasEmptySaveHistory() {
@@ -27,7 +27,7 @@ func TestInvalidRef(t *testing.T) {
 		repository.SaveIndex()
 		save0, _ := repository.CreateSave("save message")
 
-		repository = GetRepository(dir.Path())
+		repository = fixtureGetRepository(t, dir.Path())
 
 		repository.CreateRef("feat/a")
 
@@ -1,30 +1,44 @@
 package repositories
 
 import (
+	"saymow/version-manager/app/pkg/errors"
 	"saymow/version-manager/app/repositories/filesystems"
-	"time"
 )
 
-func (repository *Repository) CreateSave(message string) (*filesystems.Checkpoint, error) {
+func (repository *Repository) CreateSave(message string) (_ *filesystems.Checkpoint, err error) {
+	defer errors.Recover(&err)
+
 	if repository.isDetachedMode() {
 		return nil, &ValidationError{"cannot make changes in detached mode."}
 	}
-	if len(repository.index) == 0 {
+	if len(repository.index) == 0 && repository.mergeHead == "" {
 		return nil, &ValidationError{"cannot save empty index."}
 	}
 	if repository.isIndexConflicted() {
-		return nil, &ValidationError{"index is conflicted."}
+		return nil, &ConflictError{"index is conflicted."}
+	}
+
+	parents := []string{}
+
+	if !repository.hasEmptySaveHistory() {
+		parents = append(parents, repository.getCurrentSaveName())
+	}
+	if repository.mergeHead != "" {
+		// Then the save concludes a merge
+		parents = append(parents, repository.mergeHead)
 	}
 
 	save := filesystems.Checkpoint{
 		Message:   message,
-		Parent:    repository.getCurrentSaveName(),
-		Changes:   repository.index,
-		CreatedAt: time.Now(),
+		Parents:   parents,
+		Changes:   repository.dir.DetectRenames(repository.index),
+		CreatedAt: repository.now(),
 	}
 
-	save.Id = repository.fs.WriteCheckpoint(&save)
+	save.Id, err = repository.fs.WriteCheckpoint(&save)
+	errors.Check(err)
 	repository.clearIndex()
+	repository.setMergeHead("")
 	repository.setRef(repository.head, save.Id)
 
 	return &save, nil
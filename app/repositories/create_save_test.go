@@ -37,7 +37,7 @@ func TestInvalidCreateSave(t *testing.T) {
 
 		repository.setHead(save.Id)
 
-		repository = GetRepository(dir.Path())
+		repository = fixtureGetRepository(t, dir.Path())
 
 		// test
 
@@ -82,13 +82,13 @@ func TestCreateSave(t *testing.T) {
 4.txt-object
 %s	(modified)
 6.txt-object
-`, dir.Join("1.txt"),
-		dir.Join("a", "4.txt"),
-		dir.Join("a", "b", "6.txt"),
+`, "1.txt",
+		"a/4.txt",
+		"a/b/6.txt",
 	)
 	fixtures.WriteFile(indexFilepath, []byte(index))
 
-	repository := GetRepository(dir.Path())
+	repository := fixtureGetRepository(t, dir.Path())
 	firstSave, _ := repository.CreateSave("first save")
 	expectedFirstSaveFileContent := fmt.Sprintf(`%s
 
@@ -108,16 +108,16 @@ Files:
 `,
 		firstSave.Message,
 		firstSave.CreatedAt.Format(time.Layout),
-		firstSave.Changes[0].File.Filepath,
+		"1.txt",
 		firstSave.Changes[0].File.ObjectName,
-		firstSave.Changes[1].File.Filepath,
+		"a/4.txt",
 		firstSave.Changes[1].File.ObjectName,
-		firstSave.Changes[2].File.Filepath,
+		"a/b/6.txt",
 		firstSave.Changes[2].File.ObjectName,
 	)
 
 	assert.Equal(t, firstSave.Message, "first save")
-	assert.Equal(t, firstSave.Parent, "")
+	assert.Equal(t, firstSave.Parents, []string{})
 	assert.EqualValues(
 		t,
 		firstSave.Changes,
@@ -153,6 +153,7 @@ Files:
 				t,
 				fs.WithFile(filesystems.REFS_FILE_NAME, fmt.Sprintf("Refs:\n\n%s\n%s\n", filesystems.INITIAL_REF_NAME, firstSave.Id)),
 				fs.WithFile(filesystems.HEAD_FILE_NAME, filesystems.INITIAL_REF_NAME),
+				fs.WithFile(filesystems.VERSION_FILE_NAME, fmt.Sprint(filesystems.REPOSITORY_VERSION)),
 				fs.WithFile(filesystems.INDEX_FILE_NAME, "Tracked files:\n\n"),
 				fs.WithDir(filesystems.SAVES_FOLDER_NAME,
 					fs.WithFile(firstSave.Id, expectedFirstSaveFileContent),
@@ -170,13 +171,13 @@ Files:
 %s	(removed)
 %s	(modified)
 8.txt-object
-`, dir.Join("1.txt"),
-		dir.Join("a", "4.txt"),
-		dir.Join("a", "b", "c", "8.txt"),
+`, "1.txt",
+		"a/4.txt",
+		"a/b/c/8.txt",
 	)
 	fixtures.WriteFile(indexFilepath, []byte(index))
 
-	repository = GetRepository(dir.Path())
+	repository = fixtureGetRepository(t, dir.Path())
 	secondSave, _ := repository.CreateSave("second save")
 	expectedSecondSaveFileContent := fmt.Sprintf(`%s
 %s
@@ -193,16 +194,16 @@ Files:
 %s
 `,
 		secondSave.Message,
-		secondSave.Parent,
+		secondSave.Parents[0],
 		secondSave.CreatedAt.Format(time.Layout),
-		secondSave.Changes[0].Removal.Filepath,
-		secondSave.Changes[1].Removal.Filepath,
-		secondSave.Changes[2].File.Filepath,
+		"1.txt",
+		"a/4.txt",
+		"a/b/c/8.txt",
 		secondSave.Changes[2].File.ObjectName,
 	)
 
 	assert.Equal(t, secondSave.Message, "second save")
-	assert.Equal(t, secondSave.Parent, firstSave.Id)
+	assert.Equal(t, secondSave.Parents, []string{firstSave.Id})
 	assert.EqualValues(
 		t,
 		secondSave.Changes,
@@ -232,6 +233,7 @@ Files:
 				t,
 				fs.WithFile(filesystems.REFS_FILE_NAME, fmt.Sprintf("Refs:\n\n%s\n%s\n", filesystems.INITIAL_REF_NAME, secondSave.Id)),
 				fs.WithFile(filesystems.HEAD_FILE_NAME, filesystems.INITIAL_REF_NAME),
+				fs.WithFile(filesystems.VERSION_FILE_NAME, fmt.Sprint(filesystems.REPOSITORY_VERSION)),
 				fs.WithFile(filesystems.INDEX_FILE_NAME, "Tracked files:\n\n"),
 				fs.WithDir(filesystems.SAVES_FOLDER_NAME,
 					fs.WithFile(firstSave.Id, expectedFirstSaveFileContent),
@@ -0,0 +1,384 @@
+package diffs
+
+import (
+	"bytes"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Hunk represents a changed region between two sequences of lines.
+//
+// Lines [OldStart, OldEnd) of the old sequence are replaced by lines [NewStart, NewEnd) of the new sequence.
+type Hunk struct {
+	OldStart int
+	OldEnd   int
+	NewStart int
+	NewEnd   int
+}
+
+type LineType int
+
+const (
+	ContextLine LineType = iota
+	DeletedLine
+	InsertedLine
+)
+
+type Line struct {
+	LineType LineType
+	Content  string
+}
+
+// UnifiedHunk is a hunk in the unified diff format, the changed lines are surrounded by context lines.
+//
+// OldStart and NewStart are 1-based line numbers, as they are displayed in the hunk header.
+type UnifiedHunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+	Lines    []*Line
+}
+
+type MergeResult struct {
+	Content   []byte
+	Conflicts int
+}
+
+type editStep int
+
+const (
+	equalStep editStep = iota
+	deletionStep
+	insertionStep
+)
+
+func (result *MergeResult) HasConflicts() bool {
+	return result.Conflicts > 0
+}
+
+// SplitLines breaks content into lines, keeping the line terminators.
+func SplitLines(content []byte) []string {
+	if len(content) == 0 {
+		return []string{}
+	}
+
+	lines := strings.SplitAfter(string(content), "\n")
+
+	if lines[len(lines)-1] == "" {
+		// Content ends with a line terminator
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+// IsBinary uses the same heuristic as most diff tools: a NUL byte in the first 8000 bytes.
+func IsBinary(content []byte) bool {
+	if len(content) > 8000 {
+		content = content[:8000]
+	}
+
+	return bytes.IndexByte(content, 0) != -1
+}
+
+// Diff computes the shortest edit script from a to b (Myers algorithm) and returns it as a list of hunks.
+func Diff(a, b []string) []*Hunk {
+	// Common prefix and suffix are never part of a hunk, trim them before running the algorithm.
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	hunks := []*Hunk{}
+	var hunk *Hunk
+	x, y := prefix, prefix
+
+	for _, step := range shortestEditScript(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]) {
+		if step == equalStep {
+			if hunk != nil {
+				hunks = append(hunks, hunk)
+				hunk = nil
+			}
+
+			x++
+			y++
+			continue
+		}
+
+		if hunk == nil {
+			hunk = &Hunk{OldStart: x, OldEnd: x, NewStart: y, NewEnd: y}
+		}
+
+		if step == deletionStep {
+			x++
+			hunk.OldEnd = x
+		} else {
+			y++
+			hunk.NewEnd = y
+		}
+	}
+
+	if hunk != nil {
+		hunks = append(hunks, hunk)
+	}
+
+	return hunks
+}
+
+// Unified computes the diff from a to b and groups the hunks in the unified diff format, with up to
+// context lines around each change. Hunks whose contexts overlap are joined.
+func Unified(a, b []string, context int) []*UnifiedHunk {
+	hunks := Diff(a, b)
+	unifiedHunks := []*UnifiedHunk{}
+
+	for idx := 0; idx < len(hunks); {
+		group := []*Hunk{hunks[idx]}
+		idx++
+
+		for idx < len(hunks) && hunks[idx].OldStart-group[len(group)-1].OldEnd <= 2*context {
+			group = append(group, hunks[idx])
+			idx++
+		}
+
+		first, last := group[0], group[len(group)-1]
+		oldStart := max(0, first.OldStart-context)
+		oldEnd := min(len(a), last.OldEnd+context)
+		newStart := first.NewStart - (first.OldStart - oldStart)
+		newEnd := last.NewEnd + (oldEnd - last.OldEnd)
+
+		unifiedHunk := &UnifiedHunk{
+			OldStart: oldStart,
+			OldLines: oldEnd - oldStart,
+			NewStart: newStart,
+			NewLines: newEnd - newStart,
+			Lines:    []*Line{},
+		}
+		appendLines := func(lineType LineType, lines []string) {
+			for _, line := range lines {
+				unifiedHunk.Lines = append(unifiedHunk.Lines, &Line{LineType: lineType, Content: line})
+			}
+		}
+
+		cursor := oldStart
+		for _, hunk := range group {
+			appendLines(ContextLine, a[cursor:hunk.OldStart])
+			appendLines(DeletedLine, a[hunk.OldStart:hunk.OldEnd])
+			appendLines(InsertedLine, b[hunk.NewStart:hunk.NewEnd])
+			cursor = hunk.OldEnd
+		}
+		appendLines(ContextLine, a[cursor:oldEnd])
+
+		// An empty range is identified by the line before it
+		if unifiedHunk.OldLines > 0 {
+			unifiedHunk.OldStart++
+		}
+		if unifiedHunk.NewLines > 0 {
+			unifiedHunk.NewStart++
+		}
+
+		unifiedHunks = append(unifiedHunks, unifiedHunk)
+	}
+
+	return unifiedHunks
+}
+
+func shortestEditScript(a, b []string) []editStep {
+	n, m := len(a), len(b)
+	max := n + m
+
+	if max == 0 {
+		return []editStep{}
+	}
+
+	// v[offset+k] holds the furthest x reached in the diagonal k.
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	// Every round only depends on diagonals [-d-1, d+1] of the previous one, so only that window is kept.
+	trace := [][]int{}
+	var d int
+
+search:
+	for d = 0; d <= max; d++ {
+		trace = append(trace, slices.Clone(v[offset-d-1:offset+d+2]))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				// Move down
+				x = v[offset+k+1]
+			} else {
+				// Move right
+				x = v[offset+k-1] + 1
+			}
+
+			y := x - k
+
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	steps := []editStep{}
+	x, y := n, m
+
+	for ; d >= 0; d-- {
+		// The snapshot taken at round d starts at the diagonal -d-1.
+		previous := func(k int) int { return trace[d][k+d+1] }
+		k := x - y
+
+		var previousK int
+		if k == -d || (k != d && previous(k-1) < previous(k+1)) {
+			previousK = k + 1
+		} else {
+			previousK = k - 1
+		}
+
+		previousX := previous(previousK)
+		previousY := previousX - previousK
+
+		for x > previousX && y > previousY {
+			steps = append(steps, equalStep)
+			x--
+			y--
+		}
+
+		if d > 0 {
+			if x == previousX {
+				steps = append(steps, insertionStep)
+			} else {
+				steps = append(steps, deletionStep)
+			}
+
+			x, y = previousX, previousY
+		}
+	}
+
+	slices.Reverse(steps)
+
+	return steps
+}
+
+// Merge performs a three-way merge (diff3) of ours and theirs using base as the common ancestor.
+//
+// Regions changed by only one side are applied on their own. Regions changed by both sides are kept
+// when both made the same change; otherwise both versions are written between conflict markers.
+func Merge(base, ours, theirs []byte, oursName, theirsName string) *MergeResult {
+	baseLines := SplitLines(base)
+	oursLines := SplitLines(ours)
+	theirsLines := SplitLines(theirs)
+
+	type sideHunk struct {
+		*Hunk
+		theirs bool
+	}
+
+	hunks := []*sideHunk{}
+	for _, hunk := range Diff(baseLines, oursLines) {
+		hunks = append(hunks, &sideHunk{Hunk: hunk, theirs: false})
+	}
+	for _, hunk := range Diff(baseLines, theirsLines) {
+		hunks = append(hunks, &sideHunk{Hunk: hunk, theirs: true})
+	}
+
+	sort.SliceStable(hunks, func(i, j int) bool {
+		return hunks[i].OldStart < hunks[j].OldStart
+	})
+
+	// sideRange returns the lines of a side covering the base region [start, end).
+	sideRange := func(lines []string, group []*sideHunk, theirs bool, start, end int) []string {
+		var first, last *sideHunk
+
+		for _, hunk := range group {
+			if hunk.theirs != theirs {
+				continue
+			}
+			if first == nil {
+				first = hunk
+			}
+			last = hunk
+		}
+
+		if first == nil {
+			// The side did not change this region
+			return baseLines[start:end]
+		}
+
+		// Outside its hunks the side is equal to base, so the offsets to base are preserved.
+		return lines[first.NewStart-(first.OldStart-start) : last.NewEnd+(end-last.OldEnd)]
+	}
+
+	result := &MergeResult{}
+	var buffer bytes.Buffer
+	writeLines := func(lines []string) {
+		for _, line := range lines {
+			buffer.WriteString(line)
+		}
+	}
+	writeConflictSide := func(name string, lines []string) {
+		buffer.WriteString("<" + name + ">\n")
+		writeLines(lines)
+		if len(lines) > 0 && !strings.HasSuffix(lines[len(lines)-1], "\n") {
+			buffer.WriteString("\n")
+		}
+		buffer.WriteString("</" + name + ">\n")
+	}
+
+	cursor := 0
+
+	for idx := 0; idx < len(hunks); {
+		// Group hunks touching overlapping (or adjacent) base regions
+		start, end := hunks[idx].OldStart, hunks[idx].OldEnd
+		group := []*sideHunk{hunks[idx]}
+		hasOurs, hasTheirs := !hunks[idx].theirs, hunks[idx].theirs
+		idx++
+
+		for idx < len(hunks) && hunks[idx].OldStart <= end {
+			group = append(group, hunks[idx])
+			end = max(end, hunks[idx].OldEnd)
+			hasOurs = hasOurs || !hunks[idx].theirs
+			hasTheirs = hasTheirs || hunks[idx].theirs
+			idx++
+		}
+
+		writeLines(baseLines[cursor:start])
+		cursor = end
+
+		oursRegion := sideRange(oursLines, group, false, start, end)
+		theirsRegion := sideRange(theirsLines, group, true, start, end)
+
+		switch {
+		case !hasTheirs:
+			writeLines(oursRegion)
+		case !hasOurs:
+			writeLines(theirsRegion)
+		case slices.Equal(oursRegion, theirsRegion):
+			// Both sides made the same change
+			writeLines(oursRegion)
+		default:
+			result.Conflicts++
+			writeConflictSide(oursName, oursRegion)
+			writeConflictSide(theirsName, theirsRegion)
+		}
+	}
+
+	writeLines(baseLines[cursor:])
+	result.Content = buffer.Bytes()
+
+	return result
+}
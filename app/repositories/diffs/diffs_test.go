@@ -0,0 +1,174 @@
+package diffs
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func applyHunks(a, b []string, hunks []*Hunk) []string {
+	lines := []string{}
+	cursor := 0
+
+	for _, hunk := range hunks {
+		lines = append(lines, a[cursor:hunk.OldStart]...)
+		lines = append(lines, b[hunk.NewStart:hunk.NewEnd]...)
+		cursor = hunk.OldEnd
+	}
+
+	return append(lines, a[cursor:]...)
+}
+
+func TestSplitLines(t *testing.T) {
+	assert.Equal(t, SplitLines([]byte("")), []string{})
+	assert.Equal(t, SplitLines([]byte("a")), []string{"a"})
+	assert.Equal(t, SplitLines([]byte("a\n")), []string{"a\n"})
+	assert.Equal(t, SplitLines([]byte("a\nb")), []string{"a\n", "b"})
+	assert.Equal(t, SplitLines([]byte("a\n\nb\n")), []string{"a\n", "\n", "b\n"})
+}
+
+func TestIsBinary(t *testing.T) {
+	assert.False(t, IsBinary([]byte("plain text\n")))
+	assert.True(t, IsBinary([]byte("binary\x00content")))
+}
+
+func TestDiff(t *testing.T) {
+	assert.Equal(t, Diff([]string{}, []string{}), []*Hunk{})
+	assert.Equal(t, Diff([]string{"a"}, []string{"a"}), []*Hunk{})
+	assert.Equal(t, Diff([]string{}, []string{"a", "b"}), []*Hunk{{OldStart: 0, OldEnd: 0, NewStart: 0, NewEnd: 2}})
+	assert.Equal(t, Diff([]string{"a", "b"}, []string{}), []*Hunk{{OldStart: 0, OldEnd: 2, NewStart: 0, NewEnd: 0}})
+	assert.Equal(
+		t,
+		Diff([]string{"a", "b", "c", "d"}, []string{"a", "x", "c", "d", "e"}),
+		[]*Hunk{
+			{OldStart: 1, OldEnd: 2, NewStart: 1, NewEnd: 2},
+			{OldStart: 4, OldEnd: 4, NewStart: 4, NewEnd: 5},
+		},
+	)
+
+	// Classic example from the Myers paper
+	a := strings.Split("ABCABBA", "")
+	b := strings.Split("CBABAC", "")
+	hunks := Diff(a, b)
+
+	changedLines := 0
+	for _, hunk := range hunks {
+		changedLines += hunk.OldEnd - hunk.OldStart + hunk.NewEnd - hunk.NewStart
+	}
+
+	// The shortest edit script has 5 steps
+	assert.Equal(t, changedLines, 5)
+	assert.Equal(t, applyHunks(a, b, hunks), b)
+}
+
+func TestMergeNonOverlappingChanges(t *testing.T) {
+	base := []byte("func a() {\n\treturn 1\n}\n\nfunc b() {\n\treturn 2\n}\n")
+	ours := []byte("func a() {\n\treturn 10\n}\n\nfunc b() {\n\treturn 2\n}\n")
+	theirs := []byte("func a() {\n\treturn 1\n}\n\nfunc b() {\n\treturn 20\n}\n")
+
+	result := Merge(base, ours, theirs, "ref", "incoming")
+
+	assert.False(t, result.HasConflicts())
+	assert.Equal(t, string(result.Content), "func a() {\n\treturn 10\n}\n\nfunc b() {\n\treturn 20\n}\n")
+}
+
+func TestMergeSameChanges(t *testing.T) {
+	base := []byte("a\nb\nc\n")
+	ours := []byte("a\nB\nc\n")
+	theirs := []byte("a\nB\nc\nd\n")
+
+	result := Merge(base, ours, theirs, "ref", "incoming")
+
+	assert.False(t, result.HasConflicts())
+	assert.Equal(t, string(result.Content), "a\nB\nc\nd\n")
+}
+
+func TestMergeOverlappingChanges(t *testing.T) {
+	base := []byte("a\nb\nc\nd\ne\n")
+	ours := []byte("a\nb ours\nc\nd\ne ours\n")
+	theirs := []byte("a\nb theirs\nc\nd\ne\n")
+
+	result := Merge(base, ours, theirs, "ref", "incoming")
+
+	assert.Equal(t, result.Conflicts, 1)
+	assert.Equal(
+		t,
+		string(result.Content),
+		"a\n<ref>\nb ours\n</ref>\n<incoming>\nb theirs\n</incoming>\nc\nd\ne ours\n",
+	)
+}
+
+func TestMergeWithoutAncestor(t *testing.T) {
+	result := Merge([]byte{}, []byte("ours content."), []byte("theirs content."), "ref", "incoming")
+
+	assert.Equal(t, result.Conflicts, 1)
+	assert.Equal(
+		t,
+		string(result.Content),
+		"<ref>\nours content.\n</ref>\n<incoming>\ntheirs content.\n</incoming>\n",
+	)
+}
+
+func TestMergeAdjacentInsertions(t *testing.T) {
+	base := []byte("a\nb\n")
+	ours := []byte("a\nours\nb\n")
+	theirs := []byte("a\ntheirs\nb\n")
+
+	result := Merge(base, ours, theirs, "ref", "incoming")
+
+	assert.Equal(t, result.Conflicts, 1)
+	assert.Equal(t, string(result.Content), "a\n<ref>\nours\n</ref>\n<incoming>\ntheirs\n</incoming>\nb\n")
+}
+
+func TestUnified(t *testing.T) {
+	assert.Equal(t, Unified([]string{"a\n"}, []string{"a\n"}, 3), []*UnifiedHunk{})
+
+	assert.Equal(
+		t,
+		Unified([]string{}, []string{"a\n", "b\n"}, 3),
+		[]*UnifiedHunk{
+			{
+				OldStart: 0, OldLines: 0, NewStart: 1, NewLines: 2,
+				Lines: []*Line{{LineType: InsertedLine, Content: "a\n"}, {LineType: InsertedLine, Content: "b\n"}},
+			},
+		},
+	)
+
+	a := []string{"1\n", "2\n", "3\n", "4\n", "5\n", "6\n", "7\n", "8\n", "9\n", "10\n"}
+	b := []string{"1\n", "two\n", "3\n", "4\n", "5\n", "6\n", "7\n", "8\n", "9\n", "ten\n"}
+
+	// Contexts do not overlap
+	assert.Equal(
+		t,
+		Unified(a, b, 1),
+		[]*UnifiedHunk{
+			{
+				OldStart: 1, OldLines: 3, NewStart: 1, NewLines: 3,
+				Lines: []*Line{
+					{LineType: ContextLine, Content: "1\n"},
+					{LineType: DeletedLine, Content: "2\n"},
+					{LineType: InsertedLine, Content: "two\n"},
+					{LineType: ContextLine, Content: "3\n"},
+				},
+			},
+			{
+				OldStart: 9, OldLines: 2, NewStart: 9, NewLines: 2,
+				Lines: []*Line{
+					{LineType: ContextLine, Content: "9\n"},
+					{LineType: DeletedLine, Content: "10\n"},
+					{LineType: InsertedLine, Content: "ten\n"},
+				},
+			},
+		},
+	)
+
+	// Contexts overlap
+	hunks := Unified(a, b, 4)
+	assert.Equal(t, len(hunks), 1)
+	assert.Equal(t, hunks[0].OldStart, 1)
+	assert.Equal(t, hunks[0].OldLines, 10)
+	assert.Equal(t, hunks[0].NewStart, 1)
+	assert.Equal(t, hunks[0].NewLines, 10)
+	assert.Equal(t, len(hunks[0].Lines), 12)
+}
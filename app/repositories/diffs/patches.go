@@ -0,0 +1,204 @@
+package diffs
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// PatchError is returned when hunks do not apply to the content they were computed from.
+type PatchError struct {
+	Message string
+}
+
+func (err *PatchError) Error() string {
+	return err.Message
+}
+
+// oldStartIdx is the 0-based index of the first old line of the hunk.
+func (hunk *UnifiedHunk) oldStartIdx() int {
+	if hunk.OldLines == 0 {
+		return hunk.OldStart
+	}
+
+	return hunk.OldStart - 1
+}
+
+// IsSplittable tells whether the changes of the hunk are separated by context lines.
+func (hunk *UnifiedHunk) IsSplittable() bool {
+	return len(SplitHunk(hunk)) > 1
+}
+
+// SplitHunk breaks the hunk at each run of context lines between changes. The context runs are shared by the
+// hunks around them, like the hunks of a diff computed without joining.
+func SplitHunk(hunk *UnifiedHunk) []*UnifiedHunk {
+	type changeGroup struct{ start, end int }
+
+	groups := []changeGroup{}
+	for idx := 0; idx < len(hunk.Lines); idx++ {
+		if hunk.Lines[idx].LineType == ContextLine {
+			continue
+		}
+
+		group := changeGroup{start: idx}
+		for idx < len(hunk.Lines) && hunk.Lines[idx].LineType != ContextLine {
+			idx++
+		}
+		group.end = idx
+
+		groups = append(groups, group)
+	}
+
+	if len(groups) <= 1 {
+		return []*UnifiedHunk{hunk}
+	}
+
+	// Old and new line positions before each line
+	oldPositions := make([]int, len(hunk.Lines)+1)
+	newPositions := make([]int, len(hunk.Lines)+1)
+	oldPositions[0] = hunk.oldStartIdx()
+	newPositions[0] = hunk.NewStart - 1
+	if hunk.NewLines == 0 {
+		newPositions[0] = hunk.NewStart
+	}
+
+	for idx, line := range hunk.Lines {
+		oldPositions[idx+1] = oldPositions[idx]
+		newPositions[idx+1] = newPositions[idx]
+
+		if line.LineType != InsertedLine {
+			oldPositions[idx+1]++
+		}
+		if line.LineType != DeletedLine {
+			newPositions[idx+1]++
+		}
+	}
+
+	hunks := []*UnifiedHunk{}
+
+	for groupIdx := range groups {
+		start, end := 0, len(hunk.Lines)
+		if groupIdx > 0 {
+			start = groups[groupIdx-1].end
+		}
+		if groupIdx < len(groups)-1 {
+			end = groups[groupIdx+1].start
+		}
+
+		splitHunk := &UnifiedHunk{
+			OldStart: oldPositions[start],
+			OldLines: oldPositions[end] - oldPositions[start],
+			NewStart: newPositions[start],
+			NewLines: newPositions[end] - newPositions[start],
+			Lines:    hunk.Lines[start:end],
+		}
+
+		if splitHunk.OldLines > 0 {
+			splitHunk.OldStart++
+		}
+		if splitHunk.NewLines > 0 {
+			splitHunk.NewStart++
+		}
+
+		hunks = append(hunks, splitHunk)
+	}
+
+	return hunks
+}
+
+// ApplyHunks applies some of the hunks computed from a, in any order. The context and deleted lines must match a,
+// and the changes of the hunks must not overlap.
+func ApplyHunks(a []string, hunks []*UnifiedHunk) ([]string, error) {
+	sortedHunks := append([]*UnifiedHunk{}, hunks...)
+	sort.SliceStable(sortedHunks, func(i, j int) bool {
+		return sortedHunks[i].oldStartIdx() < sortedHunks[j].oldStartIdx()
+	})
+
+	result := []string{}
+	cursor := 0
+
+	for _, hunk := range sortedHunks {
+		position := hunk.oldStartIdx()
+
+		for _, line := range hunk.Lines {
+			if line.LineType != InsertedLine {
+				if position >= len(a) || a[position] != line.Content {
+					return nil, &PatchError{fmt.Sprintf("hunk does not apply at line %d.", position+1)}
+				}
+			}
+			if line.LineType != ContextLine && position < cursor {
+				return nil, &PatchError{"hunks overlap."}
+			}
+
+			switch line.LineType {
+			case ContextLine:
+				position++
+			case DeletedLine:
+				result = append(result, a[cursor:position]...)
+				cursor = position + 1
+				position++
+			case InsertedLine:
+				result = append(result, a[cursor:position]...)
+				cursor = position
+				result = append(result, line.Content)
+			}
+		}
+	}
+
+	return append(result, a[cursor:]...), nil
+}
+
+// ParseHunk reads an edited hunk back. Lines starting with "#" are ignored, the other lines start with " ", "-" or
+// "+" and "\ No newline at end of file" removes the line terminator of the previous line.
+//
+// Only the old lines count is checked here, ApplyHunks rejects a hunk whose old lines were edited.
+func ParseHunk(hunk *UnifiedHunk, text string) (*UnifiedHunk, error) {
+	parsedHunk := &UnifiedHunk{OldStart: hunk.OldStart, NewStart: hunk.NewStart, Lines: []*Line{}}
+	lines := strings.SplitAfter(text, "\n")
+
+	for idx, content := range lines {
+		if content == "" || strings.HasPrefix(content, "#") {
+			continue
+		}
+		if strings.HasPrefix(content, "\\") {
+			if len(parsedHunk.Lines) == 0 {
+				return nil, &PatchError{fmt.Sprintf("unexpected \"\\\" marker at line %d.", idx+1)}
+			}
+
+			previousLine := parsedHunk.Lines[len(parsedHunk.Lines)-1]
+			previousLine.Content = strings.TrimSuffix(previousLine.Content, "\n")
+			continue
+		}
+
+		line := &Line{Content: content[1:]}
+		switch content[0] {
+		case ' ':
+			line.LineType = ContextLine
+		case '-':
+			line.LineType = DeletedLine
+		case '+':
+			line.LineType = InsertedLine
+		case '\n':
+			// Editors may strip the trailing space of empty context lines
+			line.LineType = ContextLine
+			line.Content = "\n"
+		default:
+			return nil, &PatchError{fmt.Sprintf("invalid line %d.", idx+1)}
+		}
+
+		if line.LineType != InsertedLine {
+			parsedHunk.OldLines++
+		}
+		if line.LineType != DeletedLine {
+			parsedHunk.NewLines++
+		}
+
+		parsedHunk.Lines = append(parsedHunk.Lines, line)
+	}
+
+	if parsedHunk.OldLines != hunk.OldLines {
+		return nil, &PatchError{"the old lines of the hunk were changed."}
+	}
+
+	return parsedHunk, nil
+}
@@ -0,0 +1,85 @@
+package diffs
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitHunk(t *testing.T) {
+	a := SplitLines([]byte("1\n2\n3\n4\n5\n6\n7\n8\n"))
+	b := SplitLines([]byte("1\ntwo\n3\n4\n5\n6\nseven\n8\n"))
+
+	hunks := Unified(a, b, 3)
+	assert.Equal(t, len(hunks), 1)
+	assert.True(t, hunks[0].IsSplittable())
+
+	splitHunks := SplitHunk(hunks[0])
+	assert.Equal(t, len(splitHunks), 2)
+	assert.Equal(t, *splitHunks[0], UnifiedHunk{OldStart: 1, OldLines: 6, NewStart: 1, NewLines: 6, Lines: hunks[0].Lines[:7]})
+	assert.Equal(t, *splitHunks[1], UnifiedHunk{OldStart: 3, OldLines: 6, NewStart: 3, NewLines: 6, Lines: hunks[0].Lines[3:]})
+	assert.False(t, splitHunks[0].IsSplittable())
+
+	// Split hunks share their context and apply on their own or together
+	lines, err := ApplyHunks(a, splitHunks[:1])
+	assert.Nil(t, err)
+	assert.Equal(t, strings.Join(lines, ""), "1\ntwo\n3\n4\n5\n6\n7\n8\n")
+
+	lines, err = ApplyHunks(a, splitHunks[1:])
+	assert.Nil(t, err)
+	assert.Equal(t, strings.Join(lines, ""), "1\n2\n3\n4\n5\n6\nseven\n8\n")
+
+	lines, err = ApplyHunks(a, []*UnifiedHunk{splitHunks[1], splitHunks[0]})
+	assert.Nil(t, err)
+	assert.Equal(t, lines, b)
+}
+
+func TestApplyHunks(t *testing.T) {
+	a := SplitLines([]byte("1\n2\n3"))
+
+	lines, err := ApplyHunks(a, []*UnifiedHunk{})
+	assert.Nil(t, err)
+	assert.Equal(t, lines, a)
+
+	for _, b := range []string{"", "0\n1\n2\n3", "1\n3", "1\n2\n3\n", "x\ny\nz\n"} {
+		lines, err := ApplyHunks(a, Unified(a, SplitLines([]byte(b)), 1))
+		assert.Nil(t, err)
+		assert.Equal(t, strings.Join(lines, ""), b)
+	}
+
+	hunks := Unified(SplitLines([]byte("1\nx\n3")), SplitLines([]byte("1\ny\n3")), 1)
+	_, err = ApplyHunks(a, hunks)
+	assert.EqualError(t, err, "hunk does not apply at line 2.")
+
+	_, err = ApplyHunks(a, []*UnifiedHunk{hunks[0], hunks[0]})
+	assert.NotNil(t, err)
+}
+
+func TestParseHunk(t *testing.T) {
+	a := SplitLines([]byte("1\n2\n3"))
+	hunk := Unified(a, SplitLines([]byte("1\ntwo\n3\n")), 3)[0]
+
+	parsedHunk, err := ParseHunk(hunk, "# comment\n 1\n-2\n+TWO\n+2.5\n-3\n\\ No newline at end of file\n+3\n\\ No newline at end of file\n")
+	assert.Nil(t, err)
+	assert.Equal(t, parsedHunk.OldLines, 3)
+	assert.Equal(t, parsedHunk.NewLines, 4)
+
+	lines, err := ApplyHunks(a, []*UnifiedHunk{parsedHunk})
+	assert.Nil(t, err)
+	assert.Equal(t, strings.Join(lines, ""), "1\nTWO\n2.5\n3")
+
+	// Deleted lines turned into context lines are kept
+	parsedHunk, err = ParseHunk(hunk, " 1\n 2\n-3\n\\ No newline at end of file\n")
+	assert.Nil(t, err)
+
+	lines, err = ApplyHunks(a, []*UnifiedHunk{parsedHunk})
+	assert.Nil(t, err)
+	assert.Equal(t, strings.Join(lines, ""), "1\n2\n")
+
+	_, err = ParseHunk(hunk, " 1\n")
+	assert.EqualError(t, err, "the old lines of the hunk were changed.")
+
+	_, err = ParseHunk(hunk, " 1\n*2\n 3\n")
+	assert.EqualError(t, err, "invalid line 2.")
+}
@@ -2,7 +2,8 @@ package directories
 
 import (
 	Path "path/filepath"
-	"saymow/version-manager/app/pkg/errors"
+	"saymow/version-manager/app/pkg/collections"
+	"sort"
 	"strings"
 )
 
@@ -17,6 +18,11 @@ type FileRemoval struct {
 	Filepath string
 }
 
+// FileRename is the source of a renamed file, the change File holds the destination path and object.
+type FileRename struct {
+	FromFilepath string
+}
+
 type FileConflict struct {
 	Filepath   string
 	ObjectName string
@@ -30,6 +36,7 @@ const (
 	Modification
 	Removal
 	Conflict
+	Rename
 )
 
 type Change struct {
@@ -37,11 +44,24 @@ type Change struct {
 	File       *File
 	Removal    *FileRemoval
 	Conflict   *FileConflict
+	Rename     *FileRename
 }
 
+// FileMode is how a file is created in the working directory. Symlink objects hold the link target, and
+// empty directories are tracked as entries with an empty object.
+type FileMode int
+
+const (
+	RegularMode FileMode = iota
+	ExecutableMode
+	SymlinkMode
+	DirMode
+)
+
 type File struct {
 	Filepath   string
 	ObjectName string
+	Mode       FileMode
 }
 
 type Node struct {
@@ -60,6 +80,14 @@ const (
 	CREATED_CHANGE  = "(created)"
 	REMOVAL_CHANGE  = "(removed)"
 	CONFLICT_CHANGE = "(conflicted)"
+	RENAMED_CHANGE  = "(renamed)"
+)
+
+const (
+	REGULAR_MODE    = "100644"
+	EXECUTABLE_MODE = "100755"
+	SYMLINK_MODE    = "120000"
+	DIR_MODE        = "040000"
 )
 
 type DirError struct {
@@ -87,6 +115,68 @@ func (change *Change) GetPath() string {
 	return change.File.Filepath
 }
 
+func (change *Change) SetPath(path string) {
+	switch change.ChangeType {
+	case Removal:
+		change.Removal.Filepath = path
+	case Conflict:
+		change.Conflict.Filepath = path
+	default:
+		change.File.Filepath = path
+	}
+}
+
+// GetSourcePath returns the path the change was computed from, the source path of a rename.
+func (change *Change) GetSourcePath() string {
+	if change.ChangeType == Rename {
+		return change.Rename.FromFilepath
+	}
+
+	return change.GetPath()
+}
+
+func (mode FileMode) String() string {
+	switch mode {
+	case ExecutableMode:
+		return EXECUTABLE_MODE
+	case SymlinkMode:
+		return SYMLINK_MODE
+	case DirMode:
+		return DIR_MODE
+	default:
+		return REGULAR_MODE
+	}
+}
+
+func ParseFileMode(mode string) (FileMode, error) {
+	switch mode {
+	case REGULAR_MODE:
+		return RegularMode, nil
+	case EXECUTABLE_MODE:
+		return ExecutableMode, nil
+	case SYMLINK_MODE:
+		return SymlinkMode, nil
+	case DIR_MODE:
+		return DirMode, nil
+	default:
+		return RegularMode, &DirError{"invalid file mode."}
+	}
+}
+
+// Equals tells whether both files have the same content and mode, regardless of their paths.
+func (file *File) Equals(otherFile *File) bool {
+	return file.ObjectName == otherFile.ObjectName && file.Mode == otherFile.Mode
+}
+
+// GetMode returns the mode of the change file, conflicts are regular files.
+func (change *Change) GetMode() FileMode {
+	if change.ChangeType == Removal || change.ChangeType == Conflict {
+		return RegularMode
+	}
+
+	return change.File.Mode
+}
+
 func (change *Change) GetHash() string {
 	if change.ChangeType == Removal {
 		return ""
@@ -106,15 +196,20 @@ func (change *Change) Conflicts(otherChange *Change) bool {
 		return false
 	}
 
-	return change.GetHash() != otherChange.GetHash()
+	return change.GetHash() != otherChange.GetHash() || change.GetMode() != otherChange.GetMode()
 }
 
-func (root *Dir) addNodeHelper(segments []string, change *Change) {
+func (root *Dir) addNodeHelper(segments []string, change *Change) error {
 	if len(segments) == 1 {
 		switch {
 		case change.ChangeType == Removal:
 			delete(root.Children, segments[0])
-		case change.ChangeType == Creation || change.ChangeType == Modification:
+		case change.ChangeType == Creation || change.ChangeType == Modification || change.ChangeType == Rename:
+			if node, ok := root.Children[segments[0]]; ok && node.NodeType == DirType && change.File.Mode == DirMode {
+				// The directory is not empty, its files are kept
+				return nil
+			}
+
 			root.Children[segments[0]] = &Node{
 				NodeType: FileType,
 				File:     change.File,
@@ -130,18 +225,19 @@ func (root *Dir) addNodeHelper(segments []string, change *Change) {
 				}
 			}
 		default:
-			errors.Error("unreachable")
+			return &DirError{"invalid change type."}
 		}
 
-		return
+		return nil
 	}
 
 	var node *Node
 	dirNodeName := segments[0]
 
-	if _, ok := root.Children[dirNodeName]; ok {
-		node = root.Children[dirNodeName]
+	if childNode, ok := root.Children[dirNodeName]; ok && childNode.NodeType == DirType {
+		node = childNode
 	} else {
+		// Empty directories entries are replaced once files are added under them
 		node = &Node{
 			NodeType: DirType,
 			Dir: &Dir{
@@ -152,19 +248,39 @@ func (root *Dir) addNodeHelper(segments []string, change *Change) {
 		root.Children[dirNodeName] = node
 	}
 
-	node.Dir.addNodeHelper(segments[1:], change)
+	if err := node.Dir.addNodeHelper(segments[1:], change); err != nil {
+		return err
+	}
 
 	if len(node.Dir.Children) == 0 {
 		// If we remove all entries from a directory, then we dont need it anymore.
 		// This is ensure we dont restore an empty directory.
 		delete(root.Children, dirNodeName)
 	}
+
+	return nil
 }
 
-func (root *Dir) AddNode(path string, change *Change) {
+func (root *Dir) AddNode(path string, change *Change) error {
+	if change.ChangeType == Rename {
+		// The source is removed before the destination is added
+		fromPath, err := Path.Rel(root.Path, change.Rename.FromFilepath)
+		if err != nil {
+			return &DirError{err.Error()}
+		}
+
+		err = root.addNodeHelper(
+			strings.Split(fromPath, string(Path.Separator)),
+			&Change{ChangeType: Removal, Removal: &FileRemoval{Filepath: change.Rename.FromFilepath}},
+		)
+		if err != nil {
+			return err
+		}
+	}
+
 	segments := strings.Split(path, string(Path.Separator))
 
-	root.addNodeHelper(segments, change)
+	return root.addNodeHelper(segments, change)
 }
 
 func (root *Dir) findNodeHelper(segments []string) *Node {
@@ -179,7 +295,7 @@ func (root *Dir) findNodeHelper(segments []string) *Node {
 
 	subdirName := segments[0]
 	node, ok := root.Children[subdirName]
-	if !ok {
+	if !ok || node.NodeType != DirType {
 		return nil
 	}
 
@@ -276,19 +392,118 @@ func (root *Dir) AbsPath(path string) (string, error) {
 	return path, nil
 }
 
-func (root *Dir) Merge(dir *Dir) *Dir {
+func (root *Dir) Merge(dir *Dir) (*Dir, error) {
 	for _, node := range dir.CollectAllFiles() {
 		if !root.IsSubpath(node.Filepath) || node.Filepath == root.Path {
 			continue
 		}
 		normalzedPath, err := root.NormalizePath(node.Filepath)
-		errors.Check(err)
+		if err != nil {
+			return nil, err
+		}
 
-		root.AddNode(normalzedPath, &Change{ChangeType: Creation, File: &File{
+		err = root.AddNode(normalzedPath, &Change{ChangeType: Creation, File: &File{
 			Filepath:   node.Filepath,
 			ObjectName: node.ObjectName,
+			Mode:       node.Mode,
 		}})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return root, nil
+}
+
+// Diff returns the changes that turn the root file tree into the other file tree, sorted by path. Removed and
+// created files with the same content are detected as renames, see DetectRenames.
+func (root *Dir) Diff(other *Dir) []*Change {
+	rootFiles := make(map[string]*File)
+	otherFiles := make(map[string]*File)
+	filepaths := []string{}
+
+	for _, file := range root.CollectAllFiles() {
+		rootFiles[file.Filepath] = file
+		filepaths = append(filepaths, file.Filepath)
+	}
+
+	for _, file := range other.CollectAllFiles() {
+		otherFiles[file.Filepath] = file
+
+		if _, ok := rootFiles[file.Filepath]; !ok {
+			filepaths = append(filepaths, file.Filepath)
+		}
+	}
+
+	sort.Strings(filepaths)
+	changes := []*Change{}
+
+	for _, filepath := range filepaths {
+		rootFile, inRoot := rootFiles[filepath]
+		otherFile, inOther := otherFiles[filepath]
+
+		switch {
+		case !inOther:
+			changes = append(changes, &Change{ChangeType: Removal, Removal: &FileRemoval{Filepath: filepath}})
+		case !inRoot:
+			changes = append(changes, &Change{ChangeType: Creation, File: otherFile})
+		case !rootFile.Equals(otherFile):
+			changes = append(changes, &Change{ChangeType: Modification, File: otherFile})
+		}
+	}
+
+	return root.DetectRenames(changes)
+}
+
+// DetectRenames pairs the removals of root files with the creations of files with the same content, and
+// replaces each pair with a rename at the creation position. Each removal is paired at most once, with the
+// first creation in the changes order.
+func (root *Dir) DetectRenames(changes []*Change) []*Change {
+	// Files are paired when both their content and mode match
+	type fileKey struct {
+		objectName string
+		mode       FileMode
+	}
+
+	rootFiles := make(map[string]*File)
+	removedPaths := make(map[fileKey][]string)
+
+	for _, file := range root.CollectAllFiles() {
+		rootFiles[file.Filepath] = file
+	}
+
+	for _, change := range changes {
+		if change.ChangeType != Removal {
+			continue
+		}
+
+		if file, ok := rootFiles[change.Removal.Filepath]; ok {
+			key := fileKey{file.ObjectName, file.Mode}
+			removedPaths[key] = append(removedPaths[key], file.Filepath)
+		}
+	}
+
+	renamedPaths := make(map[string]bool)
+	detectedChanges := []*Change{}
+
+	for _, change := range changes {
+		if change.ChangeType != Creation {
+			detectedChanges = append(detectedChanges, change)
+			continue
+		}
+
+		if key := (fileKey{change.File.ObjectName, change.File.Mode}); len(removedPaths[key]) > 0 {
+			fromPath := removedPaths[key][0]
+			removedPaths[key] = removedPaths[key][1:]
+			renamedPaths[fromPath] = true
+
+			change = &Change{ChangeType: Rename, File: change.File, Rename: &FileRename{FromFilepath: fromPath}}
+		}
+
+		detectedChanges = append(detectedChanges, change)
 	}
 
-	return root
+	return collections.Filter(detectedChanges, func(change *Change, _ int) bool {
+		return change.ChangeType != Removal || !renamedPaths[change.Removal.Filepath]
+	})
 }
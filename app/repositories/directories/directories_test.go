@@ -105,15 +105,15 @@ func TestAddNodeRemovalChangesRemovesEmptyDir(t *testing.T) {
 						"a.txt": {
 							NodeType: FileType,
 							File: &File{
-								"home/project/dir/a.txt",
-								"object-a",
+								Filepath:   "home/project/dir/a.txt",
+								ObjectName: "object-a",
 							},
 						},
 						"b.txt": {
 							NodeType: FileType,
 							File: &File{
-								"home/project/dir/b.txt",
-								"object-b",
+								Filepath:   "home/project/dir/b.txt",
+								ObjectName: "object-b",
 							},
 						},
 					},
@@ -212,15 +212,15 @@ func TestFindNode(t *testing.T) {
 			"a.txt": {
 				NodeType: FileType,
 				File: &File{
-					"home/project/a.txt",
-					"object-a",
+					Filepath:   "home/project/a.txt",
+					ObjectName: "object-a",
 				},
 			},
 			"b.txt": {
 				NodeType: FileType,
 				File: &File{
-					"home/project/b.txt",
-					"object-b",
+					Filepath:   "home/project/b.txt",
+					ObjectName: "object-b",
 				},
 			},
 		},
@@ -228,9 +228,9 @@ func TestFindNode(t *testing.T) {
 
 	assert.Equal(t, dir.FindNode("").NodeType, DirType)
 	assert.Equal(t, dir.FindNode("a.txt").NodeType, FileType)
-	assert.Equal(t, dir.FindNode("a.txt").File, &File{"home/project/a.txt", "object-a"})
+	assert.Equal(t, dir.FindNode("a.txt").File, &File{Filepath: "home/project/a.txt", ObjectName: "object-a"})
 	assert.Equal(t, dir.FindNode("b.txt").NodeType, FileType)
-	assert.Equal(t, dir.FindNode("b.txt").File, &File{"home/project/b.txt", "object-b"})
+	assert.Equal(t, dir.FindNode("b.txt").File, &File{Filepath: "home/project/b.txt", ObjectName: "object-b"})
 }
 
 func TestFindNodeNestedPath(t *testing.T) {
@@ -239,15 +239,15 @@ func TestFindNodeNestedPath(t *testing.T) {
 			"a.txt": {
 				NodeType: FileType,
 				File: &File{
-					"home/project/a.txt",
-					"object-a",
+					Filepath:   "home/project/a.txt",
+					ObjectName: "object-a",
 				},
 			},
 			"b.txt": {
 				NodeType: FileType,
 				File: &File{
-					"home/project/b.txt",
-					"object-b",
+					Filepath:   "home/project/b.txt",
+					ObjectName: "object-b",
 				},
 			},
 			"subdir": {
@@ -257,15 +257,15 @@ func TestFindNodeNestedPath(t *testing.T) {
 						"a.txt": {
 							NodeType: FileType,
 							File: &File{
-								"home/project/subdir/a.txt",
-								"object-subdir-a",
+								Filepath:   "home/project/subdir/a.txt",
+								ObjectName: "object-subdir-a",
 							},
 						},
 						"c.txt": {
 							NodeType: FileType,
 							File: &File{
-								"home/project/subdir/c.txt",
-								"object-subdir-c",
+								Filepath:   "home/project/subdir/c.txt",
+								ObjectName: "object-subdir-c",
 							},
 						},
 						"nested-subdir": {
@@ -275,15 +275,15 @@ func TestFindNodeNestedPath(t *testing.T) {
 									"b.txt": {
 										NodeType: FileType,
 										File: &File{
-											"home/project/subdir/nested-subdir/b.txt",
-											"object-subdir-nested-subdir-b",
+											Filepath:   "home/project/subdir/nested-subdir/b.txt",
+											ObjectName: "object-subdir-nested-subdir-b",
 										},
 									},
 									"d.txt": {
 										NodeType: FileType,
 										File: &File{
-											"home/project/subdir/nested-subdir/d.txt",
-											"object-subdir-nested-subdir-d",
+											Filepath:   "home/project/subdir/nested-subdir/d.txt",
+											ObjectName: "object-subdir-nested-subdir-d",
 										},
 									},
 								},
@@ -299,19 +299,19 @@ func TestFindNodeNestedPath(t *testing.T) {
 
 	assert.Equal(t, dir.FindNode("").NodeType, DirType)
 	assert.Equal(t, dir.FindNode("a.txt").NodeType, FileType)
-	assert.Equal(t, dir.FindNode("a.txt").File, &File{"home/project/a.txt", "object-a"})
+	assert.Equal(t, dir.FindNode("a.txt").File, &File{Filepath: "home/project/a.txt", ObjectName: "object-a"})
 	assert.Equal(t, dir.FindNode("b.txt").NodeType, FileType)
-	assert.Equal(t, dir.FindNode("b.txt").File, &File{"home/project/b.txt", "object-b"})
+	assert.Equal(t, dir.FindNode("b.txt").File, &File{Filepath: "home/project/b.txt", ObjectName: "object-b"})
 	assert.Equal(t, dir.FindNode("subdir").NodeType, DirType)
 	assert.Equal(t, dir.FindNode(fmt.Sprintf("subdir%sa.txt", PATH_SEPARATOR)).NodeType, FileType)
-	assert.Equal(t, dir.FindNode(fmt.Sprintf("subdir%sa.txt", PATH_SEPARATOR)).File, &File{"home/project/subdir/a.txt", "object-subdir-a"})
+	assert.Equal(t, dir.FindNode(fmt.Sprintf("subdir%sa.txt", PATH_SEPARATOR)).File, &File{Filepath: "home/project/subdir/a.txt", ObjectName: "object-subdir-a"})
 	assert.Equal(t, dir.FindNode(fmt.Sprintf("subdir%sc.txt", PATH_SEPARATOR)).NodeType, FileType)
-	assert.Equal(t, dir.FindNode(fmt.Sprintf("subdir%sc.txt", PATH_SEPARATOR)).File, &File{"home/project/subdir/c.txt", "object-subdir-c"})
+	assert.Equal(t, dir.FindNode(fmt.Sprintf("subdir%sc.txt", PATH_SEPARATOR)).File, &File{Filepath: "home/project/subdir/c.txt", ObjectName: "object-subdir-c"})
 	assert.Equal(t, dir.FindNode(Path.Join("subdir", "nested-subdir")).NodeType, DirType)
 	assert.Equal(t, dir.FindNode(fmt.Sprintf("subdir%snested-subdir%sb.txt", PATH_SEPARATOR, PATH_SEPARATOR)).NodeType, FileType)
-	assert.Equal(t, dir.FindNode(fmt.Sprintf("subdir%snested-subdir%sb.txt", PATH_SEPARATOR, PATH_SEPARATOR)).File, &File{"home/project/subdir/nested-subdir/b.txt", "object-subdir-nested-subdir-b"})
+	assert.Equal(t, dir.FindNode(fmt.Sprintf("subdir%snested-subdir%sb.txt", PATH_SEPARATOR, PATH_SEPARATOR)).File, &File{Filepath: "home/project/subdir/nested-subdir/b.txt", ObjectName: "object-subdir-nested-subdir-b"})
 	assert.Equal(t, dir.FindNode(fmt.Sprintf("subdir%snested-subdir%sd.txt", PATH_SEPARATOR, PATH_SEPARATOR)).NodeType, FileType)
-	assert.Equal(t, dir.FindNode(fmt.Sprintf("subdir%snested-subdir%sd.txt", PATH_SEPARATOR, PATH_SEPARATOR)).File, &File{"home/project/subdir/nested-subdir/d.txt", "object-subdir-nested-subdir-d"})
+	assert.Equal(t, dir.FindNode(fmt.Sprintf("subdir%snested-subdir%sd.txt", PATH_SEPARATOR, PATH_SEPARATOR)).File, &File{Filepath: "home/project/subdir/nested-subdir/d.txt", ObjectName: "object-subdir-nested-subdir-d"})
 
 }
 
@@ -321,15 +321,15 @@ func TestAllCollectFiles(t *testing.T) {
 			"a.txt": {
 				NodeType: FileType,
 				File: &File{
-					"home/project/a.txt",
-					"1",
+					Filepath:   "home/project/a.txt",
+					ObjectName: "1",
 				},
 			},
 			"b.txt": {
 				NodeType: FileType,
 				File: &File{
-					"home/project/b.txt",
-					"2",
+					Filepath:   "home/project/b.txt",
+					ObjectName: "2",
 				},
 			},
 			"subdir": {
@@ -339,15 +339,15 @@ func TestAllCollectFiles(t *testing.T) {
 						"a.txt": {
 							NodeType: FileType,
 							File: &File{
-								"home/project/subdir/a.txt",
-								"3",
+								Filepath:   "home/project/subdir/a.txt",
+								ObjectName: "3",
 							},
 						},
 						"c.txt": {
 							NodeType: FileType,
 							File: &File{
-								"home/project/subdir/c.txt",
-								"4",
+								Filepath:   "home/project/subdir/c.txt",
+								ObjectName: "4",
 							},
 						},
 						"nested-subdir": {
@@ -357,15 +357,15 @@ func TestAllCollectFiles(t *testing.T) {
 									"b.txt": {
 										NodeType: FileType,
 										File: &File{
-											"home/project/subdir/nested-subdir/b.txt",
-											"5",
+											Filepath:   "home/project/subdir/nested-subdir/b.txt",
+											ObjectName: "5",
 										},
 									},
 									"d.txt": {
 										NodeType: FileType,
 										File: &File{
-											"home/project/subdir/nested-subdir/d.txt",
-											"6",
+											Filepath:   "home/project/subdir/nested-subdir/d.txt",
+											ObjectName: "6",
 										},
 									},
 								},
@@ -384,28 +384,28 @@ func TestAllCollectFiles(t *testing.T) {
 		received,
 		[]*File{
 			{
-				"home/project/a.txt",
-				"1",
+				Filepath:   "home/project/a.txt",
+				ObjectName: "1",
 			},
 			{
-				"home/project/b.txt",
-				"2",
+				Filepath:   "home/project/b.txt",
+				ObjectName: "2",
 			},
 			{
-				"home/project/subdir/a.txt",
-				"3",
+				Filepath:   "home/project/subdir/a.txt",
+				ObjectName: "3",
 			},
 			{
-				"home/project/subdir/c.txt",
-				"4",
+				Filepath:   "home/project/subdir/c.txt",
+				ObjectName: "4",
 			},
 			{
-				"home/project/subdir/nested-subdir/b.txt",
-				"5",
+				Filepath:   "home/project/subdir/nested-subdir/b.txt",
+				ObjectName: "5",
 			},
 			{
-				"home/project/subdir/nested-subdir/d.txt",
-				"6",
+				Filepath:   "home/project/subdir/nested-subdir/d.txt",
+				ObjectName: "6",
 			},
 		},
 	)
@@ -431,8 +431,8 @@ func TestPreOrderTraversal(t *testing.T) {
 									"b.txt": {
 										NodeType: FileType,
 										File: &File{
-											"home/project/subdir/nested-subdir/b.txt",
-											"5",
+											Filepath:   "home/project/subdir/nested-subdir/b.txt",
+											ObjectName: "5",
 										},
 									},
 								},
@@ -458,8 +458,8 @@ func TestPreOrderTraversal(t *testing.T) {
 		&Node{
 			NodeType: FileType,
 			File: &File{
-				"home/project/subdir/nested-subdir/b.txt",
-				"5",
+				Filepath:   "home/project/subdir/nested-subdir/b.txt",
+				ObjectName: "5",
 			},
 		},
 	)
@@ -474,15 +474,15 @@ func TestMerge(t *testing.T) {
 				"a.txt": {
 					NodeType: FileType,
 					File: &File{
-						"home/project/a.txt",
-						"object-a",
+						Filepath:   "home/project/a.txt",
+						ObjectName: "object-a",
 					},
 				},
 				"b.txt": {
 					NodeType: FileType,
 					File: &File{
-						"home/project/b.txt",
-						"object-b",
+						Filepath:   "home/project/b.txt",
+						ObjectName: "object-b",
 					},
 				},
 			},
@@ -494,15 +494,15 @@ func TestMerge(t *testing.T) {
 				"a.txt": {
 					NodeType: FileType,
 					File: &File{
-						"home/a.txt",
-						"object-a",
+						Filepath:   "home/a.txt",
+						ObjectName: "object-a",
 					},
 				},
 				"b.txt": {
 					NodeType: FileType,
 					File: &File{
-						"home/b.txt",
-						"object-b",
+						Filepath:   "home/b.txt",
+						ObjectName: "object-b",
 					},
 				},
 			},
@@ -522,15 +522,15 @@ func TestMerge(t *testing.T) {
 				"a.txt": {
 					NodeType: FileType,
 					File: &File{
-						Path.Join(getOsRoot(), "home", "project", "a.txt"),
-						"object-a",
+						Filepath:   Path.Join(getOsRoot(), "home", "project", "a.txt"),
+						ObjectName: "object-a",
 					},
 				},
 				"b.txt": {
 					NodeType: FileType,
 					File: &File{
-						Path.Join(getOsRoot(), "home", "project", "b.txt"),
-						"object-b",
+						Filepath:   Path.Join(getOsRoot(), "home", "project", "b.txt"),
+						ObjectName: "object-b",
 					},
 				},
 			},
@@ -542,15 +542,15 @@ func TestMerge(t *testing.T) {
 				"a.txt": {
 					NodeType: FileType,
 					File: &File{
-						Path.Join(getOsRoot(), "home", "a.txt"),
-						"object-a",
+						Filepath:   Path.Join(getOsRoot(), "home", "a.txt"),
+						ObjectName: "object-a",
 					},
 				},
 				"b.txt": {
 					NodeType: FileType,
 					File: &File{
-						Path.Join(getOsRoot(), "home", "b.txt"),
-						"object-b",
+						Filepath:   Path.Join(getOsRoot(), "home", "b.txt"),
+						ObjectName: "object-b",
 					},
 				},
 				"project": {
@@ -561,15 +561,15 @@ func TestMerge(t *testing.T) {
 							"c.txt": {
 								NodeType: FileType,
 								File: &File{
-									Path.Join(getOsRoot(), "home", "project", "c.txt"),
-									"object-c",
+									Filepath:   Path.Join(getOsRoot(), "home", "project", "c.txt"),
+									ObjectName: "object-c",
 								},
 							},
 							"d.txt": {
 								NodeType: FileType,
 								File: &File{
-									Path.Join(getOsRoot(), "home", "project", "d.txt"),
-									"object-d",
+									Filepath:   Path.Join(getOsRoot(), "home", "project", "d.txt"),
+									ObjectName: "object-d",
 								},
 							},
 							"folder": {
@@ -580,15 +580,15 @@ func TestMerge(t *testing.T) {
 										"a.txt": {
 											NodeType: FileType,
 											File: &File{
-												Path.Join(getOsRoot(), "home", "project", "folder", "a.txt"),
-												"object-a",
+												Filepath:   Path.Join(getOsRoot(), "home", "project", "folder", "a.txt"),
+												ObjectName: "object-a",
 											},
 										},
 										"b.txt": {
 											NodeType: FileType,
 											File: &File{
-												Path.Join(getOsRoot(), "home", "project", "folder", "b.txt"),
-												"object-b",
+												Filepath:   Path.Join(getOsRoot(), "home", "project", "folder", "b.txt"),
+												ObjectName: "object-b",
 											},
 										},
 									},
@@ -621,15 +621,15 @@ func TestMerge(t *testing.T) {
 				"a.txt": {
 					NodeType: FileType,
 					File: &File{
-						Path.Join(getOsRoot(), "home", "project", "a.txt"),
-						"object-a",
+						Filepath:   Path.Join(getOsRoot(), "home", "project", "a.txt"),
+						ObjectName: "object-a",
 					},
 				},
 				"b.txt": {
 					NodeType: FileType,
 					File: &File{
-						Path.Join(getOsRoot(), "home", "project", "b.txt"),
-						"object-b",
+						Filepath:   Path.Join(getOsRoot(), "home", "project", "b.txt"),
+						ObjectName: "object-b",
 					},
 				},
 			},
@@ -641,15 +641,15 @@ func TestMerge(t *testing.T) {
 				"a.txt": {
 					NodeType: FileType,
 					File: &File{
-						Path.Join(getOsRoot(), "home", "project", "a.txt"),
-						"object-a-overridden",
+						Filepath:   Path.Join(getOsRoot(), "home", "project", "a.txt"),
+						ObjectName: "object-a-overridden",
 					},
 				},
 				"b.txt": {
 					NodeType: FileType,
 					File: &File{
-						Path.Join(getOsRoot(), "home", "project", "b.txt"),
-						"object-b-overridden",
+						Filepath:   Path.Join(getOsRoot(), "home", "project", "b.txt"),
+						ObjectName: "object-b-overridden",
 					},
 				},
 				"folder": {
@@ -660,15 +660,15 @@ func TestMerge(t *testing.T) {
 							"a.txt": {
 								NodeType: FileType,
 								File: &File{
-									Path.Join(getOsRoot(), "home", "project", "folder", "a.txt"),
-									"object-a",
+									Filepath:   Path.Join(getOsRoot(), "home", "project", "folder", "a.txt"),
+									ObjectName: "object-a",
 								},
 							},
 							"b.txt": {
 								NodeType: FileType,
 								File: &File{
-									Path.Join(getOsRoot(), "home", "project", "folder", "b.txt"),
-									"object-b",
+									Filepath:   Path.Join(getOsRoot(), "home", "project", "folder", "b.txt"),
+									ObjectName: "object-b",
 								},
 							},
 						},
@@ -975,3 +975,86 @@ func TestChangeConflicts(t *testing.T) {
 		}),
 	)
 }
+
+func TestDiff(t *testing.T) {
+	dir := &Dir{
+		Path:     Path.Join("home", "project"),
+		Children: make(map[string]*Node),
+	}
+	otherDir := &Dir{
+		Path:     Path.Join("home", "project"),
+		Children: make(map[string]*Node),
+	}
+
+	dir.AddNode("1.txt", &Change{ChangeType: Creation, File: &File{Filepath: Path.Join("home", "project", "1.txt"), ObjectName: "1"}})
+	dir.AddNode("2.txt", &Change{ChangeType: Creation, File: &File{Filepath: Path.Join("home", "project", "2.txt"), ObjectName: "2"}})
+	dir.AddNode(Path.Join("a", "3.txt"), &Change{ChangeType: Creation, File: &File{Filepath: Path.Join("home", "project", "a", "3.txt"), ObjectName: "3"}})
+
+	otherDir.AddNode("1.txt", &Change{ChangeType: Creation, File: &File{Filepath: Path.Join("home", "project", "1.txt"), ObjectName: "1"}})
+	otherDir.AddNode("2.txt", &Change{ChangeType: Creation, File: &File{Filepath: Path.Join("home", "project", "2.txt"), ObjectName: "2 updated"}})
+	otherDir.AddNode(Path.Join("a", "4.txt"), &Change{ChangeType: Creation, File: &File{Filepath: Path.Join("home", "project", "a", "4.txt"), ObjectName: "4"}})
+
+	assert.EqualValues(
+		t,
+		dir.Diff(otherDir),
+		[]*Change{
+			{ChangeType: Modification, File: &File{Filepath: Path.Join("home", "project", "2.txt"), ObjectName: "2 updated"}},
+			{ChangeType: Removal, Removal: &FileRemoval{Filepath: Path.Join("home", "project", "a", "3.txt")}},
+			{ChangeType: Creation, File: &File{Filepath: Path.Join("home", "project", "a", "4.txt"), ObjectName: "4"}},
+		},
+	)
+	assert.EqualValues(t, dir.Diff(dir), []*Change{})
+}
+
+func TestAddNodeRenameChanges(t *testing.T) {
+	dir := &Dir{
+		Path:     Path.Join("home", "project"),
+		Children: make(map[string]*Node),
+	}
+
+	dir.AddNode(Path.Join("a", "1.txt"), &Change{ChangeType: Creation, File: &File{Filepath: Path.Join("home", "project", "a", "1.txt"), ObjectName: "1"}})
+	dir.AddNode(Path.Join("b", "2.txt"), &Change{
+		ChangeType: Rename,
+		File:       &File{Filepath: Path.Join("home", "project", "b", "2.txt"), ObjectName: "1"},
+		Rename:     &FileRename{FromFilepath: Path.Join("home", "project", "a", "1.txt")},
+	})
+
+	assert.Nil(t, dir.FindNode("a"))
+	assert.Equal(t, dir.FindNode(Path.Join("b", "2.txt")).File, &File{Filepath: Path.Join("home", "project", "b", "2.txt"), ObjectName: "1"})
+}
+
+func TestDiffRenames(t *testing.T) {
+	dir := &Dir{
+		Path:     Path.Join("home", "project"),
+		Children: make(map[string]*Node),
+	}
+	otherDir := &Dir{
+		Path:     Path.Join("home", "project"),
+		Children: make(map[string]*Node),
+	}
+
+	dir.AddNode("1.txt", &Change{ChangeType: Creation, File: &File{Filepath: Path.Join("home", "project", "1.txt"), ObjectName: "1"}})
+	dir.AddNode("2.txt", &Change{ChangeType: Creation, File: &File{Filepath: Path.Join("home", "project", "2.txt"), ObjectName: "2"}})
+	dir.AddNode("3.txt", &Change{ChangeType: Creation, File: &File{Filepath: Path.Join("home", "project", "3.txt"), ObjectName: "3"}})
+
+	otherDir.AddNode(Path.Join("a", "1.txt"), &Change{ChangeType: Creation, File: &File{Filepath: Path.Join("home", "project", "a", "1.txt"), ObjectName: "1"}})
+	otherDir.AddNode(Path.Join("a", "1 copy.txt"), &Change{ChangeType: Creation, File: &File{Filepath: Path.Join("home", "project", "a", "1 copy.txt"), ObjectName: "1"}})
+	otherDir.AddNode("2.txt", &Change{ChangeType: Creation, File: &File{Filepath: Path.Join("home", "project", "2.txt"), ObjectName: "2"}})
+	otherDir.AddNode("4.txt", &Change{ChangeType: Creation, File: &File{Filepath: Path.Join("home", "project", "4.txt"), ObjectName: "3 updated"}})
+
+	// A removal is only paired once, and renamed files with other content are not detected
+	assert.EqualValues(
+		t,
+		dir.Diff(otherDir),
+		[]*Change{
+			{ChangeType: Removal, Removal: &FileRemoval{Filepath: Path.Join("home", "project", "3.txt")}},
+			{ChangeType: Creation, File: &File{Filepath: Path.Join("home", "project", "4.txt"), ObjectName: "3 updated"}},
+			{
+				ChangeType: Rename,
+				File:       &File{Filepath: Path.Join("home", "project", "a", "1 copy.txt"), ObjectName: "1"},
+				Rename:     &FileRename{FromFilepath: Path.Join("home", "project", "1.txt")},
+			},
+			{ChangeType: Creation, File: &File{Filepath: Path.Join("home", "project", "a", "1.txt"), ObjectName: "1"}},
+		},
+	)
+}
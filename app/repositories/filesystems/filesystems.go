@@ -4,17 +4,22 @@ import (
 	"bufio"
 	"bytes"
 	"compress/gzip"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"io"
-	"log"
+	"io/fs"
 	"os"
 	Path "path/filepath"
-	"saymow/version-manager/app/pkg/errors"
+	"saymow/version-manager/app/pkg/vfs"
 	"saymow/version-manager/app/repositories/directories"
+	"saymow/version-manager/app/repositories/objectstores"
+	"saymow/version-manager/app/repositories/packs"
 	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -22,70 +27,293 @@ const (
 	REPOSITORY_FOLDER_NAME = ".repository"
 	OBJECTS_FOLDER_NAME    = "objects"
 	SAVES_FOLDER_NAME      = "saves"
+	PACKS_FOLDER_NAME      = "packs"
 	INDEX_FILE_NAME        = "index"
 	HEAD_FILE_NAME         = "head"
 	REFS_FILE_NAME         = "refs"
+	MERGE_HEAD_FILE_NAME   = "merge-head"
+	VERSION_FILE_NAME      = "version"
+	EXCLUDE_FILE_NAME      = "exclude"
+	OBJECT_STORE_FILE_NAME = "object-store"
+
+	// Objects and the stat cache are written to temporary files before being renamed to their name
+	TEMP_FILE_PREFIX = objectstores.TEMP_FILE_PREFIX
 
 	INITIAL_REF_NAME = "master"
 
-	USER_FILES_PERMISSIONS = 0777
+	// Version 1 repositories stored absolute paths in the index and saves, version 2 stores
+	// repository relative paths.
+	REPOSITORY_VERSION = 2
+
+	USER_FILES_PERMISSIONS       = 0777
+	REGULAR_FILES_PERMISSIONS    = 0644
+	EXECUTABLE_FILES_PERMISSIONS = 0755
 )
 
+// Save is the history of a checkpoint.
+//
+// Checkpoints are sorted so that parents always come before their children, the save checkpoint is the last one.
 type Save struct {
 	Id          string
 	Checkpoints []*Checkpoint
 }
 
+// Checkpoint changes are relative to its first parent. Merge checkpoints have more than one parent.
 type Checkpoint struct {
 	Id        string
 	Message   string
 	CreatedAt time.Time
-	Parent    string
+	Parents   []string
 	Changes   []*directories.Change
 }
 
 type FileSystem struct {
-	Root string
+	Root        string
+	Files       vfs.FS
+	objects     objectstores.ObjectStore
+	loadedPacks []*packs.Pack
+	packsLock   sync.Mutex
+	// Objects of a shared store may be referenced by other repositories
+	sharedObjects bool
+	// Held lock, and the repository files written meanwhile, nil when removed, see Lock
+	lock    *lockInfo
+	pending map[string]*string
+	ctx     context.Context
 }
 
 type Refs map[string]string
 
-func Create(root string) *FileSystem {
-	err := os.Mkdir(Path.Join(root, REPOSITORY_FOLDER_NAME), 0644)
-	errors.Check(err)
+// CorruptError is returned when a repository file cannot be parsed, or when a save or object it refers to is
+// missing. Name is the repository file, save or object.
+type CorruptError struct {
+	Name    string
+	Message string
+}
+
+func (err *CorruptError) Error() string {
+	return fmt.Sprintf("Corruption Error: %s %s", err.Name, err.Message)
+}
+
+func missingSaveError(saveName string) error {
+	return &CorruptError{fmt.Sprintf("save \"%s\"", saveName), "is missing."}
+}
+
+func missingObjectError(objectName string) error {
+	return &CorruptError{fmt.Sprintf("object \"%s\"", objectName), "is missing."}
+}
+
+func Create(files vfs.FS, root string) (*FileSystem, error) {
+	repositoryPath := Path.Join(root, REPOSITORY_FOLDER_NAME)
+	fileSystem := &FileSystem{
+		Root:    root,
+		Files:   files,
+		objects: objectstores.NewLocal(files, Path.Join(repositoryPath, OBJECTS_FOLDER_NAME)),
+	}
+
+	if err := fileSystem.Files.Mkdir(repositoryPath, 0644); err != nil {
+		return nil, err
+	}
+
+	repositoryFiles := []struct {
+		name    string
+		content string
+	}{
+		{INDEX_FILE_NAME, "Tracked files:\r\n\r\n"},
+		{REFS_FILE_NAME, fmt.Sprintf("Refs:\n\n%s\n\n", INITIAL_REF_NAME)},
+		{HEAD_FILE_NAME, INITIAL_REF_NAME},
+	}
+
+	for _, file := range repositoryFiles {
+		if err := fileSystem.Files.WriteFile(Path.Join(repositoryPath, file.name), []byte(file.content), 0644); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := fileSystem.Files.Mkdir(Path.Join(repositoryPath, OBJECTS_FOLDER_NAME), 0644); err != nil {
+		return nil, err
+	}
+
+	if err := fileSystem.Files.Mkdir(Path.Join(repositoryPath, SAVES_FOLDER_NAME), 0644); err != nil {
+		return nil, err
+	}
+
+	if err := fileSystem.writeVersion(REPOSITORY_VERSION); err != nil {
+		return nil, err
+	}
+
+	return fileSystem, nil
+}
+
+// Open opens the repository at root, its objects are in the object store set by SetObjectStoreURL or in the
+// objects folder.
+func Open(files vfs.FS, root string) (*FileSystem, error) {
+	repositoryPath := Path.Join(root, REPOSITORY_FOLDER_NAME)
+	fileSystem := &FileSystem{
+		Root:    root,
+		Files:   files,
+		objects: objectstores.NewLocal(files, Path.Join(repositoryPath, OBJECTS_FOLDER_NAME)),
+	}
+
+	content, err := files.ReadFile(Path.Join(repositoryPath, OBJECT_STORE_FILE_NAME))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fileSystem, nil
+		}
+
+		return nil, err
+	}
+
+	store, err := objectstores.NewS3FromURL(strings.TrimSpace(string(content)))
+	if err != nil {
+		return nil, &CorruptError{OBJECT_STORE_FILE_NAME, err.Error()}
+	}
+	fileSystem.SetObjectStore(store)
+
+	return fileSystem, nil
+}
+
+// SetObjectStore replaces the objects folder with store, for this FileSystem only. The objects of store are
+// shared: they are never packed nor collected.
+func (fileSystem *FileSystem) SetObjectStore(store objectstores.ObjectStore) {
+	fileSystem.objects = store
+	fileSystem.sharedObjects = true
+	fileSystem.bindObjectStore()
+}
+
+// SetContext makes the requests of the network object stores fail once ctx is done.
+func (fileSystem *FileSystem) SetContext(ctx context.Context) {
+	fileSystem.ctx = ctx
+	fileSystem.bindObjectStore()
+}
+
+func (fileSystem *FileSystem) bindObjectStore() {
+	if store, ok := fileSystem.objects.(objectstores.ContextStore); ok && fileSystem.ctx != nil {
+		fileSystem.objects = store.WithContext(fileSystem.ctx)
+	}
+}
+
+// SetObjectStoreURL makes the repository objects stored in the S3 compatible store at rawURL from now on,
+// see objectstores.NewS3FromURL. Objects already written are not moved.
+func (fileSystem *FileSystem) SetObjectStoreURL(rawURL string) error {
+	store, err := objectstores.NewS3FromURL(rawURL)
+	if err != nil {
+		return err
+	}
+
+	if err := fileSystem.writeRepositoryFile(OBJECT_STORE_FILE_NAME, rawURL); err != nil {
+		return err
+	}
+	fileSystem.SetObjectStore(store)
+
+	return nil
+}
+
+func (fileSystem *FileSystem) SharesObjects() bool {
+	return fileSystem.sharedObjects
+}
+
+// ReadVersion returns the repository format version, repositories without a version file are version 1.
+func (fileSystem *FileSystem) ReadVersion() (int, error) {
+	content, err := fileSystem.readRepositoryFile(VERSION_FILE_NAME)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 1, nil
+		}
+
+		return 0, err
+	}
+
+	version, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		return 0, &CorruptError{VERSION_FILE_NAME, "has an invalid format."}
+	}
+
+	return version, nil
+}
+
+func (fileSystem *FileSystem) writeVersion(version int) error {
+	return fileSystem.writeRepositoryFile(VERSION_FILE_NAME, strconv.Itoa(version))
+}
+
+// storedPath converts a file path to the form written in the index and saves: relative to the repository
+// root and slash separated, so the repository can be moved or cloned elsewhere.
+func (fileSystem *FileSystem) storedPath(filepath string) (string, error) {
+	relativePath, err := Path.Rel(fileSystem.Root, filepath)
+	if err != nil {
+		return "", err
+	}
+
+	return Path.ToSlash(relativePath), nil
+}
+
+// resolvePath converts a path read from the index or saves to an absolute path in the current repository root.
+func (fileSystem *FileSystem) resolvePath(storedPath string) string {
+	return Path.Join(fileSystem.Root, Path.FromSlash(storedPath))
+}
 
-	indexFile, err := os.Create(Path.Join(root, REPOSITORY_FOLDER_NAME, INDEX_FILE_NAME))
-	errors.Check(err)
-	defer errors.CheckFn(indexFile.Close)
+// storedObject converts a file to the object line written in the index and saves. Regular files only store
+// their object name, so saves written before modes were tracked keep their hashes.
+func storedObject(file *directories.File) string {
+	if file.Mode == directories.RegularMode {
+		return file.ObjectName
+	}
+
+	return fmt.Sprintf("%s\t%s", file.ObjectName, file.Mode)
+}
 
-	_, err = indexFile.Write([]byte("Tracked files:\r\n\r\n"))
-	errors.Check(err)
+// parseStoredObject reads the object name and mode from an object line of the index or saves.
+func parseStoredObject(line string, file *directories.File) error {
+	objectName, mode, hasMode := strings.Cut(line, "\t")
+	file.ObjectName = objectName
 
-	refsFile, err := os.Create(Path.Join(root, REPOSITORY_FOLDER_NAME, REFS_FILE_NAME))
-	errors.Check(err)
-	defer errors.CheckFn(refsFile.Close)
+	if hasMode {
+		fileMode, err := directories.ParseFileMode(mode)
+		if err != nil {
+			return err
+		}
 
-	_, err = refsFile.Write([]byte(fmt.Sprintf("Refs:\n\n%s\n\n", INITIAL_REF_NAME)))
-	errors.Check(err)
+		file.Mode = fileMode
+	}
 
-	headFile, err := os.Create(Path.Join(root, REPOSITORY_FOLDER_NAME, HEAD_FILE_NAME))
-	errors.Check(err)
-	defer errors.CheckFn(headFile.Close)
+	return nil
+}
 
-	_, err = headFile.Write([]byte(INITIAL_REF_NAME))
-	errors.Check(err)
+// formatChange returns the index and saves lines of a change, the conflict message is only written in the index.
+func (fileSystem *FileSystem) formatChange(change *directories.Change) (string, error) {
+	filepath, err := fileSystem.storedPath(change.GetPath())
+	if err != nil {
+		return "", err
+	}
 
-	err = os.Mkdir(Path.Join(root, REPOSITORY_FOLDER_NAME, OBJECTS_FOLDER_NAME), 0644)
-	errors.Check(err)
+	switch change.ChangeType {
+	case directories.Modification:
+		return fmt.Sprintf("%s\t%s\n%s\n", filepath, directories.MODIFIED_CHANGE, storedObject(change.File)), nil
+	case directories.Creation:
+		return fmt.Sprintf("%s\t%s\n%s\n", filepath, directories.CREATED_CHANGE, storedObject(change.File)), nil
+	case directories.Removal:
+		return fmt.Sprintf("%s\t%s\n", filepath, directories.REMOVAL_CHANGE), nil
+	case directories.Conflict:
+		return fmt.Sprintf("%s\t%s\t%s\n%s\n", filepath, directories.CONFLICT_CHANGE, change.Conflict.Message, change.Conflict.ObjectName), nil
+	case directories.Rename:
+		fromFilepath, err := fileSystem.storedPath(change.Rename.FromFilepath)
+		if err != nil {
+			return "", err
+		}
 
-	err = os.Mkdir(Path.Join(root, REPOSITORY_FOLDER_NAME, SAVES_FOLDER_NAME), 0644)
-	errors.Check(err)
+		return fmt.Sprintf("%s\t%s\t%s\n%s\n", filepath, directories.RENAMED_CHANGE, fromFilepath, storedObject(change.File)), nil
+	}
 
-	return &FileSystem{Root: root}
+	return "", fmt.Errorf("invalid change type.")
 }
 
-func Open(root string) *FileSystem {
-	return &FileSystem{Root: root}
+func (fileSystem *FileSystem) resolveChangesPaths(changes []*directories.Change) {
+	for _, change := range changes {
+		change.SetPath(fileSystem.resolvePath(change.GetPath()))
+
+		if change.ChangeType == directories.Rename {
+			change.Rename.FromFilepath = fileSystem.resolvePath(change.Rename.FromFilepath)
+		}
+	}
 }
 
 func (save *Save) Contains(otherSave *Save) bool {
@@ -104,6 +332,35 @@ func (save *Save) Checkpoint() *Checkpoint {
 	return save.Checkpoints[len(save.Checkpoints)-1]
 }
 
+// FirstParentCheckpoints returns the checkpoints reached by following the first parents from the save
+// checkpoint, in ascending order. Applying their changes in order gives the save file tree.
+func (save *Save) FirstParentCheckpoints() []*Checkpoint {
+	checkpointsMap := make(map[string]*Checkpoint)
+
+	for _, checkpoint := range save.Checkpoints {
+		checkpointsMap[checkpoint.Id] = checkpoint
+	}
+
+	checkpoints := []*Checkpoint{save.Checkpoint()}
+
+	for len(checkpoints[len(checkpoints)-1].Parents) > 0 {
+		checkpoints = append(checkpoints, checkpointsMap[checkpoints[len(checkpoints)-1].Parents[0]])
+	}
+
+	slices.Reverse(checkpoints)
+
+	return checkpoints
+}
+
+func (checkpoint *Checkpoint) IsMerge() bool {
+	return len(checkpoint.Parents) > 1
+}
+
+// FindFirstCommonCheckpointParent returns the most recent checkpoint shared by both saves histories, ignoring
+// the saves checkpoints themselves.
+//
+// Since parents always come before their children, the first shared checkpoint found walking backwards is not
+// an ancestor of any other shared checkpoint.
 func (save *Save) FindFirstCommonCheckpointParent(otherSave *Save) *Checkpoint {
 	seen := make(map[string]*Checkpoint)
 
@@ -120,35 +377,27 @@ func (save *Save) FindFirstCommonCheckpointParent(otherSave *Save) *Checkpoint {
 	return nil
 }
 
-func (fileSystem *FileSystem) SaveIndex(index []*directories.Change) {
-	file, err := os.OpenFile(Path.Join(fileSystem.Root, REPOSITORY_FOLDER_NAME, INDEX_FILE_NAME), os.O_WRONLY|os.O_TRUNC, 0644)
-	errors.Check(err)
-	defer errors.CheckFn(file.Close)
+func (fileSystem *FileSystem) SaveIndex(index []*directories.Change) error {
+	var stringBuilder strings.Builder
 
-	_, err = file.Write([]byte("Tracked files:\n\n"))
-	errors.Check(err)
+	stringBuilder.WriteString("Tracked files:\n\n")
 
 	for _, change := range index {
-
-		switch change.ChangeType {
-		case directories.Modification:
-			_, err = file.Write([]byte(fmt.Sprintf("%s\t%s\n%s\n", change.File.Filepath, directories.MODIFIED_CHANGE, change.File.ObjectName)))
-		case directories.Creation:
-			_, err = file.Write([]byte(fmt.Sprintf("%s\t%s\n%s\n", change.File.Filepath, directories.CREATED_CHANGE, change.File.ObjectName)))
-		case directories.Removal:
-			_, err = file.Write([]byte(fmt.Sprintf("%s\t%s\n", change.Removal.Filepath, directories.REMOVAL_CHANGE)))
-		case directories.Conflict:
-			_, err = file.Write([]byte(fmt.Sprintf("%s\t%s\t%s\n%s\n", change.Conflict.Filepath, directories.CONFLICT_CHANGE, change.Conflict.Message, change.Conflict.ObjectName)))
-		default:
-			errors.Error("unreachable")
+		line, err := fileSystem.formatChange(change)
+		if err != nil {
+			return err
 		}
-		errors.Check(err)
+
+		stringBuilder.WriteString(line)
 	}
+
+	return fileSystem.writeRepositoryFile(INDEX_FILE_NAME, stringBuilder.String())
 }
 
-func (fileSystem *FileSystem) parseIndex(file *os.File) []*directories.Change {
+func (fileSystem *FileSystem) parseIndex(file io.Reader) ([]*directories.Change, error) {
 	var index []*directories.Change
 	scanner := bufio.NewScanner(file)
+	invalidFormatErr := &CorruptError{INDEX_FILE_NAME, "has an invalid format."}
 
 	// Skip file header lines
 	scanner.Scan()
@@ -161,7 +410,7 @@ func (fileSystem *FileSystem) parseIndex(file *os.File) []*directories.Change {
 		changesHeaderLen := len(changeHeader)
 
 		if changesHeaderLen < 2 || changesHeaderLen > 3 {
-			errors.Error("Invalid index format.")
+			return nil, invalidFormatErr
 		}
 
 		switch {
@@ -176,7 +425,9 @@ func (fileSystem *FileSystem) parseIndex(file *os.File) []*directories.Change {
 				change.File = &directories.File{}
 				change.File.Filepath = changeHeader[0]
 				scanner.Scan()
-				change.File.ObjectName = scanner.Text()
+				if parseStoredObject(scanner.Text(), change.File) != nil {
+					return nil, invalidFormatErr
+				}
 			}
 		case changeHeader[1] == directories.REMOVAL_CHANGE:
 			{
@@ -187,7 +438,7 @@ func (fileSystem *FileSystem) parseIndex(file *os.File) []*directories.Change {
 		case changeHeader[1] == directories.CONFLICT_CHANGE:
 			{
 				if changesHeaderLen != 3 {
-					errors.Error("Invalid index format.")
+					return nil, invalidFormatErr
 				}
 
 				change.ChangeType = directories.Conflict
@@ -197,28 +448,59 @@ func (fileSystem *FileSystem) parseIndex(file *os.File) []*directories.Change {
 				scanner.Scan()
 				change.Conflict.ObjectName = scanner.Text()
 			}
+		case changeHeader[1] == directories.RENAMED_CHANGE:
+			{
+				if changesHeaderLen != 3 {
+					return nil, invalidFormatErr
+				}
+
+				change.ChangeType = directories.Rename
+				change.Rename = &directories.FileRename{FromFilepath: changeHeader[2]}
+				change.File = &directories.File{}
+				change.File.Filepath = changeHeader[0]
+				scanner.Scan()
+				if parseStoredObject(scanner.Text(), change.File) != nil {
+					return nil, invalidFormatErr
+				}
+			}
+		default:
+			return nil, invalidFormatErr
 		}
 
 		index = append(index, &change)
 	}
 
-	return index
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return index, nil
 }
 
-func (fileSystem *FileSystem) ReadIndex() []*directories.Change {
-	file, err := os.OpenFile(Path.Join(fileSystem.Root, REPOSITORY_FOLDER_NAME, INDEX_FILE_NAME), os.O_RDONLY, 0644)
-	errors.Check(err)
-	defer errors.CheckFn(file.Close)
+func (fileSystem *FileSystem) ReadIndex() ([]*directories.Change, error) {
+	file, err := fileSystem.openRepositoryFile(INDEX_FILE_NAME)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	index, err := fileSystem.parseIndex(file)
+	if err != nil {
+		return nil, err
+	}
+	fileSystem.resolveChangesPaths(index)
 
-	return fileSystem.parseIndex(file)
+	return index, nil
 }
 
-func (fileSystem *FileSystem) ReadRefs() *Refs {
+func (fileSystem *FileSystem) ReadRefs() (*Refs, error) {
 	refs := Refs{}
 
-	file, err := os.Open(Path.Join(fileSystem.Root, REPOSITORY_FOLDER_NAME, REFS_FILE_NAME))
-	errors.Check(err)
-	defer errors.CheckFn(file.Close)
+	file, err := fileSystem.openRepositoryFile(REFS_FILE_NAME)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
 
 	scanner := bufio.NewScanner(file)
 
@@ -230,220 +512,353 @@ func (fileSystem *FileSystem) ReadRefs() *Refs {
 		key := scanner.Text()
 
 		if !scanner.Scan() {
-			errors.Error("Invalid refs format.")
+			return nil, &CorruptError{REFS_FILE_NAME, "has an invalid format."}
 		}
 
 		refs[key] = scanner.Text()
 	}
 
-	return &refs
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return &refs, nil
 }
 
-func (fileSystem *FileSystem) WriteRefs(refs *Refs) {
-	file, err := os.OpenFile(Path.Join(fileSystem.Root, REPOSITORY_FOLDER_NAME, REFS_FILE_NAME), os.O_WRONLY|os.O_TRUNC, 0644)
-	errors.Check(err)
-	defer errors.CheckFn(file.Close)
+func (fileSystem *FileSystem) WriteRefs(refs *Refs) error {
+	var stringBuilder strings.Builder
 
-	_, err = file.Write([]byte("Refs:\n\n"))
-	errors.Check(err)
+	stringBuilder.WriteString("Refs:\n\n")
 
 	for branchName, saveName := range *refs {
-		_, err = file.Write([]byte(fmt.Sprintf("%s\n%s\n", branchName, saveName)))
-		errors.Check(err)
+		stringBuilder.WriteString(fmt.Sprintf("%s\n%s\n", branchName, saveName))
 	}
-}
 
-func (fileSystem *FileSystem) WriteHead(name string) {
-	file, err := os.OpenFile(Path.Join(fileSystem.Root, REPOSITORY_FOLDER_NAME, HEAD_FILE_NAME), os.O_WRONLY|os.O_TRUNC, 0644)
-	errors.Check(err)
-	defer errors.CheckFn(file.Close)
+	return fileSystem.writeRepositoryFile(REFS_FILE_NAME, stringBuilder.String())
+}
 
-	_, err = file.Write([]byte(name))
-	errors.Check(err)
+func (fileSystem *FileSystem) WriteHead(name string) error {
+	return fileSystem.writeRepositoryFile(HEAD_FILE_NAME, name)
 }
 
-func (fileSystem *FileSystem) parseHead(file *os.File) string {
+func (fileSystem *FileSystem) parseHead(file io.Reader) (string, error) {
 	buffer := make([]byte, 128)
 	n, err := file.Read(buffer)
 
 	if err != nil && err != io.EOF {
-		errors.Error(err.Error())
+		return "", err
 	}
 
-	return string(buffer[:n])
+	return string(buffer[:n]), nil
 }
 
-func (fileSystem *FileSystem) ReadHead() string {
-	file, err := os.OpenFile(Path.Join(fileSystem.Root, REPOSITORY_FOLDER_NAME, HEAD_FILE_NAME), os.O_RDONLY, 0644)
-	errors.Check(err)
-	defer errors.CheckFn(file.Close)
+func (fileSystem *FileSystem) ReadHead() (string, error) {
+	file, err := fileSystem.openRepositoryFile(HEAD_FILE_NAME)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
 
 	return fileSystem.parseHead(file)
 }
 
-func (fileSystem *FileSystem) ReadDir(saveName string) directories.Dir {
-	dir := directories.Dir{Path: fileSystem.Root, Children: make(map[string]*directories.Node)}
-	changes := []directories.Change{}
+func (fileSystem *FileSystem) WriteMergeHead(saveName string) error {
+	return fileSystem.writeRepositoryFile(MERGE_HEAD_FILE_NAME, saveName)
+}
 
-	for saveName != "" {
-		file, err := os.Open(Path.Join(fileSystem.Root, REPOSITORY_FOLDER_NAME, SAVES_FOLDER_NAME, saveName))
-		errors.Check(err)
-
-		scanner := bufio.NewScanner(file)
-
-		// Skip save message
-		scanner.Scan()
-
-		// Scan parent hash
-		scanner.Scan()
-		saveName = scanner.Text()
-
-		// Skip createdAt
-		scanner.Scan()
-		// Skip newline
-		scanner.Scan()
-		// Skip warn message
-		scanner.Scan()
-		// Skip newline
-		scanner.Scan()
-		// Skip newline
-		scanner.Scan()
-		// Skip header message
-		scanner.Scan()
-		// Skip newline
-		scanner.Scan()
-
-		for scanner.Scan() {
-			change := directories.Change{}
-
-			changeHeader := strings.Split(scanner.Text(), "\t")
-
-			if len(changeHeader) != 2 {
-				errors.Error("Invalid save format.")
-			}
+// ReadMergeHead returns the save being merged while the merge conflicts are not resolved, empty otherwise.
+func (fileSystem *FileSystem) ReadMergeHead() (string, error) {
+	file, err := fileSystem.openRepositoryFile(MERGE_HEAD_FILE_NAME)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
 
-			if changeHeader[1] == directories.MODIFIED_CHANGE || changeHeader[1] == directories.CREATED_CHANGE {
-				if changeHeader[1] == directories.MODIFIED_CHANGE {
-					change.ChangeType = directories.Modification
-				} else {
-					change.ChangeType = directories.Creation
-				}
+		return "", err
+	}
+	defer file.Close()
 
-				change.File = &directories.File{}
-				change.File.Filepath = changeHeader[0]
-				scanner.Scan()
-				change.File.ObjectName = scanner.Text()
-			} else {
-				change.ChangeType = directories.Removal
-				change.Removal = &directories.FileRemoval{}
-				change.Removal.Filepath = changeHeader[0]
-			}
+	return fileSystem.parseHead(file)
+}
+
+func (fileSystem *FileSystem) RemoveMergeHead() error {
+	return fileSystem.removeRepositoryFile(MERGE_HEAD_FILE_NAME)
+}
+
+func (fileSystem *FileSystem) ReadDir(saveName string) (directories.Dir, error) {
+	dir := directories.Dir{Path: fileSystem.Root, Children: make(map[string]*directories.Node)}
+	changes := []*directories.Change{}
 
-			changes = append(changes, change)
+	for saveName != "" {
+		checkpoint, err := fileSystem.readCheckpoint(saveName)
+		if err != nil {
+			return dir, err
+		}
+		if checkpoint == nil {
+			return dir, missingSaveError(saveName)
 		}
 
-		errors.Check(file.Close())
+		changes = append(changes, checkpoint.Changes...)
+
+		// The file tree follows the first parent
+		saveName = ""
+		if len(checkpoint.Parents) > 0 {
+			saveName = checkpoint.Parents[0]
+		}
 	}
 
 	slices.Reverse(changes)
 
 	for _, change := range changes {
 		normalizedPath, err := dir.NormalizePath(change.GetPath())
-		errors.Check(err)
+		if err != nil {
+			return dir, err
+		}
 
-		dir.AddNode(normalizedPath, &change)
+		if err := dir.AddNode(normalizedPath, change); err != nil {
+			return dir, err
+		}
 	}
 
-	return dir
+	return dir, nil
 }
 
-func (fileSystem *FileSystem) WriteObject(filepath string, file *os.File) *directories.File {
-	var buffer bytes.Buffer
-	chunkBuffer := make([]byte, 1024)
+// GetFileMode returns the mode a working directory entry is tracked with, symlinks are not followed.
+func GetFileMode(info fs.FileInfo) directories.FileMode {
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		return directories.SymlinkMode
+	case info.IsDir():
+		return directories.DirMode
+	case info.Mode()&0111 != 0:
+		return directories.ExecutableMode
+	default:
+		return directories.RegularMode
+	}
+}
 
-	for {
-		n, err := file.Read(chunkBuffer)
+// OpenWorkingFile opens the content stored for a working directory entry: the file content, the symlink
+// target, or nothing for directories.
+func (fileSystem *FileSystem) OpenWorkingFile(filepath string) (io.ReadCloser, directories.FileMode, error) {
+	info, err := fileSystem.Files.Lstat(filepath)
+	if err != nil {
+		return nil, directories.RegularMode, err
+	}
 
-		if err != nil && err != io.EOF {
-			log.Fatal(err)
-		}
-		if n == 0 {
-			break
+	mode := GetFileMode(info)
+
+	switch mode {
+	case directories.SymlinkMode:
+		target, err := fileSystem.Files.Readlink(filepath)
+		if err != nil {
+			return nil, mode, err
 		}
 
-		_, err = buffer.Write(chunkBuffer[:n])
-		errors.Check(err)
+		return io.NopCloser(strings.NewReader(target)), mode, nil
+	case directories.DirMode:
+		return io.NopCloser(strings.NewReader("")), mode, nil
+	}
+
+	file, err := fileSystem.Files.Open(filepath)
+	if err != nil {
+		return nil, mode, err
+	}
+
+	return file, mode, nil
+}
+
+// HashFile streams the working directory entry content through the hash used to name objects.
+func (fileSystem *FileSystem) HashFile(filepath string) (*directories.File, error) {
+	file, mode, err := fileSystem.OpenWorkingFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return nil, err
+	}
+
+	return &directories.File{Filepath: filepath, ObjectName: hex.EncodeToString(hasher.Sum(nil)), Mode: mode}, nil
+}
+
+// WriteObject hashes and compresses the content in a single pass.
+//
+// The object is only committed to the store once its name is known, so a partially written object is never
+// visible under a valid name.
+func (fileSystem *FileSystem) WriteObject(filepath string, file io.Reader) (*directories.File, error) {
+	writer, err := fileSystem.objects.Create()
+	if err != nil {
+		return nil, err
 	}
+	defer writer.Close()
 
 	hasher := sha256.New()
-	_, err := hasher.Write(buffer.Bytes())
-	errors.Check(err)
-	hash := hasher.Sum(nil)
+	compressor := gzip.NewWriter(writer)
 
-	objectName := hex.EncodeToString(hash)
-	objectFile, err := os.Create(Path.Join(fileSystem.Root, REPOSITORY_FOLDER_NAME, OBJECTS_FOLDER_NAME, objectName))
-	errors.Check(err)
-	defer errors.CheckFn(objectFile.Close)
+	if _, err := io.Copy(io.MultiWriter(hasher, compressor), file); err != nil {
+		return nil, err
+	}
+	if err := compressor.Close(); err != nil {
+		return nil, err
+	}
 
-	compressor := gzip.NewWriter(objectFile)
-	_, err = compressor.Write(buffer.Bytes())
-	errors.Check(err)
-	defer errors.CheckFn(compressor.Close)
+	objectName := hex.EncodeToString(hasher.Sum(nil))
+	if err := writer.Commit(objectName); err != nil {
+		return nil, err
+	}
 
-	return &directories.File{Filepath: filepath, ObjectName: objectName}
+	return &directories.File{Filepath: filepath, ObjectName: objectName}, nil
 }
 
-func (fileSystem *FileSystem) RemoveObject(name string) {
-	err := os.Remove(Path.Join(fileSystem.Root, REPOSITORY_FOLDER_NAME, OBJECTS_FOLDER_NAME, name))
-	errors.Check(err)
+// RemoveObject removes a loose object. Packed objects are only removed by repacking, and the objects of a
+// shared store, possibly referenced by other repositories, are kept.
+func (fileSystem *FileSystem) RemoveObject(name string) error {
+	if fileSystem.sharedObjects {
+		return nil
+	}
+
+	return fileSystem.objects.Remove(name)
 }
 
-func (fileSystem *FileSystem) WriteCheckpoint(save *Checkpoint) string {
-	var stringBuilder strings.Builder
+// VerifyObject decompresses the object and checks its content hash against its name.
+func (fileSystem *FileSystem) VerifyObject(name string) error {
+	object, err := fileSystem.openObject(name)
+	if err != nil {
+		return err
+	}
+	defer object.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, object); err != nil {
+		return err
+	}
+
+	if hash := hex.EncodeToString(hasher.Sum(nil)); hash != name {
+		return fmt.Errorf("hash mismatch, content hashes to %s.", hash)
+	}
+
+	return nil
+}
+
+func (fileSystem *FileSystem) listFolder(folderName string) ([]fs.FileInfo, error) {
+	entries, err := fileSystem.Files.ReadDir(Path.Join(fileSystem.Root, REPOSITORY_FOLDER_NAME, folderName))
+	if err != nil {
+		return nil, err
+	}
+
+	infos := []fs.FileInfo{}
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
+// ListObjects lists the loose objects, the whole store when it is shared.
+func (fileSystem *FileSystem) ListObjects() ([]fs.FileInfo, error) {
+	return fileSystem.objects.List()
+}
+
+// TempFile is a temporary file left by an interrupted write, Name is relative to the repository folder.
+type TempFile struct {
+	Name    string
+	ModTime time.Time
+}
+
+// ListTempFiles lists the temporary files of the repository and objects folders. Files being written by
+// another process are listed too.
+func (fileSystem *FileSystem) ListTempFiles() ([]*TempFile, error) {
+	tempFiles := []*TempFile{}
+
+	for _, folderName := range []string{"", OBJECTS_FOLDER_NAME} {
+		infos, err := fileSystem.listFolder(folderName)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, info := range infos {
+			if !info.IsDir() && strings.HasPrefix(info.Name(), TEMP_FILE_PREFIX) {
+				tempFiles = append(tempFiles, &TempFile{Name: Path.Join(folderName, info.Name()), ModTime: info.ModTime()})
+			}
+		}
+	}
+
+	return tempFiles, nil
+}
+
+func (fileSystem *FileSystem) RemoveTempFile(name string) error {
+	err := fileSystem.Files.Remove(fileSystem.repositoryFilePath(name))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
 
-	_, err := stringBuilder.Write([]byte(fmt.Sprintf("%s\n", save.Message)))
-	errors.Check(err)
+func (fileSystem *FileSystem) ListSaves() ([]fs.FileInfo, error) {
+	return fileSystem.listFolder(SAVES_FOLDER_NAME)
+}
 
-	_, err = stringBuilder.Write([]byte(fmt.Sprintf("%s\n", save.Parent)))
-	errors.Check(err)
+func (fileSystem *FileSystem) RemoveSave(name string) error {
+	return fileSystem.Files.Remove(Path.Join(fileSystem.Root, REPOSITORY_FOLDER_NAME, SAVES_FOLDER_NAME, name))
+}
 
-	_, err = stringBuilder.Write([]byte(fmt.Sprintf("%s\n\n", save.CreatedAt.Format(time.Layout))))
-	errors.Check(err)
+func (fileSystem *FileSystem) WriteCheckpoint(save *Checkpoint) (string, error) {
+	var stringBuilder strings.Builder
 
-	_, err = stringBuilder.Write([]byte("Please do not edit the lines below.\n\n\nFiles:\n\n"))
-	errors.Check(err)
+	stringBuilder.WriteString(fmt.Sprintf("%s\n", save.Message))
+	stringBuilder.WriteString(fmt.Sprintf("%s\n", strings.Join(save.Parents, " ")))
+	stringBuilder.WriteString(fmt.Sprintf("%s\n\n", save.CreatedAt.Format(time.Layout)))
+	stringBuilder.WriteString("Please do not edit the lines below.\n\n\nFiles:\n\n")
 
 	for _, change := range save.Changes {
-		if change.ChangeType == directories.Modification {
-			_, err = stringBuilder.Write([]byte(fmt.Sprintf("%s\t%s\n%s\n", change.File.Filepath, directories.MODIFIED_CHANGE, change.File.ObjectName)))
-		} else if change.ChangeType == directories.Creation {
-			_, err = stringBuilder.Write([]byte(fmt.Sprintf("%s\t%s\n%s\n", change.File.Filepath, directories.CREATED_CHANGE, change.File.ObjectName)))
-		} else {
-			_, err = stringBuilder.Write([]byte(fmt.Sprintf("%s\t%s\n", change.Removal.Filepath, directories.REMOVAL_CHANGE)))
+		if change.ChangeType == directories.Conflict {
+			return "", fmt.Errorf("cannot save conflicts.")
 		}
-		errors.Check(err)
+
+		line, err := fileSystem.formatChange(change)
+		if err != nil {
+			return "", err
+		}
+
+		stringBuilder.WriteString(line)
 	}
 
 	saveContent := stringBuilder.String()
 
-	hasher := sha256.New()
-	_, err = hasher.Write([]byte(saveContent))
-	errors.Check(err)
-	hash := hasher.Sum(nil)
+	hash := sha256.Sum256([]byte(saveContent))
+	saveName := hex.EncodeToString(hash[:])
 
-	saveName := hex.EncodeToString(hash)
+	// Saves are written through a rename, so an interrupted write never leaves a truncated save under its name
+	if err := fileSystem.writeFileAtomically(Path.Join(SAVES_FOLDER_NAME, saveName), saveContent); err != nil {
+		return "", err
+	}
 
-	file, err := os.Create(Path.Join(fileSystem.Root, REPOSITORY_FOLDER_NAME, SAVES_FOLDER_NAME, saveName))
-	errors.Check(err)
-	defer errors.CheckFn(file.Close)
+	return saveName, nil
+}
 
-	_, err = file.Write([]byte(saveContent))
-	errors.Check(err)
+func (fileSystem *FileSystem) ParseCheckpoint(id string, file io.Reader) (*Checkpoint, error) {
+	checkpoint, err := parseCheckpoint(id, file)
+	if err != nil {
+		return nil, err
+	}
+	fileSystem.resolveChangesPaths(checkpoint.Changes)
 
-	return saveName
+	return checkpoint, nil
 }
 
-func (fileSystem *FileSystem) ParseCheckpoint(id string, file *os.File) *Checkpoint {
+func parseCheckpoint(id string, file io.Reader) (*Checkpoint, error) {
 	checkpoint := &Checkpoint{}
 	scanner := bufio.NewScanner(file)
 
@@ -453,11 +868,13 @@ func (fileSystem *FileSystem) ParseCheckpoint(id string, file *os.File) *Checkpo
 	checkpoint.Message = scanner.Text()
 
 	scanner.Scan()
-	checkpoint.Parent = scanner.Text()
+	checkpoint.Parents = strings.Fields(scanner.Text())
 
 	scanner.Scan()
 	createdAt, err := time.Parse(time.Layout, scanner.Text())
-	errors.Check(err)
+	if err != nil {
+		return nil, err
+	}
 	checkpoint.CreatedAt = createdAt
 
 	// skip newline
@@ -478,11 +895,20 @@ func (fileSystem *FileSystem) ParseCheckpoint(id string, file *os.File) *Checkpo
 
 		changeHeader := strings.Split(scanner.Text(), "\t")
 
-		if len(changeHeader) != 2 {
-			errors.Error("Invalid save format.")
+		if len(changeHeader) != 2 && !(len(changeHeader) == 3 && changeHeader[1] == directories.RENAMED_CHANGE) {
+			return nil, fmt.Errorf("Invalid save format.")
 		}
 
-		if changeHeader[1] == directories.MODIFIED_CHANGE || changeHeader[1] == directories.CREATED_CHANGE {
+		if changeHeader[1] == directories.RENAMED_CHANGE {
+			change.ChangeType = directories.Rename
+			change.Rename = &directories.FileRename{FromFilepath: changeHeader[2]}
+			change.File = &directories.File{}
+			change.File.Filepath = changeHeader[0]
+			scanner.Scan()
+			if parseStoredObject(scanner.Text(), change.File) != nil {
+				return nil, fmt.Errorf("Invalid save format.")
+			}
+		} else if changeHeader[1] == directories.MODIFIED_CHANGE || changeHeader[1] == directories.CREATED_CHANGE {
 			if changeHeader[1] == directories.MODIFIED_CHANGE {
 				change.ChangeType = directories.Modification
 			} else {
@@ -492,7 +918,9 @@ func (fileSystem *FileSystem) ParseCheckpoint(id string, file *os.File) *Checkpo
 			change.File = &directories.File{}
 			change.File.Filepath = changeHeader[0]
 			scanner.Scan()
-			change.File.ObjectName = scanner.Text()
+			if parseStoredObject(scanner.Text(), change.File) != nil {
+				return nil, fmt.Errorf("Invalid save format.")
+			}
 		} else {
 			change.ChangeType = directories.Removal
 			change.Removal = &directories.FileRemoval{}
@@ -502,124 +930,210 @@ func (fileSystem *FileSystem) ParseCheckpoint(id string, file *os.File) *Checkpo
 		checkpoint.Changes = append(checkpoint.Changes, change)
 	}
 
-	return checkpoint
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return checkpoint, nil
 }
 
-func (fileSystem *FileSystem) ReadSave(checkpointId string) *Save {
-	save := &Save{Id: checkpointId}
+// VerifyCheckpoint parses the save and checks its content hash against its name.
+func (fileSystem *FileSystem) VerifyCheckpoint(checkpointId string) (*Checkpoint, error) {
+	checkpointFile, err := fileSystem.openSave(checkpointId)
+	if err != nil {
+		return nil, err
+	}
+	defer checkpointFile.Close()
 
-	checkpointFile, err := os.Open(Path.Join(fileSystem.Root, REPOSITORY_FOLDER_NAME, SAVES_FOLDER_NAME, checkpointId))
+	content, err := io.ReadAll(checkpointFile)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
-		}
+		return nil, err
+	}
+
+	hash := sha256.Sum256(content)
+
+	if hash := hex.EncodeToString(hash[:]); hash != checkpointId {
+		return nil, fmt.Errorf("hash mismatch, content hashes to %s.", hash)
+	}
 
-		errors.Error(err.Error())
+	checkpoint, err := parseCheckpoint(checkpointId, bytes.NewReader(content))
+	if err != nil {
+		return nil, err
 	}
-	defer errors.CheckFn(checkpointFile.Close)
+	fileSystem.resolveChangesPaths(checkpoint.Changes)
 
-	save.Checkpoints = append(save.Checkpoints, fileSystem.ParseCheckpoint(checkpointId, checkpointFile))
+	return checkpoint, nil
+}
+
+// readCheckpoint returns nil when the save does not exist.
+func (fileSystem *FileSystem) readCheckpoint(checkpointId string) (*Checkpoint, error) {
+	checkpointFile, err := fileSystem.openSave(checkpointId)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
 
-	for save.Checkpoints[len(save.Checkpoints)-1].Parent != "" {
-		checkpointId = save.Checkpoints[len(save.Checkpoints)-1].Parent
-		checkpointFile, err = os.Open(Path.Join(fileSystem.Root, REPOSITORY_FOLDER_NAME, SAVES_FOLDER_NAME, checkpointId))
-		errors.Check(err)
-		save.Checkpoints = append(save.Checkpoints, fileSystem.ParseCheckpoint(checkpointId, checkpointFile))
-		errors.Check(checkpointFile.Close())
+		return nil, err
 	}
+	defer checkpointFile.Close()
 
-	slices.Reverse(save.Checkpoints)
+	checkpoint, err := fileSystem.ParseCheckpoint(checkpointId, checkpointFile)
+	if err != nil {
+		return nil, &CorruptError{fmt.Sprintf("save \"%s\"", checkpointId), "has an invalid format."}
+	}
 
-	return save
+	return checkpoint, nil
 }
 
-func (fileSystem *FileSystem) ReadDirFile(file *directories.File) bytes.Buffer {
-	objectFile, err := os.Open(Path.Join(fileSystem.Root, REPOSITORY_FOLDER_NAME, OBJECTS_FOLDER_NAME, file.ObjectName))
-	errors.Check(err)
-	defer errors.CheckFn(objectFile.Close)
+// ReadSave returns nil when the save does not exist, and an error when one of its parents is missing.
+func (fileSystem *FileSystem) ReadSave(checkpointId string) (*Save, error) {
+	checkpoint, err := fileSystem.readCheckpoint(checkpointId)
+	if checkpoint == nil || err != nil {
+		return nil, err
+	}
+
+	save := &Save{Id: checkpointId}
+	checkpointsMap := map[string]*Checkpoint{checkpointId: checkpoint}
+	emitted := make(map[string]bool)
+
+	// Post-order depth-first traversal, parents are emitted before their children.
+	// Parents are visited in order, so the first parent history comes first.
+	type frame struct {
+		checkpoint *Checkpoint
+		parentIdx  int
+	}
+	stack := []*frame{{checkpoint: checkpoint}}
 
-	decompressor, err := gzip.NewReader(objectFile)
-	errors.Check(err)
-	defer errors.CheckFn(decompressor.Close)
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
 
-	var buffer bytes.Buffer
-	tmpBuffer := make([]byte, 128)
+		if top.parentIdx == len(top.checkpoint.Parents) {
+			stack = stack[:len(stack)-1]
+			save.Checkpoints = append(save.Checkpoints, top.checkpoint)
+			emitted[top.checkpoint.Id] = true
+			continue
+		}
 
-	for {
-		n, err := decompressor.Read(tmpBuffer)
+		parentId := top.checkpoint.Parents[top.parentIdx]
+		top.parentIdx++
 
-		if err != nil && err != io.EOF {
-			errors.Error(err.Error())
+		if _, ok := checkpointsMap[parentId]; ok {
+			// Already visited through another path
+			continue
 		}
-		if n == 0 {
-			break
+
+		parent, err := fileSystem.readCheckpoint(parentId)
+		if err != nil {
+			return nil, err
+		}
+		if parent == nil {
+			return nil, missingSaveError(parentId)
 		}
 
-		buffer.Write(tmpBuffer[:n])
+		checkpointsMap[parentId] = parent
+		stack = append(stack, &frame{checkpoint: parent})
 	}
 
-	return buffer
+	return save, nil
+}
+
+func (fileSystem *FileSystem) ReadDirFile(file *directories.File) (bytes.Buffer, error) {
+	var buffer bytes.Buffer
+
+	err := fileSystem.copyDirFile(file, &buffer)
+
+	return buffer, err
 }
 
-func (fileSystem *FileSystem) createFile(file *directories.File) {
-	sourceFile, err := os.OpenFile(file.Filepath, os.O_WRONLY|os.O_TRUNC, USER_FILES_PERMISSIONS)
+// copyDirFile streams the file content straight from its object into writer.
+func (fileSystem *FileSystem) copyDirFile(file *directories.File, writer io.Writer) error {
+	decompressor, err := fileSystem.openObject(file.ObjectName)
 	if err != nil {
-		if !os.IsNotExist(err) {
-			errors.Error(err.Error())
+		if os.IsNotExist(err) {
+			return missingObjectError(file.ObjectName)
 		}
 
-		sourceFile, err = os.Create(file.Filepath)
-		errors.Check(err)
+		return err
 	}
-	defer errors.CheckFn(sourceFile.Close)
+	defer decompressor.Close()
 
-	objectFile, err := os.Open(Path.Join(fileSystem.Root, REPOSITORY_FOLDER_NAME, OBJECTS_FOLDER_NAME, file.ObjectName))
-	errors.Check(err)
-	defer errors.CheckFn(objectFile.Close)
+	_, err = io.Copy(writer, decompressor)
 
-	decompressor, err := gzip.NewReader(objectFile)
-	errors.Check(err)
-	defer errors.CheckFn(decompressor.Close)
-
-	buffer := make([]byte, 256)
+	return err
+}
 
-	for {
-		n, err := decompressor.Read(buffer)
+func (fileSystem *FileSystem) createFile(file *directories.File) error {
+	permissions := os.FileMode(REGULAR_FILES_PERMISSIONS)
+	if file.Mode == directories.ExecutableMode {
+		permissions = EXECUTABLE_FILES_PERMISSIONS
+	}
 
-		if err != nil && err != io.EOF {
-			errors.Error(err.Error())
-		}
-		if n == 0 {
-			break
+	if info, err := fileSystem.Files.Lstat(file.Filepath); err == nil && !info.Mode().IsRegular() {
+		// A symlink or directory is replaced, symlinks are not followed
+		if err := fileSystem.Files.RemoveAll(file.Filepath); err != nil {
+			return err
 		}
+	}
 
-		_, err = sourceFile.Write(buffer[:n])
-		errors.Check(err)
+	sourceFile, err := fileSystem.Files.OpenFile(file.Filepath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, permissions)
+	if err != nil {
+		return err
+	}
+	defer sourceFile.Close()
+
+	if err := fileSystem.copyDirFile(file, sourceFile); err != nil {
+		return err
+	}
+	// The permissions of existing files are not changed by OpenFile
+	if err := sourceFile.Chmod(permissions); err != nil {
+		return err
+	}
+
+	return sourceFile.Close()
+}
+
+func (fileSystem *FileSystem) createSymlink(file *directories.File) error {
+	target, err := fileSystem.ReadDirFile(file)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fileSystem.Files.Lstat(file.Filepath); err == nil {
+		if err := fileSystem.Files.RemoveAll(file.Filepath); err != nil {
+			return err
+		}
 	}
+
+	return fileSystem.Files.Symlink(target.String(), file.Filepath)
 }
 
-func (fileSystem *FileSystem) CreateNode(node *directories.Node) {
+func (fileSystem *FileSystem) CreateNode(node *directories.Node) error {
 	if node.NodeType == directories.FileType {
-		fileSystem.createFile(node.File)
-		return
+		switch node.File.Mode {
+		case directories.SymlinkMode:
+			return fileSystem.createSymlink(node.File)
+		case directories.DirMode:
+			return fileSystem.Files.MkdirAll(node.File.Filepath, USER_FILES_PERMISSIONS)
+		default:
+			return fileSystem.createFile(node.File)
+		}
 	}
 
-	err := os.Mkdir(node.Dir.Path, USER_FILES_PERMISSIONS)
-	errors.Check(err)
+	return fileSystem.Files.Mkdir(node.Dir.Path, USER_FILES_PERMISSIONS)
 }
 
 // Safely remove a directory
 //
 // This helper prevents the .repository dir to be removed
-func (fileSystem *FileSystem) SafeRemoveWorkingDir(path string) {
+func (fileSystem *FileSystem) SafeRemoveWorkingDir(path string) error {
 	if path != fileSystem.Root {
-		err := os.RemoveAll(path)
-		errors.Check(err)
-		return
+		return fileSystem.Files.RemoveAll(path)
 	}
 
-	entries, err := os.ReadDir(fileSystem.Root)
-	errors.Check(err)
+	entries, err := fileSystem.Files.ReadDir(fileSystem.Root)
+	if err != nil {
+		return err
+	}
 
 	for _, entry := range entries {
 		if entry.Name() == REPOSITORY_FOLDER_NAME {
@@ -629,11 +1143,14 @@ func (fileSystem *FileSystem) SafeRemoveWorkingDir(path string) {
 		filepath := Path.Join(fileSystem.Root, entry.Name())
 
 		if entry.IsDir() {
-			err := os.RemoveAll(filepath)
-			errors.Check(err)
+			err = fileSystem.Files.RemoveAll(filepath)
 		} else {
-			err := os.Remove(filepath)
-			errors.Check(err)
+			err = fileSystem.Files.Remove(filepath)
+		}
+		if err != nil {
+			return err
 		}
 	}
+
+	return nil
 }
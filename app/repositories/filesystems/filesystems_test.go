@@ -1,35 +1,44 @@
 package filesystems
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	Path "path/filepath"
+	"saymow/version-manager/app/pkg/vfs"
 	"saymow/version-manager/app/repositories/directories"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"gotest.tools/v3/fs"
 )
 
 func TestSaveContains(t *testing.T) {
 	s0 := &Checkpoint{
 		Id:        "s0",
-		Parent:    "",
+		Parents:   []string{},
 		CreatedAt: time.Now(),
 		Changes:   []*directories.Change{},
 	}
 	s1 := &Checkpoint{
 		Id:        "s1",
-		Parent:    "s0",
+		Parents:   []string{"s0"},
 		CreatedAt: time.Now(),
 		Changes:   []*directories.Change{},
 	}
 	s2 := &Checkpoint{
 		Id:        "s2",
-		Parent:    "s1",
+		Parents:   []string{"s1"},
 		CreatedAt: time.Now(),
 		Changes:   []*directories.Change{},
 	}
 	s3 := &Checkpoint{
 		Id:        "s3",
-		Parent:    "s2",
+		Parents:   []string{"s2"},
 		CreatedAt: time.Now(),
 		Changes:   []*directories.Change{},
 	}
@@ -265,13 +274,13 @@ func TestSaveContains(t *testing.T) {
 func TestSaveFindFirstCommonParent(t *testing.T) {
 	s0 := &Checkpoint{
 		Id:        "s0",
-		Parent:    "",
+		Parents:   []string{},
 		CreatedAt: time.Now(),
 		Changes:   []*directories.Change{},
 	}
 	s1 := &Checkpoint{
 		Id:        "s1",
-		Parent:    "s0",
+		Parents:   []string{"s0"},
 		CreatedAt: time.Now(),
 		Changes:   []*directories.Change{},
 	}
@@ -280,19 +289,19 @@ func TestSaveFindFirstCommonParent(t *testing.T) {
 
 	as2 := &Checkpoint{
 		Id:        "as2",
-		Parent:    "s1",
+		Parents:   []string{"s1"},
 		CreatedAt: time.Now(),
 		Changes:   []*directories.Change{},
 	}
 	as3 := &Checkpoint{
 		Id:        "as3",
-		Parent:    "as2",
+		Parents:   []string{"as2"},
 		CreatedAt: time.Now(),
 		Changes:   []*directories.Change{},
 	}
 	as4 := &Checkpoint{
 		Id:        "as4",
-		Parent:    "as3",
+		Parents:   []string{"as3"},
 		CreatedAt: time.Now(),
 		Changes:   []*directories.Change{},
 	}
@@ -301,13 +310,13 @@ func TestSaveFindFirstCommonParent(t *testing.T) {
 
 	bs2 := &Checkpoint{
 		Id:        "bs2",
-		Parent:    "s1",
+		Parents:   []string{"s1"},
 		CreatedAt: time.Now(),
 		Changes:   []*directories.Change{},
 	}
 	bs3 := &Checkpoint{
 		Id:        "bs3",
-		Parent:    "bs2",
+		Parents:   []string{"bs2"},
 		CreatedAt: time.Now(),
 		Changes:   []*directories.Change{},
 	}
@@ -506,3 +515,519 @@ func TestSaveFindFirstCommonParent(t *testing.T) {
 		),
 	)
 }
+
+func TestSaveMergeHistory(t *testing.T) {
+	s0 := &Checkpoint{Id: "s0", Parents: []string{}, Changes: []*directories.Change{}}
+	s1 := &Checkpoint{Id: "s1", Parents: []string{"s0"}, Changes: []*directories.Change{}}
+
+	// branch a
+
+	as2 := &Checkpoint{Id: "as2", Parents: []string{"s1"}, Changes: []*directories.Change{}}
+	as3 := &Checkpoint{Id: "as3", Parents: []string{"as2"}, Changes: []*directories.Change{}}
+
+	// branch b
+
+	bs2 := &Checkpoint{Id: "bs2", Parents: []string{"s1"}, Changes: []*directories.Change{}}
+	bs3 := &Checkpoint{Id: "bs3", Parents: []string{"bs2"}, Changes: []*directories.Change{}}
+
+	// b merged into a
+
+	am4 := &Checkpoint{Id: "am4", Parents: []string{"as3", "bs2"}, Changes: []*directories.Change{}}
+	as5 := &Checkpoint{Id: "as5", Parents: []string{"am4"}, Changes: []*directories.Change{}}
+
+	save := &Save{
+		Id:          "as5",
+		Checkpoints: []*Checkpoint{s0, s1, as2, as3, bs2, am4, as5},
+	}
+
+	assert.True(t, am4.IsMerge())
+	assert.False(t, as5.IsMerge())
+	assert.Equal(t, save.FirstParentCheckpoints(), []*Checkpoint{s0, s1, as2, as3, am4, as5})
+	assert.True(t, save.Contains(&Save{Id: "bs2", Checkpoints: []*Checkpoint{s0, s1, bs2}}))
+	assert.False(t, save.Contains(&Save{Id: "bs3", Checkpoints: []*Checkpoint{s0, s1, bs2, bs3}}))
+	assert.Equal(
+		t,
+		save.FindFirstCommonCheckpointParent(&Save{Id: "bs3", Checkpoints: []*Checkpoint{s0, s1, bs2, bs3}}),
+		bs2,
+	)
+}
+
+func TestWriteObject(t *testing.T) {
+	dir := fs.NewDir(t, "project")
+	defer dir.Remove()
+
+	fileSystem, err := Create(vfs.NewOS(), dir.Path())
+	assert.Nil(t, err)
+	content := bytes.Repeat([]byte("streamed content\n"), 10000)
+	hash := sha256.Sum256(content)
+
+	file, err := fileSystem.WriteObject(dir.Join("1.txt"), bytes.NewReader(content))
+	assert.Nil(t, err)
+	assert.Equal(t, file.ObjectName, hex.EncodeToString(hash[:]))
+	assert.Equal(t, file.Filepath, dir.Join("1.txt"))
+
+	// Temporary files are renamed into place
+	entries, err := os.ReadDir(dir.Join(REPOSITORY_FOLDER_NAME, OBJECTS_FOLDER_NAME))
+	assert.Nil(t, err)
+	assert.Equal(t, len(entries), 1)
+	assert.Equal(t, entries[0].Name(), file.ObjectName)
+	assert.Nil(t, fileSystem.VerifyObject(file.ObjectName))
+
+	// Writing the same content again keeps a single object
+	_, err = fileSystem.WriteObject(dir.Join("2.txt"), bytes.NewReader(content))
+	assert.Nil(t, err)
+	entries, err = os.ReadDir(dir.Join(REPOSITORY_FOLDER_NAME, OBJECTS_FOLDER_NAME))
+	assert.Nil(t, err)
+	assert.Equal(t, len(entries), 1)
+
+	buffer, err := fileSystem.ReadDirFile(file)
+	assert.Nil(t, err)
+	assert.Equal(t, buffer.Bytes(), content)
+
+	assert.Nil(t, fileSystem.createFile(file))
+	restoredContent, err := os.ReadFile(file.Filepath)
+	assert.Nil(t, err)
+	assert.Equal(t, restoredContent, content)
+
+	fileHash, err := fileSystem.HashFile(file.Filepath)
+	assert.Nil(t, err)
+	assert.Equal(t, fileHash.ObjectName, file.ObjectName)
+
+	_, err = fileSystem.HashFile(Path.Join(dir.Path(), "missing.txt"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// Removing a missing loose object is a no-op
+	assert.Nil(t, fileSystem.RemoveObject(file.ObjectName))
+	assert.Nil(t, fileSystem.RemoveObject(file.ObjectName))
+
+	// Reading a missing object is a corruption
+	_, err = fileSystem.ReadDirFile(file)
+	var corruptErr *CorruptError
+	assert.ErrorAs(t, err, &corruptErr)
+	assert.EqualError(t, err, fmt.Sprintf("Corruption Error: object \"%s\" is missing.", file.ObjectName))
+}
+
+func TestStatCache(t *testing.T) {
+	dir := fs.NewDir(t, "project", fs.WithFile("1.txt", "1 content"), fs.WithFile("2.txt", "2 content"))
+	defer dir.Remove()
+
+	fileSystem, err := Create(vfs.NewOS(), dir.Path())
+	assert.Nil(t, err)
+	past := time.Now().Add(-time.Hour)
+	assert.Nil(t, os.Chtimes(dir.Join("1.txt"), past, past))
+	assert.Nil(t, os.Chtimes(dir.Join("2.txt"), past, past))
+
+	hashOf := func(content string) string {
+		hash := sha256.Sum256([]byte(content))
+		return hex.EncodeToString(hash[:])
+	}
+
+	cache, err := fileSystem.ReadStatCache()
+	assert.Nil(t, err)
+	hash, err := cache.Hash(dir.Join("1.txt"))
+	assert.Nil(t, err)
+	assert.Equal(t, hash.ObjectName, hashOf("1 content"))
+	_, err = cache.Hash(dir.Join("2.txt"))
+	assert.Nil(t, err)
+	assert.Equal(t, cache.hashedFiles, 2)
+	assert.Nil(t, fileSystem.WriteStatCache(cache))
+
+	// Unchanged files are not read again
+	{
+		cache, err := fileSystem.ReadStatCache()
+		assert.Nil(t, err)
+		hash, err := cache.Hash(dir.Join("1.txt"))
+		assert.Nil(t, err)
+		assert.Equal(t, hash.ObjectName, hashOf("1 content"))
+		assert.Equal(t, cache.hashedFiles, 0)
+		assert.Nil(t, fileSystem.WriteStatCache(cache))
+	}
+
+	// Entries that are not used are dropped
+	{
+		cache, err := fileSystem.ReadStatCache()
+		assert.Nil(t, err)
+		assert.Equal(t, len(cache.entries), 1)
+	}
+
+	// Changed files are read again
+	{
+		assert.Nil(t, os.WriteFile(dir.Join("1.txt"), []byte("1 changed"), 0644))
+		assert.Nil(t, os.Chtimes(dir.Join("1.txt"), past, past))
+
+		cache, err := fileSystem.ReadStatCache()
+		assert.Nil(t, err)
+		hash, err := cache.Hash(dir.Join("1.txt"))
+		assert.Nil(t, err)
+		assert.Equal(t, hash.ObjectName, hashOf("1 changed"))
+		assert.Equal(t, cache.hashedFiles, 1)
+		assert.Nil(t, fileSystem.WriteStatCache(cache))
+	}
+
+	// Racy entries, not older than the cache, are read again
+	{
+		future := time.Now().Add(time.Hour)
+		assert.Nil(t, os.Chtimes(dir.Join("1.txt"), future, future))
+
+		cache, err := fileSystem.ReadStatCache()
+		assert.Nil(t, err)
+		cache.Hash(dir.Join("1.txt"))
+		assert.Nil(t, fileSystem.WriteStatCache(cache))
+
+		cache, err = fileSystem.ReadStatCache()
+		assert.Nil(t, err)
+		hash, err := cache.Hash(dir.Join("1.txt"))
+		assert.Nil(t, err)
+		assert.Equal(t, hash.ObjectName, hashOf("1 changed"))
+		assert.Equal(t, cache.hashedFiles, 1)
+	}
+
+	// The cache is not written while another process holds the lock
+	{
+		other, err := Open(vfs.NewOS(), dir.Path())
+		assert.Nil(t, err)
+		assert.Nil(t, other.Lock(LOCK_TIMEOUT))
+
+		cache, err := fileSystem.ReadStatCache()
+		assert.Nil(t, err)
+		cache.Hash(dir.Join("2.txt"))
+		assert.Nil(t, fileSystem.WriteStatCache(cache))
+		assert.Nil(t, other.Unlock())
+
+		cache, err = fileSystem.ReadStatCache()
+		assert.Nil(t, err)
+		assert.NotNil(t, cache.entries[dir.Join("1.txt")])
+		assert.Nil(t, cache.entries[dir.Join("2.txt")])
+		assert.False(t, fileSystem.IsLocked())
+	}
+
+	// An invalid cache is ignored
+	{
+		assert.Nil(t, os.WriteFile(dir.Join(REPOSITORY_FOLDER_NAME, STAT_CACHE_FILE_NAME), []byte("invalid"), 0644))
+
+		cache, err := fileSystem.ReadStatCache()
+		assert.Nil(t, err)
+		assert.Equal(t, len(cache.entries), 0)
+	}
+}
+
+func TestRenameChanges(t *testing.T) {
+	dir := fs.NewDir(t, "project")
+	defer dir.Remove()
+
+	fileSystem, err := Create(vfs.NewOS(), dir.Path())
+	assert.Nil(t, err)
+	changes := []*directories.Change{
+		{
+			ChangeType: directories.Rename,
+			File:       &directories.File{Filepath: dir.Join("a", "2.txt"), ObjectName: "1"},
+			Rename:     &directories.FileRename{FromFilepath: dir.Join("1.txt")},
+		},
+		{ChangeType: directories.Removal, Removal: &directories.FileRemoval{Filepath: dir.Join("3.txt")}},
+	}
+
+	// Paths are stored relative to the root in the index and saves
+	assert.Nil(t, fileSystem.SaveIndex(changes))
+	index, err := fileSystem.ReadIndex()
+	assert.Nil(t, err)
+	assert.Equal(t, index, changes)
+
+	content, err := os.ReadFile(dir.Join(REPOSITORY_FOLDER_NAME, INDEX_FILE_NAME))
+	assert.Nil(t, err)
+	assert.Equal(t, string(content), "Tracked files:\n\na/2.txt\t(renamed)\t1.txt\n1\n3.txt\t(removed)\n")
+
+	checkpointId, err := fileSystem.WriteCheckpoint(&Checkpoint{Message: "rename", Parents: []string{}, CreatedAt: time.Now(), Changes: changes})
+	assert.Nil(t, err)
+	checkpoint, err := fileSystem.VerifyCheckpoint(checkpointId)
+	assert.Nil(t, err)
+	assert.Equal(t, checkpoint.Changes, changes)
+
+	// Saves are written through a temporary file
+	info, err := os.Stat(dir.Join(REPOSITORY_FOLDER_NAME, SAVES_FOLDER_NAME, checkpointId))
+	assert.Nil(t, err)
+	assert.Equal(t, info.Mode().Perm(), os.FileMode(0644))
+	tempFiles, err := Path.Glob(dir.Join(REPOSITORY_FOLDER_NAME, TEMP_FILE_PREFIX+"*"))
+	assert.Nil(t, err)
+	assert.Equal(t, len(tempFiles), 0)
+}
+
+func TestFileModes(t *testing.T) {
+	dir := fs.NewDir(t, "project", fs.WithFile("1.txt", "1 content"), fs.WithFile("run.sh", "echo", fs.WithMode(0755)), fs.WithDir("empty"))
+	defer dir.Remove()
+
+	fileSystem, err := Create(vfs.NewOS(), dir.Path())
+	assert.Nil(t, err)
+	assert.Nil(t, os.Symlink("1.txt", dir.Join("link")))
+
+	changes := []*directories.Change{}
+	for _, name := range []string{"1.txt", "empty", "link", "run.sh"} {
+		file, mode, err := fileSystem.OpenWorkingFile(dir.Join(name))
+		assert.Nil(t, err)
+
+		object, err := fileSystem.WriteObject(dir.Join(name), file)
+		assert.Nil(t, err)
+		object.Mode = mode
+		assert.Nil(t, file.Close())
+
+		changes = append(changes, &directories.Change{ChangeType: directories.Creation, File: object})
+	}
+
+	assert.Equal(t, changes[0].File.Mode, directories.RegularMode)
+	assert.Equal(t, changes[1].File.Mode, directories.DirMode)
+	assert.Equal(t, changes[2].File.Mode, directories.SymlinkMode)
+	assert.Equal(t, changes[3].File.Mode, directories.ExecutableMode)
+
+	// Symlinks are not followed, their target is stored
+	buffer, err := fileSystem.ReadDirFile(changes[2].File)
+	assert.Nil(t, err)
+	assert.Equal(t, buffer.String(), "1.txt")
+
+	// Modes are written next to the object name, except for regular files
+	assert.Nil(t, fileSystem.SaveIndex(changes))
+	index, err := fileSystem.ReadIndex()
+	assert.Nil(t, err)
+	assert.Equal(t, index, changes)
+
+	content, err := os.ReadFile(dir.Join(REPOSITORY_FOLDER_NAME, INDEX_FILE_NAME))
+	assert.Nil(t, err)
+	assert.Equal(
+		t,
+		string(content),
+		fmt.Sprintf(
+			"Tracked files:\n\n1.txt\t(created)\n%s\nempty\t(created)\n%s\t040000\nlink\t(created)\n%s\t120000\nrun.sh\t(created)\n%s\t100755\n",
+			changes[0].File.ObjectName, changes[1].File.ObjectName, changes[2].File.ObjectName, changes[3].File.ObjectName,
+		),
+	)
+
+	checkpointId, err := fileSystem.WriteCheckpoint(&Checkpoint{Message: "modes", Parents: []string{}, CreatedAt: time.Now(), Changes: changes})
+	assert.Nil(t, err)
+	checkpoint, err := fileSystem.VerifyCheckpoint(checkpointId)
+	assert.Nil(t, err)
+	assert.Equal(t, checkpoint.Changes, changes)
+
+	// Files are created with their mode
+	assert.Nil(t, os.RemoveAll(dir.Join("empty")))
+	assert.Nil(t, os.Remove(dir.Join("link")))
+	assert.Nil(t, os.Chmod(dir.Join("run.sh"), 0644))
+
+	for _, change := range changes {
+		assert.Nil(t, fileSystem.CreateNode(&directories.Node{NodeType: directories.FileType, File: change.File}))
+	}
+
+	info, err := os.Lstat(dir.Join("empty"))
+	assert.Nil(t, err)
+	assert.True(t, info.IsDir())
+	target, err := os.Readlink(dir.Join("link"))
+	assert.Nil(t, err)
+	assert.Equal(t, target, "1.txt")
+	info, err = os.Stat(dir.Join("run.sh"))
+	assert.Nil(t, err)
+	assert.Equal(t, info.Mode().Perm(), os.FileMode(EXECUTABLE_FILES_PERMISSIONS))
+	info, err = os.Stat(dir.Join("1.txt"))
+	assert.Nil(t, err)
+	assert.Equal(t, info.Mode().Perm(), os.FileMode(REGULAR_FILES_PERMISSIONS))
+}
+
+func TestCorruptFiles(t *testing.T) {
+	dir := fs.NewDir(t, "project")
+	defer dir.Remove()
+
+	fileSystem, err := Create(vfs.NewOS(), dir.Path())
+	assert.Nil(t, err)
+	var corruptErr *CorruptError
+
+	assert.Nil(t, os.WriteFile(dir.Join(REPOSITORY_FOLDER_NAME, INDEX_FILE_NAME), []byte("Tracked files:\n\n1.txt\t(unknown)\n"), 0644))
+	_, err = fileSystem.ReadIndex()
+	assert.ErrorAs(t, err, &corruptErr)
+	assert.EqualError(t, err, "Corruption Error: index has an invalid format.")
+
+	assert.Nil(t, os.WriteFile(dir.Join(REPOSITORY_FOLDER_NAME, REFS_FILE_NAME), []byte("Refs:\n\nmaster\n"), 0644))
+	_, err = fileSystem.ReadRefs()
+	assert.ErrorAs(t, err, &corruptErr)
+
+	assert.Nil(t, os.WriteFile(dir.Join(REPOSITORY_FOLDER_NAME, VERSION_FILE_NAME), []byte("two"), 0644))
+	_, err = fileSystem.ReadVersion()
+	assert.ErrorAs(t, err, &corruptErr)
+
+	// Missing saves are only an error when referenced by another save
+	save, err := fileSystem.ReadSave("missing")
+	assert.Nil(t, err)
+	assert.Nil(t, save)
+
+	checkpointId, err := fileSystem.WriteCheckpoint(&Checkpoint{Message: "orphan", Parents: []string{"missing"}, CreatedAt: time.Now()})
+	assert.Nil(t, err)
+	_, err = fileSystem.ReadSave(checkpointId)
+	assert.EqualError(t, err, "Corruption Error: save \"missing\" is missing.")
+	_, err = fileSystem.ReadDir(checkpointId)
+	assert.ErrorAs(t, err, &corruptErr)
+
+	assert.Nil(t, os.WriteFile(dir.Join(REPOSITORY_FOLDER_NAME, SAVES_FOLDER_NAME, "invalid"), []byte("message\n\nnot a date\n"), 0644))
+	_, err = fileSystem.ReadSave("invalid")
+	assert.EqualError(t, err, "Corruption Error: save \"invalid\" has an invalid format.")
+}
+
+func TestLock(t *testing.T) {
+	dir := fs.NewDir(t, "project")
+	defer dir.Remove()
+
+	fileSystem, err := Create(vfs.NewOS(), dir.Path())
+	assert.Nil(t, err)
+	other, err := Open(vfs.NewOS(), dir.Path())
+	assert.Nil(t, err)
+
+	assert.Nil(t, fileSystem.Lock(LOCK_TIMEOUT))
+	assert.Nil(t, fileSystem.WriteHead("other"))
+	assert.Nil(t, fileSystem.WriteMergeHead("save"))
+
+	// Writes are only visible to other processes once committed
+	head, err := fileSystem.ReadHead()
+	assert.Nil(t, err)
+	assert.Equal(t, head, "other")
+	head, err = other.ReadHead()
+	assert.Nil(t, err)
+	assert.Equal(t, head, INITIAL_REF_NAME)
+
+	err = other.Lock(50 * time.Millisecond)
+	var lockedErr *LockedError
+	assert.ErrorAs(t, err, &lockedErr)
+	assert.Equal(t, lockedErr.Pid, os.Getpid())
+
+	assert.Nil(t, fileSystem.Commit())
+	head, err = other.ReadHead()
+	assert.Nil(t, err)
+	assert.Equal(t, head, "other")
+	_, err = os.Stat(dir.Join(REPOSITORY_FOLDER_NAME, LOCK_FILE_NAME))
+	assert.True(t, os.IsNotExist(err))
+
+	// Unlocking discards the writes
+	assert.Nil(t, other.Lock(LOCK_TIMEOUT))
+	assert.Nil(t, other.WriteHead("discarded"))
+	assert.Nil(t, other.RemoveMergeHead())
+	mergeHead, err := other.ReadMergeHead()
+	assert.Nil(t, err)
+	assert.Equal(t, mergeHead, "")
+	assert.Nil(t, other.Unlock())
+
+	head, err = fileSystem.ReadHead()
+	assert.Nil(t, err)
+	assert.Equal(t, head, "other")
+	mergeHead, err = fileSystem.ReadMergeHead()
+	assert.Nil(t, err)
+	assert.Equal(t, mergeHead, "save")
+}
+
+func TestStaleLock(t *testing.T) {
+	dir := fs.NewDir(t, "project")
+	defer dir.Remove()
+
+	fileSystem, err := Create(vfs.NewOS(), dir.Path())
+	assert.Nil(t, err)
+	lockPath := dir.Join(REPOSITORY_FOLDER_NAME, LOCK_FILE_NAME)
+	hostname, err := os.Hostname()
+	assert.Nil(t, err)
+
+	process := exec.Command("true")
+	assert.Nil(t, process.Run())
+	deadPid := process.Process.Pid
+
+	writeLock := func(content string) {
+		assert.Nil(t, os.WriteFile(lockPath, []byte(content), 0644))
+	}
+
+	// Locks of exited processes are taken over
+	writeLock(fmt.Sprintf("%d %s %d locked\n", deadPid, hostname, time.Now().UnixNano()))
+	assert.Nil(t, fileSystem.Lock(0))
+	assert.Nil(t, fileSystem.Unlock())
+
+	// Their interrupted commits are completed first
+	assert.Nil(t, os.WriteFile(dir.Join(REPOSITORY_FOLDER_NAME, HEAD_FILE_NAME+PENDING_FILE_SUFFIX), []byte("recovered"), 0644))
+	writeLock(fmt.Sprintf("%d %s %d committing write:%s\n", deadPid, hostname, time.Now().UnixNano(), HEAD_FILE_NAME))
+	var head string
+	assert.Nil(t, fileSystem.ReadSnapshot(func() (err error) {
+		head, err = fileSystem.ReadHead()
+		return err
+	}))
+	assert.Equal(t, head, "recovered")
+	_, err = os.Stat(lockPath)
+	assert.True(t, os.IsNotExist(err))
+
+	// Processes of other hosts cannot be checked
+	var lockedErr *LockedError
+	writeLock(fmt.Sprintf("%d other-host %d locked\n", deadPid, time.Now().UnixNano()))
+	assert.ErrorAs(t, fileSystem.Lock(0), &lockedErr)
+	assert.Equal(t, lockedErr.Hostname, "other-host")
+
+	// Unreadable locks may be being written
+	writeLock("")
+	assert.ErrorAs(t, fileSystem.Lock(0), &lockedErr)
+	assert.Nil(t, os.Chtimes(lockPath, time.Now(), time.Now().Add(-2*LOCK_WRITE_GRACE)))
+	assert.Nil(t, fileSystem.Lock(0))
+	assert.Nil(t, fileSystem.Unlock())
+
+	// Stale locks are recovered by the process holding the claim
+	claimPath := dir.Join(REPOSITORY_FOLDER_NAME, LOCK_CLAIM_FILE_NAME)
+	staleLock := fmt.Sprintf("%d %s %d locked\n", deadPid, hostname, time.Now().UnixNano())
+	writeLock(staleLock)
+	assert.Nil(t, os.WriteFile(claimPath, []byte(fmt.Sprintf("%d %s %d locked\n%s", os.Getpid(), hostname, time.Now().UnixNano(), staleLock)), 0644))
+	assert.ErrorAs(t, fileSystem.Lock(0), &lockedErr)
+	assert.Equal(t, lockedErr.Pid, deadPid)
+
+	// Claims of exited processes are taken over
+	assert.Nil(t, os.WriteFile(claimPath, []byte(fmt.Sprintf("%d %s %d locked\n%s", deadPid, hostname, time.Now().UnixNano(), staleLock)), 0644))
+	assert.Nil(t, fileSystem.Lock(time.Second))
+	assert.Nil(t, fileSystem.Unlock())
+	_, err = os.Stat(claimPath)
+	assert.True(t, os.IsNotExist(err))
+
+	// A lock recovered and taken again since it was read as stale is kept
+	liveLock := fmt.Sprintf("%d %s %d locked\n", os.Getpid(), hostname, time.Now().UnixNano())
+	writeLock(liveLock)
+	claimed, err := fileSystem.claimStaleLock([]byte(staleLock))
+	assert.Nil(t, err)
+	assert.True(t, claimed)
+	assert.Nil(t, fileSystem.removeStaleLock(nil, []byte(staleLock)))
+	content, err := os.ReadFile(lockPath)
+	assert.Nil(t, err)
+	assert.Equal(t, string(content), liveLock)
+
+	// Only one process claims it
+	claimed, err = fileSystem.claimStaleLock([]byte(staleLock))
+	assert.Nil(t, err)
+	assert.False(t, claimed)
+}
+
+func TestReadSnapshot(t *testing.T) {
+	dir := fs.NewDir(t, "project")
+	defer dir.Remove()
+
+	fileSystem, err := Create(vfs.NewOS(), dir.Path())
+	assert.Nil(t, err)
+	writer, err := Open(vfs.NewOS(), dir.Path())
+	assert.Nil(t, err)
+
+	attempts := 0
+	var head string
+	var refs *Refs
+
+	assert.Nil(t, fileSystem.ReadSnapshot(func() (err error) {
+		attempts++
+		if head, err = fileSystem.ReadHead(); err != nil {
+			return err
+		}
+
+		// Another process commits between the reads
+		if attempts == 1 {
+			assert.Nil(t, writer.Lock(LOCK_TIMEOUT))
+			assert.Nil(t, writer.WriteHead("other"))
+			assert.Nil(t, writer.WriteRefs(&Refs{INITIAL_REF_NAME: "", "other": ""}))
+			assert.Nil(t, writer.Commit())
+		}
+
+		refs, err = fileSystem.ReadRefs()
+		return err
+	}))
+
+	assert.Equal(t, attempts, 2)
+	assert.Equal(t, head, "other")
+	assert.Equal(t, *refs, Refs{INITIAL_REF_NAME: "", "other": ""})
+}
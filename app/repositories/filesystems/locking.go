@@ -0,0 +1,561 @@
+package filesystems
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	Path "path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Commands modifying the repository hold the lock file, they are exclusive. Their repository files
+// writes are kept pending until they commit, so readers, which do not lock, never see half of them.
+//
+// A commit first writes the pending files next to their destination, then marks the lock as committing,
+// with the list of operations, renames the files into place, and bumps the generation file. Readers
+// retry when a commit happened while they read, see ReadSnapshot. A commit interrupted by a crash is
+// completed by the next process finding the stale lock, which first creates the claim file so that a
+// single process recovers it. Only the claim holder removes the lock.
+//
+// The lock file is a single "pid hostname created-at state" line, state is "locked" or "committing"
+// followed by the space separated operations: "write:<file name>" or "remove:<file name>".
+
+const (
+	LOCK_FILE_NAME       = "lock"
+	LOCK_CLAIM_FILE_NAME = "lock.claim"
+	GENERATION_FILE_NAME = "generation"
+	PENDING_FILE_SUFFIX  = ".pending"
+
+	LOCK_TIMEOUT        = 5 * time.Second
+	LOCK_RETRY_INTERVAL = 20 * time.Millisecond
+	// Lock files are written right after being created, an unreadable one is only stale once this old
+	LOCK_WRITE_GRACE = 10 * time.Second
+	// Reads are retried while commits keep happening, for about a LOCK_TIMEOUT
+	SNAPSHOT_ATTEMPTS = int(LOCK_TIMEOUT / LOCK_RETRY_INTERVAL)
+
+	lockedState     = "locked"
+	committingState = "committing"
+	writeOperation  = "write:"
+	removeOperation = "remove:"
+)
+
+// LockedError is returned when the repository lock is held by another process for longer than the timeout.
+type LockedError struct {
+	Pid       int
+	Hostname  string
+	CreatedAt time.Time
+}
+
+func (err *LockedError) Error() string {
+	return fmt.Sprintf(
+		"Lock Error: the repository is locked by process %d on %s since %s, remove %s/%s if it is not running.",
+		err.Pid, err.Hostname, err.CreatedAt.Format(time.RFC3339), REPOSITORY_FOLDER_NAME, LOCK_FILE_NAME,
+	)
+}
+
+type lockInfo struct {
+	pid        int
+	hostname   string
+	createdAt  time.Time
+	committing bool
+	operations []string
+}
+
+func (info *lockInfo) String() string {
+	state := lockedState
+	if info.committing {
+		state = strings.Join(append([]string{committingState}, info.operations...), " ")
+	}
+
+	return fmt.Sprintf("%d %s %d %s\n", info.pid, info.hostname, info.createdAt.UnixNano(), state)
+}
+
+func parseLockInfo(content string) (*lockInfo, error) {
+	fields := strings.Fields(content)
+	if len(fields) < 4 || (fields[3] != lockedState && fields[3] != committingState) {
+		return nil, fmt.Errorf("invalid lock file.")
+	}
+
+	pid, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid lock file pid.")
+	}
+	createdAt, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid lock file date.")
+	}
+
+	return &lockInfo{
+		pid:        pid,
+		hostname:   fields[1],
+		createdAt:  time.Unix(0, createdAt),
+		committing: fields[3] == committingState,
+		operations: fields[4:],
+	}, nil
+}
+
+// isStale tells whether the lock holder is gone. Only the processes of this host can be checked, locks of
+// other hosts are never stale.
+func (info *lockInfo) isStale() bool {
+	hostname, err := os.Hostname()
+	if err != nil || hostname != info.hostname {
+		return false
+	}
+
+	return !processExists(info.pid)
+}
+
+func (fileSystem *FileSystem) repositoryFilePath(name string) string {
+	return Path.Join(fileSystem.Root, REPOSITORY_FOLDER_NAME, name)
+}
+
+// Lock takes the repository lock, waiting up to timeout for the process holding it. Stale locks are
+// taken over.
+func (fileSystem *FileSystem) Lock(timeout time.Duration) error {
+	if fileSystem.lock != nil {
+		return fmt.Errorf("the repository is already locked.")
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+
+	info := &lockInfo{pid: os.Getpid(), hostname: hostname, createdAt: time.Now()}
+	deadline := time.Now().Add(timeout)
+
+	for {
+		err := fileSystem.createExclusiveFile(LOCK_FILE_NAME, []byte(info.String()))
+		if err == nil {
+			fileSystem.lock = info
+			fileSystem.pending = make(map[string]*string)
+
+			return nil
+		}
+		if !os.IsExist(err) {
+			return err
+		}
+
+		holder, err := fileSystem.recoverStaleLock()
+		if err != nil {
+			return err
+		}
+		if holder == nil {
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			return &LockedError{Pid: holder.pid, Hostname: holder.hostname, CreatedAt: holder.createdAt}
+		}
+		time.Sleep(LOCK_RETRY_INTERVAL)
+	}
+}
+
+// createExclusiveFile creates a file of the repository folder with content, it fails with an os.IsExist
+// error when the file exists.
+func (fileSystem *FileSystem) createExclusiveFile(name string, content []byte) error {
+	filePath := fileSystem.repositoryFilePath(name)
+
+	file, err := fileSystem.Files.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fileSystem.Files.Remove(filePath)
+	}
+
+	return err
+}
+
+// recoverStaleLock removes the lock when its holder is gone, completing its interrupted commit. The live
+// holder is returned, nil when there is none anymore.
+func (fileSystem *FileSystem) recoverStaleLock() (*lockInfo, error) {
+	lockPath := fileSystem.repositoryFilePath(LOCK_FILE_NAME)
+
+	content, err := fileSystem.Files.ReadFile(lockPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	info, err := parseLockInfo(string(content))
+	if err != nil {
+		lockStat, statErr := fileSystem.Files.Stat(lockPath)
+		if statErr != nil || time.Since(lockStat.ModTime()) < LOCK_WRITE_GRACE {
+			// Being written, or already removed
+			return &lockInfo{createdAt: time.Now()}, nil
+		}
+	} else if !info.isStale() {
+		return info, nil
+	}
+
+	claimed, err := fileSystem.claimStaleLock(content)
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		// Being recovered by another process
+		if info == nil {
+			return &lockInfo{createdAt: time.Now()}, nil
+		}
+
+		return info, nil
+	}
+
+	err = fileSystem.removeStaleLock(info, content)
+	if removeErr := fileSystem.Files.Remove(fileSystem.repositoryFilePath(LOCK_CLAIM_FILE_NAME)); err == nil && removeErr != nil && !os.IsNotExist(removeErr) {
+		err = removeErr
+	}
+
+	return nil, err
+}
+
+// removeStaleLock completes the interrupted commit of the stale lock and removes it, the claim must be held.
+// Only claim holders remove locks, so the lock is still the stale one unless it was recovered, and maybe
+// taken again, before the claim was created.
+func (fileSystem *FileSystem) removeStaleLock(info *lockInfo, content []byte) error {
+	lockPath := fileSystem.repositoryFilePath(LOCK_FILE_NAME)
+
+	current, err := fileSystem.Files.ReadFile(lockPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+	if !bytes.Equal(current, content) {
+		return nil
+	}
+
+	if info != nil && info.committing {
+		if err := fileSystem.applyOperations(info.operations); err != nil {
+			return err
+		}
+	}
+
+	if err := fileSystem.Files.Remove(lockPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// claimStaleLock creates the claim file, so that a single process recovers the stale lock read with content.
+// The claim is the claimer "pid hostname created-at locked" line followed by the stale lock content. The
+// claim of a process that exited while recovering is removed, to be claimed on the next attempt.
+func (fileSystem *FileSystem) claimStaleLock(content []byte) (bool, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return false, err
+	}
+
+	claimer := &lockInfo{pid: os.Getpid(), hostname: hostname, createdAt: time.Now()}
+	err = fileSystem.createExclusiveFile(LOCK_CLAIM_FILE_NAME, append([]byte(claimer.String()), content...))
+	if err == nil {
+		return true, nil
+	}
+	if !os.IsExist(err) {
+		return false, err
+	}
+
+	claimPath := fileSystem.repositoryFilePath(LOCK_CLAIM_FILE_NAME)
+	claim, err := fileSystem.Files.ReadFile(claimPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	claimerLine, _, _ := strings.Cut(string(claim), "\n")
+	if claimerInfo, err := parseLockInfo(claimerLine); err != nil {
+		claimStat, statErr := fileSystem.Files.Stat(claimPath)
+		if statErr != nil || time.Since(claimStat.ModTime()) < LOCK_WRITE_GRACE {
+			return false, nil
+		}
+	} else if !claimerInfo.isStale() {
+		return false, nil
+	}
+
+	if err := fileSystem.Files.Remove(claimPath); err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+
+	return false, nil
+}
+
+func (fileSystem *FileSystem) IsLocked() bool {
+	return fileSystem.lock != nil
+}
+
+// Commit writes the pending repository files and releases the lock.
+func (fileSystem *FileSystem) Commit() error {
+	if fileSystem.lock == nil {
+		return nil
+	}
+
+	if err := fileSystem.flush(); err != nil {
+		return err
+	}
+
+	return fileSystem.Unlock()
+}
+
+// Unlock releases the lock, the pending repository files are discarded.
+func (fileSystem *FileSystem) Unlock() error {
+	if fileSystem.lock == nil {
+		return nil
+	}
+
+	fileSystem.lock = nil
+	fileSystem.pending = nil
+
+	err := fileSystem.Files.Remove(fileSystem.repositoryFilePath(LOCK_FILE_NAME))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// flush commits the pending repository files, the lock is kept.
+func (fileSystem *FileSystem) flush() error {
+	if len(fileSystem.pending) == 0 {
+		return nil
+	}
+
+	names := []string{}
+	for name := range fileSystem.pending {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	operations := []string{}
+
+	for _, name := range names {
+		content := fileSystem.pending[name]
+		if content == nil {
+			operations = append(operations, removeOperation+name)
+			continue
+		}
+
+		if err := fileSystem.Files.WriteFile(fileSystem.repositoryFilePath(name+PENDING_FILE_SUFFIX), []byte(*content), 0644); err != nil {
+			return err
+		}
+		operations = append(operations, writeOperation+name)
+	}
+
+	fileSystem.lock.committing = true
+	fileSystem.lock.operations = operations
+	if err := fileSystem.writeFileAtomically(LOCK_FILE_NAME, fileSystem.lock.String()); err != nil {
+		return err
+	}
+
+	if err := fileSystem.applyOperations(operations); err != nil {
+		return err
+	}
+
+	fileSystem.lock.committing = false
+	fileSystem.lock.operations = nil
+	fileSystem.pending = make(map[string]*string)
+
+	return fileSystem.writeFileAtomically(LOCK_FILE_NAME, fileSystem.lock.String())
+}
+
+// applyOperations moves the pending files into place and bumps the generation. Operations already applied
+// are skipped, so an interrupted commit can be applied again.
+func (fileSystem *FileSystem) applyOperations(operations []string) error {
+	for _, operation := range operations {
+		if name, ok := strings.CutPrefix(operation, writeOperation); ok {
+			err := fileSystem.Files.Rename(fileSystem.repositoryFilePath(name+PENDING_FILE_SUFFIX), fileSystem.repositoryFilePath(name))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		if name, ok := strings.CutPrefix(operation, removeOperation); ok {
+			err := fileSystem.Files.Remove(fileSystem.repositoryFilePath(name))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+
+	generation, err := fileSystem.readGeneration()
+	if err != nil {
+		return err
+	}
+
+	return fileSystem.writeFileAtomically(GENERATION_FILE_NAME, strconv.FormatInt(generation+1, 10))
+}
+
+func (fileSystem *FileSystem) readGeneration() (int64, error) {
+	content, err := fileSystem.Files.ReadFile(fileSystem.repositoryFilePath(GENERATION_FILE_NAME))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+
+		return 0, err
+	}
+
+	generation, err := strconv.ParseInt(strings.TrimSpace(string(content)), 10, 64)
+	if err != nil {
+		return 0, &CorruptError{GENERATION_FILE_NAME, "has an invalid format."}
+	}
+
+	return generation, nil
+}
+
+// isCommitting tells whether a commit is in progress, interrupted commits are completed first.
+func (fileSystem *FileSystem) isCommitting() (bool, error) {
+	content, err := fileSystem.Files.ReadFile(fileSystem.repositoryFilePath(LOCK_FILE_NAME))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	info, err := parseLockInfo(string(content))
+	if err != nil || !info.committing {
+		return false, nil
+	}
+	if !info.isStale() {
+		return true, nil
+	}
+
+	holder, err := fileSystem.recoverStaleLock()
+
+	return holder != nil && holder.committing, err
+}
+
+// ReadSnapshot runs read, again while a commit happened meanwhile, so the repository files it reads are
+// consistent with each other. Without the lock, the files written by a concurrent command may be read
+// before and after its commit.
+func (fileSystem *FileSystem) ReadSnapshot(read func() error) error {
+	if fileSystem.lock != nil {
+		return read()
+	}
+
+	for attempt := 1; ; attempt++ {
+		generation, err := fileSystem.readGeneration()
+		if err != nil {
+			return err
+		}
+
+		committing, err := fileSystem.isCommitting()
+		if err != nil {
+			return err
+		}
+
+		if !committing {
+			readErr := read()
+
+			committing, err := fileSystem.isCommitting()
+			if err != nil {
+				return err
+			}
+			currentGeneration, err := fileSystem.readGeneration()
+			if err != nil {
+				return err
+			}
+
+			if !committing && currentGeneration == generation {
+				return readErr
+			}
+		}
+
+		if attempt == SNAPSHOT_ATTEMPTS {
+			return fmt.Errorf("the repository kept being modified while being read.")
+		}
+		time.Sleep(LOCK_RETRY_INTERVAL)
+	}
+}
+
+// writeFileAtomically replaces a file of the repository folder, name is relative to it, with a rename. Readers
+// see either the previous or the new content.
+func (fileSystem *FileSystem) writeFileAtomically(name string, content string) error {
+	tempFile, err := fileSystem.Files.CreateTemp(Path.Join(fileSystem.Root, REPOSITORY_FOLDER_NAME), TEMP_FILE_PREFIX)
+	if err != nil {
+		return err
+	}
+	defer fileSystem.Files.Remove(tempFile.Name())
+
+	_, err = tempFile.Write([]byte(content))
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := fileSystem.Files.Chmod(tempFile.Name(), 0644); err != nil {
+		return err
+	}
+
+	return fileSystem.Files.Rename(tempFile.Name(), fileSystem.repositoryFilePath(name))
+}
+
+// writeRepositoryFile replaces the content of a file of the repository folder, when the lock is held the
+// file is only written on commit.
+func (fileSystem *FileSystem) writeRepositoryFile(name string, content string) error {
+	if fileSystem.lock != nil {
+		fileSystem.pending[name] = &content
+		return nil
+	}
+
+	return fileSystem.writeFileAtomically(name, content)
+}
+
+// removeRepositoryFile removes a file of the repository folder, when the lock is held the file is only
+// removed on commit. Removing a missing file is a no-op.
+func (fileSystem *FileSystem) removeRepositoryFile(name string) error {
+	if fileSystem.lock != nil {
+		fileSystem.pending[name] = nil
+		return nil
+	}
+
+	err := fileSystem.Files.Remove(fileSystem.repositoryFilePath(name))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// openRepositoryFile opens a file of the repository folder, with its pending content when there is one.
+func (fileSystem *FileSystem) openRepositoryFile(name string) (io.ReadCloser, error) {
+	if content, ok := fileSystem.pending[name]; ok {
+		if content == nil {
+			return nil, &os.PathError{Op: "open", Path: fileSystem.repositoryFilePath(name), Err: os.ErrNotExist}
+		}
+
+		return io.NopCloser(strings.NewReader(*content)), nil
+	}
+
+	return fileSystem.Files.Open(fileSystem.repositoryFilePath(name))
+}
+
+func (fileSystem *FileSystem) readRepositoryFile(name string) ([]byte, error) {
+	file, err := fileSystem.openRepositoryFile(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return io.ReadAll(file)
+}
@@ -0,0 +1,187 @@
+package filesystems
+
+import (
+	"bytes"
+	"fmt"
+	Path "path/filepath"
+	"saymow/version-manager/app/repositories/directories"
+	"strings"
+)
+
+type MigrationError struct {
+	message string
+}
+
+func (err *MigrationError) Error() string {
+	return err.message
+}
+
+// Migrate upgrades a version 1 repository, whose index and saves store absolute paths under oldRoot, to
+// repository relative paths.
+//
+// Saves content changes, and so do their names, the refs, head and merge head are updated accordingly.
+// The outdated saves are only removed once everything else is written, so an interrupted migration can
+// be run again. The repository is locked meanwhile, unless the lock is already held.
+func (fileSystem *FileSystem) Migrate(oldRoot string) error {
+	version, err := fileSystem.ReadVersion()
+	if err != nil || version >= REPOSITORY_VERSION {
+		return err
+	}
+
+	if !fileSystem.IsLocked() {
+		if err := fileSystem.Lock(LOCK_TIMEOUT); err != nil {
+			return err
+		}
+		defer fileSystem.Unlock()
+
+		// Another process may have migrated the repository while this one waited for the lock
+		version, err := fileSystem.ReadVersion()
+		if err != nil || version >= REPOSITORY_VERSION {
+			return err
+		}
+	}
+
+	migratePaths := func(changes []*directories.Change) error {
+		for _, change := range changes {
+			filepath := change.GetPath()
+
+			if !Path.IsAbs(filepath) {
+				// Already migrated
+				fileSystem.resolveChangesPaths([]*directories.Change{change})
+				continue
+			}
+
+			relativePath, err := Path.Rel(oldRoot, filepath)
+			if err != nil || relativePath == ".." || strings.HasPrefix(relativePath, ".."+string(Path.Separator)) {
+				return &MigrationError{fmt.Sprintf("path \"%s\" is not inside \"%s\", the repository was moved: run \"vcs migrate --from <previous repository path>\".", filepath, oldRoot)}
+			}
+
+			change.SetPath(Path.Join(fileSystem.Root, relativePath))
+		}
+
+		return nil
+	}
+
+	saveNames := make(map[string]string)
+
+	var migrateSave func(saveName string) (string, error)
+	migrateSave = func(saveName string) (string, error) {
+		if newSaveName, ok := saveNames[saveName]; ok {
+			return newSaveName, nil
+		}
+
+		content, err := fileSystem.Files.ReadFile(Path.Join(fileSystem.Root, REPOSITORY_FOLDER_NAME, SAVES_FOLDER_NAME, saveName))
+		if err != nil {
+			return "", err
+		}
+
+		checkpoint, err := parseCheckpoint(saveName, bytes.NewReader(content))
+		if err != nil {
+			return "", err
+		}
+
+		// Parents are migrated first, children store their new names
+		for idx, parent := range checkpoint.Parents {
+			checkpoint.Parents[idx], err = migrateSave(parent)
+			if err != nil {
+				return "", err
+			}
+		}
+
+		if err := migratePaths(checkpoint.Changes); err != nil {
+			return "", err
+		}
+
+		newSaveName, err := fileSystem.WriteCheckpoint(checkpoint)
+		if err != nil {
+			return "", err
+		}
+		saveNames[saveName] = newSaveName
+
+		return newSaveName, nil
+	}
+
+	saveInfos, err := fileSystem.ListSaves()
+	if err != nil {
+		return err
+	}
+
+	for _, info := range saveInfos {
+		if _, err := migrateSave(info.Name()); err != nil {
+			return err
+		}
+	}
+
+	indexFile, err := fileSystem.openRepositoryFile(INDEX_FILE_NAME)
+	if err != nil {
+		return err
+	}
+	index, err := fileSystem.parseIndex(indexFile)
+	indexFile.Close()
+	if err != nil {
+		return err
+	}
+
+	if err := migratePaths(index); err != nil {
+		return err
+	}
+
+	migratedSaveName := func(saveName string) string {
+		if newSaveName, ok := saveNames[saveName]; ok {
+			return newSaveName
+		}
+
+		return saveName
+	}
+
+	refs, err := fileSystem.ReadRefs()
+	if err != nil {
+		return err
+	}
+	head, err := fileSystem.ReadHead()
+	if err != nil {
+		return err
+	}
+	mergeHead, err := fileSystem.ReadMergeHead()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := (*refs)[head]; !ok {
+		head = migratedSaveName(head)
+	}
+	for name, saveName := range *refs {
+		(*refs)[name] = migratedSaveName(saveName)
+	}
+
+	if err := fileSystem.SaveIndex(index); err != nil {
+		return err
+	}
+	if err := fileSystem.WriteRefs(refs); err != nil {
+		return err
+	}
+	if err := fileSystem.WriteHead(head); err != nil {
+		return err
+	}
+	if mergeHead != "" {
+		if err := fileSystem.WriteMergeHead(migratedSaveName(mergeHead)); err != nil {
+			return err
+		}
+	}
+	if err := fileSystem.writeVersion(REPOSITORY_VERSION); err != nil {
+		return err
+	}
+	if err := fileSystem.flush(); err != nil {
+		return err
+	}
+
+	for saveName, newSaveName := range saveNames {
+		if saveName != newSaveName {
+			if err := fileSystem.RemoveSave(saveName); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,318 @@
+package filesystems
+
+import (
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"os"
+	Path "path/filepath"
+	"saymow/version-manager/app/repositories/packs"
+	"slices"
+	"sort"
+	"time"
+)
+
+type objectReader struct {
+	io.Reader
+	decompressor *gzip.Reader
+	file         io.ReadCloser
+}
+
+func (reader *objectReader) Close() error {
+	if err := reader.decompressor.Close(); err != nil {
+		reader.file.Close()
+		return err
+	}
+
+	return reader.file.Close()
+}
+
+func (fileSystem *FileSystem) packsPath() string {
+	return Path.Join(fileSystem.Root, REPOSITORY_FOLDER_NAME, PACKS_FOLDER_NAME)
+}
+
+func (fileSystem *FileSystem) getPacks() ([]*packs.Pack, error) {
+	fileSystem.packsLock.Lock()
+	defer fileSystem.packsLock.Unlock()
+
+	if fileSystem.loadedPacks == nil {
+		loadedPacks, err := packs.List(fileSystem.Files, fileSystem.packsPath())
+		if err != nil {
+			return nil, err
+		}
+
+		fileSystem.loadedPacks = loadedPacks
+	}
+
+	return fileSystem.loadedPacks, nil
+}
+
+// openEntry opens the content of a loose object or save, falling back to the packs when it is not loose.
+func (fileSystem *FileSystem) openEntry(kind packs.EntryKind, name string) (io.ReadCloser, error) {
+	var file io.ReadCloser
+	var err error
+
+	if kind == packs.SaveEntry {
+		file, err = fileSystem.Files.Open(Path.Join(fileSystem.Root, REPOSITORY_FOLDER_NAME, SAVES_FOLDER_NAME, name))
+	} else {
+		file, err = fileSystem.objects.Open(name)
+	}
+	if err == nil {
+		if kind == packs.SaveEntry {
+			return file, nil
+		}
+
+		decompressor, err := gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		return &objectReader{Reader: decompressor, decompressor: decompressor, file: file}, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	content, packErr := fileSystem.openPacked(kind, name)
+	if os.IsNotExist(packErr) {
+		// A concurrent repack may have packed the loose entry, or removed the pack holding it
+		fileSystem.packsLock.Lock()
+		fileSystem.loadedPacks = nil
+		fileSystem.packsLock.Unlock()
+
+		content, packErr = fileSystem.openPacked(kind, name)
+	}
+	if os.IsNotExist(packErr) {
+		return nil, err
+	}
+
+	return content, packErr
+}
+
+func (fileSystem *FileSystem) openPacked(kind packs.EntryKind, name string) (io.ReadCloser, error) {
+	loadedPacks, err := fileSystem.getPacks()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pack := range loadedPacks {
+		if pack.Contains(kind, name) {
+			return pack.OpenContent(kind, name)
+		}
+	}
+
+	return nil, os.ErrNotExist
+}
+
+// openObject returns the object uncompressed content.
+func (fileSystem *FileSystem) openObject(name string) (io.ReadCloser, error) {
+	return fileSystem.openEntry(packs.ObjectEntry, name)
+}
+
+func (fileSystem *FileSystem) openSave(name string) (io.ReadCloser, error) {
+	return fileSystem.openEntry(packs.SaveEntry, name)
+}
+
+// listLoose lists the entries that are not packed, the objects of a shared store are left out.
+func (fileSystem *FileSystem) listLoose(kind packs.EntryKind) ([]fs.FileInfo, error) {
+	if kind == packs.SaveEntry {
+		return fileSystem.ListSaves()
+	}
+	if fileSystem.sharedObjects {
+		return []fs.FileInfo{}, nil
+	}
+
+	return fileSystem.ListObjects()
+}
+
+func (fileSystem *FileSystem) listPacked(kind packs.EntryKind) ([]string, error) {
+	loadedPacks, err := fileSystem.getPacks()
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+
+	for _, pack := range loadedPacks {
+		names = append(names, pack.Names(kind)...)
+	}
+
+	return names, nil
+}
+
+func (fileSystem *FileSystem) ListPackedObjects() ([]string, error) {
+	return fileSystem.listPacked(packs.ObjectEntry)
+}
+
+func (fileSystem *FileSystem) ListPackedSaves() ([]string, error) {
+	return fileSystem.listPacked(packs.SaveEntry)
+}
+
+func (fileSystem *FileSystem) ListPacks() ([]*packs.Pack, error) {
+	return fileSystem.getPacks()
+}
+
+// deltaBases maps each object to the previous version of the same file, following the order in which
+// objects were first saved. Every object has at most one base and bases are older, so there are no cycles.
+func (fileSystem *FileSystem) deltaBases(saveNames []string) (map[string]string, error) {
+	checkpoints := []*Checkpoint{}
+
+	for _, saveName := range saveNames {
+		checkpoint, err := fileSystem.readCheckpoint(saveName)
+		if err != nil {
+			return nil, err
+		}
+
+		if checkpoint != nil {
+			checkpoints = append(checkpoints, checkpoint)
+		}
+	}
+
+	sort.SliceStable(checkpoints, func(i, j int) bool {
+		return checkpoints[i].CreatedAt.Before(checkpoints[j].CreatedAt)
+	})
+
+	bases := make(map[string]string)
+	latestObjects := make(map[string]string)
+	seenObjects := make(map[string]bool)
+
+	for _, checkpoint := range checkpoints {
+		for _, change := range checkpoint.Changes {
+			objectName := change.GetHash()
+			if objectName == "" {
+				continue
+			}
+
+			if !seenObjects[objectName] {
+				seenObjects[objectName] = true
+
+				if previousObjectName, ok := latestObjects[change.GetPath()]; ok && previousObjectName != objectName {
+					bases[objectName] = previousObjectName
+				}
+			}
+
+			latestObjects[change.GetPath()] = objectName
+		}
+	}
+
+	return bases, nil
+}
+
+// Repack moves the reachable loose objects and saves, and the reachable entries of the existing packs, into
+// a single new pack.
+//
+// Objects are stored as deltas against the previous version of the same file when that is smaller.
+// Unreachable loose entries modified before expiration stay loose, to be collected, and unreachable entries
+// of packs written before expiration are dropped. Loose entries whose names are not hashes stay loose, and so do the objects of a
+// shared store. Nil is returned when everything is already in a single pack.
+//
+// The replaced loose entries and packs are removed while readers, which do not lock, may still list them,
+// openEntry lists the packs again when an entry is missing.
+func (fileSystem *FileSystem) Repack(isReachable func(kind packs.EntryKind, name string) bool, expiration time.Time) (*packs.Pack, error) {
+	oldPacks, err := fileSystem.getPacks()
+	if err != nil {
+		return nil, err
+	}
+
+	looseNames := map[packs.EntryKind][]string{}
+	names := map[packs.EntryKind][]string{}
+	droppedEntries := 0
+
+	for _, kind := range []packs.EntryKind{packs.ObjectEntry, packs.SaveEntry} {
+		for _, pack := range oldPacks {
+			info, err := pack.Stat()
+			if err != nil {
+				return nil, err
+			}
+
+			for _, name := range pack.Names(kind) {
+				if !isReachable(kind, name) && info.ModTime().Before(expiration) {
+					droppedEntries++
+					continue
+				}
+
+				names[kind] = append(names[kind], name)
+			}
+		}
+
+		infos, err := fileSystem.listLoose(kind)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, info := range infos {
+			if !packs.IsValidName(info.Name()) || (!isReachable(kind, info.Name()) && info.ModTime().Before(expiration)) {
+				continue
+			}
+
+			looseNames[kind] = append(looseNames[kind], info.Name())
+			names[kind] = append(names[kind], info.Name())
+		}
+	}
+
+	if len(looseNames[packs.ObjectEntry])+len(looseNames[packs.SaveEntry])+droppedEntries == 0 && len(oldPacks) <= 1 {
+		return nil, nil
+	}
+
+	for kind := range names {
+		slices.Sort(names[kind])
+		names[kind] = slices.Compact(names[kind])
+	}
+
+	bases, err := fileSystem.deltaBases(names[packs.SaveEntry])
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []*packs.Entry{}
+
+	for _, kind := range []packs.EntryKind{packs.ObjectEntry, packs.SaveEntry} {
+		for _, name := range names[kind] {
+			entries = append(entries, &packs.Entry{
+				Kind: kind,
+				Name: name,
+				Base: bases[name],
+				Open: func() (io.ReadCloser, error) { return fileSystem.openEntry(kind, name) },
+			})
+		}
+	}
+
+	if err := fileSystem.Files.MkdirAll(fileSystem.packsPath(), 0755); err != nil {
+		return nil, err
+	}
+
+	packName, err := packs.Write(fileSystem.Files, fileSystem.packsPath(), entries)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range looseNames[packs.ObjectEntry] {
+		if err := fileSystem.RemoveObject(name); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range looseNames[packs.SaveEntry] {
+		if err := fileSystem.RemoveSave(name); err != nil {
+			return nil, err
+		}
+	}
+	for _, pack := range oldPacks {
+		if pack.Name != packName {
+			if err := pack.Remove(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	pack, err := packs.Open(fileSystem.Files, fileSystem.packsPath(), packName)
+	if err != nil {
+		return nil, err
+	}
+
+	fileSystem.packsLock.Lock()
+	fileSystem.loadedPacks = []*packs.Pack{pack}
+	fileSystem.packsLock.Unlock()
+
+	return pack, nil
+}
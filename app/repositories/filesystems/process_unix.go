@@ -0,0 +1,15 @@
+//go:build unix
+
+package filesystems
+
+import (
+	"errors"
+	"syscall"
+)
+
+// processExists tells whether the process of this host with pid is running, signal 0 only checks it.
+func processExists(pid int) bool {
+	err := syscall.Kill(pid, 0)
+
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
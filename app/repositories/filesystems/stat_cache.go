@@ -0,0 +1,254 @@
+package filesystems
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	Path "path/filepath"
+	"saymow/version-manager/app/repositories/directories"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	STAT_CACHE_FILE_NAME = "stat-cache"
+
+	statCacheHeader = "Stat cache v1"
+)
+
+// FileStat is the file metadata used to tell whether a file changed without reading it.
+type FileStat struct {
+	Size       int64
+	ModTime    int64
+	ChangeTime int64
+	Inode      uint64
+	Mode       uint32
+}
+
+func NewFileStat(info fs.FileInfo) FileStat {
+	stat := FileStat{
+		Size:    info.Size(),
+		ModTime: info.ModTime().UnixNano(),
+		Mode:    uint32(info.Mode()),
+	}
+	fillSystemStat(&stat, info)
+
+	return stat
+}
+
+type statCacheEntry struct {
+	stat FileStat
+	hash string
+}
+
+// StatCache remembers the working directory files hashes, they are reused as long as the file stat data
+// does not change.
+//
+// A file modified twice within the timestamp granularity keeps the same mtime. So entries whose mtime is
+// not older than the cache file itself are "racy" and always hashed again. Files can be hashed concurrently.
+type StatCache struct {
+	fileSystem  *FileSystem
+	lock        sync.Mutex
+	modTime     int64
+	entries     map[string]*statCacheEntry
+	usedEntries map[string]*statCacheEntry
+	changed     bool
+	hashedFiles int
+}
+
+// Hash returns the file with its content hash and mode, the file is only read when its stat data changed.
+// Symlinks are not followed, see HashFile.
+func (cache *StatCache) Hash(filepath string) (*directories.File, error) {
+	info, err := cache.fileSystem.Files.Lstat(filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	stat := NewFileStat(info)
+	mode := GetFileMode(info)
+
+	cache.lock.Lock()
+	entry, ok := cache.entries[filepath]
+	if ok && entry.stat == stat && stat.ModTime < cache.modTime {
+		cache.usedEntries[filepath] = entry
+		cache.lock.Unlock()
+
+		return &directories.File{Filepath: filepath, ObjectName: entry.hash, Mode: mode}, nil
+	}
+	cache.lock.Unlock()
+
+	file, err := cache.fileSystem.HashFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	cache.hashedFiles++
+	cache.changed = true
+	cache.usedEntries[filepath] = &statCacheEntry{stat: stat, hash: file.ObjectName}
+
+	return file, nil
+}
+
+// ReadStatCache reads the stat cache, a missing or unreadable cache is empty.
+func (fileSystem *FileSystem) ReadStatCache() (*StatCache, error) {
+	cache := &StatCache{
+		fileSystem:  fileSystem,
+		entries:     make(map[string]*statCacheEntry),
+		usedEntries: make(map[string]*statCacheEntry),
+	}
+
+	file, err := fileSystem.Files.Open(Path.Join(fileSystem.Root, REPOSITORY_FOLDER_NAME, STAT_CACHE_FILE_NAME))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		return cache, nil
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := fileSystem.parseStatCache(file)
+	if err != nil {
+		// The cache is only an optimization, files are hashed again
+		return cache, nil
+	}
+
+	cache.modTime = info.ModTime().UnixNano()
+	cache.entries = entries
+
+	return cache, nil
+}
+
+func (fileSystem *FileSystem) parseStatCache(file io.Reader) (map[string]*statCacheEntry, error) {
+	entries := make(map[string]*statCacheEntry)
+	scanner := bufio.NewScanner(file)
+
+	if !scanner.Scan() || scanner.Text() != statCacheHeader {
+		return nil, fmt.Errorf("invalid stat cache header.")
+	}
+
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("invalid stat cache entry.")
+		}
+
+		entry := &statCacheEntry{hash: fields[1]}
+		numbers := []int64{}
+
+		for _, field := range fields[2:] {
+			number, err := strconv.ParseInt(field, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+
+			numbers = append(numbers, number)
+		}
+
+		entry.stat = FileStat{
+			Size:       numbers[0],
+			ModTime:    numbers[1],
+			ChangeTime: numbers[2],
+			Inode:      uint64(numbers[3]),
+			Mode:       uint32(numbers[4]),
+		}
+		entries[fileSystem.resolvePath(fields[0])] = entry
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// WriteStatCache keeps the entries used since the cache was read, so deleted and untracked files are dropped.
+//
+// Without the lock, e.g. for status, it is taken for the write so concurrent commands do not race on the
+// cache. The cache is only an optimization, it is not written while another process holds the lock.
+func (fileSystem *FileSystem) WriteStatCache(cache *StatCache) error {
+	if !cache.changed && len(cache.usedEntries) == len(cache.entries) {
+		return nil
+	}
+	if fileSystem.lock != nil {
+		return fileSystem.writeStatCache(cache)
+	}
+
+	var lockedErr *LockedError
+	err := fileSystem.Lock(0)
+	if errors.As(err, &lockedErr) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	err = fileSystem.writeStatCache(cache)
+	if unlockErr := fileSystem.Unlock(); err == nil {
+		err = unlockErr
+	}
+
+	return err
+}
+
+func (fileSystem *FileSystem) writeStatCache(cache *StatCache) error {
+	repositoryPath := Path.Join(fileSystem.Root, REPOSITORY_FOLDER_NAME)
+
+	tempFile, err := fileSystem.Files.CreateTemp(repositoryPath, TEMP_FILE_PREFIX)
+	if err != nil {
+		return err
+	}
+	defer fileSystem.Files.Remove(tempFile.Name())
+	defer tempFile.Close()
+
+	writer := bufio.NewWriter(tempFile)
+	if _, err := fmt.Fprintln(writer, statCacheHeader); err != nil {
+		return err
+	}
+
+	for filepath, entry := range cache.usedEntries {
+		storedPath, err := fileSystem.storedPath(filepath)
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(
+			writer,
+			"%s\t%s\t%d\t%d\t%d\t%d\t%d\n",
+			storedPath,
+			entry.hash,
+			entry.stat.Size,
+			entry.stat.ModTime,
+			entry.stat.ChangeTime,
+			int64(entry.stat.Inode),
+			entry.stat.Mode,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+	if err := fileSystem.Files.Chmod(tempFile.Name(), 0644); err != nil {
+		return err
+	}
+
+	return fileSystem.Files.Rename(tempFile.Name(), Path.Join(repositoryPath, STAT_CACHE_FILE_NAME))
+}
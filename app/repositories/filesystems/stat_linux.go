@@ -0,0 +1,13 @@
+package filesystems
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+func fillSystemStat(stat *FileStat, info fs.FileInfo) {
+	if sys, ok := info.Sys().(*syscall.Stat_t); ok {
+		stat.ChangeTime = sys.Ctim.Nano()
+		stat.Inode = sys.Ino
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package filesystems
+
+import "io/fs"
+
+// The change time and inode are only compared on linux
+func fillSystemStat(stat *FileStat, info fs.FileInfo) {}
@@ -0,0 +1,180 @@
+package repositories
+
+import (
+	"io"
+	"os"
+	"saymow/version-manager/app/pkg/errors"
+	"saymow/version-manager/app/repositories/diffs"
+	"saymow/version-manager/app/repositories/directories"
+	"sort"
+)
+
+const DIFF_CONTEXT_LINES = 3
+
+// FileDiff holds the changes of a single file.
+//
+// OldObjectName is empty when the file was created and NewObjectName is empty when the file was removed.
+// OldFilepath is the source path of a renamed file, and is empty otherwise. The content of symlinks is their
+// target.
+type FileDiff struct {
+	Filepath      string
+	OldFilepath   string
+	OldObjectName string
+	NewObjectName string
+	OldMode       directories.FileMode
+	NewMode       directories.FileMode
+	IsBinary      bool
+	Hunks         []*diffs.UnifiedHunk
+}
+
+// makeFileDiff diffs the old and new files content, oldFile is nil when the file was created and newFile is nil
+// when the file was removed.
+func makeFileDiff(filepath string, oldFile, newFile *directories.File, oldContent, newContent []byte) *FileDiff {
+	fileDiff := &FileDiff{
+		Filepath: filepath,
+		Hunks:    []*diffs.UnifiedHunk{},
+	}
+
+	if oldFile != nil {
+		fileDiff.OldObjectName = oldFile.ObjectName
+		fileDiff.OldMode = oldFile.Mode
+	}
+	if newFile != nil {
+		fileDiff.NewObjectName = newFile.ObjectName
+		fileDiff.NewMode = newFile.Mode
+	}
+
+	if diffs.IsBinary(oldContent) || diffs.IsBinary(newContent) {
+		fileDiff.IsBinary = true
+		return fileDiff
+	}
+
+	fileDiff.Hunks = diffs.Unified(diffs.SplitLines(oldContent), diffs.SplitLines(newContent), DIFF_CONTEXT_LINES)
+
+	return fileDiff
+}
+
+func (repository *Repository) readObjectContent(file *directories.File) []byte {
+	if file == nil {
+		return []byte{}
+	}
+
+	buffer, err := repository.fs.ReadDirFile(file)
+	errors.Check(err)
+
+	return buffer.Bytes()
+}
+
+// getStagedDir returns the HEAD file tree with the index changes applied.
+func (repository *Repository) getStagedDir() *directories.Dir {
+	dir, err := repository.fs.ReadDir(repository.getCurrentSaveName())
+	errors.Check(err)
+
+	for _, change := range repository.index {
+		normalizedPath, err := dir.NormalizePath(change.GetPath())
+		errors.Check(err)
+
+		errors.Check(dir.AddNode(normalizedPath, change))
+	}
+
+	return &dir
+}
+
+func (repository *Repository) diffDirs(oldDir *directories.Dir, newDir *directories.Dir) []*FileDiff {
+	fileDiffs := []*FileDiff{}
+
+	for _, change := range oldDir.Diff(newDir) {
+		var oldFile, newFile *directories.File
+
+		normalizedPath, err := oldDir.NormalizePath(change.GetSourcePath())
+		errors.Check(err)
+
+		if node := oldDir.FindNode(normalizedPath); node != nil && node.NodeType == directories.FileType {
+			oldFile = node.File
+		}
+		if change.ChangeType != directories.Removal {
+			newFile = change.File
+		}
+
+		fileDiff := makeFileDiff(change.GetPath(), oldFile, newFile, repository.readObjectContent(oldFile), repository.readObjectContent(newFile))
+		if change.ChangeType == directories.Rename {
+			fileDiff.OldFilepath = change.Rename.FromFilepath
+		}
+
+		fileDiffs = append(fileDiffs, fileDiff)
+	}
+
+	return fileDiffs
+}
+
+// GetWorkingDirDiff shows the tracked files changes in the working directory that are not in the index.
+//
+// Untracked files are not part of the diff.
+func (repository *Repository) GetWorkingDirDiff() (_ []*FileDiff, err error) {
+	defer errors.Recover(&err)
+
+	files := repository.getStagedDir().CollectAllFiles()
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Filepath < files[j].Filepath
+	})
+
+	fileDiffs := []*FileDiff{}
+	statCache, err := repository.fs.ReadStatCache()
+	errors.Check(err)
+
+	for _, file := range files {
+		workingFile, err := statCache.Hash(file.Filepath)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				errors.Error(err.Error())
+			}
+
+			fileDiffs = append(fileDiffs, makeFileDiff(file.Filepath, file, nil, repository.readObjectContent(file), []byte{}))
+			continue
+		}
+
+		// Unchanged files are only streamed through the hasher
+		if workingFile.Equals(file) {
+			continue
+		}
+
+		content, _, err := repository.fs.OpenWorkingFile(file.Filepath)
+		errors.Check(err)
+		workingContent, err := io.ReadAll(content)
+		errors.Check(err)
+		errors.Check(content.Close())
+
+		fileDiffs = append(fileDiffs, makeFileDiff(file.Filepath, file, workingFile, repository.readObjectContent(file), workingContent))
+	}
+
+	errors.Check(repository.fs.WriteStatCache(statCache))
+
+	return fileDiffs, nil
+}
+
+// GetStagedDiff shows the index changes against HEAD.
+func (repository *Repository) GetStagedDiff() (_ []*FileDiff, err error) {
+	defer errors.Recover(&err)
+
+	headDir, err := repository.fs.ReadDir(repository.getCurrentSaveName())
+	errors.Check(err)
+
+	return repository.diffDirs(&headDir, repository.getStagedDir()), nil
+}
+
+// GetSavesDiff shows the changes between two Refs or Save hashes.
+func (repository *Repository) GetSavesDiff(from string, to string) (_ []*FileDiff, err error) {
+	defer errors.Recover(&err)
+
+	fromSave := repository.getSave(from)
+	if fromSave == nil {
+		return nil, &InvalidRefError{from}
+	}
+
+	toSave := repository.getSave(to)
+	if toSave == nil {
+		return nil, &InvalidRefError{to}
+	}
+
+	return repository.diffDirs(buildDir(repository.fs.Root, fromSave), buildDir(repository.fs.Root, toSave)), nil
+}
@@ -0,0 +1,138 @@
+package repositories
+
+import (
+	path "path/filepath"
+	"saymow/version-manager/app/pkg/fixtures"
+	"saymow/version-manager/app/repositories/diffs"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetDiff(t *testing.T) {
+	dir, repository := fixtureGetBaseProject(t)
+	defer dir.Remove()
+
+	repository.IndexFile("1.txt")
+	repository.IndexFile(path.Join("a", "4.txt"))
+	repository.IndexFile(path.Join("c", "8.txt"))
+	repository.SaveIndex()
+	s0, _ := repository.CreateSave("s0")
+
+	repository = fixtureGetRepository(t, dir.Path())
+
+	fixtures.WriteFile(dir.Join("1.txt"), []byte("1 content\n1 new line\n"))
+	fixtures.WriteFile(dir.Join("a", "4.txt"), []byte("4 new content"))
+	repository.IndexFile("1.txt")
+	repository.IndexFile("2.txt")
+	repository.RemoveFile(path.Join("c", "8.txt"))
+	repository.SaveIndex()
+
+	// Working dir against index
+	{
+		fileDiffs, err := repository.GetWorkingDirDiff()
+		assert.NoError(t, err)
+
+		assert.Equal(t, len(fileDiffs), 1)
+		assert.Equal(t, fileDiffs[0].Filepath, dir.Join("a", "4.txt"))
+		assert.EqualValues(
+			t,
+			fileDiffs[0].Hunks,
+			[]*diffs.UnifiedHunk{
+				{
+					OldStart: 1, OldLines: 1, NewStart: 1, NewLines: 1,
+					Lines: []*diffs.Line{
+						{LineType: diffs.DeletedLine, Content: "4 content"},
+						{LineType: diffs.InsertedLine, Content: "4 new content"},
+					},
+				},
+			},
+		)
+	}
+
+	// Index against HEAD
+	{
+		fileDiffs, err := repository.GetStagedDiff()
+		assert.NoError(t, err)
+
+		assert.Equal(t, len(fileDiffs), 3)
+
+		assert.Equal(t, fileDiffs[0].Filepath, dir.Join("1.txt"))
+		assert.EqualValues(
+			t,
+			fileDiffs[0].Hunks,
+			[]*diffs.UnifiedHunk{
+				{
+					OldStart: 1, OldLines: 1, NewStart: 1, NewLines: 2,
+					Lines: []*diffs.Line{
+						{LineType: diffs.DeletedLine, Content: "1 content"},
+						{LineType: diffs.InsertedLine, Content: "1 content\n"},
+						{LineType: diffs.InsertedLine, Content: "1 new line\n"},
+					},
+				},
+			},
+		)
+
+		assert.Equal(t, fileDiffs[1].Filepath, dir.Join("2.txt"))
+		assert.Equal(t, fileDiffs[1].OldObjectName, "")
+		assert.EqualValues(
+			t,
+			fileDiffs[1].Hunks,
+			[]*diffs.UnifiedHunk{
+				{
+					OldStart: 0, OldLines: 0, NewStart: 1, NewLines: 1,
+					Lines: []*diffs.Line{{LineType: diffs.InsertedLine, Content: "2 content"}},
+				},
+			},
+		)
+
+		assert.Equal(t, fileDiffs[2].Filepath, dir.Join("c", "8.txt"))
+		assert.Equal(t, fileDiffs[2].NewObjectName, "")
+		assert.EqualValues(
+			t,
+			fileDiffs[2].Hunks,
+			[]*diffs.UnifiedHunk{
+				{
+					OldStart: 1, OldLines: 1, NewStart: 0, NewLines: 0,
+					Lines: []*diffs.Line{{LineType: diffs.DeletedLine, Content: "8 content"}},
+				},
+			},
+		)
+	}
+
+	// Saves
+	{
+		s1, _ := repository.CreateSave("s1")
+
+		repository = fixtureGetRepository(t, dir.Path())
+
+		fileDiffs, err := repository.GetSavesDiff(s0.Id, s1.Id)
+		assert.Nil(t, err)
+		assert.Equal(t, len(fileDiffs), 3)
+		assert.Equal(t, fileDiffs[0].Filepath, dir.Join("1.txt"))
+		assert.Equal(t, fileDiffs[1].Filepath, dir.Join("2.txt"))
+		assert.Equal(t, fileDiffs[2].Filepath, dir.Join("c", "8.txt"))
+
+		fileDiffs, err = repository.GetSavesDiff(s1.Id, "HEAD")
+		assert.Nil(t, err)
+		assert.Equal(t, len(fileDiffs), 0)
+
+		_, err = repository.GetSavesDiff(s0.Id, "undefined")
+		assert.Error(t, err, "Validation Error: invalid ref.")
+	}
+
+	// Renames
+	{
+		repository = fixtureGetRepository(t, dir.Path())
+
+		assert.Nil(t, repository.MoveFile("1.txt", "10.txt"))
+
+		fileDiffs, err := repository.GetStagedDiff()
+		assert.NoError(t, err)
+		assert.Equal(t, len(fileDiffs), 1)
+		assert.Equal(t, fileDiffs[0].Filepath, dir.Join("10.txt"))
+		assert.Equal(t, fileDiffs[0].OldFilepath, dir.Join("1.txt"))
+		assert.Equal(t, fileDiffs[0].OldObjectName, fileDiffs[0].NewObjectName)
+		assert.Equal(t, len(fileDiffs[0].Hunks), 0)
+	}
+}
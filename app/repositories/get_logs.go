@@ -2,6 +2,7 @@ package repositories
 
 import (
 	"saymow/version-manager/app/pkg/collections"
+	"saymow/version-manager/app/pkg/errors"
 	"saymow/version-manager/app/repositories/filesystems"
 	"slices"
 )
@@ -11,7 +12,9 @@ type Log struct {
 	History []*SaveLog
 }
 
-func (repository *Repository) GetLogs() *Log {
+func (repository *Repository) GetLogs() (_ *Log, err error) {
+	defer errors.Recover(&err)
+
 	save := repository.getSave(repository.head)
 
 	if save == nil {
@@ -20,7 +23,7 @@ func (repository *Repository) GetLogs() *Log {
 		return &Log{
 			Head:    repository.head,
 			History: []*SaveLog{},
-		}
+		}, nil
 	}
 
 	savesToRefsMap := collections.InvertMap(*repository.refs)
@@ -40,5 +43,5 @@ func (repository *Repository) GetLogs() *Log {
 
 			return &SaveLog{Checkpoint: checkpoint, Refs: refs}
 		}),
-	}
+	}, nil
 }
@@ -15,9 +15,11 @@ func TestGetLogs(t *testing.T) {
 
 	// History empty
 
+	log, err := repository.GetLogs()
+	assert.NoError(t, err)
 	assert.EqualValues(
 		t,
-		repository.GetLogs(),
+		log,
 		&Log{Head: filesystems.INITIAL_REF_NAME, History: []*SaveLog{}},
 	)
 
@@ -29,14 +31,15 @@ func TestGetLogs(t *testing.T) {
 	repository.SaveIndex()
 	save0, _ := repository.CreateSave("save0")
 
-	log := repository.GetLogs()
+	log, err = repository.GetLogs()
+	assert.NoError(t, err)
 	assert.Equal(t, log.Head, filesystems.INITIAL_REF_NAME)
 	assert.Equal(t, len(log.History), 1)
 	assert.Equal(t, len(log.History[0].Refs), 1)
 	assert.Equal(t, log.History[0].Refs[0], filesystems.INITIAL_REF_NAME)
 	assert.Equal(t, log.History[0].Checkpoint.Id, save0.Id)
 	assert.Equal(t, log.History[0].Checkpoint.Message, save0.Message)
-	assert.Equal(t, log.History[0].Checkpoint.Parent, save0.Parent)
+	assert.Equal(t, log.History[0].Checkpoint.Parents, save0.Parents)
 	// When saving the time in the file, using the Layout format, we lose the ms precision.
 	// Therefore this is needed to compare times
 	assert.Equal(t, log.History[0].Checkpoint.CreatedAt.Format(time.Layout), save0.CreatedAt.Format(time.Layout))
@@ -48,7 +51,7 @@ func TestGetLogs(t *testing.T) {
 
 	// After Save 1
 
-	repository = GetRepository(dir.Path())
+	repository = fixtureGetRepository(t, dir.Path())
 
 	fixtures.WriteFile(dir.Join("2.txt"), []byte("file 2 original content."))
 
@@ -56,14 +59,15 @@ func TestGetLogs(t *testing.T) {
 	repository.SaveIndex()
 	save1, _ := repository.CreateSave("save1")
 
-	log = repository.GetLogs()
+	log, err = repository.GetLogs()
+	assert.NoError(t, err)
 	assert.Equal(t, log.Head, "a")
 	assert.Equal(t, len(log.History), 2)
 	assert.Equal(t, len(log.History[0].Refs), 1)
 	assert.Equal(t, log.History[0].Refs[0], "a")
 	assert.Equal(t, log.History[0].Checkpoint.Id, save1.Id)
 	assert.Equal(t, log.History[0].Checkpoint.Message, save1.Message)
-	assert.Equal(t, log.History[0].Checkpoint.Parent, save1.Parent)
+	assert.Equal(t, log.History[0].Checkpoint.Parents, save1.Parents)
 	// When saving the time in the file, using the Layout format, we lose the ms precision.
 	// Therefore this is needed to compare times
 	assert.Equal(t, log.History[0].Checkpoint.CreatedAt.Format(time.Layout), save1.CreatedAt.Format(time.Layout))
@@ -73,7 +77,7 @@ func TestGetLogs(t *testing.T) {
 	assert.Equal(t, log.History[1].Refs[0], filesystems.INITIAL_REF_NAME)
 	assert.Equal(t, log.History[1].Checkpoint.Id, save0.Id)
 	assert.Equal(t, log.History[1].Checkpoint.Message, save0.Message)
-	assert.Equal(t, log.History[1].Checkpoint.Parent, save0.Parent)
+	assert.Equal(t, log.History[1].Checkpoint.Parents, save0.Parents)
 	// When saving the time in the file, using the Layout format, we lose the ms precision.
 	// Therefore this is needed to compare times
 	assert.Equal(t, log.History[1].Checkpoint.CreatedAt.Format(time.Layout), save0.CreatedAt.Format(time.Layout))
@@ -81,7 +85,7 @@ func TestGetLogs(t *testing.T) {
 
 	// After Save 2
 
-	repository = GetRepository(dir.Path())
+	repository = fixtureGetRepository(t, dir.Path())
 
 	fixtures.WriteFile(dir.Join("3.txt"), []byte("file 3 original content."))
 
@@ -94,13 +98,14 @@ func TestGetLogs(t *testing.T) {
 	repository.CreateRef("b")
 	repository.CreateRef("c")
 
-	log = repository.GetLogs()
+	log, err = repository.GetLogs()
+	assert.NoError(t, err)
 	assert.Equal(t, log.Head, "c")
 	assert.Equal(t, len(log.History), 3)
 	assert.Equal(t, len(log.History[0].Refs), 3)
 	assert.Equal(t, log.History[0].Checkpoint.Id, save2.Id)
 	assert.Equal(t, log.History[0].Checkpoint.Message, save2.Message)
-	assert.Equal(t, log.History[0].Checkpoint.Parent, save2.Parent)
+	assert.Equal(t, log.History[0].Checkpoint.Parents, save2.Parents)
 	// When saving the time in the file, using the Layout format, we lose the ms precision.
 	// Therefore this is needed to compare times
 	assert.Equal(t, log.History[0].Checkpoint.CreatedAt.Format(time.Layout), save2.CreatedAt.Format(time.Layout))
@@ -109,7 +114,7 @@ func TestGetLogs(t *testing.T) {
 	assert.Equal(t, len(log.History[1].Refs), 0)
 	assert.Equal(t, log.History[1].Checkpoint.Id, save1.Id)
 	assert.Equal(t, log.History[1].Checkpoint.Message, save1.Message)
-	assert.Equal(t, log.History[1].Checkpoint.Parent, save1.Parent)
+	assert.Equal(t, log.History[1].Checkpoint.Parents, save1.Parents)
 	// When saving the time in the file, using the Layout format, we lose the ms precision.
 	// Therefore this is needed to compare times
 	assert.Equal(t, log.History[1].Checkpoint.CreatedAt.Format(time.Layout), save1.CreatedAt.Format(time.Layout))
@@ -119,7 +124,7 @@ func TestGetLogs(t *testing.T) {
 	assert.Equal(t, log.History[2].Refs[0], filesystems.INITIAL_REF_NAME)
 	assert.Equal(t, log.History[2].Checkpoint.Id, save0.Id)
 	assert.Equal(t, log.History[2].Checkpoint.Message, save0.Message)
-	assert.Equal(t, log.History[2].Checkpoint.Parent, save0.Parent)
+	assert.Equal(t, log.History[2].Checkpoint.Parents, save0.Parents)
 	// When saving the time in the file, using the Layout format, we lose the ms precision.
 	// Therefore this is needed to compare times
 	assert.Equal(t, log.History[2].Checkpoint.CreatedAt.Format(time.Layout), save0.CreatedAt.Format(time.Layout))
@@ -1,89 +1,80 @@
 package repositories
 
 import (
-	"bytes"
-	"crypto/sha256"
-	"encoding/hex"
-	"io"
-	"io/fs"
-	"os"
-	Path "path/filepath"
 	"saymow/version-manager/app/pkg/errors"
 	"saymow/version-manager/app/repositories/directories"
-	"saymow/version-manager/app/repositories/filesystems"
-	"strings"
+	"slices"
 
 	"github.com/golang-collections/collections/set"
 )
 
-func (repository *Repository) GetStatus() *Status {
+func (repository *Repository) GetStatus() (_ *Status, err error) {
+	defer errors.Recover(&err)
+
 	status := Status{}
 	seenPaths := set.New()
 	trackedPaths := set.New()
 
-	for _, file := range repository.dir.CollectAllFiles() {
-		trackedPaths.Insert(file.Filepath)
-	}
+	tracked := repository.getTrackedFiles()
 
-	for _, change := range repository.index {
-		trackedPaths.Insert(change.GetPath())
+	for _, filepath := range tracked.paths {
+		trackedPaths.Insert(filepath)
 	}
 
-	Path.Walk(repository.fs.Root, func(filepath string, info fs.FileInfo, err error) error {
-		errors.Check(err)
-		if repository.fs.Root == filepath || strings.HasPrefix(filepath, Path.Join(repository.fs.Root, filesystems.REPOSITORY_FOLDER_NAME)) {
-			return nil
-		}
-		if info.IsDir() {
-			return nil
-		}
+	statCache, err := repository.fs.ReadStatCache()
+	errors.Check(err)
 
-		seenPaths.Insert(filepath)
+	// Tracked files are hashed concurrently once the walk is done
+	walkedTrackedPaths := []string{}
 
-		savedFile := repository.findSavedFile(filepath)
-		stagedChange := repository.findStagedChange(filepath)
+	for _, filepath := range repository.listWorkingDirFiles(repository.fs.Root, tracked) {
+		seenPaths.Insert(filepath)
 
-		if savedFile == nil && stagedChange == nil {
+		if tracked.isTracked(filepath) {
+			walkedTrackedPaths = append(walkedTrackedPaths, filepath)
+		} else {
 			status.WorkingDir.UntrackedFilePaths = append(status.WorkingDir.UntrackedFilePaths, filepath)
-			return nil
 		}
+	}
 
-		file, err := os.Open(filepath)
-		errors.Check(err)
-		defer errors.CheckFn(file.Close)
-
-		var buffer bytes.Buffer
-		chunkBuffer := make([]byte, 1024)
-
-		for {
-			n, err := file.Read(chunkBuffer)
-
-			if err != nil && err != io.EOF {
-				errors.Error(err.Error())
-			}
-			if n == 0 {
-				break
-			}
+	workingFiles := make([]*directories.File, len(walkedTrackedPaths))
+	err = repository.runWorkers(HASHING_OPERATION, len(walkedTrackedPaths), func(idx int) error {
+		workingFile, err := statCache.Hash(walkedTrackedPaths[idx])
+		workingFiles[idx] = workingFile
 
-			_, err = buffer.Write(chunkBuffer[:n])
-			errors.Check(err)
-		}
+		return err
+	})
+	errors.Check(err)
 
-		hasher := sha256.New()
-		_, err = hasher.Write(buffer.Bytes())
-		errors.Check(err)
-		fileHash := hex.EncodeToString(hasher.Sum(nil))
+	for idx, filepath := range walkedTrackedPaths {
+		savedFile := tracked.findSavedFile(filepath)
+		stagedChange := tracked.findStagedChange(filepath)
+		workingFile := workingFiles[idx]
 
 		if stagedChange != nil {
 			if stagedChange.ChangeType == directories.Removal {
 				status.Staged.RemovedFilePaths = append(status.Staged.RemovedFilePaths, stagedChange.Removal.Filepath)
+
+				// The file was kept in the working directory, e.g. by rm --cached
+				if !repository.isIgnored(filepath, false) {
+					status.WorkingDir.UntrackedFilePaths = append(status.WorkingDir.UntrackedFilePaths, filepath)
+				}
+			} else if stagedChange.ChangeType == directories.Rename {
+				status.Staged.RenamedFiles = append(status.Staged.RenamedFiles, RenamedFileStatus{
+					FromFilepath: stagedChange.Rename.FromFilepath,
+					Filepath:     filepath,
+				})
+
+				if !stagedChange.File.Equals(workingFile) {
+					status.WorkingDir.ModifiedFilePaths = append(status.WorkingDir.ModifiedFilePaths, filepath)
+				}
 			} else if stagedChange.ChangeType == directories.Conflict {
 				status.Staged.ConflictedFilesPaths = append(status.Staged.ConflictedFilesPaths, ConflictedFileStatus{
 					Filepath: stagedChange.GetPath(),
 					Message:  stagedChange.Conflict.Message,
 				})
 
-				if stagedChange.Conflict.ObjectName != fileHash {
+				if stagedChange.Conflict.ObjectName != workingFile.ObjectName {
 					status.WorkingDir.ModifiedFilePaths = append(status.WorkingDir.ModifiedFilePaths, filepath)
 				}
 			} else {
@@ -93,28 +84,59 @@ func (repository *Repository) GetStatus() *Status {
 					status.Staged.ModifiedFilePaths = append(status.Staged.ModifiedFilePaths, filepath)
 				}
 
-				if stagedChange.File.ObjectName != fileHash {
+				if !stagedChange.File.Equals(workingFile) {
 					status.WorkingDir.ModifiedFilePaths = append(status.WorkingDir.ModifiedFilePaths, filepath)
 				}
 			}
 		} else {
-			if savedFile.ObjectName != fileHash {
+			if !savedFile.Equals(workingFile) {
 				status.WorkingDir.ModifiedFilePaths = append(status.WorkingDir.ModifiedFilePaths, filepath)
 			}
 		}
-
-		return nil
-	})
+	}
 
 	trackedPaths.Difference(seenPaths).Do(func(i interface{}) {
 		filepath := i.(string)
 
-		if repository.findStagedChange(filepath) != nil {
+		if repository.isTrackedDirPresent(tracked.findFile(filepath)) {
+			// Empty directories are only listed while empty, files were added under it
+			return
+		}
+
+		stagedChange := tracked.findStagedChange(filepath)
+
+		if stagedChange != nil && stagedChange.ChangeType == directories.Rename {
+			status.Staged.RenamedFiles = append(status.Staged.RenamedFiles, RenamedFileStatus{
+				FromFilepath: stagedChange.Rename.FromFilepath,
+				Filepath:     filepath,
+			})
+			status.WorkingDir.RemovedFilePaths = append(status.WorkingDir.RemovedFilePaths, filepath)
+		} else if stagedChange != nil {
 			status.Staged.RemovedFilePaths = append(status.Staged.RemovedFilePaths, filepath)
 		} else {
 			status.WorkingDir.RemovedFilePaths = append(status.WorkingDir.RemovedFilePaths, filepath)
 		}
 	})
 
-	return &status
+	// Staged removals and creations of the same content are shown as renames, they are saved as such
+	for _, change := range repository.dir.DetectRenames(repository.index) {
+		if change.ChangeType != directories.Rename || tracked.findStagedChange(change.GetPath()).ChangeType != directories.Creation {
+			continue
+		}
+
+		status.Staged.CreatedFilesPaths = slices.DeleteFunc(status.Staged.CreatedFilesPaths, func(filepath string) bool {
+			return filepath == change.GetPath()
+		})
+		status.Staged.RemovedFilePaths = slices.DeleteFunc(status.Staged.RemovedFilePaths, func(filepath string) bool {
+			return filepath == change.Rename.FromFilepath
+		})
+		status.Staged.RenamedFiles = append(status.Staged.RenamedFiles, RenamedFileStatus{
+			FromFilepath: change.Rename.FromFilepath,
+			Filepath:     change.GetPath(),
+		})
+	}
+
+	errors.Check(repository.fs.WriteStatCache(statCache))
+
+	return &status, nil
 }
@@ -23,7 +23,7 @@ func TestGetStatus(t *testing.T) {
 		repository.SaveIndex()
 		repository.CreateSave("initial save")
 
-		repository = GetRepository(dir.Path())
+		repository = fixtureGetRepository(t, dir.Path())
 
 		repository.IndexFile("2.txt")
 		fixtures.WriteFile(dir.Join("a", "4.txt"), []byte("4 new content"))
@@ -31,12 +31,13 @@ func TestGetStatus(t *testing.T) {
 		repository.RemoveFile(path.Join("a", "b", "6.txt"))
 		repository.SaveIndex()
 
-		repository = GetRepository(dir.Path())
+		repository = fixtureGetRepository(t, dir.Path())
 
 		fixtures.WriteFile(dir.Join("c", "8.txt"), []byte("8 new content"))
 		fixtures.RemoveFile(dir.Join("c", "9.txt"))
 
-		status := repository.GetStatus()
+		status, err := repository.GetStatus()
+		assert.NoError(t, err)
 
 		assert.EqualValues(t, status.Staged.CreatedFilesPaths, []string{dir.Join("2.txt")})
 		assert.EqualValues(t, status.Staged.ModifiedFilePaths, []string{dir.Join("a", "4.txt")})
@@ -64,7 +65,8 @@ func TestGetStatus(t *testing.T) {
 
 		fixtures.WriteFile(dir.Join("1.txt"), []byte("it is definitely gonna fix the conflict."))
 
-		status := repository.GetStatus()
+		status, err := repository.GetStatus()
+		assert.NoError(t, err)
 
 		assert.EqualValues(t, len(status.Staged.ConflictedFilesPaths), 1)
 		assert.EqualValues(t, status.Staged.ConflictedFilesPaths[0].Filepath, dir.Join("1.txt"))
@@ -81,3 +83,58 @@ func TestGetStatus(t *testing.T) {
 		)
 	}
 }
+
+func TestGetStatusIgnoredFiles(t *testing.T) {
+	dir, repository := fixtureGetBaseProject(t)
+	defer dir.Remove()
+
+	repository.IndexFile(path.Join("c", "8.txt"))
+	repository.SaveIndex()
+	repository.CreateSave("initial save")
+
+	fixtures.WriteFile(dir.Join(".vcsignore"), []byte("/a/\nc/\n*.log\n"))
+	fixtures.WriteFile(dir.Join("1.log"), []byte("log"))
+	fixtures.WriteFile(dir.Join("c", "8.txt"), []byte("8 new content"))
+
+	repository = fixtureGetRepository(t, dir.Path())
+	status, err := repository.GetStatus()
+	assert.NoError(t, err)
+
+	// Tracked files are reported even when ignored
+	assert.EqualValues(t, status.WorkingDir.ModifiedFilePaths, []string{dir.Join("c", "8.txt")})
+	assert.EqualValues(
+		t,
+		status.WorkingDir.UntrackedFilePaths,
+		[]string{dir.Join(".vcsignore"), dir.Join("1.txt"), dir.Join("2.txt"), dir.Join("3.txt")},
+	)
+}
+
+func TestGetStatusRenamedFiles(t *testing.T) {
+	dir, repository := fixtureGetBaseProject(t)
+	defer dir.Remove()
+
+	assert.Nil(t, repository.AddFiles([]string{"1.txt", "2.txt"}))
+	repository.SaveIndex()
+	repository.CreateSave("initial save")
+	repository = fixtureGetRepository(t, dir.Path())
+
+	// A staged removal and a staged creation with the same content are a rename
+	fixtures.WriteFile(dir.Join("10.txt"), []byte("1 content"))
+	fixtures.RemoveFile(dir.Join("1.txt"))
+	assert.Nil(t, repository.AddFiles([]string{"1.txt", "10.txt"}))
+
+	status, err := repository.GetStatus()
+	assert.NoError(t, err)
+
+	assert.Empty(t, status.Staged.CreatedFilesPaths)
+	assert.Empty(t, status.Staged.RemovedFilePaths)
+	assert.EqualValues(t, status.Staged.RenamedFiles, []RenamedFileStatus{{FromFilepath: dir.Join("1.txt"), Filepath: dir.Join("10.txt")}})
+
+	// And it is saved as such
+	repository.SaveIndex()
+	save, err := repository.CreateSave("rename")
+	assert.Nil(t, err)
+	assert.Equal(t, len(save.Changes), 1)
+	assert.Equal(t, save.Changes[0].ChangeType, directories.Rename)
+	assert.Equal(t, save.Changes[0].Rename.FromFilepath, dir.Join("1.txt"))
+}
@@ -0,0 +1,329 @@
+package ignores
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	Path "path/filepath"
+	"regexp"
+	"saymow/version-manager/app/pkg/vfs"
+	"strings"
+)
+
+const IGNORE_FILE_NAME = ".vcsignore"
+
+// Rule is a single pattern line of an ignore file.
+//
+// Rules of a nested ignore file only apply to the paths under its directory. Source is the ignore file path
+// relative to the root, slash separated.
+type Rule struct {
+	Source  string
+	Line    int
+	Pattern string
+	Negated bool
+	DirOnly bool
+	base    string
+	expr    *regexp.Regexp
+}
+
+func (rule *Rule) String() string {
+	return fmt.Sprintf("%s:%d:%s", rule.Source, rule.Line, rule.Pattern)
+}
+
+func (rule *Rule) matches(path string, isDir bool) bool {
+	if rule.DirOnly && !isDir {
+		return false
+	}
+
+	if rule.base != "" {
+		if !strings.HasPrefix(path, rule.base+"/") {
+			return false
+		}
+
+		path = path[len(rule.base)+1:]
+	}
+
+	return rule.expr.MatchString(path)
+}
+
+// Matcher resolves the ignore rules of a working directory.
+//
+// Rules are matched in precedence order: the exclude file first, then the ignore files from the root down to
+// the path directory. The last matching rule wins. Nested ignore files are only read when a path under their
+// directory is matched.
+type Matcher struct {
+	files        vfs.FS
+	root         string
+	excludeRules []*Rule
+	dirRules     map[string][]*Rule
+}
+
+// New creates a matcher for the working directory at root. The exclude file applies to the whole working
+// directory and may not exist.
+func New(files vfs.FS, root string, excludeFilepath string) (*Matcher, error) {
+	matcher := &Matcher{files: files, root: root, dirRules: make(map[string][]*Rule)}
+
+	source, err := Path.Rel(root, excludeFilepath)
+	if err != nil {
+		return nil, err
+	}
+
+	matcher.excludeRules, err = readRules(files, excludeFilepath, Path.ToSlash(source), "")
+	if err != nil {
+		return nil, err
+	}
+
+	return matcher, nil
+}
+
+// Match returns the last rule matching path, nil when no rule matches.
+//
+// A path inside an ignored directory is matched by the directory rule, since the directory content is never
+// looked at. A negated rule means the path is not ignored.
+func (matcher *Matcher) Match(path string, isDir bool) (*Rule, error) {
+	relPath, err := Path.Rel(matcher.root, path)
+	if err != nil {
+		return nil, err
+	}
+	if relPath == "." || strings.HasPrefix(relPath, "..") {
+		return nil, nil
+	}
+
+	segments := strings.Split(Path.ToSlash(relPath), "/")
+
+	for idx := 1; idx < len(segments); idx++ {
+		rule, err := matcher.matchPath(segments[:idx], true)
+		if err != nil {
+			return nil, err
+		}
+		if rule != nil && !rule.Negated {
+			return rule, nil
+		}
+	}
+
+	return matcher.matchPath(segments, isDir)
+}
+
+func (matcher *Matcher) IsIgnored(path string, isDir bool) (bool, error) {
+	rule, err := matcher.Match(path, isDir)
+	if err != nil {
+		return false, err
+	}
+
+	return rule != nil && !rule.Negated, nil
+}
+
+func (matcher *Matcher) matchPath(segments []string, isDir bool) (*Rule, error) {
+	path := strings.Join(segments, "/")
+	var matchedRule *Rule
+
+	check := func(rules []*Rule) {
+		for _, rule := range rules {
+			if rule.matches(path, isDir) {
+				matchedRule = rule
+			}
+		}
+	}
+
+	check(matcher.excludeRules)
+
+	for idx := 0; idx < len(segments); idx++ {
+		rules, err := matcher.getDirRules(strings.Join(segments[:idx], "/"))
+		if err != nil {
+			return nil, err
+		}
+
+		check(rules)
+	}
+
+	return matchedRule, nil
+}
+
+func (matcher *Matcher) getDirRules(dir string) ([]*Rule, error) {
+	if rules, ok := matcher.dirRules[dir]; ok {
+		return rules, nil
+	}
+
+	source := IGNORE_FILE_NAME
+	if dir != "" {
+		source = dir + "/" + IGNORE_FILE_NAME
+	}
+
+	rules, err := readRules(matcher.files, Path.Join(matcher.root, Path.FromSlash(source)), source, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	matcher.dirRules[dir] = rules
+
+	return rules, nil
+}
+
+func readRules(files vfs.FS, filepath string, source string, base string) ([]*Rule, error) {
+	file, err := files.Open(filepath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*Rule{}, nil
+		}
+
+		return nil, err
+	}
+	defer file.Close()
+
+	rules := []*Rule{}
+	scanner := bufio.NewScanner(file)
+
+	for line := 1; scanner.Scan(); line++ {
+		if rule := parseRule(scanner.Text()); rule != nil {
+			rule.Source = source
+			rule.Line = line
+			rule.base = base
+			rules = append(rules, rule)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// parseRule parses a gitignore style pattern, nil is returned for blank lines, comments and invalid patterns.
+func parseRule(line string) *Rule {
+	line = strings.TrimSuffix(line, "\r")
+	if !strings.HasSuffix(line, "\\ ") {
+		line = strings.TrimRight(line, " \t")
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+
+	rule := &Rule{Pattern: line}
+	pattern := line
+
+	if strings.HasPrefix(pattern, "!") {
+		rule.Negated = true
+		pattern = pattern[1:]
+	} else if strings.HasPrefix(pattern, "\\!") || strings.HasPrefix(pattern, "\\#") {
+		pattern = pattern[1:]
+	}
+
+	if strings.HasSuffix(pattern, "/") {
+		rule.DirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+
+	// Patterns with a slash are relative to the ignore file directory, others match at any depth
+	if strings.Contains(pattern, "/") {
+		pattern = strings.TrimPrefix(pattern, "/")
+	} else {
+		pattern = "**/" + pattern
+	}
+
+	if pattern == "" || pattern == "**/" {
+		return nil
+	}
+
+	expr, err := regexp.Compile(compilePattern(pattern))
+	if err != nil {
+		return nil
+	}
+
+	rule.expr = expr
+
+	return rule
+}
+
+// CompileGlob compiles a slash separated glob. "*" and "?" do not match "/", and a "**" segment matches any
+// number of directories.
+func CompileGlob(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile(compilePattern(pattern))
+}
+
+func compilePattern(pattern string) string {
+	var expr strings.Builder
+	segments := strings.Split(pattern, "/")
+
+	expr.WriteString("^")
+
+	for idx, segment := range segments {
+		isLast := idx == len(segments)-1
+
+		if segment == "**" {
+			if isLast {
+				expr.WriteString(".*")
+			} else {
+				expr.WriteString("(?:.*/)?")
+			}
+
+			continue
+		}
+
+		expr.WriteString(compileGlob(segment))
+
+		if !isLast {
+			expr.WriteString("/")
+		}
+	}
+
+	expr.WriteString("$")
+
+	return expr.String()
+}
+
+func compileGlob(glob string) string {
+	var expr strings.Builder
+	runes := []rune(glob)
+
+	for idx := 0; idx < len(runes); idx++ {
+		switch runes[idx] {
+		case '*':
+			expr.WriteString("[^/]*")
+		case '?':
+			expr.WriteString("[^/]")
+		case '\\':
+			if idx+1 < len(runes) {
+				idx++
+			}
+
+			expr.WriteString(regexp.QuoteMeta(string(runes[idx])))
+		case '[':
+			end := idx + 1
+			if end < len(runes) && runes[end] == '!' {
+				end++
+			}
+			if end < len(runes) && runes[end] == ']' {
+				end++
+			}
+			for end < len(runes) && runes[end] != ']' {
+				end++
+			}
+
+			if end >= len(runes) {
+				expr.WriteString(regexp.QuoteMeta("["))
+				continue
+			}
+
+			expr.WriteString("[")
+			class := runes[idx+1 : end]
+			if len(class) > 0 && class[0] == '!' {
+				expr.WriteString("^")
+				class = class[1:]
+			}
+			for _, char := range class {
+				if char == '\\' || char == '[' || char == ']' || char == '^' {
+					expr.WriteString("\\")
+				}
+				expr.WriteRune(char)
+			}
+			expr.WriteString("]")
+
+			idx = end
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(runes[idx])))
+		}
+	}
+
+	return expr.String()
+}
@@ -0,0 +1,122 @@
+package ignores
+
+import (
+	"saymow/version-manager/app/pkg/vfs"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gotest.tools/v3/fs"
+)
+
+func TestParseRule(t *testing.T) {
+	matches := func(pattern string, path string, isDir bool) bool {
+		rule := parseRule(pattern)
+		assert.NotNil(t, rule, pattern)
+
+		return rule.matches(path, isDir)
+	}
+
+	assert.Nil(t, parseRule(""))
+	assert.Nil(t, parseRule("   "))
+	assert.Nil(t, parseRule("# comment"))
+	assert.Nil(t, parseRule("/"))
+
+	assert.True(t, matches("*.log", "a.log", false))
+	assert.True(t, matches("*.log", "a/b/a.log", false))
+	assert.False(t, matches("*.log", "a.log.txt", false))
+	assert.True(t, matches("*.log   ", "a.log", false))
+
+	assert.True(t, matches("build/", "build", true))
+	assert.True(t, matches("build/", "a/build", true))
+	assert.False(t, matches("build/", "build", false))
+
+	assert.True(t, matches("/build", "build", false))
+	assert.False(t, matches("/build", "a/build", false))
+	assert.True(t, matches("a/b.txt", "a/b.txt", false))
+	assert.False(t, matches("a/b.txt", "c/a/b.txt", false))
+
+	assert.True(t, matches("**/b.txt", "b.txt", false))
+	assert.True(t, matches("**/b.txt", "a/c/b.txt", false))
+	assert.True(t, matches("a/**/b.txt", "a/b.txt", false))
+	assert.True(t, matches("a/**/b.txt", "a/c/d/b.txt", false))
+	assert.True(t, matches("a/**", "a/c/d", false))
+	assert.False(t, matches("a/**", "a", true))
+
+	assert.True(t, matches("?.txt", "a.txt", false))
+	assert.False(t, matches("?.txt", "ab.txt", false))
+	assert.True(t, matches("[ab].txt", "b.txt", false))
+	assert.False(t, matches("[!ab].txt", "b.txt", false))
+	assert.True(t, matches("[!ab].txt", "c.txt", false))
+	assert.True(t, matches("a[.txt", "a[.txt", false))
+	assert.True(t, matches("\\#a", "#a", false))
+	assert.True(t, matches("\\!a", "!a", false))
+	assert.True(t, matches("a\\*", "a*", false))
+	assert.False(t, matches("a\\*", "ab", false))
+
+	rule := parseRule("!*.txt")
+	assert.True(t, rule.Negated)
+	assert.True(t, rule.matches("a.txt", false))
+}
+
+func TestMatcher(t *testing.T) {
+	dir := fs.NewDir(
+		t,
+		"project",
+		fs.WithFile(IGNORE_FILE_NAME, "# Logs\n*.log\n!keep.log\nbuild/\ntmp\n"),
+		fs.WithDir(
+			"a",
+			fs.WithFile(IGNORE_FILE_NAME, "*.txt\n!/keep.txt\n/debug.log\n"),
+		),
+		fs.WithDir(
+			".repository",
+			fs.WithFile("exclude", "*.swp\n"),
+		),
+	)
+	defer dir.Remove()
+
+	matcher, err := New(vfs.NewOS(), dir.Path(), dir.Join(".repository", "exclude"))
+	assert.Nil(t, err)
+
+	match := func(path string, isDir bool) string {
+		rule, err := matcher.Match(path, isDir)
+		assert.Nil(t, err)
+
+		if rule == nil {
+			return ""
+		}
+
+		return rule.String()
+	}
+
+	assert.Equal(t, match(dir.Join("1.txt"), false), "")
+	assert.Equal(t, match(dir.Join("1.log"), false), ".vcsignore:2:*.log")
+	assert.Equal(t, match(dir.Join("keep.log"), false), ".vcsignore:3:!keep.log")
+	assert.Equal(t, match(dir.Join("b", "keep.log"), false), ".vcsignore:3:!keep.log")
+	assert.Equal(t, match(dir.Join("1.swp"), false), ".repository/exclude:1:*.swp")
+
+	// Directory rules apply to the directory content
+	assert.Equal(t, match(dir.Join("build"), true), ".vcsignore:4:build/")
+	assert.Equal(t, match(dir.Join("build", "1.txt"), false), ".vcsignore:4:build/")
+	assert.Equal(t, match(dir.Join("build"), false), "")
+	assert.Equal(t, match(dir.Join("b", "tmp", "keep.log"), false), ".vcsignore:5:tmp")
+
+	// Nested rules apply under their directory and override the parent rules
+	assert.Equal(t, match(dir.Join("a", "1.txt"), false), "a/.vcsignore:1:*.txt")
+	assert.Equal(t, match(dir.Join("a", "b", "1.txt"), false), "a/.vcsignore:1:*.txt")
+	assert.Equal(t, match(dir.Join("a", "keep.txt"), false), "a/.vcsignore:2:!/keep.txt")
+	assert.Equal(t, match(dir.Join("a", "b", "keep.txt"), false), "a/.vcsignore:1:*.txt")
+	assert.Equal(t, match(dir.Join("a", "debug.log"), false), "a/.vcsignore:3:/debug.log")
+	assert.Equal(t, match(dir.Join("a", "keep.log"), false), ".vcsignore:3:!keep.log")
+
+	ignored, err := matcher.IsIgnored(dir.Join("keep.log"), false)
+	assert.Nil(t, err)
+	assert.False(t, ignored)
+
+	ignored, err = matcher.IsIgnored(dir.Join("a", "1.txt"), false)
+	assert.Nil(t, err)
+	assert.True(t, ignored)
+
+	// Paths outside the root are never ignored
+	assert.Equal(t, match(dir.Path(), true), "")
+	assert.Equal(t, match(dir.Join("..", "1.log"), false), "")
+}
@@ -1,44 +1,134 @@
 package repositories
 
 import (
-	"os"
 	"saymow/version-manager/app/pkg/errors"
 	"saymow/version-manager/app/repositories/directories"
 	"slices"
 )
 
 func (repository *Repository) IndexFile(filepath string) error {
+	return repository.IndexFiles([]string{filepath})
+}
+
+// IndexFiles writes the files objects concurrently. The paths are validated before any object is written, and
+// the index is then updated in the paths order.
+func (repository *Repository) IndexFiles(filepaths []string) (err error) {
+	defer errors.Recover(&err)
+
 	if repository.isDetachedMode() {
 		return &ValidationError{"cannot make changes in detached mode."}
 	}
 
-	filepath, err := repository.dir.AbsPath(filepath)
-	if err != nil {
-		return &ValidationError{err.Error()}
+	absPaths := []string{}
+	tracked := repository.getTrackedFiles()
+
+	for _, filepath := range filepaths {
+		filepath, err := repository.dir.AbsPath(filepath)
+		if err != nil {
+			return &ValidationError{err.Error()}
+		}
+
+		if !tracked.isTracked(filepath) && repository.isIgnored(filepath, false) {
+			return &ValidationError{"path is ignored."}
+		}
+
+		absPaths = append(absPaths, filepath)
 	}
 
-	file, err := os.Open(filepath)
+	objects := make([]*directories.File, len(absPaths))
+	err = repository.runWorkers(INDEXING_OPERATION, len(absPaths), func(idx int) error {
+		file, mode, err := repository.fs.OpenWorkingFile(absPaths[idx])
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		object, err := repository.fs.WriteObject(absPaths[idx], file)
+		if err != nil {
+			return err
+		}
+
+		object.Mode = mode
+		objects[idx] = object
+
+		return nil
+	})
 	errors.Check(err)
-	defer errors.CheckFn(file.Close)
 
-	object := repository.fs.WriteObject(filepath, file)
+	repository.indexObjects(objects)
+
+	return nil
+}
+
+// indexObjects records the objects in the index and removes the objects of the changes they replaced.
+func (repository *Repository) indexObjects(objects []*directories.File) {
+	staleObjects := []string{}
+	for _, object := range objects {
+		staleObjects = append(staleObjects, repository.indexObject(object)...)
+	}
+
+	// A stale object may have been written again for another path
+	repository.removeUnusedObjects(staleObjects)
+}
+
+// removeUnusedObjects removes the objects that are not used by the index, the HEAD files or the files being
+// merged. A conflicted merge stages the objects of the incoming save. Older saves are left to CollectGarbage.
+func (repository *Repository) removeUnusedObjects(objectNames []string) {
+	if len(objectNames) == 0 {
+		return
+	}
+
+	usedObjects := make(map[string]bool)
+	for _, change := range repository.index {
+		markChangeObjects(change, usedObjects)
+	}
+	for _, file := range repository.dir.CollectAllFiles() {
+		usedObjects[file.ObjectName] = true
+	}
+	if mergeSave := repository.getSave(repository.mergeHead); mergeSave != nil {
+		for _, file := range buildDir(repository.fs.Root, mergeSave).CollectAllFiles() {
+			usedObjects[file.ObjectName] = true
+		}
+	}
+
+	for _, objectName := range objectNames {
+		if !usedObjects[objectName] {
+			errors.Check(repository.fs.RemoveObject(objectName))
+		}
+	}
+}
+
+// indexObject records the object in the index and returns the objects of the index changes it replaced.
+func (repository *Repository) indexObject(object *directories.File) []string {
+	filepath := object.Filepath
+	staleObjects := []string{}
 	stagedChangeIdx := repository.findStagedChangeIdx(filepath)
 	savedObject := repository.findSavedFile(filepath)
 	var ChangeType directories.ChangeType
+	var rename *directories.FileRename
 
-	if savedObject != nil {
+	if repository.findRenameSource(filepath) != nil {
+		// The saved file was renamed, a new file is created in its place
+		savedObject = nil
+	}
+
+	if stagedChangeIdx != -1 && repository.index[stagedChangeIdx].ChangeType == directories.Rename {
+		// The renamed file content is updated
+		ChangeType = directories.Rename
+		rename = repository.index[stagedChangeIdx].Rename
+	} else if savedObject != nil {
 		ChangeType = directories.Modification
 	} else {
 		ChangeType = directories.Creation
 	}
 
-	if savedObject != nil && savedObject.ObjectName == object.ObjectName {
+	if savedObject != nil && savedObject.Equals(object) {
 		// No changes at all
 
 		if stagedChangeIdx != -1 {
 			if repository.index[stagedChangeIdx].GetHash() != object.ObjectName {
 				// Remove change file object
-				repository.fs.RemoveObject(repository.index[stagedChangeIdx].GetHash())
+				staleObjects = append(staleObjects, repository.index[stagedChangeIdx].GetHash())
 			}
 
 			// Undo index existing change
@@ -51,24 +141,29 @@ func (repository *Repository) IndexFile(filepath string) error {
 			stagedChange.GetHash() != object.ObjectName &&
 			stagedChange.Conflict.IsObjectTemporary() {
 			// Remove conflicted temp file object
-			repository.fs.RemoveObject(stagedChange.GetHash())
+			staleObjects = append(staleObjects, stagedChange.GetHash())
 		}
 
-		if (stagedChange.ChangeType == directories.Creation || stagedChange.ChangeType == directories.Modification) &&
+		if (stagedChange.ChangeType == directories.Creation || stagedChange.ChangeType == directories.Modification || stagedChange.ChangeType == directories.Rename) &&
 			stagedChange.GetHash() != object.ObjectName {
 			// Remove change file object
-			repository.fs.RemoveObject(stagedChange.GetHash())
+			staleObjects = append(staleObjects, stagedChange.GetHash())
 		}
 
-		// Undo index existing change
-		repository.index = slices.Delete(repository.index, stagedChangeIdx, stagedChangeIdx+1)
-		// Index change
-		repository.index = append(repository.index, &directories.Change{ChangeType: ChangeType, File: object})
+		if ChangeType == directories.Rename {
+			// Keep the rename before the changes staged at its source path
+			repository.index[stagedChangeIdx] = &directories.Change{ChangeType: ChangeType, File: object, Rename: rename}
+		} else {
+			// Undo index existing change
+			repository.index = slices.Delete(repository.index, stagedChangeIdx, stagedChangeIdx+1)
+			// Index change
+			repository.index = append(repository.index, &directories.Change{ChangeType: ChangeType, File: object})
+		}
 
 	} else {
 		// Index change
 		repository.index = append(repository.index, &directories.Change{ChangeType: ChangeType, File: object})
 	}
 
-	return nil
+	return staleObjects
 }
@@ -44,6 +44,7 @@ func TestIndexFile(t *testing.T) {
 					t,
 					fs.WithFile(filesystems.REFS_FILE_NAME, fmt.Sprintf("Refs:\n\n%s\n\n", filesystems.INITIAL_REF_NAME)),
 					fs.WithFile(filesystems.HEAD_FILE_NAME, filesystems.INITIAL_REF_NAME),
+					fs.WithFile(filesystems.VERSION_FILE_NAME, fmt.Sprint(filesystems.REPOSITORY_VERSION)),
 					fs.WithFile(filesystems.INDEX_FILE_NAME, "Tracked files:\r\n\r\n"),
 					fs.WithDir(filesystems.SAVES_FOLDER_NAME),
 					fs.WithDir(
@@ -81,6 +82,7 @@ func TestIndexFile(t *testing.T) {
 						t,
 						fs.WithFile(filesystems.REFS_FILE_NAME, fmt.Sprintf("Refs:\n\n%s\n\n", filesystems.INITIAL_REF_NAME)),
 						fs.WithFile(filesystems.HEAD_FILE_NAME, filesystems.INITIAL_REF_NAME),
+						fs.WithFile(filesystems.VERSION_FILE_NAME, fmt.Sprint(filesystems.REPOSITORY_VERSION)),
 						fs.WithFile(filesystems.INDEX_FILE_NAME, "Tracked files:\r\n\r\n"),
 						fs.WithDir(filesystems.SAVES_FOLDER_NAME),
 						fs.WithDir(
@@ -135,6 +137,7 @@ func TestIndexFile(t *testing.T) {
 					t,
 					fs.WithFile(filesystems.REFS_FILE_NAME, fmt.Sprintf("Refs:\n\n%s\n\n", filesystems.INITIAL_REF_NAME)),
 					fs.WithFile(filesystems.HEAD_FILE_NAME, filesystems.INITIAL_REF_NAME),
+					fs.WithFile(filesystems.VERSION_FILE_NAME, fmt.Sprint(filesystems.REPOSITORY_VERSION)),
 					fs.WithFile(filesystems.INDEX_FILE_NAME, "Tracked files:\r\n\r\n"),
 					fs.WithDir(filesystems.SAVES_FOLDER_NAME),
 					fs.WithDir(
@@ -321,3 +324,172 @@ func TestIndexConflictedFile(t *testing.T) {
 		assert.True(t, fixtures.FileExists(dir.Join(filesystems.REPOSITORY_FOLDER_NAME, filesystems.OBJECTS_FOLDER_NAME, permanentObjectName)))
 	}
 }
+
+func TestIndexFiles(t *testing.T) {
+	dir, repository := fixtureGetBaseProject(t)
+	defer dir.Remove()
+
+	repository.SetParallelism(4)
+	objectPath := func(name string) string {
+		return dir.Join(filesystems.REPOSITORY_FOLDER_NAME, filesystems.OBJECTS_FOLDER_NAME, name)
+	}
+
+	// Paths are validated before any object is written
+	{
+		err := repository.IndexFiles([]string{"1.txt", dir.Join("..", "1.txt")})
+		assert.EqualError(t, err, "Validation Error: invalid path.")
+
+		entries, err := os.ReadDir(dir.Join(filesystems.REPOSITORY_FOLDER_NAME, filesystems.OBJECTS_FOLDER_NAME))
+		assert.Nil(t, err)
+		assert.Equal(t, len(entries), 0)
+	}
+
+	// The index follows the paths order
+	{
+		paths := []string{"1.txt", "2.txt", "3.txt", dir.Join("a", "4.txt"), dir.Join("a", "b", "6.txt"), dir.Join("c", "8.txt")}
+		assert.Nil(t, repository.IndexFiles(paths))
+
+		indexedPaths := collections.Map(repository.index, func(change *directories.Change, _ int) string {
+			return change.GetPath()
+		})
+		assert.Equal(t, indexedPaths, []string{
+			dir.Join("1.txt"), dir.Join("2.txt"), dir.Join("3.txt"), dir.Join("a", "4.txt"), dir.Join("a", "b", "6.txt"), dir.Join("c", "8.txt"),
+		})
+
+		for _, change := range repository.index {
+			assert.True(t, fixtures.FileExists(objectPath(change.GetHash())))
+		}
+	}
+
+	// A replaced object is kept when another path uses it
+	{
+		oldObjectName := repository.index[0].GetHash()
+
+		fixtures.WriteFile(dir.Join("1.txt"), []byte("1 new content"))
+		fixtures.WriteFile(dir.Join("2.txt"), []byte("1 content"))
+		assert.Nil(t, repository.IndexFiles([]string{"1.txt", "2.txt"}))
+
+		assert.Equal(t, repository.findStagedChange(dir.Join("2.txt")).GetHash(), oldObjectName)
+		assert.True(t, fixtures.FileExists(objectPath(oldObjectName)))
+	}
+}
+
+func TestIndexFileModes(t *testing.T) {
+	dir, repository := fixtureGetBaseProject(t)
+	defer dir.Remove()
+
+	assert.Nil(t, os.Chmod(dir.Join("2.txt"), 0755))
+	assert.Nil(t, os.Symlink("1.txt", dir.Join("link")))
+	fixtures.MakeDirs(dir.Join("empty"))
+
+	// Empty directories and symlinks are listed as files
+	status, err := repository.GetStatus()
+	assert.NoError(t, err)
+	assert.Contains(t, status.WorkingDir.UntrackedFilePaths, dir.Join("empty"))
+	assert.Contains(t, status.WorkingDir.UntrackedFilePaths, dir.Join("link"))
+
+	assert.Nil(t, repository.AddFiles([]string{"1.txt", "2.txt", "empty", "link"}))
+	assert.Equal(t, repository.findStagedChange(dir.Join("1.txt")).File.Mode, directories.RegularMode)
+	assert.Equal(t, repository.findStagedChange(dir.Join("2.txt")).File.Mode, directories.ExecutableMode)
+	assert.Equal(t, repository.findStagedChange(dir.Join("empty")).File.Mode, directories.DirMode)
+	assert.Equal(t, repository.findStagedChange(dir.Join("link")).File.Mode, directories.SymlinkMode)
+
+	repository.SaveIndex()
+	repository.CreateSave("modes")
+	repository = fixtureGetRepository(t, dir.Path())
+
+	assert.Equal(t, repository.findSavedFile(dir.Join("2.txt")).Mode, directories.ExecutableMode)
+	assert.Equal(t, repository.findSavedFile(dir.Join("empty")).Mode, directories.DirMode)
+	assert.Equal(t, repository.findSavedFile(dir.Join("link")).Mode, directories.SymlinkMode)
+
+	// Mode changes are modifications
+	{
+		assert.Nil(t, os.Chmod(dir.Join("2.txt"), 0644))
+
+		status, err := repository.GetStatus()
+		assert.NoError(t, err)
+		assert.Equal(t, status.WorkingDir.ModifiedFilePaths, []string{dir.Join("2.txt")})
+
+		fileDiffs, err := repository.GetWorkingDirDiff()
+		assert.NoError(t, err)
+		assert.Equal(t, len(fileDiffs), 1)
+		assert.Equal(t, fileDiffs[0].OldMode, directories.ExecutableMode)
+		assert.Equal(t, fileDiffs[0].NewMode, directories.RegularMode)
+		assert.Equal(t, len(fileDiffs[0].Hunks), 0)
+
+		assert.Nil(t, repository.IndexFile("2.txt"))
+		assert.Equal(t, repository.findStagedChange(dir.Join("2.txt")).ChangeType, directories.Modification)
+		assert.Equal(t, repository.findStagedChange(dir.Join("2.txt")).File.Mode, directories.RegularMode)
+	}
+
+	// Empty directories stay tracked once files are added under them
+	{
+		fixtures.WriteFile(dir.Join("empty", "10.txt"), []byte("10 content"))
+
+		status, err := repository.GetStatus()
+		assert.NoError(t, err)
+		assert.Empty(t, status.WorkingDir.RemovedFilePaths)
+		assert.Equal(t, status.WorkingDir.UntrackedFilePaths, []string{dir.Join("3.txt"), dir.Join("a", "4.txt"), dir.Join("a", "5.txt"), dir.Join("a", "b", "6.txt"), dir.Join("a", "b", "7.txt"), dir.Join("c", "8.txt"), dir.Join("c", "9.txt"), dir.Join("empty", "10.txt")})
+
+		fixtures.RemoveFile(dir.Join("empty", "10.txt"))
+	}
+
+	// Files are restored with their modes
+	{
+		assert.Nil(t, os.Remove(dir.Join("link")))
+		assert.Nil(t, os.Remove(dir.Join("empty")))
+		assert.Nil(t, repository.Restore("HEAD", "link"))
+		assert.Nil(t, repository.Restore("HEAD", "empty"))
+		assert.Nil(t, repository.Unstage([]string{"2.txt"}))
+		assert.Nil(t, repository.Restore("HEAD", "2.txt"))
+
+		target, err := os.Readlink(dir.Join("link"))
+		assert.Nil(t, err)
+		assert.Equal(t, target, "1.txt")
+		assert.True(t, fixtures.FileExists(dir.Join("empty")))
+		info, err := os.Stat(dir.Join("2.txt"))
+		assert.Nil(t, err)
+		assert.Equal(t, info.Mode().Perm(), os.FileMode(filesystems.EXECUTABLE_FILES_PERMISSIONS))
+
+		status, err := repository.GetStatus()
+		assert.NoError(t, err)
+		assert.Empty(t, status.WorkingDir.ModifiedFilePaths)
+		assert.Empty(t, status.WorkingDir.RemovedFilePaths)
+	}
+}
+
+func TestRemoveUnusedObjects(t *testing.T) {
+	// b.txt is staged with the object of the merged feature save, replacing it must keep the object
+	tests := []struct {
+		name    string
+		replace func(dir *fs.Dir, repository *Repository) error
+	}{
+		{"add", func(dir *fs.Dir, repository *Repository) error {
+			fixtures.WriteFile(dir.Join("b.txt"), []byte("b.txt merged content."))
+			return repository.AddFiles([]string{"b.txt"})
+		}},
+		{"unstage", func(dir *fs.Dir, repository *Repository) error {
+			return repository.Unstage([]string{"b.txt"})
+		}},
+		{"rm", func(dir *fs.Dir, repository *Repository) error {
+			return repository.RemoveFiles([]string{"b.txt"}, false, true, false)
+		}},
+		{"restore", func(dir *fs.Dir, repository *Repository) error {
+			return repository.Restore("HEAD", dir.Join("b.txt"))
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, repository := fixtureGetConflictedMerge(t)
+			defer dir.Remove()
+
+			assert.Nil(t, test.replace(dir, repository))
+			repository.SaveIndex()
+
+			report, err := CheckIntegrity(dir.Path())
+			assert.NoError(t, err)
+			assert.False(t, report.HasProblems())
+		})
+	}
+}
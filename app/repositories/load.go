@@ -1,14 +1,21 @@
 package repositories
 
-func (repository *Repository) Load(ref string) error {
+import "saymow/version-manager/app/pkg/errors"
+
+func (repository *Repository) Load(ref string) (err error) {
+	defer errors.Recover(&err)
+
 	save := repository.getSave(ref)
 	if save == nil {
-		return &ValidationError{"invalid ref."}
+		return &InvalidRefError{ref}
 	}
 
-	workingDir := repository.GetStatus().WorkingDir
+	status, err := repository.GetStatus()
+	errors.Check(err)
+
+	workingDir := status.WorkingDir
 	if len(workingDir.ModifiedFilePaths)+len(workingDir.RemovedFilePaths)+len(workingDir.UntrackedFilePaths) > 0 {
-		return &ValidationError{"unsaved changes."}
+		return &ConflictError{"unsaved changes."}
 	}
 
 	dir := buildDir(repository.fs.Root, save)
@@ -17,13 +24,15 @@ func (repository *Repository) Load(ref string) error {
 	// if we are traversing the root dir, the root-dir-file should be removed from the response.
 	nodes = nodes[1:]
 
-	repository.fs.SafeRemoveWorkingDir(dir.Path)
+	errors.Check(repository.fs.SafeRemoveWorkingDir(dir.Path))
 
 	for _, node := range nodes {
-		repository.fs.CreateNode(node)
+		errors.Check(repository.fs.CreateNode(node))
 	}
 
 	repository.setHead(ref)
+	// A pending merge is abandoned when loading other files tree
+	repository.setMergeHead("")
 
 	return nil
 }
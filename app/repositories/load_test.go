@@ -14,15 +14,22 @@ func TestInvalidLoad(t *testing.T) {
 	dir, repository := fixtureGetCustomProject(t, fixtureMakeBasicRepositoryFs)
 	defer dir.Remove()
 
-	assert.EqualError(t, repository.Load(""), "Validation Error: invalid ref.")
-	assert.EqualError(t, repository.Load("____"), "Validation Error: invalid ref.")
-	assert.EqualError(t, repository.Load("invalid"), "Validation Error: invalid ref.")
+	assert.EqualError(t, repository.Load(""), "Ref Error: invalid ref \"\".")
+	assert.EqualError(t, repository.Load("____"), "Ref Error: invalid ref \"____\".")
+	assert.EqualError(t, repository.Load("invalid"), "Ref Error: invalid ref \"invalid\".")
 
 	fixtures.WriteFile(dir.Join("1.txt"), []byte("1 updated content."))
 	fixtures.WriteFile(dir.Join("2.txt"), []byte("2 updated content."))
 	fixtures.RemoveFile(dir.Join("a", "4.txt"))
 
-	assert.EqualError(t, repository.Load("9a35bd416196f27e40f4f9e4768496ef29c1922f0ab5e2651a218e4d4cb09688"), "Validation Error: unsaved changes.")
+	assert.EqualError(t, repository.Load("9a35bd416196f27e40f4f9e4768496ef29c1922f0ab5e2651a218e4d4cb09688"), "Conflict Error: unsaved changes.")
+
+	var invalidRefErr *InvalidRefError
+	assert.ErrorAs(t, repository.Load("invalid"), &invalidRefErr)
+	assert.Equal(t, invalidRefErr.Ref, "invalid")
+
+	var conflictErr *ConflictError
+	assert.ErrorAs(t, repository.Load("9a35bd416196f27e40f4f9e4768496ef29c1922f0ab5e2651a218e4d4cb09688"), &conflictErr)
 }
 
 func TestLoad(t *testing.T) {
@@ -59,7 +66,7 @@ func TestLoad(t *testing.T) {
 
 	// Save 1
 
-	repository = GetRepository(dir.Path())
+	repository = fixtureGetRepository(t, dir.Path())
 
 	fixtures.WriteFile(dir.Join("1.txt"), []byte("1 updated content."))
 	fixtures.MakeDirs(dir.Join("c"))
@@ -79,7 +86,7 @@ func TestLoad(t *testing.T) {
 
 	// Save 2
 
-	repository = GetRepository(dir.Path())
+	repository = fixtureGetRepository(t, dir.Path())
 
 	fixtures.WriteFile(dir.Join("2.txt"), []byte("2 updated content."))
 	fixtures.MakeDirs(dir.Join("d"))
@@ -99,7 +106,7 @@ func TestLoad(t *testing.T) {
 
 	// Save 2
 
-	repository = GetRepository(dir.Path())
+	repository = fixtureGetRepository(t, dir.Path())
 
 	fixtures.WriteFile(dir.Join("3.txt"), []byte("3 updated content."))
 	fixtures.MakeDirs(dir.Join("e"))
@@ -122,7 +129,7 @@ func TestLoad(t *testing.T) {
 	// Load Save 0
 	{
 
-		repository = GetRepository(dir.Path())
+		repository = fixtureGetRepository(t, dir.Path())
 		repository.Load(save0.Id)
 
 		assert.Equal(t, repository.head, save0.Id)
@@ -157,7 +164,7 @@ func TestLoad(t *testing.T) {
 	// Load Save 1
 	{
 
-		repository = GetRepository(dir.Path())
+		repository = fixtureGetRepository(t, dir.Path())
 		repository.Load(save1.Id)
 
 		assert.Equal(t, repository.head, save1.Id)
@@ -192,7 +199,7 @@ func TestLoad(t *testing.T) {
 	// Load Save 2
 	{
 
-		repository = GetRepository(dir.Path())
+		repository = fixtureGetRepository(t, dir.Path())
 		repository.Load(save2.Id)
 
 		assert.Equal(t, repository.head, save2.Id)
@@ -227,7 +234,7 @@ func TestLoad(t *testing.T) {
 	// Load Save 3 (using ref)
 	{
 
-		repository = GetRepository(dir.Path())
+		repository = fixtureGetRepository(t, dir.Path())
 		repository.Load(filesystems.INITIAL_REF_NAME)
 
 		assert.Equal(t, repository.head, filesystems.INITIAL_REF_NAME)
@@ -2,206 +2,293 @@ package repositories
 
 import (
 	"bytes"
-	"compress/gzip"
-	"crypto/sha256"
-	"encoding/hex"
 	"fmt"
-	"os"
 	Path "path/filepath"
 	"saymow/version-manager/app/pkg/collections"
 	"saymow/version-manager/app/pkg/errors"
+	"saymow/version-manager/app/repositories/diffs"
 	"saymow/version-manager/app/repositories/directories"
 	"saymow/version-manager/app/repositories/filesystems"
-	"time"
+	"strings"
 )
 
-func (repository *Repository) createConflictFile(refFile *directories.File, incomingFile *directories.File, refName, incomingName string) *directories.FileConflict {
-	refFileContent := repository.fs.ReadDirFile(refFile)
-	incomingFileContent := repository.fs.ReadDirFile(incomingFile)
-
-	var buffer bytes.Buffer
-
-	_, err := buffer.Write([]byte(fmt.Sprintf("<%s>\n", refName)))
-	errors.Check(err)
-
-	_, err = buffer.Write(refFileContent.Bytes())
-	errors.Check(err)
-
-	_, err = buffer.Write([]byte(fmt.Sprintf("\n</%s>\n", refName)))
-	errors.Check(err)
+// mergeFiles merges the ref and incoming versions of a file line by line (diff3), using the common
+// ancestor version as base. When the file did not exist in the common ancestor, ancestorFile is nil.
+//
+// Non-overlapping changes are merged on their own and a Modification change is returned. Otherwise, a
+// conflict object is created where only the overlapping regions are marked. The merged file keeps the mode
+// changed by either side. Binary files, symlinks and directories cannot be merged line by line, their
+// conflict keeps the ref object, see keptConflict.
+func (repository *Repository) mergeFiles(ancestorFile, refFile, incomingFile *directories.File, refName, incomingName string) *directories.Change {
+	var ancestorContent []byte
+
+	mode := refFile.Mode
+	if ancestorFile != nil && ancestorFile.Mode == refFile.Mode {
+		mode = incomingFile.Mode
+	}
 
-	_, err = buffer.Write([]byte(fmt.Sprintf("<%s>\n", incomingName)))
-	errors.Check(err)
+	if ancestorFile != nil {
+		ancestorContent = repository.readObjectContent(ancestorFile)
+	}
 
-	_, err = buffer.Write(incomingFileContent.Bytes())
-	errors.Check(err)
+	refContent := repository.readObjectContent(refFile)
+	incomingContent := repository.readObjectContent(incomingFile)
+
+	if diffs.IsBinary(ancestorContent) || diffs.IsBinary(refContent) || diffs.IsBinary(incomingContent) ||
+		!isContentMode(refFile.Mode) || !isContentMode(incomingFile.Mode) {
+		return &directories.Change{
+			ChangeType: directories.Conflict,
+			Conflict: &directories.FileConflict{
+				Filepath:   refFile.Filepath,
+				ObjectName: refFile.ObjectName,
+				Message:    fmt.Sprintf("Cannot be merged, the \"%s\" version is kept.", refName),
+			},
+		}
+	}
 
-	_, err = buffer.Write([]byte(fmt.Sprintf("\n</%s>\n", incomingName)))
+	result := diffs.Merge(ancestorContent, refContent, incomingContent, refName, incomingName)
+	object, err := repository.fs.WriteObject(refFile.Filepath, bytes.NewReader(result.Content))
 	errors.Check(err)
 
-	hasher := sha256.New()
-	_, err = hasher.Write(buffer.Bytes())
-	errors.Check(err)
-	hash := hasher.Sum(nil)
+	if !result.HasConflicts() {
+		object.Mode = mode
+		return &directories.Change{ChangeType: directories.Modification, File: object}
+	}
 
-	objectName := hex.EncodeToString(hash)
-	objectFile, err := os.Create(Path.Join(repository.fs.Root, filesystems.REPOSITORY_FOLDER_NAME, filesystems.OBJECTS_FOLDER_NAME, objectName))
-	errors.Check(err)
-	defer objectFile.Close()
+	return &directories.Change{
+		ChangeType: directories.Conflict,
+		Conflict: &directories.FileConflict{
+			Filepath:   object.Filepath,
+			ObjectName: object.ObjectName,
+			Message:    "Conflict.",
+		},
+	}
+}
 
-	compressor := gzip.NewWriter(objectFile)
-	_, err = compressor.Write(buffer.Bytes())
-	errors.Check(err)
-	errors.Check(compressor.Close())
+// isContentMode tells whether files of the mode hold their content, so they can be merged or patched.
+func isContentMode(mode directories.FileMode) bool {
+	return mode == directories.RegularMode || mode == directories.ExecutableMode
+}
 
-	return &directories.FileConflict{
-		Filepath:   refFile.Filepath,
-		ObjectName: objectName,
-		Message:    "Conflict.",
-	}
+// keptConflict is a conflict of files that cannot be merged. The ref version stays in the working directory
+// and the incoming one is written beside it, to path~incoming, so that no content is mangled by conflict
+// markers. The file written beside is not tracked.
+type keptConflict struct {
+	change       *directories.Change
+	refFile      *directories.File
+	incomingFile *directories.File
 }
 
 func (repository *Repository) handleMergeSave(refSave *filesystems.Save, incomingSave *filesystems.Save, ref, incoming string) *filesystems.Save {
-	commonCheckpoint := refSave.FindFirstCommonCheckpointParent(incomingSave)
-	ancestorSave := repository.getSave(commonCheckpoint.Id)
-	dir := buildDir(repository.fs.Root, ancestorSave)
-	refCommonAncestorIdx := collections.FindIndex(refSave.Checkpoints, func(checkpoint *filesystems.Checkpoint, _ int) bool {
-		return checkpoint.Id == commonCheckpoint.Id
-	})
-	incomingAncestorIdx := collections.FindIndex(incomingSave.Checkpoints, func(checkpoint *filesystems.Checkpoint, _ int) bool {
-		return checkpoint.Id == commonCheckpoint.Id
-	})
+	ancestorDir := &directories.Dir{Path: repository.fs.Root, Children: make(map[string]*directories.Node)}
 
-	refChangesMap := make(map[string]*directories.Change)
+	if commonCheckpoint := refSave.FindFirstCommonCheckpointParent(incomingSave); commonCheckpoint != nil {
+		ancestorDir = buildDir(repository.fs.Root, repository.getSave(commonCheckpoint.Id))
+	}
 
-	for _, checkpoint := range refSave.Checkpoints[refCommonAncestorIdx+1:] {
-		for _, change := range checkpoint.Changes {
-			refChangesMap[change.GetPath()] = change
+	// Both sides changes are computed against the common ancestor file tree, and the merge result is
+	// built on top of the ref file tree.
+	dir := buildDir(repository.fs.Root, refSave)
+	refChanges := ancestorDir.Diff(dir)
+	refChangesMap := collections.ToMap(refChanges, func(change *directories.Change, _ int) string {
+		return change.GetPath()
+	})
+	// Ref renames by their source path, so that incoming changes follow the renamed files
+	refRenamesMap := collections.ToMap(
+		collections.Filter(refChanges, func(change *directories.Change, _ int) bool {
+			return change.ChangeType == directories.Rename
+		}),
+		func(change *directories.Change, _ int) string {
+			return change.Rename.FromFilepath
+		},
+	)
+
+	mergeChanges := []*directories.Change{}
+	conflictedChanges := []*directories.Change{}
 
-			normalizedPath, err := dir.NormalizePath(change.GetPath())
-			errors.Check(err)
+	findAncestorFile := func(filepath string) *directories.File {
+		normalizedPath, err := ancestorDir.NormalizePath(filepath)
+		errors.Check(err)
 
-			dir.AddNode(normalizedPath, change)
+		if node := ancestorDir.FindNode(normalizedPath); node != nil && node.NodeType == directories.FileType {
+			return node.File
 		}
-	}
 
-	conflictedChanges := []*directories.Change{}
+		return nil
+	}
+	applyChange := func(change *directories.Change) {
+		normalizedPath, err := dir.NormalizePath(change.GetPath())
+		errors.Check(err)
 
-	for _, checkpoint := range incomingSave.Checkpoints[incomingAncestorIdx+1:] {
-		for _, incomingChange := range checkpoint.Changes {
-			normalizedPath, err := dir.NormalizePath(incomingChange.GetPath())
-			errors.Check(err)
+		if change.ChangeType == directories.Conflict {
+			conflictedChanges = append(conflictedChanges, change)
+		} else {
+			mergeChanges = append(mergeChanges, change)
+		}
 
-			refChange, ok := refChangesMap[incomingChange.GetPath()]
+		errors.Check(dir.AddNode(normalizedPath, change))
+	}
+	keptConflicts := []*keptConflict{}
+	mergeFiles := func(ancestorFile, refFile, incomingFile *directories.File) *directories.Change {
+		change := repository.mergeFiles(ancestorFile, refFile, incomingFile, ref, incoming)
+		if change.ChangeType == directories.Conflict && !change.Conflict.IsObjectTemporary() {
+			keptConflicts = append(keptConflicts, &keptConflict{change: change, refFile: refFile, incomingFile: incomingFile})
+		}
 
-			if !ok || !refChange.Conflicts(incomingChange) {
-				// No conflict found, go ahead
+		return change
+	}
+	makeConflict := func(file *directories.File, message string) *directories.Change {
+		return &directories.Change{
+			ChangeType: directories.Conflict,
+			Conflict: &directories.FileConflict{
+				Filepath:   file.Filepath,
+				ObjectName: file.ObjectName,
+				Message:    message,
+			},
+		}
+	}
 
-				dir.AddNode(normalizedPath, incomingChange)
-				continue
-			}
-			// Otherwise, create conflict change
+	for _, incomingChange := range ancestorDir.Diff(buildDir(repository.fs.Root, incomingSave)) {
+		sourcePath := incomingChange.GetSourcePath()
+		refChange, ok := refChangesMap[incomingChange.GetPath()]
 
-			var change *directories.Change
+		if !ok {
+			refRename, renamedAtRef := refRenamesMap[sourcePath]
+			refSourceChange, changedAtRef := refChangesMap[sourcePath]
 
 			switch {
-			case refChange.ChangeType == directories.Removal:
-				change = &directories.Change{
-					ChangeType: directories.Conflict,
-					Conflict: &directories.FileConflict{
-						Filepath:   incomingChange.File.Filepath,
-						ObjectName: incomingChange.File.ObjectName,
-						Message:    fmt.Sprintf("Removed at \"%s\" but modified at \"%s\".", ref, incoming),
-					},
-				}
-			case incomingChange.ChangeType == directories.Removal:
-				change = &directories.Change{
-					ChangeType: directories.Conflict,
-					Conflict: &directories.FileConflict{
-						Filepath:   refChange.File.Filepath,
-						ObjectName: refChange.File.ObjectName,
-						Message:    fmt.Sprintf("Removed at \"%s\" but modified at \"%s\".", incoming, ref),
-					},
+			case renamedAtRef && incomingChange.ChangeType == directories.Removal:
+				applyChange(makeConflict(refRename.File, fmt.Sprintf("Removed at \"%s\" but renamed at \"%s\".", incoming, ref)))
+			case renamedAtRef && incomingChange.ChangeType == directories.Rename:
+				applyChange(makeConflict(incomingChange.File, fmt.Sprintf("Renamed differently at \"%s\" and \"%s\".", ref, incoming)))
+			case renamedAtRef:
+				// Modified at incoming, the changes follow the file renamed at ref
+				applyChange(mergeFiles(findAncestorFile(sourcePath), refRename.File, incomingChange.File))
+			case incomingChange.ChangeType == directories.Rename && changedAtRef && refSourceChange.ChangeType == directories.Removal:
+				applyChange(makeConflict(incomingChange.File, fmt.Sprintf("Removed at \"%s\" but renamed at \"%s\".", ref, incoming)))
+			case incomingChange.ChangeType == directories.Rename && changedAtRef:
+				// Renamed at incoming, the ref changes follow the file
+				change := mergeFiles(findAncestorFile(sourcePath), refSourceChange.File, incomingChange.File)
+				change.SetPath(incomingChange.GetPath())
+
+				if change.ChangeType == directories.Conflict {
+					applyChange(&directories.Change{ChangeType: directories.Removal, Removal: &directories.FileRemoval{Filepath: sourcePath}})
+					applyChange(change)
+				} else {
+					applyChange(&directories.Change{ChangeType: directories.Rename, File: change.File, Rename: incomingChange.Rename})
 				}
 			default:
-				change = &directories.Change{
-					ChangeType: directories.Conflict,
-					Conflict:   repository.createConflictFile(refChange.File, incomingChange.File, ref, incoming),
-				}
+				// Only changed at incoming, go ahead
+				applyChange(incomingChange)
 			}
 
-			conflictedChanges = append(conflictedChanges, change)
-			dir.AddNode(normalizedPath, change)
+			continue
+		}
+		if !refChange.Conflicts(incomingChange) {
+			// Both sides made the same change
+			continue
+		}
+		// Otherwise, try to merge both changes
+
+		switch {
+		case refChange.ChangeType == directories.Removal:
+			applyChange(makeConflict(incomingChange.File, fmt.Sprintf("Removed at \"%s\" but modified at \"%s\".", ref, incoming)))
+		case incomingChange.ChangeType == directories.Removal:
+			applyChange(makeConflict(refChange.File, fmt.Sprintf("Removed at \"%s\" but modified at \"%s\".", incoming, ref)))
+		default:
+			// The common version is looked up where either side renamed the file from
+			ancestorPath := sourcePath
+			if incomingChange.ChangeType != directories.Rename {
+				ancestorPath = refChange.GetSourcePath()
+			}
+
+			applyChange(mergeFiles(findAncestorFile(ancestorPath), refChange.File, incomingChange.File))
 		}
 	}
 
 	// Apply changes on the working directory
 	repository.applyDir(dir)
 
-	// Append the incoming Checkpoints to the end of the refSave, to keep the incoming save history correct
-	incomingCheckpoints := incomingSave.Checkpoints[incomingAncestorIdx+1:]
-	leafCheckpointId := refSave.Id
-
-	for len(incomingCheckpoints) > 0 {
-		// Rebuild each checkpoint accordingly
-
-		incomingCheckpoint := incomingCheckpoints[0]
-
-		checkpoint := filesystems.Checkpoint{
-			Parent:    leafCheckpointId,
-			Message:   incomingCheckpoint.Message,
-			CreatedAt: time.Now(),
-			Changes:   incomingCheckpoint.Changes,
-		}
-		leafCheckpointId = repository.fs.WriteCheckpoint(&checkpoint)
-
-		incomingCheckpoints = incomingCheckpoints[1:]
+	for _, conflict := range keptConflicts {
+		filepath := conflict.change.GetPath()
+		incomingPath := filepath + "~" + strings.NewReplacer("/", "_", "\\", "_").Replace(incoming)
+
+		// Conflicts are restored as regular files, the ref version keeps its mode
+		errors.Check(repository.fs.SafeRemoveWorkingDir(filepath))
+		errors.Check(repository.fs.CreateNode(&directories.Node{
+			NodeType: directories.FileType,
+			File:     &directories.File{Filepath: filepath, ObjectName: conflict.refFile.ObjectName, Mode: conflict.refFile.Mode},
+		}))
+		errors.Check(repository.fs.SafeRemoveWorkingDir(incomingPath))
+		errors.Check(repository.fs.CreateNode(&directories.Node{
+			NodeType: directories.FileType,
+			File:     &directories.File{Filepath: incomingPath, ObjectName: conflict.incomingFile.ObjectName, Mode: conflict.incomingFile.Mode},
+		}))
+
+		relativePath, err := Path.Rel(repository.fs.Root, incomingPath)
+		errors.Check(err)
+		conflict.change.Conflict.Message = fmt.Sprintf(
+			"Cannot be merged, the \"%s\" version is kept and the \"%s\" one is at \"%s\".", ref, incoming, relativePath,
+		)
 	}
 
 	if len(conflictedChanges) > 0 {
-		// Then populate the index with conflicting changes and let the user resolve the merge.
+		// Then populate the index with merged and conflicting changes and let the user resolve the merge.
+		// The merge checkpoint is created by the next save.
 
-		repository.setRef(repository.head, leafCheckpointId)
-		repository.index = conflictedChanges
-		repository.SaveIndex()
+		repository.index = append(mergeChanges, conflictedChanges...)
+		errors.Check(repository.SaveIndex())
+		repository.setMergeHead(incomingSave.Id)
 
-		return repository.getSave(leafCheckpointId)
+		return refSave
 	}
 
-	// Otherwise, append merge checkpoint at the end
+	// Otherwise, create the merge checkpoint, its changes are relative to the ref save
 	checkpoint := filesystems.Checkpoint{
 		Message:   fmt.Sprintf("Merge \"%s\" at \"%s\".", incoming, ref),
-		Parent:    leafCheckpointId,
-		CreatedAt: time.Now(),
-		Changes:   []*directories.Change{},
+		Parents:   []string{refSave.Id, incomingSave.Id},
+		CreatedAt: repository.now(),
+		Changes:   mergeChanges,
 	}
-	checkpoint.Id = repository.fs.WriteCheckpoint(&checkpoint)
+	id, err := repository.fs.WriteCheckpoint(&checkpoint)
+	errors.Check(err)
+
+	checkpoint.Id = id
 	repository.setRef(repository.head, checkpoint.Id)
 
 	return repository.getSave(checkpoint.Id)
 }
 
-func (repository *Repository) Merge(ref string) (*filesystems.Save, error) {
+func (repository *Repository) Merge(ref string) (_ *filesystems.Save, err error) {
+	defer errors.Recover(&err)
+
 	if repository.isDetachedMode() {
 		return nil, &ValidationError{"cannot make changes in detached mode."}
 	}
 
-	if len(repository.index) > 0 {
-		return nil, &ValidationError{"unsaved changes."}
+	if len(repository.index) > 0 || repository.mergeHead != "" {
+		return nil, &ConflictError{"unsaved changes."}
 	}
 
-	workingDirStatus := repository.GetStatus().WorkingDir
+	status, err := repository.GetStatus()
+	errors.Check(err)
+
+	workingDirStatus := status.WorkingDir
 	if len(workingDirStatus.ModifiedFilePaths)+len(workingDirStatus.RemovedFilePaths)+len(workingDirStatus.UntrackedFilePaths) > 0 {
-		return nil, &ValidationError{"unsaved changes."}
+		return nil, &ConflictError{"unsaved changes."}
 	}
 
 	refSave := repository.getSave(repository.getCurrentSaveName())
 	incomingSave := repository.getSave(ref)
 	if incomingSave == nil {
-		return nil, &ValidationError{"invalid ref."}
+		return nil, &InvalidRefError{ref}
+	}
+
+	if refSave != nil && refSave.Contains(incomingSave) {
+		return nil, &ValidationError{"already up to date."}
 	}
 
-	if incomingSave.Contains(refSave) {
+	if refSave == nil || incomingSave.Contains(refSave) {
 		// Fast forward
 
 		dir := buildDir(repository.fs.Root, incomingSave)
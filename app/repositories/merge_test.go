@@ -2,6 +2,7 @@ package repositories
 
 import (
 	"fmt"
+	"os"
 	Path "path/filepath"
 	"saymow/version-manager/app/pkg/collections"
 	"saymow/version-manager/app/pkg/fixtures"
@@ -33,7 +34,7 @@ func makeBaseRepository(t *testing.T) (*fs.Dir, *Repository, *BaseRepositoryMeta
 	s0, _ := repository.CreateSave("s0")
 	repository.CreateRef("ref")
 
-	repository = GetRepository(dir.Path())
+	repository = fixtureGetRepository(t, dir.Path())
 
 	fixtures.MakeDirs(dir.Join("a"))
 	fixtures.WriteFile(dir.Join("a", "a.txt"), []byte("a/a.txt content."))
@@ -42,7 +43,7 @@ func makeBaseRepository(t *testing.T) (*fs.Dir, *Repository, *BaseRepositoryMeta
 	repository.SaveIndex()
 	s1, _ := repository.CreateSave("s1")
 
-	repository = GetRepository(dir.Path())
+	repository = fixtureGetRepository(t, dir.Path())
 
 	fixtures.WriteFile(dir.Join("b.txt"), []byte("b.txt updated content."))
 	fixtures.WriteFile(dir.Join("a", "b.txt"), []byte("b/b.txt content."))
@@ -54,7 +55,7 @@ func makeBaseRepository(t *testing.T) (*fs.Dir, *Repository, *BaseRepositoryMeta
 	s2, _ := repository.CreateSave("s1")
 
 	return dir,
-		GetRepository(dir.Path()),
+		fixtureGetRepository(t, dir.Path()),
 		&BaseRepositoryMeta{s0: s0, s1: s1, s2: s2, refName: "ref"}
 }
 
@@ -67,7 +68,7 @@ func TestInvalidMerge(t *testing.T) {
 	_, err := repository.Merge(meta.refName)
 	assert.Error(t, err, "Validaton Error: cannot make changes in detached mode.")
 
-	repository = GetRepository(dir.Path())
+	repository = fixtureGetRepository(t, dir.Path())
 	repository.Load(filesystems.INITIAL_REF_NAME)
 
 	_, err = repository.Merge("undefined")
@@ -90,7 +91,7 @@ func TestFastForwardMerge(t *testing.T) {
 
 	repository.Load(filesystems.INITIAL_REF_NAME)
 
-	repository = GetRepository(dir.Path())
+	repository = fixtureGetRepository(t, dir.Path())
 
 	save, err := repository.Merge(meta.refName)
 	refs := repository.GetRefs().Refs
@@ -138,7 +139,7 @@ func TestNewSaveMerge(t *testing.T) {
 
 	// s2
 
-	repository = GetRepository(dir.Path())
+	repository = fixtureGetRepository(t, dir.Path())
 
 	fixtures.WriteFile(dir.Join("a", "c.txt"), []byte("a/c.txt incoming content."))
 	fixtures.WriteFile(dir.Join("a", "b.txt"), []byte("a/b.txt incoming updated content."))
@@ -155,7 +156,7 @@ func TestNewSaveMerge(t *testing.T) {
 
 	// s3
 
-	repository = GetRepository(dir.Path())
+	repository = fixtureGetRepository(t, dir.Path())
 
 	fixtures.MakeDirs(dir.Join("c"))
 	fixtures.WriteFile(dir.Join("c", "a.txt"), []byte("c/a.txt incoming content."))
@@ -166,13 +167,13 @@ func TestNewSaveMerge(t *testing.T) {
 
 	// Load ref
 
-	repository = GetRepository(dir.Path())
+	repository = fixtureGetRepository(t, dir.Path())
 
 	repository.Load(meta.refName)
 
 	// s1'
 
-	repository = GetRepository(dir.Path())
+	repository = fixtureGetRepository(t, dir.Path())
 
 	fixtures.WriteFile(dir.Join("a.txt"), []byte("a.txt ref content."))
 	fixtures.WriteFile(dir.Join("b.txt"), []byte("b.txt ref updated content."))
@@ -182,17 +183,18 @@ func TestNewSaveMerge(t *testing.T) {
 	repository.IndexFile(dir.Join("b.txt"))
 	repository.IndexFile(dir.Join("a", "a.txt"))
 	repository.SaveIndex()
-	repository.CreateSave("s1'")
+	s1Prime, _ := repository.CreateSave("s1'")
 
 	// Test
 
-	repository = GetRepository(dir.Path())
+	repository = fixtureGetRepository(t, dir.Path())
 	save, err := repository.Merge(incoming)
 	refs := repository.GetRefs().Refs
 
 	assert.Nil(t, err)
 	assert.Equal(t, save.Checkpoint().Message, fmt.Sprintf("Merge \"%s\" at \"%s\".", incoming, meta.refName))
-	assert.Equal(t, len(save.Checkpoint().Changes), 0)
+	assert.Equal(t, save.Checkpoint().Parents, []string{s1Prime.Id, s3.Id})
+	assert.Equal(t, len(save.Checkpoint().Changes), 6)
 	assert.Equal(t, save.Checkpoints[len(save.Checkpoints)-2].Message, "s3")
 	assert.Equal(t, save.Checkpoints[len(save.Checkpoints)-3].Message, "s2")
 	assert.Equal(t, save.Checkpoints[len(save.Checkpoints)-4].Message, "s1")
@@ -200,6 +202,7 @@ func TestNewSaveMerge(t *testing.T) {
 	assert.Equal(t, repository.head, meta.refName)
 	assert.Equal(t, refs[incoming], s3.Id)
 	assert.Equal(t, refs[meta.refName], save.Checkpoint().Id)
+	assert.Equal(t, save.Checkpoints[len(save.Checkpoints)-2].Id, s3.Id)
 	fsAssert.Assert(
 		t,
 		fs.Equal(
@@ -229,9 +232,14 @@ func TestNewSaveMerge(t *testing.T) {
 		),
 	)
 
+	// Merging again should not duplicate history
+	repository = fixtureGetRepository(t, dir.Path())
+	_, err = repository.Merge(incoming)
+	assert.Error(t, err, "Validation Error: already up to date.")
+
 	// Check if the file tree is not corrupted
 	{
-		repository = GetRepository(dir.Path())
+		repository = fixtureGetRepository(t, dir.Path())
 
 		// Load older versions
 		repository.Load(meta.s0.Id)
@@ -249,7 +257,7 @@ func TestNewSaveMerge(t *testing.T) {
 			),
 		)
 
-		repository = GetRepository(dir.Path())
+		repository = fixtureGetRepository(t, dir.Path())
 
 		// Load merge save
 		repository.Load(save.Checkpoint().Id)
@@ -294,7 +302,7 @@ func TestIndexConflictsMerge(t *testing.T) {
 
 	// s1
 
-	repository = GetRepository(dir.Path())
+	repository = fixtureGetRepository(t, dir.Path())
 
 	fixtures.WriteFile(dir.Join("a.txt"), []byte("a.txt incoming content."))
 	fixtures.WriteFile(dir.Join("c.txt"), []byte("c.txt incoming content."))
@@ -307,7 +315,7 @@ func TestIndexConflictsMerge(t *testing.T) {
 
 	// s2
 
-	repository = GetRepository(dir.Path())
+	repository = fixtureGetRepository(t, dir.Path())
 
 	fixtures.WriteFile(dir.Join("a", "b.txt"), []byte("a/b.txt incoming updated content."))
 	fixtures.WriteFile(dir.Join("a", "c.txt"), []byte("a/c.txt incoming content."))
@@ -325,24 +333,24 @@ func TestIndexConflictsMerge(t *testing.T) {
 
 	// s3
 
-	repository = GetRepository(dir.Path())
+	repository = fixtureGetRepository(t, dir.Path())
 
 	fixtures.MakeDirs(dir.Join("c"))
 	fixtures.WriteFile(dir.Join("c", "a.txt"), []byte("c/a.txt incoming content."))
 
 	repository.IndexFile(dir.Join("c", "a.txt"))
 	repository.SaveIndex()
-	repository.CreateSave("s3")
+	s3, _ := repository.CreateSave("s3")
 
 	// Load ref
 
-	repository = GetRepository(dir.Path())
+	repository = fixtureGetRepository(t, dir.Path())
 
 	repository.Load(meta.refName)
 
 	// s1'
 
-	repository = GetRepository(dir.Path())
+	repository = fixtureGetRepository(t, dir.Path())
 
 	fixtures.WriteFile(dir.Join("a.txt"), []byte("a.txt ref content."))
 	fixtures.WriteFile(dir.Join("b.txt"), []byte("b.txt ref updated content."))
@@ -358,7 +366,7 @@ func TestIndexConflictsMerge(t *testing.T) {
 
 	// s2'
 
-	repository = GetRepository(dir.Path())
+	repository = fixtureGetRepository(t, dir.Path())
 
 	fixtures.MakeDirs(dir.Join("c"))
 	fixtures.WriteFile(dir.Join("c", "a.txt"), []byte("c/a.txt ref content."))
@@ -367,11 +375,11 @@ func TestIndexConflictsMerge(t *testing.T) {
 	repository.IndexFile(dir.Join("c", "a.txt"))
 	repository.IndexFile(dir.Join("c", "b.txt"))
 	repository.SaveIndex()
-	repository.CreateSave("s2'")
+	s2Prime, _ := repository.CreateSave("s2'")
 
 	// Test
 
-	repository = GetRepository(dir.Path())
+	repository = fixtureGetRepository(t, dir.Path())
 
 	save, err := repository.Merge(incoming)
 
@@ -429,12 +437,13 @@ func TestIndexConflictsMerge(t *testing.T) {
 		changesMap[dir.Join("c", "a.txt")].Conflict.Message,
 		"Conflict.",
 	)
+	assert.Equal(t, changesMap[dir.Join("a", "c.txt")].ChangeType, directories.Creation)
+	assert.Equal(t, changesMap[dir.Join("a", "a.txt")].ChangeType, directories.Removal)
 	assert.Nil(t, err)
-	assert.Equal(t, (*repository.refs)[repository.head], save.Checkpoint().Id)
-	assert.Equal(t, save.Checkpoint().Message, "s3")
-	assert.Equal(t, save.Checkpoints[len(save.Checkpoints)-2].Message, "s2")
-	assert.Equal(t, save.Checkpoints[len(save.Checkpoints)-3].Message, "s1")
-	assert.Equal(t, save.Checkpoints[len(save.Checkpoints)-4].Message, "s2'")
+	// The ref is not changed until the conflicts are resolved
+	assert.Equal(t, (*repository.refs)[repository.head], s2Prime.Id)
+	assert.Equal(t, save.Checkpoint().Id, s2Prime.Id)
+	assert.Equal(t, repository.mergeHead, s3.Id)
 	fsAssert.Assert(
 		t,
 		fs.Equal(
@@ -463,4 +472,336 @@ func TestIndexConflictsMerge(t *testing.T) {
 			),
 		),
 	)
+
+	// Resolve conflicts
+
+	repository = fixtureGetRepository(t, dir.Path())
+
+	_, err = repository.Merge(incoming)
+	assert.Error(t, err, "Validation Error: unsaved changes.")
+
+	fixtures.WriteFile(dir.Join("a.txt"), []byte("a.txt merged content."))
+	fixtures.WriteFile(dir.Join("c.txt"), []byte("c.txt merged content."))
+	fixtures.WriteFile(dir.Join("a", "b.txt"), []byte("a/b.txt merged content."))
+	fixtures.WriteFile(dir.Join("c", "a.txt"), []byte("c/a.txt merged content."))
+
+	repository.IndexFile(dir.Join("a.txt"))
+	repository.IndexFile(dir.Join("b.txt"))
+	repository.IndexFile(dir.Join("c.txt"))
+	repository.IndexFile(dir.Join("a", "b.txt"))
+	repository.IndexFile(dir.Join("c", "a.txt"))
+	repository.SaveIndex()
+	mergeSave, err := repository.CreateSave("merge")
+
+	assert.Nil(t, err)
+	assert.Equal(t, mergeSave.Parents, []string{s2Prime.Id, s3.Id})
+	assert.Equal(t, repository.mergeHead, "")
+
+	repository = fixtureGetRepository(t, dir.Path())
+
+	assert.True(t, repository.getSave(repository.head).Contains(repository.getSave(incoming)))
+	assert.Equal(t, fixtures.FileExists(dir.Join(filesystems.REPOSITORY_FOLDER_NAME, filesystems.MERGE_HEAD_FILE_NAME)), false)
+	status, err := repository.GetStatus()
+	assert.NoError(t, err)
+	assert.Equal(t, len(status.Staged.CreatedFilesPaths), 0)
+	fileDiffs, err := repository.GetWorkingDirDiff()
+	assert.NoError(t, err)
+	assert.Equal(t, len(fileDiffs), 0)
+}
+func TestLineMerge(t *testing.T) {
+	dir, repository, meta := makeBaseRepository(t)
+	defer dir.Remove()
+	incoming := "incoming"
+
+	fixtures.WriteFile(dir.Join("a", "a.txt"), []byte("func a() {\n\treturn 1\n}\n\nfunc b() {\n\treturn 2\n}\n"))
+	fixtures.WriteFile(dir.Join("a", "b.txt"), []byte("line 1\nline 2\nline 3\n"))
+
+	repository.IndexFile(dir.Join("a", "a.txt"))
+	repository.IndexFile(dir.Join("a", "b.txt"))
+	repository.SaveIndex()
+	repository.CreateSave("common")
+	repository.CreateRef(incoming)
+
+	// s1
+
+	repository = fixtureGetRepository(t, dir.Path())
+
+	fixtures.WriteFile(dir.Join("a", "a.txt"), []byte("func a() {\n\treturn 1\n}\n\nfunc b() {\n\treturn 20\n}\n"))
+	fixtures.WriteFile(dir.Join("a", "b.txt"), []byte("line 1\nline 2 incoming\nline 3\n"))
+
+	repository.IndexFile(dir.Join("a", "a.txt"))
+	repository.IndexFile(dir.Join("a", "b.txt"))
+	repository.SaveIndex()
+	repository.CreateSave("s1")
+
+	// Load ref
+
+	repository = fixtureGetRepository(t, dir.Path())
+
+	repository.Load(meta.refName)
+
+	// s1'
+
+	repository = fixtureGetRepository(t, dir.Path())
+
+	fixtures.WriteFile(dir.Join("a", "a.txt"), []byte("func a() {\n\treturn 10\n}\n\nfunc b() {\n\treturn 2\n}\n"))
+
+	repository.IndexFile(dir.Join("a", "a.txt"))
+	repository.SaveIndex()
+	repository.CreateSave("s1'")
+
+	// Test
+
+	repository = fixtureGetRepository(t, dir.Path())
+	save, err := repository.Merge(incoming)
+
+	assert.Nil(t, err)
+	assert.Equal(t, save.Checkpoint().Message, fmt.Sprintf("Merge \"%s\" at \"%s\".", incoming, meta.refName))
+	assert.Equal(t, len(save.Checkpoint().Changes), 2)
+	assert.Equal(t, save.Checkpoint().Changes[0].ChangeType, directories.Modification)
+	assert.Equal(t, save.Checkpoint().Changes[0].File.Filepath, dir.Join("a", "a.txt"))
+	assert.Equal(t, save.Checkpoint().Changes[1].ChangeType, directories.Modification)
+	assert.Equal(t, save.Checkpoint().Changes[1].File.Filepath, dir.Join("a", "b.txt"))
+	assert.Equal(t, len(repository.index), 0)
+	assert.Equal(t, fixtures.ReadFile(dir.Join("a", "a.txt")), "func a() {\n\treturn 10\n}\n\nfunc b() {\n\treturn 20\n}\n")
+	assert.Equal(t, fixtures.ReadFile(dir.Join("a", "b.txt")), "line 1\nline 2 incoming\nline 3\n")
+
+	// Overlapping changes
+
+	repository = fixtureGetRepository(t, dir.Path())
+
+	repository.Load(incoming)
+
+	repository = fixtureGetRepository(t, dir.Path())
+
+	fixtures.WriteFile(dir.Join("a", "b.txt"), []byte("line 1\nline 2 incoming again\nline 3\nline 4\n"))
+
+	repository.IndexFile(dir.Join("a", "b.txt"))
+	repository.SaveIndex()
+	repository.CreateSave("s2")
+
+	repository = fixtureGetRepository(t, dir.Path())
+
+	repository.Load(meta.refName)
+
+	repository = fixtureGetRepository(t, dir.Path())
+
+	fixtures.WriteFile(dir.Join("a", "b.txt"), []byte("line 1 ref\nline 2 ref\nline 3\n"))
+
+	repository.IndexFile(dir.Join("a", "b.txt"))
+	repository.SaveIndex()
+	repository.CreateSave("s2'")
+
+	repository = fixtureGetRepository(t, dir.Path())
+	_, err = repository.Merge(incoming)
+
+	changesMap := collections.ToMap(repository.index, func(change *directories.Change, _ int) string {
+		return change.GetPath()
+	})
+
+	assert.Nil(t, err)
+	// The previous merge is the common ancestor, so a.txt is not merged again
+	assert.Equal(t, len(repository.index), 1)
+	assert.Equal(t, changesMap[dir.Join("a", "b.txt")].ChangeType, directories.Conflict)
+	assert.Equal(t, changesMap[dir.Join("a", "b.txt")].Conflict.Message, "Conflict.")
+	assert.Equal(
+		t,
+		fixtures.ReadFile(dir.Join("a", "b.txt")),
+		"<ref>\nline 1 ref\nline 2 ref\n</ref>\n<incoming>\nline 1\nline 2 incoming again\n</incoming>\nline 3\nline 4\n",
+	)
+}
+
+func TestBinaryMerge(t *testing.T) {
+	dir, repository := fixtureGetNewProject(t)
+	defer dir.Remove()
+
+	fixtures.WriteFile(dir.Join("a.bin"), []byte("a.bin\x00content"))
+	assert.Nil(t, os.Symlink("target", dir.Join("link")))
+	assert.Nil(t, repository.AddFiles([]string{"a.bin", "link"}))
+	repository.SaveIndex()
+	repository.CreateSave("s0")
+	repository.CreateRef("feature")
+
+	repository = fixtureGetRepository(t, dir.Path())
+	fixtures.WriteFile(dir.Join("a.bin"), []byte("a.bin\x00feature content"))
+	fixtures.RemoveFile(dir.Join("link"))
+	assert.Nil(t, os.Symlink("feature-target", dir.Join("link")))
+	assert.Nil(t, repository.AddFiles([]string{"a.bin", "link"}))
+	repository.SaveIndex()
+	repository.CreateSave("feature save")
+
+	repository = fixtureGetRepository(t, dir.Path())
+	assert.Nil(t, repository.Load(filesystems.INITIAL_REF_NAME))
+	repository = fixtureGetRepository(t, dir.Path())
+	fixtures.WriteFile(dir.Join("a.bin"), []byte("a.bin\x00master content"))
+	fixtures.RemoveFile(dir.Join("link"))
+	assert.Nil(t, os.Symlink("master-target", dir.Join("link")))
+	assert.Nil(t, repository.AddFiles([]string{"a.bin", "link"}))
+	repository.SaveIndex()
+	repository.CreateSave("master save")
+
+	repository = fixtureGetRepository(t, dir.Path())
+	_, err := repository.Merge("feature")
+	assert.Nil(t, err)
+
+	changesMap := collections.ToMap(repository.index, func(change *directories.Change, _ int) string {
+		return change.GetPath()
+	})
+	assert.Equal(t, len(repository.index), 2)
+	assert.Equal(
+		t,
+		changesMap[dir.Join("a.bin")].Conflict.Message,
+		fmt.Sprintf("Cannot be merged, the \"%s\" version is kept and the \"feature\" one is at \"a.bin~feature\".", filesystems.INITIAL_REF_NAME),
+	)
+	assert.Equal(
+		t,
+		changesMap[dir.Join("link")].Conflict.Message,
+		fmt.Sprintf("Cannot be merged, the \"%s\" version is kept and the \"feature\" one is at \"link~feature\".", filesystems.INITIAL_REF_NAME),
+	)
+
+	// Both versions are left untouched
+	assert.Equal(t, fixtures.ReadFile(dir.Join("a.bin")), "a.bin\x00master content")
+	assert.Equal(t, fixtures.ReadFile(dir.Join("a.bin~feature")), "a.bin\x00feature content")
+	target, err := os.Readlink(dir.Join("link"))
+	assert.Nil(t, err)
+	assert.Equal(t, target, "master-target")
+	target, err = os.Readlink(dir.Join("link~feature"))
+	assert.Nil(t, err)
+	assert.Equal(t, target, "feature-target")
+
+	status, err := fixtureGetRepository(t, dir.Path()).GetStatus()
+	assert.Nil(t, err)
+	assert.Equal(t, len(status.Staged.ConflictedFilesPaths), 2)
+	assert.Equal(t, status.WorkingDir.ModifiedFilePaths, []string(nil))
+	assert.Equal(t, status.WorkingDir.UntrackedFilePaths, []string{dir.Join("a.bin~feature"), dir.Join("link~feature")})
+}
+
+func TestRenameMerge(t *testing.T) {
+	dir, repository, meta := makeBaseRepository(t)
+	defer dir.Remove()
+	incoming := "incoming"
+
+	fixtures.WriteFile(dir.Join("a", "a.txt"), []byte("line 1\nline 2\nline 3\n"))
+	fixtures.WriteFile(dir.Join("a", "b.txt"), []byte("line 4\nline 5\nline 6\n"))
+
+	repository.IndexFile(dir.Join("a", "a.txt"))
+	repository.IndexFile(dir.Join("a", "b.txt"))
+	repository.SaveIndex()
+	repository.CreateSave("common")
+	repository.CreateRef(incoming)
+
+	// Renamed at incoming
+
+	repository = fixtureGetRepository(t, dir.Path())
+
+	assert.Nil(t, repository.MoveFile(dir.Join("a", "a.txt"), dir.Join("a", "c.txt")))
+	fixtures.WriteFile(dir.Join("a", "b.txt"), []byte("line 4\nline 5 incoming\nline 6\n"))
+	repository.IndexFile(dir.Join("a", "b.txt"))
+	repository.SaveIndex()
+	repository.CreateSave("s1")
+
+	repository = fixtureGetRepository(t, dir.Path())
+
+	repository.Load(meta.refName)
+
+	// Modified at ref, and renamed without the source object changing
+
+	repository = fixtureGetRepository(t, dir.Path())
+
+	fixtures.WriteFile(dir.Join("a", "a.txt"), []byte("line 1 ref\nline 2\nline 3\n"))
+	repository.IndexFile(dir.Join("a", "a.txt"))
+	fixtures.MakeDirs(dir.Join("d"))
+	assert.Nil(t, repository.MoveFile(dir.Join("a", "b.txt"), dir.Join("d", "b.txt")))
+	repository.SaveIndex()
+	repository.CreateSave("s1'")
+
+	repository = fixtureGetRepository(t, dir.Path())
+	save, err := repository.Merge(incoming)
+
+	changesMap := collections.ToMap(save.Checkpoint().Changes, func(change *directories.Change, _ int) string {
+		return change.GetPath()
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, len(repository.index), 0)
+	assert.Equal(t, len(save.Checkpoint().Changes), 2)
+	assert.Equal(t, changesMap[dir.Join("a", "c.txt")].ChangeType, directories.Rename)
+	assert.Equal(t, changesMap[dir.Join("a", "c.txt")].Rename.FromFilepath, dir.Join("a", "a.txt"))
+	assert.Equal(t, changesMap[dir.Join("d", "b.txt")].ChangeType, directories.Modification)
+	assert.False(t, fixtures.FileExists(dir.Join("a", "a.txt")))
+	assert.False(t, fixtures.FileExists(dir.Join("a", "b.txt")))
+	assert.Equal(t, fixtures.ReadFile(dir.Join("a", "c.txt")), "line 1 ref\nline 2\nline 3\n")
+	assert.Equal(t, fixtures.ReadFile(dir.Join("d", "b.txt")), "line 4\nline 5 incoming\nline 6\n")
+
+	// Removed at one side and renamed at the other
+
+	repository = fixtureGetRepository(t, dir.Path())
+
+	repository.Load(incoming)
+
+	repository = fixtureGetRepository(t, dir.Path())
+
+	assert.Nil(t, repository.MoveFile(dir.Join("a", "c.txt"), dir.Join("a", "e.txt")))
+	repository.SaveIndex()
+	repository.CreateSave("s2")
+
+	repository = fixtureGetRepository(t, dir.Path())
+
+	repository.Load(meta.refName)
+
+	repository = fixtureGetRepository(t, dir.Path())
+
+	repository.RemoveFile(dir.Join("a", "c.txt"))
+	repository.SaveIndex()
+	repository.CreateSave("s2'")
+
+	repository = fixtureGetRepository(t, dir.Path())
+	_, err = repository.Merge(incoming)
+
+	assert.Nil(t, err)
+	assert.Equal(t, len(repository.index), 1)
+	assert.Equal(t, repository.index[0].ChangeType, directories.Conflict)
+	assert.Equal(t, repository.index[0].Conflict.Filepath, dir.Join("a", "e.txt"))
+	assert.Equal(t, repository.index[0].Conflict.Message, fmt.Sprintf("Removed at \"%s\" but renamed at \"%s\".", meta.refName, incoming))
+}
+
+func TestConflictedMergeObjects(t *testing.T) {
+	dir, repository := fixtureGetNewProject(t)
+	defer dir.Remove()
+
+	fixtures.WriteFile(dir.Join("a.txt"), []byte("a.txt content."))
+	fixtures.WriteFile(dir.Join("b.txt"), []byte("b.txt content."))
+	assert.Nil(t, repository.AddFiles([]string{"a.txt", "b.txt"}))
+	repository.SaveIndex()
+	repository.CreateSave("s0")
+	repository.CreateRef("feature")
+
+	repository = fixtureGetRepository(t, dir.Path())
+	fixtures.WriteFile(dir.Join("a.txt"), []byte("a.txt feature content."))
+	fixtures.WriteFile(dir.Join("b.txt"), []byte("b.txt feature content."))
+	assert.Nil(t, repository.AddFiles([]string{"a.txt", "b.txt"}))
+	repository.SaveIndex()
+	repository.CreateSave("feature save")
+
+	repository = fixtureGetRepository(t, dir.Path())
+	assert.Nil(t, repository.Load(filesystems.INITIAL_REF_NAME))
+	repository = fixtureGetRepository(t, dir.Path())
+	fixtures.WriteFile(dir.Join("a.txt"), []byte("a.txt master content."))
+	assert.Nil(t, repository.AddFiles([]string{"a.txt"}))
+	repository.SaveIndex()
+	repository.CreateSave("master save")
+
+	repository = fixtureGetRepository(t, dir.Path())
+	_, err := repository.Merge("feature")
+	assert.Nil(t, err)
+
+	// b.txt is staged with the feature object, replacing it keeps the object of the feature save
+	repository = fixtureGetRepository(t, dir.Path())
+	fixtures.WriteFile(dir.Join("b.txt"), []byte("b.txt merged content."))
+	assert.Nil(t, repository.AddFiles([]string{"b.txt"}))
+	repository.SaveIndex()
+
+	report, err := CheckIntegrity(dir.Path())
+	assert.Nil(t, err)
+	assert.False(t, report.HasProblems())
 }
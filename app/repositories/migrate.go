@@ -0,0 +1,24 @@
+package repositories
+
+import (
+	"saymow/version-manager/app/pkg/vfs"
+	"saymow/version-manager/app/repositories/filesystems"
+)
+
+// Migrate upgrades the repository at root to the current storage format.
+//
+// oldRoot is where the repository was when it was last used, the paths stored by older versions are
+// relative to it.
+func Migrate(root, oldRoot string) error {
+	fileSystem, err := filesystems.Open(vfs.NewOS(), root)
+	if err != nil {
+		return err
+	}
+
+	err = fileSystem.Migrate(oldRoot)
+	if migrationErr, ok := err.(*filesystems.MigrationError); ok {
+		return &ValidationError{migrationErr.Error()}
+	}
+
+	return err
+}
@@ -0,0 +1,146 @@
+package repositories
+
+import (
+	"fmt"
+	Path "path/filepath"
+	"saymow/version-manager/app/pkg/fixtures"
+	"saymow/version-manager/app/repositories/filesystems"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gotest.tools/v3/fs"
+)
+
+// fixtureMakeLegacyRepositoryFs makes a version 1 repository, which stored absolute paths under oldRoot.
+func fixtureMakeLegacyRepositoryFs(oldRoot string) fs.PathOp {
+	return fs.WithDir(
+		filesystems.REPOSITORY_FOLDER_NAME,
+		fs.WithDir(
+			filesystems.SAVES_FOLDER_NAME,
+			fs.WithFile(
+				"legacy-s0",
+				fmt.Sprintf(`s0
+
+11/15 04:08:58PM '24 -0300
+
+Please do not edit the lines below.
+
+
+Files:
+
+%s	(created)
+1.txt-object
+%s	(created)
+4.txt-object
+`, Path.Join(oldRoot, "1.txt"), Path.Join(oldRoot, "a", "4.txt")),
+			),
+			fs.WithFile(
+				"legacy-s1",
+				fmt.Sprintf(`s1
+legacy-s0
+11/15 04:09:54PM '24 -0300
+
+Please do not edit the lines below.
+
+
+Files:
+
+%s	(removed)
+`, Path.Join(oldRoot, "1.txt")),
+			),
+		),
+		fs.WithDir(filesystems.OBJECTS_FOLDER_NAME),
+		fs.WithFile(filesystems.REFS_FILE_NAME, fmt.Sprintf("Refs:\n\n%s\nlegacy-s1\nold\nlegacy-s0\n", filesystems.INITIAL_REF_NAME)),
+		fs.WithFile(filesystems.HEAD_FILE_NAME, "legacy-s0"),
+		fs.WithFile(filesystems.INDEX_FILE_NAME, fmt.Sprintf("Tracked files:\n\n%s\t(removed)\n", Path.Join(oldRoot, "2.txt"))),
+	)
+}
+
+func TestMigrate(t *testing.T) {
+	oldRoot := Path.Join(string(Path.Separator), "old", "project")
+
+	dir := fs.NewDir(t, "project", fixtureMakeLegacyRepositoryFs(oldRoot))
+	defer dir.Remove()
+
+	// Moved repository
+	{
+		err := Migrate(dir.Path(), dir.Path())
+		assert.EqualError(t, err, fmt.Sprintf("Validation Error: path \"%s\" is not inside \"%s\", the repository was moved: run \"vcs migrate --from <previous repository path>\".", Path.Join(oldRoot, "1.txt"), dir.Path()))
+	}
+
+	err := Migrate(dir.Path(), oldRoot)
+	assert.Nil(t, err)
+
+	assert.Equal(t, fixtures.ReadFile(dir.Join(filesystems.REPOSITORY_FOLDER_NAME, filesystems.VERSION_FILE_NAME)), fmt.Sprint(filesystems.REPOSITORY_VERSION))
+	assert.Equal(t, fixtures.ReadFile(dir.Join(filesystems.REPOSITORY_FOLDER_NAME, filesystems.INDEX_FILE_NAME)), "Tracked files:\n\n2.txt\t(removed)\n")
+	assert.False(t, fixtures.FileExists(dir.Join(filesystems.REPOSITORY_FOLDER_NAME, filesystems.SAVES_FOLDER_NAME, "legacy-s0")))
+	assert.False(t, fixtures.FileExists(dir.Join(filesystems.REPOSITORY_FOLDER_NAME, filesystems.SAVES_FOLDER_NAME, "legacy-s1")))
+
+	repository := fixtureGetRepository(t, dir.Path())
+
+	s0 := repository.getSave("old")
+	s1 := repository.getSave(filesystems.INITIAL_REF_NAME)
+
+	assert.Equal(t, repository.head, s0.Id)
+	assert.Equal(t, s1.Checkpoint().Parents, []string{s0.Id})
+	assert.Equal(t, len(s1.Checkpoints), 2)
+	assert.Equal(t, s0.Checkpoint().Changes[0].File.Filepath, dir.Join("1.txt"))
+	assert.Equal(t, s0.Checkpoint().Changes[1].File.Filepath, dir.Join("a", "4.txt"))
+	assert.Equal(t, s1.Checkpoint().Changes[0].Removal.Filepath, dir.Join("1.txt"))
+	assert.Equal(t, repository.index[0].Removal.Filepath, dir.Join("2.txt"))
+	assert.Equal(t, repository.dir.FindNode(Path.Join("a", "4.txt")).File.Filepath, dir.Join("a", "4.txt"))
+	assert.Equal(
+		t,
+		fixtures.ReadFile(dir.Join(filesystems.REPOSITORY_FOLDER_NAME, filesystems.SAVES_FOLDER_NAME, s0.Id)),
+		`s0
+
+11/15 04:08:58PM '24 -0300
+
+Please do not edit the lines below.
+
+
+Files:
+
+1.txt	(created)
+1.txt-object
+a/4.txt	(created)
+4.txt-object
+`,
+	)
+
+	// Migrating again is a no-op
+	{
+		err := Migrate(dir.Path(), oldRoot)
+		assert.Nil(t, err)
+		saveInfos, err := repository.fs.ListSaves()
+		assert.NoError(t, err)
+		assert.Equal(t, len(saveInfos), 2)
+	}
+}
+
+func TestMovedRepository(t *testing.T) {
+	dir, repository := fixtureGetBaseProject(t)
+	defer dir.Remove()
+
+	repository.IndexFile("1.txt")
+	repository.IndexFile(Path.Join("a", "4.txt"))
+	repository.SaveIndex()
+	s0, _ := repository.CreateSave("s0")
+
+	assert.Contains(t, fixtures.ReadFile(dir.Join(filesystems.REPOSITORY_FOLDER_NAME, filesystems.SAVES_FOLDER_NAME, s0.Id)), "\na/4.txt\t(created)\n")
+
+	movedDir := fs.NewDir(t, "moved")
+	defer movedDir.Remove()
+
+	fs.Apply(t, movedDir, fs.FromDir(dir.Path()))
+
+	repository = fixtureGetRepository(t, movedDir.Path())
+
+	assert.Equal(t, repository.dir.FindNode("1.txt").File.Filepath, movedDir.Join("1.txt"))
+	assert.Equal(t, repository.dir.FindNode(Path.Join("a", "4.txt")).File.Filepath, movedDir.Join("a", "4.txt"))
+
+	status, err := repository.GetStatus()
+	assert.NoError(t, err)
+	assert.Empty(t, status.WorkingDir.ModifiedFilePaths)
+	assert.Empty(t, status.WorkingDir.RemovedFilePaths)
+}
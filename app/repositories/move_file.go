@@ -0,0 +1,134 @@
+package repositories
+
+import (
+	"fmt"
+	"os"
+	Path "path/filepath"
+	"saymow/version-manager/app/pkg/errors"
+	"saymow/version-manager/app/repositories/directories"
+	"slices"
+)
+
+// MoveFile moves the tracked file or directory src to dst in the working directory, and stages the moved files
+// as renames. When dst is an existing directory, src is moved into it.
+func (repository *Repository) MoveFile(src string, dst string) (err error) {
+	defer errors.Recover(&err)
+
+	if repository.isDetachedMode() {
+		return &ValidationError{"cannot make changes in detached mode."}
+	}
+
+	srcPath, err := repository.dir.AbsPath(src)
+	if err != nil {
+		return &ValidationError{err.Error()}
+	}
+	dstPath, err := repository.dir.AbsPath(dst)
+	if err != nil {
+		return &ValidationError{err.Error()}
+	}
+
+	if _, err := repository.fs.Files.Lstat(srcPath); err != nil {
+		if os.IsNotExist(err) {
+			return &ValidationError{fmt.Sprintf("path \"%s\" does not exist.", src)}
+		}
+
+		errors.Error(err.Error())
+	}
+
+	if info, err := repository.fs.Files.Stat(dstPath); err == nil && info.IsDir() {
+		dstPath = Path.Join(dstPath, Path.Base(srcPath))
+	}
+
+	if isSubpath(srcPath, dstPath) {
+		return &ValidationError{fmt.Sprintf("cannot move \"%s\" into itself.", src)}
+	}
+	if _, err := repository.fs.Files.Lstat(dstPath); err == nil {
+		return &ValidationError{fmt.Sprintf("destination \"%s\" already exists.", dstPath)}
+	}
+
+	filepaths := []string{}
+	tracked := repository.getTrackedFiles()
+	for _, trackedPath := range tracked.paths {
+		if !isSubpath(srcPath, trackedPath) {
+			continue
+		}
+
+		if stagedChange := tracked.findStagedChange(trackedPath); stagedChange != nil {
+			switch stagedChange.ChangeType {
+			case directories.Removal:
+				// Untracked once saved, moved as any other untracked file
+				continue
+			case directories.Conflict:
+				return &ConflictError{fmt.Sprintf("\"%s\" has conflicts.", trackedPath)}
+			}
+		}
+
+		if tracked.isTracked(Path.Join(dstPath, trackedPath[len(srcPath):])) {
+			return &ValidationError{fmt.Sprintf("destination \"%s\" is tracked.", Path.Join(dstPath, trackedPath[len(srcPath):]))}
+		}
+
+		filepaths = append(filepaths, trackedPath)
+	}
+
+	if len(filepaths) == 0 {
+		return &ValidationError{fmt.Sprintf("path \"%s\" is not tracked.", src)}
+	}
+
+	slices.Sort(filepaths)
+
+	errors.Check(repository.fs.Files.MkdirAll(Path.Dir(dstPath), 0755))
+	errors.Check(repository.fs.Files.Rename(srcPath, dstPath))
+	repository.removeEmptyDirs(Path.Dir(srcPath))
+
+	for _, filepath := range filepaths {
+		repository.renameIndexEntry(filepath, Path.Join(dstPath, filepath[len(srcPath):]))
+	}
+
+	return nil
+}
+
+// renameIndexEntry moves the staged or saved file at from to the path to.
+func (repository *Repository) renameIndexEntry(from string, to string) {
+	stagedChangeIdx := repository.findStagedChangeIdx(from)
+
+	if stagedChangeIdx == -1 {
+		savedFile := repository.findSavedFile(from)
+
+		repository.index = append(repository.index, &directories.Change{
+			ChangeType: directories.Rename,
+			File:       &directories.File{Filepath: to, ObjectName: savedFile.ObjectName, Mode: savedFile.Mode},
+			Rename:     &directories.FileRename{FromFilepath: from},
+		})
+
+		return
+	}
+
+	stagedChange := repository.index[stagedChangeIdx]
+	file := &directories.File{Filepath: to, ObjectName: stagedChange.File.ObjectName, Mode: stagedChange.File.Mode}
+
+	switch stagedChange.ChangeType {
+	case directories.Creation:
+		repository.index[stagedChangeIdx] = &directories.Change{ChangeType: directories.Creation, File: file}
+	case directories.Modification:
+		repository.index[stagedChangeIdx] = &directories.Change{
+			ChangeType: directories.Rename,
+			File:       file,
+			Rename:     &directories.FileRename{FromFilepath: from},
+		}
+	case directories.Rename:
+		sourcePath := stagedChange.Rename.FromFilepath
+
+		if sourcePath != to {
+			repository.index[stagedChangeIdx] = &directories.Change{
+				ChangeType: directories.Rename,
+				File:       file,
+				Rename:     &directories.FileRename{FromFilepath: sourcePath},
+			}
+		} else if !repository.findSavedFile(sourcePath).Equals(file) {
+			// Moved back to its source path
+			repository.index[stagedChangeIdx] = &directories.Change{ChangeType: directories.Modification, File: file}
+		} else {
+			repository.index = slices.Delete(repository.index, stagedChangeIdx, stagedChangeIdx+1)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package repositories
+
+import (
+	"saymow/version-manager/app/pkg/fixtures"
+	"saymow/version-manager/app/repositories/directories"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMoveFile(t *testing.T) {
+	dir, repository := fixtureGetBaseProject(t)
+	defer dir.Remove()
+
+	assert.Nil(t, repository.AddFiles([]string{"1.txt", "2.txt", "a"}))
+	repository.SaveIndex()
+	repository.CreateSave("initial save")
+	repository = fixtureGetRepository(t, dir.Path())
+
+	// Files are moved in the working directory and staged as renames
+	{
+		assert.Nil(t, repository.MoveFile("1.txt", "10.txt"))
+
+		assert.False(t, fixtures.FileExists(dir.Join("1.txt")))
+		assert.Equal(t, fixtures.ReadFile(dir.Join("10.txt")), "1 content")
+		assert.Equal(t, len(repository.index), 1)
+		assert.Equal(t, repository.index[0].ChangeType, directories.Rename)
+		assert.Equal(t, repository.index[0].Rename.FromFilepath, dir.Join("1.txt"))
+		assert.Equal(t, repository.index[0].File.Filepath, dir.Join("10.txt"))
+
+		status, err := repository.GetStatus()
+		assert.NoError(t, err)
+		assert.Equal(t, status.Staged.RenamedFiles, []RenamedFileStatus{{FromFilepath: dir.Join("1.txt"), Filepath: dir.Join("10.txt")}})
+		assert.Empty(t, status.WorkingDir.RemovedFilePaths)
+		assert.Equal(t, status.WorkingDir.UntrackedFilePaths, []string{dir.Join("3.txt"), dir.Join("c", "8.txt"), dir.Join("c", "9.txt")})
+	}
+
+	// Moving a file back to its source drops the rename
+	{
+		assert.Nil(t, repository.MoveFile("10.txt", "1.txt"))
+
+		assert.Equal(t, fixtures.ReadFile(dir.Join("1.txt")), "1 content")
+		assert.Equal(t, repository.index, []*directories.Change{})
+	}
+
+	// Moving a modified file keeps its staged content
+	{
+		fixtures.WriteFile(dir.Join("2.txt"), []byte("2 new content"))
+		assert.Nil(t, repository.IndexFile("2.txt"))
+		assert.Nil(t, repository.MoveFile("2.txt", "20.txt"))
+
+		assert.Equal(t, getIndexPaths(repository), []string{dir.Join("20.txt")})
+		assert.Equal(t, repository.index[0].ChangeType, directories.Rename)
+		assert.Equal(t, repository.index[0].Rename.FromFilepath, dir.Join("2.txt"))
+
+		assert.Nil(t, repository.MoveFile("20.txt", "2.txt"))
+		assert.Equal(t, repository.index[0].ChangeType, directories.Modification)
+		assert.Equal(t, getIndexPaths(repository), []string{dir.Join("2.txt")})
+	}
+
+	// Directories are moved into existing directories
+	{
+		fixtures.MakeDirs(dir.Join("d"))
+		assert.Nil(t, repository.MoveFile("a", "d"))
+
+		assert.False(t, fixtures.FileExists(dir.Join("a")))
+		assert.Equal(t, fixtures.ReadFile(dir.Join("d", "a", "b", "6.txt")), "6 content")
+		assert.Equal(t, getIndexPaths(repository), []string{
+			dir.Join("2.txt"),
+			dir.Join("d", "a", "4.txt"),
+			dir.Join("d", "a", "5.txt"),
+			dir.Join("d", "a", "b", "6.txt"),
+			dir.Join("d", "a", "b", "7.txt"),
+		})
+	}
+
+	// Renames are saved and restored
+	{
+		repository.SaveIndex()
+		_, err := repository.CreateSave("move a")
+		assert.Nil(t, err)
+		repository = fixtureGetRepository(t, dir.Path())
+
+		assert.Nil(t, repository.findSavedFile(dir.Join("a", "4.txt")))
+		assert.Equal(t, repository.findSavedFile(dir.Join("d", "a", "4.txt")).Filepath, dir.Join("d", "a", "4.txt"))
+		status, err := repository.GetStatus()
+		assert.NoError(t, err)
+		assert.Empty(t, status.Staged.RenamedFiles)
+		assert.Empty(t, status.WorkingDir.RemovedFilePaths)
+		assert.Empty(t, status.WorkingDir.ModifiedFilePaths)
+	}
+
+	err := repository.MoveFile("3.txt", "30.txt")
+	assert.EqualError(t, err, "Validation Error: path \"3.txt\" is not tracked.")
+	err = repository.MoveFile("11.txt", "30.txt")
+	assert.EqualError(t, err, "Validation Error: path \"11.txt\" does not exist.")
+	err = repository.MoveFile("d", dir.Join("d", "a", "e"))
+	assert.EqualError(t, err, "Validation Error: cannot move \"d\" into itself.")
+	err = repository.MoveFile("1.txt", "2.txt")
+	assert.EqualError(t, err, "Validation Error: destination \""+dir.Join("2.txt")+"\" already exists.")
+}
@@ -0,0 +1,108 @@
+package objectstores
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type memoryObject struct {
+	content []byte
+	modTime time.Time
+}
+
+// Memory keeps the objects in memory, it is safe for concurrent use.
+type Memory struct {
+	lock    sync.RWMutex
+	objects map[string]*memoryObject
+}
+
+func NewMemory() *Memory {
+	return &Memory{objects: make(map[string]*memoryObject)}
+}
+
+type memoryWriter struct {
+	store  *Memory
+	buffer bytes.Buffer
+}
+
+func (store *Memory) Create() (Writer, error) {
+	return &memoryWriter{store: store}, nil
+}
+
+func (writer *memoryWriter) Write(data []byte) (int, error) {
+	return writer.buffer.Write(data)
+}
+
+func (writer *memoryWriter) Commit(name string) error {
+	writer.store.lock.Lock()
+	defer writer.store.lock.Unlock()
+
+	writer.store.objects[name] = &memoryObject{content: bytes.Clone(writer.buffer.Bytes()), modTime: time.Now()}
+
+	return nil
+}
+
+func (writer *memoryWriter) Close() error {
+	writer.buffer.Reset()
+
+	return nil
+}
+
+func (store *Memory) Open(name string) (io.ReadCloser, error) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	object, ok := store.objects[name]
+	if !ok {
+		return nil, notExistError("open", name)
+	}
+
+	return io.NopCloser(bytes.NewReader(object.content)), nil
+}
+
+func (store *Memory) Stat(name string) (fs.FileInfo, error) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	object, ok := store.objects[name]
+	if !ok {
+		return nil, notExistError("stat", name)
+	}
+
+	return &objectInfo{name: name, size: int64(len(object.content)), modTime: object.modTime}, nil
+}
+
+func (store *Memory) Remove(name string) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	delete(store.objects, name)
+
+	return nil
+}
+
+func (store *Memory) List() ([]fs.FileInfo, error) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	infos := []fs.FileInfo{}
+
+	for name, object := range store.objects {
+		if strings.HasPrefix(name, TEMP_FILE_PREFIX) {
+			continue
+		}
+
+		infos = append(infos, &objectInfo{name: name, size: int64(len(object.content)), modTime: object.modTime})
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name() < infos[j].Name()
+	})
+
+	return infos, nil
+}
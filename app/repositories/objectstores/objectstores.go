@@ -0,0 +1,158 @@
+package objectstores
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	Path "path/filepath"
+	"saymow/version-manager/app/pkg/vfs"
+	"strings"
+	"time"
+)
+
+// Temporary files are named with this prefix, they are never listed as objects.
+const TEMP_FILE_PREFIX = "tmp-"
+
+// ObjectStore holds the objects, the compressed content of the saved files, by name. Errors on missing
+// objects behave as the os package ones: os.IsNotExist can be used on them.
+type ObjectStore interface {
+	// Create returns a writer for an object whose name is only known once its content is written.
+	Create() (Writer, error)
+	Open(name string) (io.ReadCloser, error)
+	Stat(name string) (fs.FileInfo, error)
+	// Remove removes the object, removing a missing object is a no-op.
+	Remove(name string) error
+	List() ([]fs.FileInfo, error)
+}
+
+// ContextStore is implemented by the stores doing network requests. WithContext returns the store with its
+// requests bound to ctx, they fail once ctx is done.
+type ContextStore interface {
+	ObjectStore
+	WithContext(ctx context.Context) ObjectStore
+}
+
+// Writer buffers an object content. Commit stores it under name, Close discards it when it was not
+// committed. A partially written object is never visible under a valid name.
+type Writer interface {
+	io.Writer
+	Commit(name string) error
+	Close() error
+}
+
+func notExistError(op string, name string) error {
+	return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+}
+
+// objectInfo is the fs.FileInfo of the objects that are not files.
+type objectInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (info *objectInfo) Name() string       { return info.name }
+func (info *objectInfo) Size() int64        { return info.size }
+func (info *objectInfo) Mode() fs.FileMode  { return 0644 }
+func (info *objectInfo) ModTime() time.Time { return info.modTime }
+func (info *objectInfo) IsDir() bool        { return false }
+func (info *objectInfo) Sys() any           { return nil }
+
+type local struct {
+	files  vfs.FS
+	folder string
+}
+
+// NewLocal returns the store of the objects as files of folder.
+func NewLocal(files vfs.FS, folder string) ObjectStore {
+	return &local{files: files, folder: folder}
+}
+
+type localWriter struct {
+	files     vfs.FS
+	folder    string
+	file      vfs.File
+	committed bool
+}
+
+func (store *local) Create() (Writer, error) {
+	file, err := store.files.CreateTemp(store.folder, TEMP_FILE_PREFIX)
+	if err != nil {
+		return nil, err
+	}
+
+	return &localWriter{files: store.files, folder: store.folder, file: file}, nil
+}
+
+func (writer *localWriter) Write(data []byte) (int, error) {
+	return writer.file.Write(data)
+}
+
+// Commit renames the temporary file once the object name is known.
+func (writer *localWriter) Commit(name string) error {
+	if err := writer.file.Close(); err != nil {
+		return err
+	}
+	if err := writer.files.Chmod(writer.file.Name(), 0644); err != nil {
+		return err
+	}
+	if err := writer.files.Rename(writer.file.Name(), Path.Join(writer.folder, name)); err != nil {
+		return err
+	}
+
+	writer.committed = true
+
+	return nil
+}
+
+func (writer *localWriter) Close() error {
+	if writer.committed {
+		return nil
+	}
+
+	writer.file.Close()
+
+	return writer.files.Remove(writer.file.Name())
+}
+
+func (store *local) Open(name string) (io.ReadCloser, error) {
+	return store.files.Open(Path.Join(store.folder, name))
+}
+
+func (store *local) Stat(name string) (fs.FileInfo, error) {
+	return store.files.Stat(Path.Join(store.folder, name))
+}
+
+func (store *local) Remove(name string) error {
+	err := store.files.Remove(Path.Join(store.folder, name))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (store *local) List() ([]fs.FileInfo, error) {
+	entries, err := store.files.ReadDir(store.folder)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := []fs.FileInfo{}
+
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), TEMP_FILE_PREFIX) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
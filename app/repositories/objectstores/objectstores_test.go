@@ -0,0 +1,108 @@
+package objectstores
+
+import (
+	"io"
+	"os"
+	"saymow/version-manager/app/pkg/vfs"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testStores runs the same checks on every store, the S3 one against a stand-in server.
+func testStores(t *testing.T, test func(t *testing.T, store ObjectStore)) {
+	t.Run("local", func(t *testing.T) {
+		test(t, NewLocal(vfs.NewOS(), t.TempDir()))
+	})
+	t.Run("memory", func(t *testing.T) {
+		test(t, NewMemory())
+	})
+	t.Run("s3", func(t *testing.T) {
+		server := newS3Server(t, "bucket")
+		defer server.Close()
+
+		test(t, NewS3(S3Config{
+			Endpoint:        server.URL,
+			Bucket:          "bucket",
+			Prefix:          "team/objects/",
+			AccessKeyID:     s3TestAccessKeyID,
+			SecretAccessKey: s3TestSecretAccessKey,
+		}))
+	})
+}
+
+func writeObject(t *testing.T, store ObjectStore, name string, content string) {
+	writer, err := store.Create()
+	assert.Nil(t, err)
+	defer writer.Close()
+
+	_, err = writer.Write([]byte(content))
+	assert.Nil(t, err)
+	assert.Nil(t, writer.Commit(name))
+}
+
+func readObject(t *testing.T, store ObjectStore, name string) string {
+	reader, err := store.Open(name)
+	assert.Nil(t, err)
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	assert.Nil(t, err)
+
+	return string(content)
+}
+
+func TestObjects(t *testing.T) {
+	testStores(t, func(t *testing.T, store ObjectStore) {
+		writeObject(t, store, "b", "b content")
+		writeObject(t, store, "a", "a content")
+		writeObject(t, store, "c", "")
+
+		assert.Equal(t, readObject(t, store, "a"), "a content")
+		assert.Equal(t, readObject(t, store, "c"), "")
+
+		info, err := store.Stat("b")
+		assert.Nil(t, err)
+		assert.Equal(t, info.Name(), "b")
+		assert.Equal(t, info.Size(), int64(9))
+
+		infos, err := store.List()
+		assert.Nil(t, err)
+		names := []string{}
+		for _, info := range infos {
+			names = append(names, info.Name())
+		}
+		assert.Equal(t, names, []string{"a", "b", "c"})
+
+		// Overwritten objects have the same content, the name is its hash
+		writeObject(t, store, "a", "a content")
+		assert.Equal(t, readObject(t, store, "a"), "a content")
+
+		assert.Nil(t, store.Remove("a"))
+		assert.Nil(t, store.Remove("a"))
+		_, err = store.Open("a")
+		assert.True(t, os.IsNotExist(err))
+		_, err = store.Stat("a")
+		assert.True(t, os.IsNotExist(err))
+	})
+}
+
+func TestUncommittedObjects(t *testing.T) {
+	testStores(t, func(t *testing.T, store ObjectStore) {
+		writer, err := store.Create()
+		assert.Nil(t, err)
+		_, err = writer.Write([]byte("discarded content"))
+		assert.Nil(t, err)
+
+		// Objects being written are not listed
+		infos, err := store.List()
+		assert.Nil(t, err)
+		assert.Equal(t, len(infos), 0)
+
+		assert.Nil(t, writer.Close())
+
+		infos, err = store.List()
+		assert.Nil(t, err)
+		assert.Equal(t, len(infos), 0)
+	})
+}
@@ -0,0 +1,506 @@
+package objectstores
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	DEFAULT_S3_REGION = "us-east-1"
+	// Requests, bodies included, of the default client fail after this timeout, so a server that stopped
+	// responding does not block the commands holding the repository lock
+	DEFAULT_S3_TIMEOUT = 2 * time.Minute
+	// Objects larger than the part size are sent in parts of that size. S3 rejects parts, but the last one,
+	// smaller than 5 MiB
+	DEFAULT_S3_PART_SIZE = 16 << 20
+
+	ACCESS_KEY_ID_ENV     = "AWS_ACCESS_KEY_ID"
+	SECRET_ACCESS_KEY_ENV = "AWS_SECRET_ACCESS_KEY"
+	SESSION_TOKEN_ENV     = "AWS_SESSION_TOKEN"
+	REGION_ENV            = "AWS_REGION"
+
+	s3Service       = "s3"
+	s3Algorithm     = "AWS4-HMAC-SHA256"
+	s3DateFormat    = "20060102T150405Z"
+	s3ShortFormat   = "20060102"
+	s3ListPageLimit = "1000"
+)
+
+// S3Config locates the objects of an S3 compatible store: they are stored under Prefix in Bucket, and
+// requests use the path style, Endpoint/Bucket/Prefix<name>, so any S3 compatible server works. Client
+// defaults to a client with the DEFAULT_S3_TIMEOUT and PartSize to DEFAULT_S3_PART_SIZE.
+type S3Config struct {
+	Endpoint        string
+	Bucket          string
+	Prefix          string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Client          *http.Client
+	PartSize        int64
+}
+
+// ParseS3URL reads the endpoint, bucket and prefix of an "http(s)://host[:port]/bucket[/prefix]" url. The
+// region and the credentials are left empty.
+func ParseS3URL(rawURL string) (S3Config, error) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return S3Config{}, err
+	}
+	if (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+		return S3Config{}, fmt.Errorf("invalid object store url \"%s\", expected http(s)://host/bucket[/prefix].", rawURL)
+	}
+
+	bucket, prefix, _ := strings.Cut(strings.Trim(parsedURL.Path, "/"), "/")
+	if bucket == "" {
+		return S3Config{}, fmt.Errorf("invalid object store url \"%s\", the bucket is missing.", rawURL)
+	}
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	return S3Config{
+		Endpoint: fmt.Sprintf("%s://%s", parsedURL.Scheme, parsedURL.Host),
+		Bucket:   bucket,
+		Prefix:   prefix,
+	}, nil
+}
+
+// NewS3FromURL returns the store of an "http(s)://host[:port]/bucket[/prefix]" url, the region and the
+// credentials are read from the usual AWS environment variables.
+func NewS3FromURL(rawURL string) (ObjectStore, error) {
+	config, err := ParseS3URL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	config.Region = os.Getenv(REGION_ENV)
+	config.AccessKeyID = os.Getenv(ACCESS_KEY_ID_ENV)
+	config.SecretAccessKey = os.Getenv(SECRET_ACCESS_KEY_ENV)
+	config.SessionToken = os.Getenv(SESSION_TOKEN_ENV)
+
+	return NewS3(config), nil
+}
+
+type s3 struct {
+	config S3Config
+	ctx    context.Context
+	now    func() time.Time
+}
+
+// NewS3 returns the store of the objects of an S3 compatible server, requests are signed with the AWS
+// signature version 4.
+func NewS3(config S3Config) ObjectStore {
+	if config.Region == "" {
+		config.Region = DEFAULT_S3_REGION
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: DEFAULT_S3_TIMEOUT}
+	}
+	if config.PartSize <= 0 {
+		config.PartSize = DEFAULT_S3_PART_SIZE
+	}
+	config.Endpoint = strings.TrimSuffix(config.Endpoint, "/")
+
+	return &s3{config: config, ctx: context.Background(), now: time.Now}
+}
+
+func (store *s3) WithContext(ctx context.Context) ObjectStore {
+	return &s3{config: store.config, ctx: ctx, now: store.now}
+}
+
+// s3Writer buffers the object in a temporary file, its size and hash are needed before it is sent. Objects
+// larger than the part size are sent with a multipart upload.
+type s3Writer struct {
+	store *s3
+	file  *os.File
+}
+
+func (store *s3) Create() (Writer, error) {
+	file, err := os.CreateTemp("", TEMP_FILE_PREFIX)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3Writer{store: store, file: file}, nil
+}
+
+func (writer *s3Writer) Write(data []byte) (int, error) {
+	return writer.file.Write(data)
+}
+
+func (writer *s3Writer) Commit(name string) error {
+	size, err := writer.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if size > writer.store.config.PartSize {
+		return writer.store.putMultipart(name, writer.file, size)
+	}
+
+	response, err := writer.store.send(http.MethodPut, writer.store.objectPath(name), nil, io.NewSectionReader(writer.file, 0, size))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	return checkS3Response("put", name, response)
+}
+
+func (writer *s3Writer) Close() error {
+	writer.file.Close()
+	if err := os.Remove(writer.file.Name()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+type s3CompletedPart struct {
+	PartNumber int
+	ETag       string
+}
+
+type s3CompleteMultipartUpload struct {
+	XMLName xml.Name          `xml:"CompleteMultipartUpload"`
+	Parts   []s3CompletedPart `xml:"Part"`
+}
+
+// putMultipart sends the content of file in parts of the part size. A failed upload is aborted, so the server
+// discards the parts already sent.
+func (store *s3) putMultipart(name string, file io.ReaderAt, size int64) (err error) {
+	path := store.objectPath(name)
+
+	response, err := store.do(http.MethodPost, path, url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return err
+	}
+	var upload struct{ UploadId string }
+	err = checkS3Response("put", name, response)
+	if err == nil {
+		err = xml.NewDecoder(response.Body).Decode(&upload)
+	}
+	response.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	uploadQuery := url.Values{"uploadId": {upload.UploadId}}
+	defer func() {
+		if err == nil {
+			return
+		}
+		if response, abortErr := store.do(http.MethodDelete, path, uploadQuery, nil); abortErr == nil {
+			response.Body.Close()
+		}
+	}()
+
+	completed := s3CompleteMultipartUpload{}
+	for offset, partNumber := int64(0), 1; offset < size; offset, partNumber = offset+store.config.PartSize, partNumber+1 {
+		part := io.NewSectionReader(file, offset, min(store.config.PartSize, size-offset))
+		query := url.Values{"partNumber": {fmt.Sprint(partNumber)}, "uploadId": {upload.UploadId}}
+
+		response, err = store.send(http.MethodPut, path, query, part)
+		if err != nil {
+			return err
+		}
+		err = checkS3Response("put", name, response)
+		response.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		completed.Parts = append(completed.Parts, s3CompletedPart{PartNumber: partNumber, ETag: response.Header.Get("ETag")})
+	}
+
+	content, err := xml.Marshal(completed)
+	if err != nil {
+		return err
+	}
+	response, err = store.do(http.MethodPost, path, uploadQuery, content)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if err = checkS3Response("put", name, response); err != nil {
+		return err
+	}
+
+	// The completion can fail after the server started responding, the error is then in a successful response
+	var errorResponse s3ErrorResponse
+	content, _ = io.ReadAll(io.LimitReader(response.Body, 64<<10))
+	if xml.Unmarshal(content, &errorResponse) == nil && errorResponse.Code != "" {
+		err = fmt.Errorf("put %s: %s %s", name, errorResponse.Code, errorResponse.Message)
+	}
+
+	return err
+}
+
+func (store *s3) Open(name string) (io.ReadCloser, error) {
+	response, err := store.do(http.MethodGet, store.objectPath(name), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkS3Response("open", name, response); err != nil {
+		response.Body.Close()
+		return nil, err
+	}
+
+	return response.Body, nil
+}
+
+func (store *s3) Stat(name string) (fs.FileInfo, error) {
+	response, err := store.do(http.MethodHead, store.objectPath(name), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if err := checkS3Response("stat", name, response); err != nil {
+		return nil, err
+	}
+
+	modTime, err := http.ParseTime(response.Header.Get("Last-Modified"))
+	if err != nil {
+		return nil, fmt.Errorf("stat %s: invalid Last-Modified header.", name)
+	}
+
+	return &objectInfo{name: name, size: response.ContentLength, modTime: modTime}, nil
+}
+
+func (store *s3) Remove(name string) error {
+	response, err := store.do(http.MethodDelete, store.objectPath(name), nil, nil)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if err := checkS3Response("remove", name, response); err != nil && response.StatusCode != http.StatusNotFound {
+		return err
+	}
+
+	return nil
+}
+
+type s3ListResult struct {
+	IsTruncated           bool
+	NextContinuationToken string
+	Contents              []struct {
+		Key          string
+		LastModified time.Time
+		Size         int64
+	}
+}
+
+// List lists the objects under the prefix, keys in nested folders are not objects.
+func (store *s3) List() ([]fs.FileInfo, error) {
+	infos := []fs.FileInfo{}
+	query := url.Values{"list-type": {"2"}, "prefix": {store.config.Prefix}, "max-keys": {s3ListPageLimit}}
+
+	for {
+		response, err := store.do(http.MethodGet, "/"+store.config.Bucket, query, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var result s3ListResult
+		err = checkS3Response("list", store.config.Bucket, response)
+		if err == nil {
+			err = xml.NewDecoder(response.Body).Decode(&result)
+		}
+		response.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, content := range result.Contents {
+			name := strings.TrimPrefix(content.Key, store.config.Prefix)
+			if name == "" || strings.Contains(name, "/") {
+				continue
+			}
+
+			infos = append(infos, &objectInfo{name: name, size: content.Size, modTime: content.LastModified})
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name() < infos[j].Name()
+	})
+
+	return infos, nil
+}
+
+func (store *s3) objectPath(name string) string {
+	return fmt.Sprintf("/%s/%s%s", store.config.Bucket, store.config.Prefix, name)
+}
+
+func (store *s3) do(method string, path string, query url.Values, body []byte) (*http.Response, error) {
+	return store.send(method, path, query, io.NewSectionReader(bytes.NewReader(body), 0, int64(len(body))))
+}
+
+// send sends the request with body, which is read once to be hashed and then streamed.
+func (store *s3) send(method string, path string, query url.Values, body *io.SectionReader) (*http.Response, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, body); err != nil {
+		return nil, err
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequestWithContext(store.ctx, method, store.config.Endpoint+escapePath(path), body)
+	if err != nil {
+		return nil, err
+	}
+	request.URL.RawQuery = escapeQuery(query)
+	request.ContentLength = body.Size()
+	if body.Size() == 0 {
+		request.Body = http.NoBody
+	}
+
+	if store.config.SessionToken != "" {
+		request.Header.Set("X-Amz-Security-Token", store.config.SessionToken)
+	}
+	signS3Request(request, store.config, hex.EncodeToString(hash.Sum(nil)), store.now())
+
+	return store.config.Client.Do(request)
+}
+
+type s3ErrorResponse struct {
+	Code    string
+	Message string
+}
+
+// checkS3Response returns the error of a failed response, missing objects are fs.ErrNotExist errors.
+func checkS3Response(op string, name string, response *http.Response) error {
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return nil
+	}
+	if response.StatusCode == http.StatusNotFound {
+		return notExistError(op, name)
+	}
+
+	var errorResponse s3ErrorResponse
+	content, _ := io.ReadAll(io.LimitReader(response.Body, 64<<10))
+	if xml.Unmarshal(content, &errorResponse) == nil && errorResponse.Code != "" {
+		return fmt.Errorf("%s %s: %s %s", op, name, errorResponse.Code, errorResponse.Message)
+	}
+
+	return fmt.Errorf("%s %s: unexpected status %s.", op, name, response.Status)
+}
+
+// signS3Request sets the date, payload hash and authorization headers. Every header already set is signed.
+func signS3Request(request *http.Request, config S3Config, payloadHash string, now time.Time) {
+	now = now.UTC()
+	date := now.Format(s3ShortFormat)
+
+	request.Header.Set("X-Amz-Date", now.Format(s3DateFormat))
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": request.URL.Host}
+	for name, values := range request.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+
+	names := []string{}
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(fmt.Sprintf("%s:%s\n", name, headers[name]))
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		request.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, config.Region, s3Service)
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{s3Algorithm, now.Format(s3DateFormat), scope, hex.EncodeToString(canonicalHash[:])}, "\n")
+
+	key := []byte("AWS4" + config.SecretAccessKey)
+	for _, part := range []string{date, config.Region, s3Service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	request.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, config.AccessKeyID, scope, signedHeaders, signature,
+	))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	hash := hmac.New(sha256.New, key)
+	hash.Write([]byte(data))
+
+	return hash.Sum(nil)
+}
+
+// escape encodes everything but the unreserved characters, as the signature expects.
+func escape(value string, keepSlash bool) string {
+	var builder strings.Builder
+
+	for _, char := range []byte(value) {
+		switch {
+		case 'A' <= char && char <= 'Z', 'a' <= char && char <= 'z', '0' <= char && char <= '9',
+			char == '-', char == '.', char == '_', char == '~', keepSlash && char == '/':
+			builder.WriteByte(char)
+		default:
+			builder.WriteString(fmt.Sprintf("%%%02X", char))
+		}
+	}
+
+	return builder.String()
+}
+
+func escapePath(path string) string {
+	return escape(path, true)
+}
+
+// escapeQuery encodes the query sorted by key, url.Values.Encode escapes spaces as "+".
+func escapeQuery(query url.Values) string {
+	keys := []string{}
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := []string{}
+	for _, key := range keys {
+		for _, value := range query[key] {
+			pairs = append(pairs, escape(key, false)+"="+escape(value, false))
+		}
+	}
+
+	return strings.Join(pairs, "&")
+}
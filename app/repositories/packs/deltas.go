@@ -0,0 +1,157 @@
+package packs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// A delta rebuilds a target content from a base content. It starts with the base and target sizes,
+// followed by instructions that either copy a range of the base or insert new data.
+
+const (
+	copyInstruction byte = iota
+	insertInstruction
+)
+
+// Matches shorter than a block are inserted instead of copied.
+const deltaBlockSize = 16
+
+func appendUvarint(buffer *bytes.Buffer, value int) {
+	buffer.Write(binary.AppendUvarint(nil, uint64(value)))
+}
+
+func readUvarint(reader *bytes.Reader) (int, error) {
+	value, err := binary.ReadUvarint(reader)
+	if err != nil || value > math.MaxInt32 {
+		return 0, &FormatError{"invalid delta."}
+	}
+
+	return int(value), nil
+}
+
+func makeDelta(base []byte, target []byte) []byte {
+	var delta bytes.Buffer
+
+	appendUvarint(&delta, len(base))
+	appendUvarint(&delta, len(target))
+
+	blocks := make(map[string]int)
+	for offset := 0; offset+deltaBlockSize <= len(base); offset += deltaBlockSize {
+		block := string(base[offset : offset+deltaBlockSize])
+
+		if _, ok := blocks[block]; !ok {
+			blocks[block] = offset
+		}
+	}
+
+	insertStart := 0
+	flushInsert := func(end int) {
+		if end > insertStart {
+			delta.WriteByte(insertInstruction)
+			appendUvarint(&delta, end-insertStart)
+			delta.Write(target[insertStart:end])
+		}
+	}
+
+	idx := 0
+	for idx+deltaBlockSize <= len(target) {
+		baseOffset, ok := blocks[string(target[idx:idx+deltaBlockSize])]
+		if !ok {
+			idx++
+			continue
+		}
+
+		// Extend the match backwards over the pending insertion, and forwards as far as possible
+		start := idx
+		for start > insertStart && baseOffset > 0 && base[baseOffset-1] == target[start-1] {
+			start--
+			baseOffset--
+		}
+
+		end := idx + deltaBlockSize
+		baseEnd := baseOffset + (end - start)
+		for end < len(target) && baseEnd < len(base) && base[baseEnd] == target[end] {
+			end++
+			baseEnd++
+		}
+
+		flushInsert(start)
+
+		delta.WriteByte(copyInstruction)
+		appendUvarint(&delta, baseOffset)
+		appendUvarint(&delta, end-start)
+
+		insertStart = end
+		idx = end
+	}
+
+	flushInsert(len(target))
+
+	return delta.Bytes()
+}
+
+func applyDelta(base []byte, delta []byte) ([]byte, error) {
+	reader := bytes.NewReader(delta)
+
+	baseSize, err := readUvarint(reader)
+	if err != nil {
+		return nil, err
+	}
+	if baseSize != len(base) {
+		return nil, &FormatError{"delta base size mismatch."}
+	}
+
+	targetSize, err := readUvarint(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	// The target size is only trusted once the delta is applied
+	target := make([]byte, 0, min(targetSize, len(base)+len(delta)))
+
+	for reader.Len() > 0 {
+		instruction, _ := reader.ReadByte()
+
+		switch instruction {
+		case copyInstruction:
+			offset, err := readUvarint(reader)
+			if err != nil {
+				return nil, err
+			}
+			length, err := readUvarint(reader)
+			if err != nil {
+				return nil, err
+			}
+			if offset+length > len(base) {
+				return nil, &FormatError{"invalid delta."}
+			}
+
+			target = append(target, base[offset:offset+length]...)
+		case insertInstruction:
+			length, err := readUvarint(reader)
+			if err != nil {
+				return nil, err
+			}
+			if length > reader.Len() {
+				return nil, &FormatError{"invalid delta."}
+			}
+
+			data := make([]byte, length)
+			if _, err := io.ReadFull(reader, data); err != nil {
+				return nil, err
+			}
+
+			target = append(target, data...)
+		default:
+			return nil, &FormatError{"invalid delta."}
+		}
+	}
+
+	if len(target) != targetSize {
+		return nil, &FormatError{"delta target size mismatch."}
+	}
+
+	return target, nil
+}
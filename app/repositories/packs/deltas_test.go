@@ -0,0 +1,122 @@
+package packs
+
+import (
+	"fmt"
+	"saymow/version-manager/app/pkg/vfs"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gotest.tools/v3/fs"
+)
+
+func makeLines(count int, format string) string {
+	var builder strings.Builder
+
+	for idx := 0; idx < count; idx++ {
+		builder.WriteString(fmt.Sprintf(format, idx))
+	}
+
+	return builder.String()
+}
+
+func TestDelta(t *testing.T) {
+	base := makeLines(200, "line %d of the base content\n")
+
+	targets := []string{
+		"",
+		base,
+		"short",
+		strings.Replace(base, "line 100 of", "line one hundred of", 1),
+		"new first line\n" + base + "new last line",
+		base[:len(base)/2],
+		base[len(base)/2:] + base[:len(base)/2],
+		makeLines(50, "unrelated %d\n"),
+	}
+
+	for _, target := range targets {
+		delta := makeDelta([]byte(base), []byte(target))
+
+		content, err := applyDelta([]byte(base), delta)
+		assert.Nil(t, err)
+		assert.Equal(t, string(content), target)
+	}
+
+	// Small changes make small deltas
+	delta := makeDelta([]byte(base), []byte(targets[3]))
+	assert.Less(t, len(delta), 100)
+
+	// Empty base
+	delta = makeDelta([]byte{}, []byte("content"))
+	content, err := applyDelta([]byte{}, delta)
+	assert.Nil(t, err)
+	assert.Equal(t, string(content), "content")
+
+	// Wrong base
+	_, err = applyDelta([]byte("other base"), makeDelta([]byte(base), []byte(targets[3])))
+	assert.EqualError(t, err, "delta base size mismatch.")
+
+	// Truncated delta
+	_, err = applyDelta([]byte(base), delta[:len(delta)-1])
+	assert.Error(t, err)
+}
+
+func TestPackDeltas(t *testing.T) {
+	dir := fs.NewDir(t, "packs")
+	defer dir.Remove()
+
+	versions := []string{}
+	content := makeLines(500, "line %d\n")
+	for idx := 0; idx < MAX_DELTA_DEPTH+3; idx++ {
+		content = strings.Replace(content, fmt.Sprintf("line %d\n", idx), fmt.Sprintf("changed line %d\n", idx), 1)
+		versions = append(versions, content)
+	}
+
+	entries := []*Entry{}
+	for idx, version := range versions {
+		entry := makeEntry(ObjectEntry, version)
+		if idx > 0 {
+			entry.Base = hashOf(versions[idx-1])
+		}
+
+		// Bases can come after the objects stored against them
+		entries = append([]*Entry{entry}, entries...)
+	}
+	// Unrelated content is stored whole
+	unrelated := makeEntry(ObjectEntry, makeLines(500, "unrelated %d\n"))
+	unrelated.Base = hashOf(versions[0])
+	entries = append(entries, unrelated)
+
+	name, err := Write(vfs.NewOS(), dir.Path(), entries)
+	assert.Nil(t, err)
+
+	pack, err := Open(vfs.NewOS(), dir.Path(), name)
+	assert.Nil(t, err)
+	assert.Nil(t, pack.Verify())
+
+	for _, version := range versions {
+		assert.Equal(t, readContent(t, pack, ObjectEntry, hashOf(version)), version)
+	}
+	assert.Equal(t, readContent(t, pack, ObjectEntry, unrelated.Name), makeLines(500, "unrelated %d\n"))
+
+	isDelta := func(name string) bool {
+		data, err := pack.openData(ObjectEntry, name)
+		assert.Nil(t, err)
+		defer data.Close()
+
+		magic := make([]byte, len(deltaMagic))
+		_, err = data.ReadAt(magic, 0)
+		assert.Nil(t, err)
+
+		return string(magic) == string(deltaMagic)
+	}
+
+	assert.False(t, isDelta(hashOf(versions[0])))
+	assert.False(t, isDelta(unrelated.Name))
+	for idx := 1; idx <= MAX_DELTA_DEPTH; idx++ {
+		assert.True(t, isDelta(hashOf(versions[idx])))
+	}
+	// The chain depth limit starts a new chain
+	assert.False(t, isDelta(hashOf(versions[MAX_DELTA_DEPTH+1])))
+	assert.True(t, isDelta(hashOf(versions[MAX_DELTA_DEPTH+2])))
+}
@@ -0,0 +1,619 @@
+package packs
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	Path "path/filepath"
+	"saymow/version-manager/app/pkg/vfs"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// A pack stores many objects and saves in a single file.
+//
+// The pack file is a header followed by the entries data, and ends with the SHA-256 checksum of everything
+// before it, which is also the pack name. Saves data is their content and objects data is either their
+// gzip compressed content, as stored loose, or a delta: a magic, the base object name and the gzip
+// compressed delta against the base content.
+//
+// The index file is a header followed by fixed size records sorted by kind and name, so entries are found
+// with a binary search, and ends with the pack checksum. Records hold the entry kind, the binary entry
+// name, and the entry data offset and size in the pack file.
+
+const (
+	PACK_PREFIX     = "pack-"
+	PACK_EXTENSION  = ".pack"
+	INDEX_EXTENSION = ".idx"
+
+	VERSION = 1
+
+	// Reading an object stored as a delta reads its whole base chain, so chains are kept short
+	MAX_DELTA_DEPTH = 10
+	// Deltas are computed in memory, bigger objects are always stored whole
+	MAX_DELTA_CONTENT_SIZE = 64 << 20
+)
+
+const (
+	headerSize = 12
+	nameSize   = sha256.Size
+	keySize    = 1 + nameSize
+	recordSize = keySize + 8 + 8
+)
+
+var (
+	packMagic  = []byte("VPCK")
+	indexMagic = []byte("VIDX")
+	deltaMagic = []byte("VDLT")
+)
+
+type EntryKind byte
+
+const (
+	ObjectEntry EntryKind = iota + 1
+	SaveEntry
+)
+
+// Entry is an object or save to be written in a pack, Open returns its uncompressed content.
+//
+// Objects with a Base, usually the previous version of the same file, are stored as a delta against
+// it when that is smaller.
+type Entry struct {
+	Kind EntryKind
+	Name string
+	Base string
+	Open func() (io.ReadCloser, error)
+}
+
+type Pack struct {
+	Name    string
+	files   vfs.FS
+	path    string
+	records []byte
+	count   int
+}
+
+type FormatError struct {
+	message string
+}
+
+func (err *FormatError) Error() string {
+	return err.message
+}
+
+type entryReader struct {
+	*io.SectionReader
+	file vfs.File
+}
+
+func (reader *entryReader) Close() error {
+	return reader.file.Close()
+}
+
+type contentReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (reader *contentReader) Close() error {
+	var err error
+
+	for _, closer := range reader.closers {
+		if closeErr := closer.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
+
+// IsValidName reports whether name can be stored in a pack, only SHA-256 hex names can.
+func IsValidName(name string) bool {
+	decoded, err := hex.DecodeString(name)
+
+	return err == nil && len(decoded) == nameSize
+}
+
+func makeKey(kind EntryKind, name string) ([]byte, error) {
+	decoded, err := hex.DecodeString(name)
+	if err != nil || len(decoded) != nameSize {
+		return nil, &FormatError{fmt.Sprintf("invalid entry name \"%s\".", name)}
+	}
+
+	return append([]byte{byte(kind)}, decoded...), nil
+}
+
+func writeHeader(writer io.Writer, magic []byte, count int) error {
+	header := make([]byte, headerSize)
+	copy(header, magic)
+	binary.BigEndian.PutUint32(header[4:8], VERSION)
+	binary.BigEndian.PutUint32(header[8:12], uint32(count))
+
+	_, err := writer.Write(header)
+	return err
+}
+
+func readEntry(entry *Entry) ([]byte, error) {
+	reader, err := entry.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return io.ReadAll(reader)
+}
+
+func compress(content []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+
+	compressor := gzip.NewWriter(&buffer)
+	if _, err := compressor.Write(content); err != nil {
+		return nil, err
+	}
+	if err := compressor.Close(); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// sortByBaseChain sorts the entries so that delta bases come before the objects stored against them.
+func sortByBaseChain(entries []*Entry, objects map[string]*Entry) []*Entry {
+	chainLengths := make(map[string]int)
+
+	var chainLength func(entry *Entry, visiting map[string]bool) int
+	chainLength = func(entry *Entry, visiting map[string]bool) int {
+		if entry.Kind != ObjectEntry {
+			return 0
+		}
+		if length, ok := chainLengths[entry.Name]; ok {
+			return length
+		}
+
+		base, ok := objects[entry.Base]
+		if !ok || visiting[entry.Name] {
+			return 0
+		}
+
+		visiting[entry.Name] = true
+		length := chainLength(base, visiting) + 1
+		chainLengths[entry.Name] = length
+
+		return length
+	}
+
+	sortedEntries := slices.Clone(entries)
+	sort.SliceStable(sortedEntries, func(i, j int) bool {
+		return chainLength(sortedEntries[i], map[string]bool{}) < chainLength(sortedEntries[j], map[string]bool{})
+	})
+
+	return sortedEntries
+}
+
+// encodeObject returns the object data and its delta depth, 0 when it is stored whole.
+func encodeObject(entry *Entry, content []byte, objects map[string]*Entry, depths map[string]int) ([]byte, int, error) {
+	data, err := compress(content)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	base, ok := objects[entry.Base]
+	baseDepth, written := depths[entry.Base]
+	if !ok || !written || baseDepth >= MAX_DELTA_DEPTH || len(content) > MAX_DELTA_CONTENT_SIZE {
+		return data, 0, nil
+	}
+
+	baseContent, err := readEntry(base)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(baseContent) > MAX_DELTA_CONTENT_SIZE {
+		return data, 0, nil
+	}
+
+	delta, err := compress(makeDelta(baseContent, content))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	baseName, err := hex.DecodeString(entry.Base)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if len(deltaMagic)+len(baseName)+len(delta) >= len(data) {
+		return data, 0, nil
+	}
+
+	return slices.Concat(deltaMagic, baseName, delta), baseDepth + 1, nil
+}
+
+func writePackFile(file vfs.File, entries []*Entry) ([]byte, [][]byte, error) {
+	hasher := sha256.New()
+	writer := bufio.NewWriter(io.MultiWriter(file, hasher))
+	records := [][]byte{}
+	offset := uint64(headerSize)
+
+	objects := make(map[string]*Entry)
+	for _, entry := range entries {
+		if entry.Kind == ObjectEntry {
+			objects[entry.Name] = entry
+		}
+	}
+	depths := make(map[string]int)
+
+	if err := writeHeader(writer, packMagic, len(entries)); err != nil {
+		return nil, nil, err
+	}
+
+	for _, entry := range sortByBaseChain(entries, objects) {
+		key, err := makeKey(entry.Kind, entry.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		data, err := readEntry(entry)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if entry.Kind == ObjectEntry {
+			data, depths[entry.Name], err = encodeObject(entry, data, objects, depths)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+
+		if _, err := writer.Write(data); err != nil {
+			return nil, nil, err
+		}
+
+		record := make([]byte, recordSize)
+		copy(record, key)
+		binary.BigEndian.PutUint64(record[keySize:keySize+8], offset)
+		binary.BigEndian.PutUint64(record[keySize+8:], uint64(len(data)))
+		records = append(records, record)
+
+		offset += uint64(len(data))
+	}
+
+	if err := writer.Flush(); err != nil {
+		return nil, nil, err
+	}
+
+	checksum := hasher.Sum(nil)
+	if _, err := file.Write(checksum); err != nil {
+		return nil, nil, err
+	}
+
+	return checksum, records, nil
+}
+
+func writeIndexFile(file vfs.File, checksum []byte, records [][]byte) error {
+	writer := bufio.NewWriter(file)
+
+	if err := writeHeader(writer, indexMagic, len(records)); err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		if _, err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	if _, err := writer.Write(checksum); err != nil {
+		return err
+	}
+
+	return writer.Flush()
+}
+
+// Write creates a pack with the entries in folder and returns its name.
+//
+// The index is renamed into place last, packs without an index are not listed, so readers never see
+// an incomplete pack.
+func Write(files vfs.FS, folder string, entries []*Entry) (string, error) {
+	packFile, err := files.CreateTemp(folder, "tmp-"+PACK_PREFIX)
+	if err != nil {
+		return "", err
+	}
+	defer files.Remove(packFile.Name())
+	defer packFile.Close()
+
+	checksum, records, err := writePackFile(packFile, entries)
+	if err != nil {
+		return "", err
+	}
+	if err := packFile.Close(); err != nil {
+		return "", err
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return bytes.Compare(records[i][:keySize], records[j][:keySize]) < 0
+	})
+	for idx := 1; idx < len(records); idx++ {
+		if bytes.Equal(records[idx-1][:keySize], records[idx][:keySize]) {
+			return "", &FormatError{fmt.Sprintf("duplicated entry \"%s\".", hex.EncodeToString(records[idx][1:keySize]))}
+		}
+	}
+
+	indexFile, err := files.CreateTemp(folder, "tmp-"+PACK_PREFIX)
+	if err != nil {
+		return "", err
+	}
+	defer files.Remove(indexFile.Name())
+	defer indexFile.Close()
+
+	if err := writeIndexFile(indexFile, checksum, records); err != nil {
+		return "", err
+	}
+	if err := indexFile.Close(); err != nil {
+		return "", err
+	}
+
+	name := hex.EncodeToString(checksum)
+
+	for _, file := range []vfs.File{packFile, indexFile} {
+		if err := files.Chmod(file.Name(), 0644); err != nil {
+			return "", err
+		}
+	}
+
+	if err := files.Rename(packFile.Name(), Path.Join(folder, PACK_PREFIX+name+PACK_EXTENSION)); err != nil {
+		return "", err
+	}
+	if err := files.Rename(indexFile.Name(), Path.Join(folder, PACK_PREFIX+name+INDEX_EXTENSION)); err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+func Open(files vfs.FS, folder string, name string) (*Pack, error) {
+	content, err := files.ReadFile(Path.Join(folder, PACK_PREFIX+name+INDEX_EXTENSION))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(content) < headerSize+sha256.Size || !bytes.Equal(content[:4], indexMagic) {
+		return nil, &FormatError{fmt.Sprintf("invalid pack index \"%s\".", name)}
+	}
+	if version := binary.BigEndian.Uint32(content[4:8]); version != VERSION {
+		return nil, &FormatError{fmt.Sprintf("unsupported pack version %d.", version)}
+	}
+
+	count := int(binary.BigEndian.Uint32(content[8:12]))
+	if len(content) != headerSize+count*recordSize+sha256.Size {
+		return nil, &FormatError{fmt.Sprintf("invalid pack index \"%s\".", name)}
+	}
+
+	return &Pack{
+		Name:    name,
+		files:   files,
+		path:    Path.Join(folder, PACK_PREFIX+name+PACK_EXTENSION),
+		records: content[headerSize : headerSize+count*recordSize],
+		count:   count,
+	}, nil
+}
+
+// List opens the packs in folder, sorted by name. A missing folder has no packs, and packs removed while
+// being listed are left out.
+func List(files vfs.FS, folder string) ([]*Pack, error) {
+	packs := []*Pack{}
+
+	entries, err := files.ReadDir(folder)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return packs, nil
+		}
+
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		fileName := entry.Name()
+		if !strings.HasPrefix(fileName, PACK_PREFIX) || !strings.HasSuffix(fileName, INDEX_EXTENSION) {
+			continue
+		}
+
+		pack, err := Open(files, folder, strings.TrimSuffix(strings.TrimPrefix(fileName, PACK_PREFIX), INDEX_EXTENSION))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		packs = append(packs, pack)
+	}
+
+	return packs, nil
+}
+
+func (pack *Pack) record(idx int) []byte {
+	return pack.records[idx*recordSize : (idx+1)*recordSize]
+}
+
+func (pack *Pack) find(kind EntryKind, name string) (int64, int64, bool) {
+	key, err := makeKey(kind, name)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	idx := sort.Search(pack.count, func(i int) bool {
+		return bytes.Compare(pack.record(i)[:keySize], key) >= 0
+	})
+	if idx == pack.count || !bytes.Equal(pack.record(idx)[:keySize], key) {
+		return 0, 0, false
+	}
+
+	record := pack.record(idx)
+
+	return int64(binary.BigEndian.Uint64(record[keySize : keySize+8])), int64(binary.BigEndian.Uint64(record[keySize+8:])), true
+}
+
+func (pack *Pack) Contains(kind EntryKind, name string) bool {
+	_, _, ok := pack.find(kind, name)
+
+	return ok
+}
+
+func (pack *Pack) openData(kind EntryKind, name string) (*entryReader, error) {
+	offset, size, ok := pack.find(kind, name)
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	file, err := pack.files.Open(pack.path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entryReader{SectionReader: io.NewSectionReader(file, offset, size), file: file}, nil
+}
+
+func (pack *Pack) readDelta(data *entryReader, depth int) ([]byte, error) {
+	if depth > MAX_DELTA_DEPTH {
+		return nil, &FormatError{"delta chain is too deep."}
+	}
+
+	baseName := make([]byte, nameSize)
+	if _, err := data.ReadAt(baseName, int64(len(deltaMagic))); err != nil {
+		return nil, err
+	}
+
+	decompressor, err := gzip.NewReader(io.NewSectionReader(data, int64(len(deltaMagic)+nameSize), data.Size()))
+	if err != nil {
+		return nil, err
+	}
+	defer decompressor.Close()
+
+	delta, err := io.ReadAll(decompressor)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := pack.readObject(hex.EncodeToString(baseName), depth+1)
+	if err != nil {
+		return nil, err
+	}
+
+	return applyDelta(base, delta)
+}
+
+func (pack *Pack) readObject(name string, depth int) ([]byte, error) {
+	reader, err := pack.openObject(name, depth)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return io.ReadAll(reader)
+}
+
+func (pack *Pack) openObject(name string, depth int) (io.ReadCloser, error) {
+	data, err := pack.openData(ObjectEntry, name)
+	if err != nil {
+		return nil, err
+	}
+
+	magic := make([]byte, len(deltaMagic))
+	if _, err := data.ReadAt(magic, 0); err == nil && bytes.Equal(magic, deltaMagic) {
+		defer data.Close()
+
+		content, err := pack.readDelta(data, depth)
+		if err != nil {
+			return nil, err
+		}
+
+		return io.NopCloser(bytes.NewReader(content)), nil
+	}
+
+	decompressor, err := gzip.NewReader(data)
+	if err != nil {
+		data.Close()
+		return nil, err
+	}
+
+	return &contentReader{Reader: decompressor, closers: []io.Closer{decompressor, data}}, nil
+}
+
+// OpenContent returns the entry uncompressed content, objects stored as deltas are rebuilt from their base.
+func (pack *Pack) OpenContent(kind EntryKind, name string) (io.ReadCloser, error) {
+	if kind == ObjectEntry {
+		return pack.openObject(name, 0)
+	}
+
+	return pack.openData(kind, name)
+}
+
+// Names returns the names of the entries of kind, sorted.
+func (pack *Pack) Names(kind EntryKind) []string {
+	names := []string{}
+
+	for idx := 0; idx < pack.count; idx++ {
+		record := pack.record(idx)
+
+		if EntryKind(record[0]) == kind {
+			names = append(names, hex.EncodeToString(record[1:keySize]))
+		}
+	}
+
+	return names
+}
+
+// Verify checks the pack file content against its checksum.
+func (pack *Pack) Verify() error {
+	file, err := pack.files.Open(pack.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() < headerSize+sha256.Size {
+		return &FormatError{"truncated pack."}
+	}
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, io.NewSectionReader(file, 0, info.Size()-sha256.Size)); err != nil {
+		return err
+	}
+
+	checksum := make([]byte, sha256.Size)
+	if _, err := file.ReadAt(checksum, info.Size()-sha256.Size); err != nil {
+		return err
+	}
+
+	if hash := hex.EncodeToString(hasher.Sum(nil)); hash != pack.Name || !bytes.Equal(hasher.Sum(nil), checksum) {
+		return &FormatError{fmt.Sprintf("checksum mismatch, content hashes to %s.", hash)}
+	}
+
+	return nil
+}
+
+// Stat returns the pack file info, its modification time is when the pack was written.
+func (pack *Pack) Stat() (fs.FileInfo, error) {
+	return pack.files.Stat(pack.path)
+}
+
+// Remove deletes the pack, the index goes first so the pack is never listed without its content.
+func (pack *Pack) Remove() error {
+	if err := pack.files.Remove(strings.TrimSuffix(pack.path, PACK_EXTENSION) + INDEX_EXTENSION); err != nil {
+		return err
+	}
+
+	return pack.files.Remove(pack.path)
+}
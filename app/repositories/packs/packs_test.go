@@ -0,0 +1,104 @@
+package packs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"saymow/version-manager/app/pkg/vfs"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gotest.tools/v3/fs"
+)
+
+func hashOf(content string) string {
+	hash := sha256.Sum256([]byte(content))
+
+	return hex.EncodeToString(hash[:])
+}
+
+func makeEntry(kind EntryKind, content string) *Entry {
+	return &Entry{
+		Kind: kind,
+		Name: hashOf(content),
+		Open: func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader([]byte(content))), nil },
+	}
+}
+
+func readContent(t *testing.T, pack *Pack, kind EntryKind, name string) string {
+	reader, err := pack.OpenContent(kind, name)
+	assert.Nil(t, err)
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	assert.Nil(t, err)
+
+	return string(content)
+}
+
+func TestPack(t *testing.T) {
+	dir := fs.NewDir(t, "packs")
+	defer dir.Remove()
+
+	contents := []string{"object 1", "object 2", "object 3", ""}
+	entries := []*Entry{}
+	for _, content := range contents {
+		entries = append(entries, makeEntry(ObjectEntry, content))
+	}
+	// A save may have the same name as an object
+	entries = append(entries, makeEntry(SaveEntry, "object 1"), makeEntry(SaveEntry, "save 1"))
+
+	name, err := Write(vfs.NewOS(), dir.Path(), entries)
+	assert.Nil(t, err)
+
+	packs, err := List(vfs.NewOS(), dir.Path())
+	assert.Nil(t, err)
+	assert.Equal(t, len(packs), 1)
+
+	pack := packs[0]
+	assert.Equal(t, pack.Name, name)
+	assert.Nil(t, pack.Verify())
+
+	for _, content := range contents {
+		assert.True(t, pack.Contains(ObjectEntry, hashOf(content)))
+		assert.Equal(t, readContent(t, pack, ObjectEntry, hashOf(content)), content)
+	}
+
+	assert.Equal(t, readContent(t, pack, SaveEntry, hashOf("save 1")), "save 1")
+	assert.True(t, pack.Contains(SaveEntry, hashOf("object 1")))
+	assert.False(t, pack.Contains(SaveEntry, hashOf("object 2")))
+	assert.False(t, pack.Contains(ObjectEntry, hashOf("save 1")))
+	assert.False(t, pack.Contains(ObjectEntry, "invalid-name"))
+
+	_, err = pack.OpenContent(ObjectEntry, hashOf("missing"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	assert.Equal(t, len(pack.Names(ObjectEntry)), 4)
+	assert.ElementsMatch(t, pack.Names(SaveEntry), []string{hashOf("object 1"), hashOf("save 1")})
+
+	// Duplicated entries
+	{
+		_, err := Write(vfs.NewOS(), dir.Path(), []*Entry{makeEntry(ObjectEntry, "a"), makeEntry(ObjectEntry, "a")})
+		assert.EqualError(t, err, "duplicated entry \""+hashOf("a")+"\".")
+	}
+
+	// Corrupted pack
+	{
+		path := dir.Join(PACK_PREFIX + name + PACK_EXTENSION)
+		content, err := os.ReadFile(path)
+		assert.Nil(t, err)
+
+		content[headerSize] ^= 0xff
+		assert.Nil(t, os.WriteFile(path, content, 0644))
+
+		assert.Error(t, pack.Verify())
+	}
+
+	assert.Nil(t, pack.Remove())
+
+	packs, err = List(vfs.NewOS(), dir.Path())
+	assert.Nil(t, err)
+	assert.Equal(t, len(packs), 0)
+}
@@ -1,50 +1,192 @@
 package repositories
 
 import (
+	"fmt"
 	"os"
+	Path "path/filepath"
 	"saymow/version-manager/app/pkg/errors"
 	"saymow/version-manager/app/repositories/directories"
 	"slices"
 )
 
-func (repository *Repository) RemoveFile(filepath string) error {
+func (repository *Repository) RemoveFile(filepath string) (err error) {
+	defer errors.Recover(&err)
+
 	if repository.isDetachedMode() {
 		return &ValidationError{"cannot make changes in detached mode."}
 	}
 
-	filepath, err := repository.dir.AbsPath(filepath)
+	filepath, err = repository.dir.AbsPath(filepath)
 	if err != nil {
 		return &ValidationError{err.Error()}
 	}
 
-	// Remove from working dir
-	err = os.Remove(filepath)
-	if err != nil && !os.IsNotExist(err) {
+	repository.removeFile(filepath, false)
+
+	return nil
+}
+
+// RemoveFiles stages the removal of the tracked files matched by paths, directories require recursive. The files
+// are deleted from the working directory unless cached is set.
+//
+// Unless force is set, files whose unsaved content would be lost are refused: without cached, the working file
+// and the staged change must match HEAD; with cached, the staged change must match HEAD or the working file.
+func (repository *Repository) RemoveFiles(paths []string, cached bool, force bool, recursive bool) (err error) {
+	defer errors.Recover(&err)
+
+	if repository.isDetachedMode() {
+		return &ValidationError{"cannot make changes in detached mode."}
+	}
+
+	trackedPaths := repository.getTrackedPaths()
+	filepaths := []string{}
+	matchedPaths := make(map[string]bool)
+
+	for _, path := range paths {
+		filepath, err := repository.dir.AbsPath(path)
+		if err != nil {
+			return &ValidationError{err.Error()}
+		}
+
+		pathFilepaths := []string{}
+		isDir := false
+
+		for _, trackedPath := range trackedPaths {
+			if trackedPath == filepath {
+				pathFilepaths = append(pathFilepaths, trackedPath)
+			} else if isSubpath(filepath, trackedPath) {
+				pathFilepaths = append(pathFilepaths, trackedPath)
+				isDir = true
+			}
+		}
+
+		if len(pathFilepaths) == 0 {
+			return &ValidationError{fmt.Sprintf("path \"%s\" did not match any tracked files.", path)}
+		}
+		if isDir && !recursive {
+			return &ValidationError{fmt.Sprintf("not removing \"%s\" recursively without -r.", path)}
+		}
+
+		for _, filepath := range pathFilepaths {
+			if !matchedPaths[filepath] {
+				filepaths = append(filepaths, filepath)
+				matchedPaths[filepath] = true
+			}
+		}
+	}
+
+	slices.Sort(filepaths)
+
+	if !force {
+		for _, filepath := range filepaths {
+			if repository.hasUnsavedContent(filepath, cached) {
+				return &ConflictError{fmt.Sprintf("\"%s\" has unsaved modifications, use --force to remove it.", filepath)}
+			}
+		}
+	}
+
+	for _, filepath := range filepaths {
+		repository.removeFile(filepath, cached)
+	}
+
+	return nil
+}
+
+// hasUnsavedContent tells whether removing the file would lose content that is not in HEAD.
+func (repository *Repository) hasUnsavedContent(filepath string, cached bool) bool {
+	savedHash, stagedHash, workingHash := "", "", ""
+
+	if savedFile := repository.findSavedFile(filepath); savedFile != nil {
+		savedHash = savedFile.ObjectName
+	}
+
+	if stagedChange := repository.findStagedChange(filepath); stagedChange != nil {
+		switch stagedChange.ChangeType {
+		case directories.Conflict:
+			return true
+		case directories.Creation, directories.Modification:
+			stagedHash = stagedChange.GetHash()
+		case directories.Rename:
+			stagedHash = stagedChange.GetHash()
+
+			// The renamed file content is saved at its source path
+			if savedFile := repository.findSavedFile(stagedChange.Rename.FromFilepath); savedFile != nil {
+				savedHash = savedFile.ObjectName
+			}
+		}
+	}
+
+	if _, err := repository.fs.Files.Lstat(filepath); err == nil {
+		file, err := repository.fs.HashFile(filepath)
+		errors.Check(err)
+
+		workingHash = file.ObjectName
+	} else if !os.IsNotExist(err) {
 		errors.Error(err.Error())
 	}
 
+	if cached {
+		return stagedHash != "" && stagedHash != savedHash && stagedHash != workingHash
+	}
+
+	return (workingHash != "" && workingHash != savedHash) || (stagedHash != "" && stagedHash != savedHash)
+}
+
+// removeEmptyDirs removes dirpath and its parents up to the root, stopping at the first directory that is not empty.
+func (repository *Repository) removeEmptyDirs(dirpath string) {
+	for dirpath != repository.fs.Root && isSubpath(repository.fs.Root, dirpath) {
+		if err := repository.fs.Files.Remove(dirpath); err != nil {
+			return
+		}
+
+		dirpath = Path.Dir(dirpath)
+	}
+}
+
+// removeFile stages the removal of the file, and deletes it from the working directory unless cached is set.
+// The directories left empty are deleted as well, so they do not show up as untracked.
+func (repository *Repository) removeFile(filepath string, cached bool) {
+	if !cached {
+		// Remove from working dir, a tracked empty directory is kept when files were added under it
+		err := repository.fs.Files.Remove(filepath)
+		if err != nil && !os.IsNotExist(err) && !repository.isTrackedDirPresent(repository.getTrackedFiles().findFile(filepath)) {
+			errors.Error(err.Error())
+		}
+
+		repository.removeEmptyDirs(Path.Dir(filepath))
+	}
+
 	stagedChangeIdx := repository.findStagedChangeIdx(filepath)
 	savedObject := repository.findSavedFile(filepath)
 
 	if stagedChangeIdx != -1 {
 		if repository.index[stagedChangeIdx].ChangeType == directories.Removal {
 			// Index entry is already meant for removal
-			return nil
+			return
 		}
 
-		if !(repository.index[stagedChangeIdx].ChangeType == directories.Conflict && !repository.index[stagedChangeIdx].Conflict.IsObjectTemporary()) {
-			// Remove change object unless it is a conflict permanent object.
-
-			repository.fs.RemoveObject(repository.index[stagedChangeIdx].GetHash())
+		if stagedChange := repository.index[stagedChangeIdx]; stagedChange.ChangeType == directories.Rename {
+			// Removing a renamed file removes its source, the rename object may be the saved one
+			repository.index[stagedChangeIdx] = &directories.Change{
+				ChangeType: directories.Removal,
+				Removal:    &directories.FileRemoval{Filepath: stagedChange.Rename.FromFilepath},
+			}
+			repository.removeUnusedObjects([]string{stagedChange.GetHash()})
+			return
 		}
+
+		stagedChange := repository.index[stagedChangeIdx]
 		// Remove existing change from the index
 		repository.index = slices.Delete(repository.index, stagedChangeIdx, stagedChangeIdx+1)
+
+		if !(stagedChange.ChangeType == directories.Conflict && !stagedChange.Conflict.IsObjectTemporary()) {
+			// Remove change object unless it is a conflict permanent object.
+			repository.removeUnusedObjects([]string{stagedChange.GetHash()})
+		}
 	}
 
 	if savedObject != nil {
 		// Create Index file removal entry
 		repository.index = append(repository.index, &directories.Change{ChangeType: directories.Removal, Removal: &directories.FileRemoval{Filepath: filepath}})
 	}
-
-	return nil
 }
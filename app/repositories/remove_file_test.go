@@ -1,6 +1,7 @@
 package repositories
 
 import (
+	"fmt"
 	path "path/filepath"
 	"saymow/version-manager/app/pkg/collections"
 	"saymow/version-manager/app/pkg/fixtures"
@@ -45,6 +46,8 @@ func TestRemoveFile(t *testing.T) {
 
 	// Check remove file base case (existing only on the index and working dir)
 	{
+		// The index already stages the "4 content" object for 4.txt, it must be kept
+		fixtures.WriteFile(dir.Join("a", "4.txt"), []byte("a/4 content"))
 		repository.IndexFile(path.Join("a", "4.txt"))
 
 		idx := collections.FindIndex(repository.index, func(change *directories.Change, _ int) bool {
@@ -130,7 +133,7 @@ func TestRemoveConflictedFile(t *testing.T) {
 		repository.SaveIndex()
 		repository.CreateSave("s0")
 
-		repository = GetRepository(dir.Path())
+		repository = fixtureGetRepository(t, dir.Path())
 
 		// Mock a merge conflict
 
@@ -194,3 +197,63 @@ func TestRemoveConflictedFile(t *testing.T) {
 		assert.True(t, fixtures.FileExists(dir.Join(filesystems.REPOSITORY_FOLDER_NAME, filesystems.OBJECTS_FOLDER_NAME, tempObjectName)))
 	}
 }
+
+func TestRemoveFiles(t *testing.T) {
+	dir, repository := fixtureGetBaseProject(t)
+	defer dir.Remove()
+
+	assert.Nil(t, repository.AddFiles([]string{"."}))
+	repository.SaveIndex()
+	repository.CreateSave("initial save")
+	repository = fixtureGetRepository(t, dir.Path())
+
+	// Directories require recursive
+	{
+		err := repository.RemoveFiles([]string{"a"}, false, false, false)
+		assert.EqualError(t, err, "Validation Error: not removing \"a\" recursively without -r.")
+
+		err = repository.RemoveFiles([]string{"missing.txt"}, false, false, false)
+		assert.EqualError(t, err, "Validation Error: path \"missing.txt\" did not match any tracked files.")
+
+		assert.Nil(t, repository.RemoveFiles([]string{path.Join("a", "b")}, false, false, true))
+		assert.Equal(t, getIndexPaths(repository), []string{dir.Join("a", "b", "6.txt"), dir.Join("a", "b", "7.txt")})
+		assert.False(t, fixtures.FileExists(dir.Join("a", "b")))
+		assert.True(t, fixtures.FileExists(dir.Join("a", "4.txt")))
+	}
+
+	// Cached keeps the working file, which becomes untracked
+	{
+		assert.Nil(t, repository.RemoveFiles([]string{"1.txt"}, true, false, false))
+		assert.Equal(t, repository.index[2].ChangeType, directories.Removal)
+		assert.Equal(t, fixtures.ReadFile(dir.Join("1.txt")), "1 content")
+
+		status, err := repository.GetStatus()
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, status.Staged.RemovedFilePaths, []string{dir.Join("1.txt"), dir.Join("a", "b", "6.txt"), dir.Join("a", "b", "7.txt")})
+		assert.Equal(t, status.WorkingDir.UntrackedFilePaths, []string{dir.Join("1.txt")})
+	}
+
+	// Unsaved modifications are refused unless forced
+	{
+		fixtures.WriteFile(dir.Join("2.txt"), []byte("2 new content"))
+
+		err := repository.RemoveFiles([]string{"2.txt"}, false, false, false)
+		assert.EqualError(t, err, fmt.Sprintf("Conflict Error: \"%s\" has unsaved modifications, use --force to remove it.", dir.Join("2.txt")))
+		assert.True(t, fixtures.FileExists(dir.Join("2.txt")))
+
+		// The working file is kept, so its modifications are safe
+		assert.Nil(t, repository.RemoveFiles([]string{"2.txt"}, true, false, false))
+		assert.True(t, fixtures.FileExists(dir.Join("2.txt")))
+
+		// The staged content would be lost
+		fixtures.WriteFile(dir.Join("c", "8.txt"), []byte("8 new content"))
+		assert.Nil(t, repository.IndexFile(path.Join("c", "8.txt")))
+		fixtures.WriteFile(dir.Join("c", "8.txt"), []byte("8 newer content"))
+
+		err = repository.RemoveFiles([]string{path.Join("c", "8.txt")}, true, false, false)
+		assert.EqualError(t, err, fmt.Sprintf("Conflict Error: \"%s\" has unsaved modifications, use --force to remove it.", dir.Join("c", "8.txt")))
+
+		assert.Nil(t, repository.RemoveFiles([]string{"c"}, false, true, true))
+		assert.False(t, fixtures.FileExists(dir.Join("c")))
+	}
+}
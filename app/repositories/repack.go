@@ -0,0 +1,42 @@
+package repositories
+
+import (
+	"saymow/version-manager/app/pkg/errors"
+	"saymow/version-manager/app/repositories/packs"
+	"time"
+)
+
+type Repack struct {
+	PackName      string
+	PackedObjects int
+	PackedSaves   int
+}
+
+// Repack moves the loose objects and saves, and the existing packs, into a single pack.
+//
+// Only the entries reachable from the refs, the head or the index are packed, and the ones written in the
+// last GC_GRACE_PERIOD. The other loose entries are left to CollectGarbage. Nil is returned when there is
+// nothing to pack.
+func (repository *Repository) Repack() (_ *Repack, err error) {
+	defer errors.Recover(&err)
+
+	reachableSaves, reachableObjects := repository.markReachable()
+	isReachable := func(kind packs.EntryKind, name string) bool {
+		if kind == packs.SaveEntry {
+			return reachableSaves[name]
+		}
+
+		return reachableObjects[name]
+	}
+
+	pack, err := repository.fs.Repack(isReachable, time.Now().Add(-GC_GRACE_PERIOD))
+	if pack == nil || err != nil {
+		return nil, err
+	}
+
+	return &Repack{
+		PackName:      pack.Name,
+		PackedObjects: len(pack.Names(packs.ObjectEntry)),
+		PackedSaves:   len(pack.Names(packs.SaveEntry)),
+	}, nil
+}
@@ -0,0 +1,147 @@
+package repositories
+
+import (
+	"os"
+	Path "path/filepath"
+	"saymow/version-manager/app/pkg/errors"
+	"saymow/version-manager/app/pkg/fixtures"
+	"saymow/version-manager/app/repositories/filesystems"
+	"saymow/version-manager/app/repositories/packs"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepack(t *testing.T) {
+	dir, repository := fixtureGetBaseProject(t)
+	defer dir.Remove()
+
+	objectsPath := dir.Join(filesystems.REPOSITORY_FOLDER_NAME, filesystems.OBJECTS_FOLDER_NAME)
+	savesPath := dir.Join(filesystems.REPOSITORY_FOLDER_NAME, filesystems.SAVES_FOLDER_NAME)
+	packsPath := dir.Join(filesystems.REPOSITORY_FOLDER_NAME, filesystems.PACKS_FOLDER_NAME)
+
+	countEntries := func(path string) int {
+		entries, err := os.ReadDir(path)
+		errors.Check(err)
+
+		return len(entries)
+	}
+
+	repository.IndexFile("1.txt")
+	repository.IndexFile(Path.Join("a", "4.txt"))
+	repository.SaveIndex()
+	s0, _ := repository.CreateSave("s0")
+
+	repository = fixtureGetRepository(t, dir.Path())
+
+	fixtures.WriteFile(dir.Join("1.txt"), []byte("1 new content"))
+	repository.IndexFile("1.txt")
+	repository.SaveIndex()
+	s1, _ := repository.CreateSave("s1")
+
+	repository = fixtureGetRepository(t, dir.Path())
+
+	// Loose entries are packed
+	{
+		repack, err := repository.Repack()
+		assert.NoError(t, err)
+
+		assert.Equal(t, repack.PackedObjects, 3)
+		assert.Equal(t, repack.PackedSaves, 2)
+		assert.Equal(t, countEntries(objectsPath), 0)
+		assert.Equal(t, countEntries(savesPath), 0)
+		assert.Equal(t, countEntries(packsPath), 2)
+		report, err := CheckIntegrity(dir.Path())
+		assert.NoError(t, err)
+		assert.False(t, report.HasProblems())
+	}
+
+	// Nothing to pack
+	{
+		repack, err := repository.Repack()
+		assert.NoError(t, err)
+		assert.Nil(t, repack)
+	}
+
+	// Packed entries are read transparently
+	{
+		repository = fixtureGetRepository(t, dir.Path())
+
+		assert.Equal(t, repository.dir.FindNode("1.txt").File.ObjectName, s1.Changes[0].File.ObjectName)
+		assert.Equal(t, len(repository.getSave(s1.Id).Checkpoints), 2)
+
+		assert.Nil(t, repository.Restore(s0.Id, "1.txt"))
+		assert.Equal(t, fixtures.ReadFile(dir.Join("1.txt")), "1 content")
+
+		assert.Nil(t, repository.Restore(filesystems.INITIAL_REF_NAME, "1.txt"))
+		assert.Equal(t, fixtures.ReadFile(dir.Join("1.txt")), "1 new content")
+	}
+
+	// Packs and new loose entries are combined
+	{
+		repository = fixtureGetRepository(t, dir.Path())
+
+		repository.IndexFile("2.txt")
+		repository.SaveIndex()
+		s2, _ := repository.CreateSave("s2")
+
+		// Readers that loaded the previous packs read the entries moved into the new pack
+		reader := fixtureGetRepository(t, dir.Path())
+
+		repository = fixtureGetRepository(t, dir.Path())
+		repack, err := repository.Repack()
+		assert.NoError(t, err)
+
+		assert.Equal(t, len(reader.getSave(s2.Id).Checkpoints), 3)
+		assert.Nil(t, reader.fs.VerifyObject(s1.Changes[0].File.ObjectName))
+
+		assert.Equal(t, repack.PackedObjects, 4)
+		assert.Equal(t, repack.PackedSaves, 3)
+		assert.Equal(t, countEntries(objectsPath), 0)
+		assert.Equal(t, countEntries(savesPath), 0)
+		assert.Equal(t, countEntries(packsPath), 2)
+
+		repository = fixtureGetRepository(t, dir.Path())
+		assert.Equal(t, len(repository.getSave(s2.Id).Checkpoints), 3)
+		report, err := CheckIntegrity(dir.Path())
+		assert.NoError(t, err)
+		assert.False(t, report.HasProblems())
+	}
+
+	// Unreachable entries are left to gc, unless they were just written
+	{
+		repository = fixtureGetRepository(t, dir.Path())
+
+		oldObject, err := repository.fs.WriteObject("", strings.NewReader("old unreachable content"))
+		assert.NoError(t, err)
+		newObject, err := repository.fs.WriteObject("", strings.NewReader("new unreachable content"))
+		assert.NoError(t, err)
+		past := time.Now().Add(-2 * GC_GRACE_PERIOD)
+		errors.Check(os.Chtimes(Path.Join(objectsPath, oldObject.ObjectName), past, past))
+
+		repack, err := repository.Repack()
+		assert.NoError(t, err)
+
+		assert.Equal(t, repack.PackedObjects, 5)
+		assert.Equal(t, countEntries(objectsPath), 1)
+		collection, err := repository.CollectGarbage(false, GC_GRACE_PERIOD)
+		assert.NoError(t, err)
+		assert.Equal(t, collection.RemovedObjects, []string{oldObject.ObjectName})
+
+		// The packed object is dropped once its pack is older than the grace period
+		loadedPacks, err := repository.fs.ListPacks()
+		assert.NoError(t, err)
+		assert.True(t, loadedPacks[0].Contains(packs.ObjectEntry, newObject.ObjectName))
+		errors.Check(os.Chtimes(Path.Join(packsPath, packs.PACK_PREFIX+loadedPacks[0].Name+packs.PACK_EXTENSION), past, past))
+
+		repack, err = repository.Repack()
+		assert.NoError(t, err)
+
+		assert.Equal(t, repack.PackedObjects, 4)
+		loadedPacks, err = repository.fs.ListPacks()
+		assert.NoError(t, err)
+		assert.False(t, loadedPacks[0].Contains(packs.ObjectEntry, newObject.ObjectName))
+	}
+}
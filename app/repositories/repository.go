@@ -1,20 +1,49 @@
 package repositories
 
 import (
+	"context"
 	"fmt"
+	"io/fs"
+	"os"
+	Path "path/filepath"
 	"saymow/version-manager/app/pkg/collections"
 	"saymow/version-manager/app/pkg/errors"
+	"saymow/version-manager/app/pkg/vfs"
+	"saymow/version-manager/app/pkg/workers"
 
 	"saymow/version-manager/app/repositories/directories"
 	"saymow/version-manager/app/repositories/filesystems"
+	"saymow/version-manager/app/repositories/ignores"
+	"saymow/version-manager/app/repositories/objectstores"
+	"sync"
+	"time"
 )
 
 type Repository struct {
-	fs    *filesystems.FileSystem
-	refs  *filesystems.Refs
-	head  string
-	index []*directories.Change
-	dir   directories.Dir
+	fs          *filesystems.FileSystem
+	refs        *filesystems.Refs
+	head        string
+	mergeHead   string
+	index       []*directories.Change
+	dir         directories.Dir
+	ignores     *ignores.Matcher
+	parallelism int
+	ctx         context.Context
+	clock       func() time.Time
+	progress    func(Progress)
+}
+
+const (
+	INDEXING_OPERATION  = "indexing"
+	HASHING_OPERATION   = "hashing"
+	RESTORING_OPERATION = "restoring"
+)
+
+// Progress reports how many of the files of an operation were processed.
+type Progress struct {
+	Operation string
+	Done      int
+	Total     int
 }
 
 type SaveLog struct {
@@ -27,12 +56,18 @@ type ConflictedFileStatus struct {
 	Message  string
 }
 
+type RenamedFileStatus struct {
+	FromFilepath string
+	Filepath     string
+}
+
 type Status struct {
 	Staged struct {
 		ConflictedFilesPaths []ConflictedFileStatus
 		CreatedFilesPaths    []string
 		ModifiedFilePaths    []string
 		RemovedFilePaths     []string
+		RenamedFiles         []RenamedFileStatus
 	}
 	WorkingDir struct {
 		ModifiedFilePaths  []string
@@ -41,6 +76,10 @@ type Status struct {
 	}
 }
 
+// Errors returned by the repository. Besides these, the filesystems.CorruptError is returned when the
+// repository files are corrupted, the filesystems.LockedError when another process holds the repository
+// lock, and other errors come from the operating system.
+
 type ValidationError struct {
 	Message string
 }
@@ -49,8 +88,44 @@ func (err *ValidationError) Error() string {
 	return fmt.Sprintf("Validation Error: %s", err.Message)
 }
 
-func CreateRepository(root string) *Repository {
-	fileSystem := filesystems.Create(root)
+// NotRepositoryError is returned when no repository is found in a directory or its parents.
+type NotRepositoryError struct {
+	Path string
+}
+
+func (err *NotRepositoryError) Error() string {
+	return "Repository Error: not a repository (or any of the parent directories)."
+}
+
+// InvalidRefError is returned when a name is neither a ref nor a save hash.
+type InvalidRefError struct {
+	Ref string
+}
+
+func (err *InvalidRefError) Error() string {
+	return fmt.Sprintf("Ref Error: invalid ref \"%s\".", err.Ref)
+}
+
+// ConflictError is returned when an operation would lose unsaved changes or conflicts are not resolved.
+type ConflictError struct {
+	Message string
+}
+
+func (err *ConflictError) Error() string {
+	return fmt.Sprintf("Conflict Error: %s", err.Message)
+}
+
+func CreateRepository(root string) (*Repository, error) {
+	return CreateRepositoryFS(vfs.NewOS(), root)
+}
+
+// CreateRepositoryFS creates a repository at root on files, the working directory and the repository folder
+// are both read and written through it.
+func CreateRepositoryFS(files vfs.FS, root string) (_ *Repository, err error) {
+	defer errors.Recover(&err)
+
+	fileSystem, err := filesystems.Create(files, root)
+	errors.Check(err)
 
 	return &Repository{
 		fs:    fileSystem,
@@ -58,7 +133,7 @@ func CreateRepository(root string) *Repository {
 		head:  filesystems.INITIAL_REF_NAME,
 		index: []*directories.Change{},
 		dir:   directories.Dir{Path: root, Children: make(map[string]*directories.Node)},
-	}
+	}, nil
 }
 
 func (status *Status) HasChanges() bool {
@@ -66,23 +141,224 @@ func (status *Status) HasChanges() bool {
 		len(status.Staged.CreatedFilesPaths)+
 		len(status.Staged.ModifiedFilePaths)+
 		len(status.Staged.RemovedFilePaths)+
+		len(status.Staged.RenamedFiles)+
 		len(status.WorkingDir.UntrackedFilePaths)+
 		len(status.WorkingDir.ModifiedFilePaths)+
 		len(status.WorkingDir.RemovedFilePaths) > 0
 }
 
-func GetRepository(root string) *Repository {
-	repository := &Repository{}
+// openRepository reads the repository state without building the current file tree. With lock, the
+// repository is locked first and stays locked until Commit or Unlock.
+func openRepository(files vfs.FS, root string, lock bool) *Repository {
+	repository := openRepositoryFS(files, root)
+
+	if lock {
+		errors.Check(repository.fs.Lock(filesystems.LOCK_TIMEOUT))
+		defer func() {
+			if value := recover(); value != nil {
+				repository.fs.Unlock()
+				panic(value)
+			}
+		}()
+	}
 
-	repository.fs = filesystems.Open(root)
-	repository.index = repository.fs.ReadIndex()
-	repository.refs = repository.fs.ReadRefs()
-	repository.head = repository.fs.ReadHead()
-	repository.dir = repository.fs.ReadDir(repository.getCurrentSaveName())
+	// Repositories from older versions are upgraded in place, assuming they were not moved
+	errors.Check(repository.fs.Migrate(root))
+	repository.readState()
 
 	return repository
 }
 
+// openRepositoryFS opens the repository files, its state is not read.
+func openRepositoryFS(files vfs.FS, root string) *Repository {
+	if info, err := files.Stat(Path.Join(root, filesystems.REPOSITORY_FOLDER_NAME)); os.IsNotExist(err) || (err == nil && !info.IsDir()) {
+		errors.Check(&NotRepositoryError{root})
+	}
+
+	fileSystem, err := filesystems.Open(files, root)
+	errors.Check(err)
+
+	return &Repository{fs: fileSystem}
+}
+
+// readState reads the index, refs, head and merge head from a single snapshot of the repository files.
+func (repository *Repository) readState() {
+	errors.Check(repository.fs.ReadSnapshot(func() (err error) {
+		if repository.index, err = repository.fs.ReadIndex(); err != nil {
+			return err
+		}
+		if repository.refs, err = repository.fs.ReadRefs(); err != nil {
+			return err
+		}
+		if repository.head, err = repository.fs.ReadHead(); err != nil {
+			return err
+		}
+		repository.mergeHead, err = repository.fs.ReadMergeHead()
+
+		return err
+	}))
+}
+
+// getRepository reads the repository state and builds the current file tree.
+func getRepository(files vfs.FS, root string, lock bool) *Repository {
+	repository := openRepository(files, root, lock)
+
+	dir, err := repository.fs.ReadDir(repository.getCurrentSaveName())
+	if err != nil {
+		repository.fs.Unlock()
+	}
+	errors.Check(err)
+	repository.dir = dir
+
+	return repository
+}
+
+// FindRoot walks up from dir to the closest directory containing a repository.
+func FindRoot(dir string) (string, error) {
+	return FindRootFS(vfs.NewOS(), dir)
+}
+
+// FindRootFS is FindRoot on files.
+func FindRootFS(files vfs.FS, dir string) (string, error) {
+	absDir, err := Path.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		info, err := files.Stat(Path.Join(absDir, filesystems.REPOSITORY_FOLDER_NAME))
+		if err == nil && info.IsDir() {
+			return absDir, nil
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+
+		parentDir := Path.Dir(absDir)
+		if parentDir == absDir {
+			return "", &NotRepositoryError{dir}
+		}
+
+		absDir = parentDir
+	}
+}
+
+func GetRepository(root string) (*Repository, error) {
+	return GetRepositoryFS(vfs.NewOS(), root)
+}
+
+// GetRepositoryFS reads the repository at root on files. The repository is not locked, the state read is
+// consistent but may be outdated by the time it is used, so it is meant for read only operations.
+func GetRepositoryFS(files vfs.FS, root string) (_ *Repository, err error) {
+	defer errors.Recover(&err)
+
+	return getRepository(files, root, false), nil
+}
+
+func LockRepository(root string) (*Repository, error) {
+	return LockRepositoryFS(vfs.NewOS(), root)
+}
+
+// LockRepositoryFS locks the repository at root on files and reads it, waiting for the process holding
+// the lock, if any, up to filesystems.LOCK_TIMEOUT. The repository files written are only visible to other
+// processes after Commit, and the lock must be released with Commit or Unlock.
+func LockRepositoryFS(files vfs.FS, root string) (_ *Repository, err error) {
+	defer errors.Recover(&err)
+
+	return getRepository(files, root, true), nil
+}
+
+// Commit writes the repository files changed since LockRepository and releases the lock.
+func (repository *Repository) Commit() error {
+	return repository.fs.Commit()
+}
+
+// Unlock releases the lock, the repository files changed since LockRepository are discarded. The objects
+// and saves written are kept, they are collected by CollectGarbage when unreachable.
+func (repository *Repository) Unlock() error {
+	return repository.fs.Unlock()
+}
+
+// SetParallelism bounds the number of files hashed, written or restored concurrently. A non positive
+// parallelism uses the number of CPUs.
+func (repository *Repository) SetParallelism(parallelism int) {
+	repository.parallelism = parallelism
+}
+
+// SetContext makes the file operations, and the requests of an S3 object store, stop with the context
+// error once ctx is done. Files already written are kept, e.g. a cancelled load leaves the working
+// directory partially restored.
+func (repository *Repository) SetContext(ctx context.Context) {
+	repository.ctx = ctx
+	repository.fs.SetContext(ctx)
+}
+
+// SetClock sets the function giving the creation date of saves, time.Now by default.
+func (repository *Repository) SetClock(clock func() time.Time) {
+	repository.clock = clock
+}
+
+// SetProgress sets a function called after each file indexed, hashed or restored. Calls are serialized.
+func (repository *Repository) SetProgress(progress func(Progress)) {
+	repository.progress = progress
+}
+
+// SetObjectStore makes this Repository read and write its objects in store, e.g. an objectstores.Memory.
+// The store is not remembered, see SetObjectStoreURL.
+func (repository *Repository) SetObjectStore(store objectstores.ObjectStore) {
+	repository.fs.SetObjectStore(store)
+}
+
+// SetObjectStoreURL makes the repository objects stored in the S3 compatible store at rawURL, for every
+// later use of the repository. Objects of a shared store are never packed nor collected, they may be
+// referenced by other repositories.
+func (repository *Repository) SetObjectStoreURL(rawURL string) (err error) {
+	defer errors.Recover(&err)
+
+	if err := repository.fs.SetObjectStoreURL(rawURL); err != nil {
+		return &ValidationError{err.Error()}
+	}
+
+	return nil
+}
+
+func (repository *Repository) now() time.Time {
+	if repository.clock == nil {
+		return time.Now()
+	}
+
+	return repository.clock()
+}
+
+// runWorkers runs fn for every file of operation with workers.Run, checking the context before each file
+// and reporting the progress after it.
+func (repository *Repository) runWorkers(operation string, count int, fn func(idx int) error) error {
+	var lock sync.Mutex
+	done := 0
+
+	return workers.Run(count, repository.parallelism, func(idx int) error {
+		if repository.ctx != nil {
+			if err := repository.ctx.Err(); err != nil {
+				return err
+			}
+		}
+
+		if err := fn(idx); err != nil {
+			return err
+		}
+
+		if repository.progress != nil {
+			lock.Lock()
+			defer lock.Unlock()
+
+			done++
+			repository.progress(Progress{Operation: operation, Done: done, Total: count})
+		}
+
+		return nil
+	})
+}
+
 func (repository *Repository) getCurrentSaveName() string {
 	if repository.isDetachedMode() {
 		return repository.head
@@ -108,17 +384,27 @@ func (repository *Repository) isDetachedMode() bool {
 
 func (repository *Repository) clearIndex() {
 	repository.index = []*directories.Change{}
-	repository.fs.SaveIndex(repository.index)
+	errors.Check(repository.fs.SaveIndex(repository.index))
 }
 
 func (repository *Repository) setRef(name, saveName string) {
 	(*repository.refs)[name] = saveName
-	repository.fs.WriteRefs(repository.refs)
+	errors.Check(repository.fs.WriteRefs(repository.refs))
 }
 
 func (repository *Repository) setHead(newHead string) {
 	repository.head = newHead
-	repository.fs.WriteHead(repository.head)
+	errors.Check(repository.fs.WriteHead(repository.head))
+}
+
+func (repository *Repository) setMergeHead(saveName string) {
+	repository.mergeHead = saveName
+
+	if saveName == "" {
+		errors.Check(repository.fs.RemoveMergeHead())
+	} else {
+		errors.Check(repository.fs.WriteMergeHead(saveName))
+	}
 }
 
 func (repository *Repository) isIndexConflicted() bool {
@@ -144,6 +430,23 @@ func (repository *Repository) findStagedChange(filepath string) *directories.Cha
 	return repository.index[idx]
 }
 
+// findRenameSource returns the staged rename moving the saved file at filepath, unless another change was
+// staged at filepath after it.
+func (repository *Repository) findRenameSource(filepath string) *directories.Change {
+	if repository.findStagedChange(filepath) != nil {
+		return nil
+	}
+
+	idx := collections.FindIndex(repository.index, func(change *directories.Change, _ int) bool {
+		return change.ChangeType == directories.Rename && change.Rename.FromFilepath == filepath
+	})
+	if idx == -1 {
+		return nil
+	}
+
+	return repository.index[idx]
+}
+
 func (repository *Repository) findSavedFile(filepath string) *directories.File {
 	normalizedPath, err := repository.dir.NormalizePath(filepath)
 	errors.Check(err)
@@ -156,6 +459,172 @@ func (repository *Repository) findSavedFile(filepath string) *directories.File {
 	return node.File
 }
 
+// isTrackedDirPresent tells whether the tracked file is an empty directory that still exists in the working
+// directory, files may have been added under it since.
+func (repository *Repository) isTrackedDirPresent(file *directories.File) bool {
+	if file == nil || file.Mode != directories.DirMode {
+		return false
+	}
+
+	info, err := repository.fs.Files.Lstat(file.Filepath)
+
+	return err == nil && info.IsDir()
+}
+
+// trackedFiles maps the saved files and the index changes by path. It is built once for the many lookups of
+// a walk, instead of scanning the index for each file, and must be built again when the index changes.
+type trackedFiles struct {
+	savedFiles    map[string]*directories.File
+	stagedChanges map[string]*directories.Change
+	renameSources map[string]*directories.Change
+	// Paths of the saved files that were not renamed and of the index changes
+	paths []string
+	// Directories containing tracked paths
+	dirs map[string]bool
+}
+
+func (repository *Repository) getTrackedFiles() *trackedFiles {
+	tracked := &trackedFiles{
+		savedFiles:    make(map[string]*directories.File),
+		stagedChanges: make(map[string]*directories.Change),
+		renameSources: make(map[string]*directories.Change),
+		paths:         []string{},
+		dirs:          make(map[string]bool),
+	}
+	savedFiles := repository.dir.CollectAllFiles()
+
+	for _, file := range savedFiles {
+		tracked.savedFiles[file.Filepath] = file
+	}
+
+	// The first change of a path wins, as with findStagedChange
+	for _, change := range repository.index {
+		if _, ok := tracked.stagedChanges[change.GetPath()]; !ok {
+			tracked.stagedChanges[change.GetPath()] = change
+		}
+		if change.ChangeType != directories.Rename {
+			continue
+		}
+		if _, ok := tracked.renameSources[change.Rename.FromFilepath]; !ok {
+			tracked.renameSources[change.Rename.FromFilepath] = change
+		}
+	}
+
+	for _, file := range savedFiles {
+		if tracked.findRenameSource(file.Filepath) == nil {
+			tracked.paths = append(tracked.paths, file.Filepath)
+		}
+	}
+
+	for _, change := range repository.index {
+		if tracked.savedFiles[change.GetPath()] == nil {
+			tracked.paths = append(tracked.paths, change.GetPath())
+		}
+	}
+
+	for _, trackedPath := range tracked.paths {
+		for dirpath := Path.Dir(trackedPath); !tracked.dirs[dirpath] && dirpath != Path.Dir(dirpath); dirpath = Path.Dir(dirpath) {
+			tracked.dirs[dirpath] = true
+		}
+	}
+
+	return tracked
+}
+
+func (tracked *trackedFiles) findSavedFile(filepath string) *directories.File {
+	return tracked.savedFiles[filepath]
+}
+
+func (tracked *trackedFiles) findStagedChange(filepath string) *directories.Change {
+	return tracked.stagedChanges[filepath]
+}
+
+// findRenameSource returns the staged rename moving the saved file at filepath, unless another change was
+// staged at filepath after it.
+func (tracked *trackedFiles) findRenameSource(filepath string) *directories.Change {
+	if tracked.findStagedChange(filepath) != nil {
+		return nil
+	}
+
+	return tracked.renameSources[filepath]
+}
+
+func (tracked *trackedFiles) isTracked(filepath string) bool {
+	if tracked.findStagedChange(filepath) != nil {
+		return true
+	}
+
+	return tracked.findSavedFile(filepath) != nil && tracked.findRenameSource(filepath) == nil
+}
+
+// findFile returns the staged file at filepath, or the saved one unless it was renamed.
+func (tracked *trackedFiles) findFile(filepath string) *directories.File {
+	if stagedChange := tracked.findStagedChange(filepath); stagedChange != nil {
+		return stagedChange.File
+	}
+	if tracked.findRenameSource(filepath) != nil {
+		return nil
+	}
+
+	return tracked.findSavedFile(filepath)
+}
+
+// containsTrackedPaths tells whether tracked paths are under dirpath.
+func (tracked *trackedFiles) containsTrackedPaths(dirpath string) bool {
+	return tracked.dirs[dirpath]
+}
+
+// getTrackedPaths returns the paths of the saved files that were not renamed and of the index changes.
+func (repository *Repository) getTrackedPaths() []string {
+	return repository.getTrackedFiles().paths
+}
+
+// listWorkingDirFiles walks dirpath and returns, in lexical order, the files that are tracked or not ignored.
+// Empty directories are listed as files, symlinks are not followed.
+//
+// Ignored directories are only walked when they contain tracked files.
+func (repository *Repository) listWorkingDirFiles(dirpath string, tracked *trackedFiles) []string {
+	repositoryPath := Path.Join(repository.fs.Root, filesystems.REPOSITORY_FOLDER_NAME)
+	filepaths := []string{}
+
+	err := vfs.Walk(repository.fs.Files, dirpath, func(filepath string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if filepath == repositoryPath {
+			return Path.SkipDir
+		}
+		if info.IsDir() {
+			if filepath != repository.fs.Root && repository.isIgnored(filepath, true) && !tracked.containsTrackedPaths(filepath) {
+				return Path.SkipDir
+			}
+
+			if filepath != repository.fs.Root && repository.isEmptyDir(filepath) &&
+				(tracked.isTracked(filepath) || !repository.isIgnored(filepath, true)) {
+				filepaths = append(filepaths, filepath)
+			}
+
+			return nil
+		}
+
+		if tracked.isTracked(filepath) || !repository.isIgnored(filepath, false) {
+			filepaths = append(filepaths, filepath)
+		}
+
+		return nil
+	})
+	errors.Check(err)
+
+	return filepaths
+}
+
+func (repository *Repository) isEmptyDir(dirpath string) bool {
+	empty, err := vfs.IsEmptyDir(repository.fs.Files, dirpath)
+	errors.Check(err)
+
+	return empty
+}
+
 func (repository *Repository) getSave(ref string) *filesystems.Save {
 	if repository.hasEmptySaveHistory() {
 		return nil
@@ -176,7 +645,10 @@ func (repository *Repository) getSave(ref string) *filesystems.Save {
 		checkpointId = ref
 	}
 
-	return repository.fs.ReadSave(checkpointId)
+	save, err := repository.fs.ReadSave(checkpointId)
+	errors.Check(err)
+
+	return save
 }
 
 func (repository *Repository) resolvePath(path string) (string, error) {
@@ -192,12 +664,12 @@ func (repository *Repository) resolvePath(path string) (string, error) {
 func buildDir(root string, save *filesystems.Save) *directories.Dir {
 	dir := &directories.Dir{Path: root, Children: map[string]*directories.Node{}}
 
-	for _, checkpoint := range save.Checkpoints {
+	for _, checkpoint := range save.FirstParentCheckpoints() {
 		for _, change := range checkpoint.Changes {
 			normalizedPath, err := dir.NormalizePath(change.GetPath())
 			errors.Check(err)
 
-			dir.AddNode(normalizedPath, change)
+			errors.Check(dir.AddNode(normalizedPath, change))
 		}
 	}
 
@@ -213,9 +685,22 @@ func (repository *Repository) applyDir(dir *directories.Dir) {
 		nodes = nodes[1:]
 	}
 
-	repository.fs.SafeRemoveWorkingDir(dir.Path)
+	errors.Check(repository.fs.SafeRemoveWorkingDir(dir.Path))
+
+	// Directories are created in order, so that files can be created concurrently
+	fileNodes := []*directories.Node{}
 
 	for _, node := range nodes {
-		repository.fs.CreateNode(node)
+		if node.NodeType == directories.FileType {
+			fileNodes = append(fileNodes, node)
+			continue
+		}
+
+		errors.Check(repository.fs.CreateNode(node))
 	}
+
+	err := repository.runWorkers(RESTORING_OPERATION, len(fileNodes), func(idx int) error {
+		return repository.fs.CreateNode(fileNodes[idx])
+	})
+	errors.Check(err)
 }
@@ -1,11 +1,18 @@
 package repositories
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	Path "path/filepath"
+	"saymow/version-manager/app/pkg/vfs"
 	"saymow/version-manager/app/repositories/directories"
 	"saymow/version-manager/app/repositories/filesystems"
+	"saymow/version-manager/app/repositories/objectstores"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	fsAssert "gotest.tools/v3/assert"
@@ -16,7 +23,7 @@ func TestInitRepository(t *testing.T) {
 	dir := fs.NewDir(t, "project")
 	defer dir.Remove()
 
-	CreateRepository(dir.Path())
+	fixtureCreateRepository(t, dir.Path())
 
 	fsAssert.Assert(
 		t,
@@ -28,6 +35,7 @@ func TestInitRepository(t *testing.T) {
 					filesystems.REPOSITORY_FOLDER_NAME,
 					fs.WithFile(filesystems.REFS_FILE_NAME, fmt.Sprintf("Refs:\n\n%s\n\n", filesystems.INITIAL_REF_NAME)),
 					fs.WithFile(filesystems.HEAD_FILE_NAME, filesystems.INITIAL_REF_NAME),
+					fs.WithFile(filesystems.VERSION_FILE_NAME, fmt.Sprint(filesystems.REPOSITORY_VERSION)),
 					fs.WithFile(filesystems.INDEX_FILE_NAME, "Tracked files:\r\n\r\n"),
 					fs.WithDir(filesystems.SAVES_FOLDER_NAME),
 					fs.WithDir(filesystems.OBJECTS_FOLDER_NAME),
@@ -47,7 +55,7 @@ func TestGetRepository(t *testing.T) {
 		fixtureMakeBasicRepositoryFs(dir),
 	)
 
-	repository := GetRepository(dir.Path())
+	repository := fixtureGetRepository(t, dir.Path())
 
 	fsAssert.Equal(t, repository.fs.Root, dir.Path())
 	fsAssert.Equal(t, repository.head, filesystems.INITIAL_REF_NAME)
@@ -77,6 +85,45 @@ func TestGetRepository(t *testing.T) {
 	fsAssert.Equal(t, repository.dir.Children["2.txt"].File.ObjectName, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855")
 	fsAssert.Equal(t, repository.dir.Children["3.txt"].File.Filepath, dir.Join("3.txt"))
 	fsAssert.Equal(t, repository.dir.Children["3.txt"].File.ObjectName, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855")
+
+	// Corrupted repository files are returned as errors
+	fs.Apply(t, dir, fs.WithDir(filesystems.REPOSITORY_FOLDER_NAME, fs.WithFile(filesystems.REFS_FILE_NAME, "Refs:\n\nmain\n")))
+
+	_, err := GetRepository(dir.Path())
+
+	var corruptErr *filesystems.CorruptError
+	assert.ErrorAs(t, err, &corruptErr)
+	assert.Equal(t, corruptErr.Name, "refs")
+}
+
+func TestFindRoot(t *testing.T) {
+	dir, _ := fixtureGetBaseProject(t)
+	defer dir.Remove()
+
+	root, err := FindRoot(dir.Path())
+	assert.Nil(t, err)
+	assert.Equal(t, root, dir.Path())
+
+	root, err = FindRoot(dir.Join("a", "b"))
+	assert.Nil(t, err)
+	assert.Equal(t, root, dir.Path())
+
+	root, err = FindRoot(dir.Join("a", "b", "..", "..", "c"))
+	assert.Nil(t, err)
+	assert.Equal(t, root, dir.Path())
+
+	otherDir := fs.NewDir(t, "other", fs.WithDir("a"))
+	defer otherDir.Remove()
+
+	_, err = FindRoot(otherDir.Join("a"))
+	assert.EqualError(t, err, "Repository Error: not a repository (or any of the parent directories).")
+
+	var notRepositoryErr *NotRepositoryError
+	assert.ErrorAs(t, err, &notRepositoryErr)
+	assert.Equal(t, notRepositoryErr.Path, otherDir.Join("a"))
+
+	_, err = GetRepository(otherDir.Path())
+	assert.ErrorAs(t, err, &notRepositoryErr)
 }
 
 func TestResolvePath(t *testing.T) {
@@ -114,3 +161,260 @@ func TestResolvePath(t *testing.T) {
 	_, err = repository.resolvePath(dir.Join(".."))
 	assert.Error(t, err, "invalid path.")
 }
+
+func TestRepositoryHooks(t *testing.T) {
+	dir, repository := fixtureGetBaseProject(t)
+	defer dir.Remove()
+
+	// Cancelled operations return the context error
+	{
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		repository.SetContext(ctx)
+		err := repository.IndexFiles([]string{dir.Join("1.txt"), dir.Join("2.txt")})
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, len(repository.index), 0)
+	}
+
+	// Every file reports its progress
+	{
+		progresses := []Progress{}
+
+		repository.SetContext(context.Background())
+		repository.SetProgress(func(progress Progress) {
+			progresses = append(progresses, progress)
+		})
+		err := repository.IndexFiles([]string{dir.Join("1.txt"), dir.Join("2.txt"), dir.Join("3.txt")})
+		assert.Nil(t, err)
+		assert.Equal(t, progresses, []Progress{
+			{Operation: INDEXING_OPERATION, Done: 1, Total: 3},
+			{Operation: INDEXING_OPERATION, Done: 2, Total: 3},
+			{Operation: INDEXING_OPERATION, Done: 3, Total: 3},
+		})
+	}
+
+	// Saves are dated by the clock
+	{
+		createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+		repository.SetClock(func() time.Time { return createdAt })
+		checkpoint, err := repository.CreateSave("save")
+		assert.Nil(t, err)
+		assert.True(t, checkpoint.CreatedAt.Equal(createdAt))
+	}
+}
+
+func TestInMemoryRepository(t *testing.T) {
+	files := vfs.NewMemory()
+	root := Path.Join(string(Path.Separator), "project")
+	assert.Nil(t, files.MkdirAll(Path.Join(root, "a"), 0755))
+	assert.Nil(t, files.WriteFile(Path.Join(root, "1.txt"), []byte("1 content"), 0644))
+	assert.Nil(t, files.WriteFile(Path.Join(root, "a", "2.txt"), []byte("2 content"), 0644))
+	assert.Nil(t, files.WriteFile(Path.Join(root, ".gitignore"), []byte("*.log\n"), 0644))
+	assert.Nil(t, files.WriteFile(Path.Join(root, "debug.log"), []byte("logs"), 0644))
+
+	repository, err := CreateRepositoryFS(files, root)
+	assert.Nil(t, err)
+
+	foundRoot, err := FindRootFS(files, Path.Join(root, "a"))
+	assert.Nil(t, err)
+	assert.Equal(t, foundRoot, root)
+
+	assert.Nil(t, repository.AddFiles([]string{root}))
+	assert.Nil(t, repository.SaveIndex())
+	checkpoint, err := repository.CreateSave("first save")
+	assert.Nil(t, err)
+
+	assert.Nil(t, files.WriteFile(Path.Join(root, "1.txt"), []byte("1 updated content"), 0644))
+	assert.Nil(t, files.WriteFile(Path.Join(root, "a", "3.txt"), []byte("3 content"), 0644))
+
+	repository, err = GetRepositoryFS(files, root)
+	assert.Nil(t, err)
+
+	status, err := repository.GetStatus()
+	assert.Nil(t, err)
+	assert.Equal(t, status.WorkingDir.ModifiedFilePaths, []string{Path.Join(root, "1.txt")})
+	assert.Equal(t, status.WorkingDir.UntrackedFilePaths, []string{Path.Join(root, "a", "3.txt")})
+
+	assert.Nil(t, repository.AddFiles([]string{root}))
+	_, err = repository.CreateSave("second save")
+	assert.Nil(t, err)
+
+	repository, err = GetRepositoryFS(files, root)
+	assert.Nil(t, err)
+	assert.Nil(t, repository.Load(checkpoint.Id))
+
+	content, err := files.ReadFile(Path.Join(root, "1.txt"))
+	assert.Nil(t, err)
+	assert.Equal(t, string(content), "1 content")
+	_, err = files.Stat(Path.Join(root, "a", "3.txt"))
+	assert.True(t, os.IsNotExist(err))
+
+	// Nothing is written to the disk
+	_, err = GetRepository(root)
+	var notRepositoryErr *NotRepositoryError
+	assert.ErrorAs(t, err, &notRepositoryErr)
+}
+
+func TestSharedObjectStore(t *testing.T) {
+	files := vfs.NewMemory()
+	store := objectstores.NewMemory()
+	roots := []string{Path.Join(string(Path.Separator), "a"), Path.Join(string(Path.Separator), "b")}
+
+	for _, root := range roots {
+		assert.Nil(t, files.MkdirAll(root, 0755))
+		assert.Nil(t, files.WriteFile(Path.Join(root, "1.txt"), []byte("1 content"), 0644))
+
+		_, err := CreateRepositoryFS(files, root)
+		assert.Nil(t, err)
+		repository, err := GetRepositoryFS(files, root)
+		assert.Nil(t, err)
+		repository.SetObjectStore(store)
+
+		assert.Nil(t, repository.AddFiles([]string{Path.Join(root, "1.txt")}))
+		assert.Nil(t, repository.SaveIndex())
+		_, err = repository.CreateSave("save")
+		assert.Nil(t, err)
+	}
+
+	// Both repositories share the object
+	objects, err := store.List()
+	assert.Nil(t, err)
+	assert.Equal(t, len(objects), 1)
+	empty, err := vfs.IsEmptyDir(files, Path.Join(roots[0], filesystems.REPOSITORY_FOLDER_NAME, filesystems.OBJECTS_FOLDER_NAME))
+	assert.Nil(t, err)
+	assert.True(t, empty)
+
+	repository, err := GetRepositoryFS(files, roots[0])
+	assert.Nil(t, err)
+	repository.SetObjectStore(store)
+
+	// Shared objects are neither collected nor packed, another repository may reference them
+	writer, err := store.Create()
+	assert.Nil(t, err)
+	assert.Nil(t, writer.Commit("unreachable-object"))
+	collection, err := repository.CollectGarbage(false, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, collection.RemovedObjects, []string{})
+	repack, err := repository.Repack()
+	assert.Nil(t, err)
+	assert.Equal(t, repack.PackedObjects, 0)
+	assert.Equal(t, repack.PackedSaves, 1)
+
+	// Only the objects referenced by the repository are verified, the other objects of the store are not
+	// its own
+	report, err := repository.CheckIntegrity()
+	assert.Nil(t, err)
+	assert.False(t, report.HasProblems())
+	assert.Equal(t, report.CheckedObjects, 1)
+
+	objects, err = store.List()
+	assert.Nil(t, err)
+	assert.Equal(t, len(objects), 2)
+
+	assert.Nil(t, files.WriteFile(Path.Join(roots[0], "1.txt"), []byte("1 updated content"), 0644))
+	assert.Nil(t, repository.Restore("HEAD", Path.Join(roots[0], "1.txt")))
+	content, err := files.ReadFile(Path.Join(roots[0], "1.txt"))
+	assert.Nil(t, err)
+	assert.Equal(t, string(content), "1 content")
+}
+
+func TestSetObjectStoreURL(t *testing.T) {
+	files := vfs.NewMemory()
+	root := Path.Join(string(Path.Separator), "project")
+	assert.Nil(t, files.MkdirAll(root, 0755))
+
+	repository, err := CreateRepositoryFS(files, root)
+	assert.Nil(t, err)
+
+	var validationErr *ValidationError
+	assert.ErrorAs(t, repository.SetObjectStoreURL("s3://bucket"), &validationErr)
+	repository, err = GetRepositoryFS(files, root)
+	assert.Nil(t, err)
+	assert.False(t, repository.fs.SharesObjects())
+
+	assert.Nil(t, repository.SetObjectStoreURL("https://storage.example.com/bucket/objects"))
+	repository, err = GetRepositoryFS(files, root)
+	assert.Nil(t, err)
+	assert.True(t, repository.fs.SharesObjects())
+
+	// An unreadable url is a corrupted repository
+	assert.Nil(t, files.WriteFile(Path.Join(root, filesystems.REPOSITORY_FOLDER_NAME, filesystems.OBJECT_STORE_FILE_NAME), []byte("invalid"), 0644))
+	_, err = GetRepositoryFS(files, root)
+	var corruptErr *filesystems.CorruptError
+	assert.ErrorAs(t, err, &corruptErr)
+}
+
+func TestLockRepository(t *testing.T) {
+	files := vfs.NewMemory()
+	root := Path.Join(string(Path.Separator), "project")
+	assert.Nil(t, files.MkdirAll(root, 0755))
+	assert.Nil(t, files.WriteFile(Path.Join(root, "1.txt"), []byte("1 content"), 0644))
+
+	_, err := CreateRepositoryFS(files, root)
+	assert.Nil(t, err)
+
+	repository, err := LockRepositoryFS(files, root)
+	assert.Nil(t, err)
+	assert.Nil(t, repository.AddFiles([]string{root}))
+	assert.Nil(t, repository.SaveIndex())
+
+	// Readers see the repository as it was before the lock
+	reader, err := GetRepositoryFS(files, root)
+	assert.Nil(t, err)
+	status, err := reader.GetStatus()
+	assert.Nil(t, err)
+	assert.Equal(t, status.WorkingDir.UntrackedFilePaths, []string{Path.Join(root, "1.txt")})
+
+	assert.Nil(t, repository.Commit())
+
+	reader, err = GetRepositoryFS(files, root)
+	assert.Nil(t, err)
+	status, err = reader.GetStatus()
+	assert.Nil(t, err)
+	assert.Equal(t, status.Staged.CreatedFilesPaths, []string{Path.Join(root, "1.txt")})
+
+	// Unlocked changes are discarded
+	repository, err = LockRepositoryFS(files, root)
+	assert.Nil(t, err)
+	assert.Nil(t, repository.Unstage([]string{Path.Join(root, "1.txt")}))
+	assert.Nil(t, repository.SaveIndex())
+	assert.Nil(t, repository.Unlock())
+
+	reader, err = GetRepositoryFS(files, root)
+	assert.Nil(t, err)
+	status, err = reader.GetStatus()
+	assert.Nil(t, err)
+	assert.Equal(t, status.Staged.CreatedFilesPaths, []string{Path.Join(root, "1.txt")})
+}
+
+func TestObjectStoreContext(t *testing.T) {
+	// An S3 server that stopped responding
+	stop := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		select {
+		case <-request.Context().Done():
+		case <-stop:
+		}
+	}))
+	defer server.Close()
+	defer close(stop)
+
+	files := vfs.NewMemory()
+	root := Path.Join(string(Path.Separator), "project")
+	assert.Nil(t, files.MkdirAll(root, 0755))
+	assert.Nil(t, files.WriteFile(Path.Join(root, "1.txt"), []byte("1 content"), 0644))
+
+	_, err := CreateRepositoryFS(files, root)
+	assert.Nil(t, err)
+	repository, err := GetRepositoryFS(files, root)
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	repository.SetObjectStore(objectstores.NewS3(objectstores.S3Config{Endpoint: server.URL, Bucket: "bucket"}))
+	repository.SetContext(ctx)
+
+	assert.ErrorIs(t, repository.AddFiles([]string{Path.Join(root, "1.txt")}), context.DeadlineExceeded)
+}
@@ -18,7 +18,7 @@ func (repository *Repository) getIndexDir() *directories.Node {
 			normalizedPath, err := dir.NormalizePath(change.GetPath())
 			errors.Check(err)
 
-			dir.AddNode(normalizedPath, change)
+			errors.Check(dir.AddNode(normalizedPath, change))
 		}
 	}
 
@@ -42,7 +42,9 @@ func (repository *Repository) getIndexDir() *directories.Node {
 //   - Restore will remove the existing changes in the path (forever) and restore reference.
 //   - You can use Restore to recover a deleted file from the index or from a Save.
 //   - The HEAD is not changed during Restore.
-func (repository *Repository) Restore(ref string, path string) error {
+func (repository *Repository) Restore(ref string, path string) (err error) {
+	defer errors.Recover(&err)
+
 	resolvedPath, err := repository.resolvePath(path)
 	if err != nil {
 		return err
@@ -56,13 +58,14 @@ func (repository *Repository) Restore(ref string, path string) error {
 		save := repository.getSave(ref)
 
 		if save == nil {
-			return &ValidationError{"invalid ref."}
+			return &InvalidRefError{ref}
 		}
 
 		dir := buildDir(repository.fs.Root, save)
 
 		if ref == "HEAD" {
-			dir.Merge(repository.getIndexDir().Dir)
+			_, err := dir.Merge(repository.getIndexDir().Dir)
+			errors.Check(err)
 		}
 
 		node = dir.FindNode(resolvedPath)
@@ -128,14 +131,14 @@ func (repository *Repository) Restore(ref string, path string) error {
 	if node.NodeType == directories.DirType {
 		repository.applyDir(node.Dir)
 	} else {
-		repository.fs.CreateNode(node)
+		errors.Check(repository.fs.CreateNode(node))
 	}
 
+	staleObjects := []string{}
 	for _, fileRemoved := range filesRemovedFromIndex {
-		repository.fs.RemoveObject(fileRemoved.ObjectName)
+		staleObjects = append(staleObjects, fileRemoved.ObjectName)
 	}
+	repository.removeUnusedObjects(staleObjects)
 
-	repository.SaveIndex()
-
-	return nil
+	return repository.SaveIndex()
 }
@@ -19,9 +19,9 @@ func TestInvalidRestore(t *testing.T) {
 	dir, repository := fixtureGetCustomProject(t, fixtureMakeBasicRepositoryFs)
 	defer dir.Remove()
 
-	assert.EqualError(t, repository.Restore("", "."), "Validation Error: invalid ref.")
-	assert.EqualError(t, repository.Restore("def invalid", "."), "Validation Error: invalid ref.")
-	assert.EqualError(t, repository.Restore("___", "."), "Validation Error: invalid ref.")
+	assert.EqualError(t, repository.Restore("", "."), "Ref Error: invalid ref \"\".")
+	assert.EqualError(t, repository.Restore("def invalid", "."), "Ref Error: invalid ref \"def invalid\".")
+	assert.EqualError(t, repository.Restore("___", "."), "Ref Error: invalid ref \"___\".")
 
 	assert.EqualError(t, repository.Restore("HEAD", "def-invalid-folder"), "Validation Error: invalid path.")
 	assert.EqualError(t, repository.Restore("HEAD", "def-invalid-folder"), "Validation Error: invalid path.")
@@ -41,7 +41,7 @@ func TestRestoreHeadSingleFile(t *testing.T) {
 			repository.SaveIndex()
 			repository.CreateSave("initial save")
 
-			repository = GetRepository(dir.Path())
+			repository = fixtureGetRepository(t, dir.Path())
 			fixtures.WriteFile(dir.Join("1.txt"), []byte("not the original content. Saved on the index"))
 			repository.IndexFile("1.txt")
 			repository.SaveIndex()
@@ -52,7 +52,7 @@ func TestRestoreHeadSingleFile(t *testing.T) {
 		// Test
 		{
 			// 1) Ensure index priority (and remove files from it)
-			repository = GetRepository(dir.Path())
+			repository = fixtureGetRepository(t, dir.Path())
 			assert.Equal(t, len(repository.index), 1)
 			assert.Equal(t, repository.index[0].File.Filepath, dir.Join("1.txt"))
 			repository.Restore("HEAD", "1.txt")
@@ -62,7 +62,7 @@ func TestRestoreHeadSingleFile(t *testing.T) {
 			assert.Equal(t, fixtures.ReadFile(dir.Join("1.txt")), "not the original content. Saved on the index")
 
 			// 1) When no index files, use history file
-			repository = GetRepository(dir.Path())
+			repository = fixtureGetRepository(t, dir.Path())
 			// should be indempontent now
 			repository.Restore("HEAD", "1.txt")
 			repository.Restore("HEAD", "1.txt")
@@ -85,7 +85,7 @@ func TestRestoreHeadSingleFile(t *testing.T) {
 
 		// Test
 		{
-			repository = GetRepository(dir.Path())
+			repository = fixtureGetRepository(t, dir.Path())
 			repository.RemoveFile("2.txt")
 
 			assert.Equal(t, len(repository.index), 1)
@@ -120,7 +120,7 @@ func TestRestoreHeadDir(t *testing.T) {
 
 			fixtures.WriteFile(dir.Join("a", "4.txt"), []byte("file 4 updated content."))
 
-			repository = GetRepository(dir.Path())
+			repository = fixtureGetRepository(t, dir.Path())
 			repository.Restore("HEAD", "a")
 		}
 
@@ -165,12 +165,12 @@ func TestRestoreHeadDir(t *testing.T) {
 			fixtures.MakeDirs(dir.Join("dir1"), dir.Join("dir1", "dir2"), dir.Join("dir1", "dir2", "dir3"))
 			fixtures.WriteFile(dir.Join("dir1", "dir2", "dir3", "10.txt"), []byte("file 10 original content."))
 
-			repository = GetRepository(dir.Path())
+			repository = fixtureGetRepository(t, dir.Path())
 			repository.IndexFile(path.Join("dir1", "dir2", "dir3", "10.txt"))
 			repository.RemoveFile(dir.Join("c", "8.txt"))
 			repository.SaveIndex()
 
-			repository = GetRepository(dir.Path())
+			repository = fixtureGetRepository(t, dir.Path())
 			repository.Restore("HEAD", ".")
 		}
 
@@ -225,7 +225,7 @@ func TestRestoreHeadNoHistory(t *testing.T) {
 	fixtures.WriteFile(dir.Join("2.txt"), []byte("2 updated content"))
 	fixtures.WriteFile(dir.Join("a", "4.txt"), []byte("4 updated content"))
 
-	repository = GetRepository(dir.Path())
+	repository = fixtureGetRepository(t, dir.Path())
 
 	repository.Restore("HEAD", ".")
 
@@ -348,7 +348,7 @@ func TestRestoreHistoryUnsavedChangesRootDir(t *testing.T) {
 
 		// SAVE 1
 		{
-			repository = GetRepository(dir.Path())
+			repository = fixtureGetRepository(t, dir.Path())
 
 			fixtures.WriteFile(dir.Join("1.txt"), []byte("file 1 (SAVE 0) (SAVE 1)."))
 			fixtures.WriteFile(dir.Join("2.txt"), []byte("file 2 (SAVE 0) (SAVE 1)."))
@@ -369,7 +369,7 @@ func TestRestoreHistoryUnsavedChangesRootDir(t *testing.T) {
 		// delete
 		fixtures.RemoveFile(dir.Join("c", "8.txt"))
 
-		repository = GetRepository(dir.Path())
+		repository = fixtureGetRepository(t, dir.Path())
 
 		repository.IndexFile(dir.Join("9.txt"))
 		repository.IndexFile(dir.Join("2.txt"))
@@ -379,10 +379,10 @@ func TestRestoreHistoryUnsavedChangesRootDir(t *testing.T) {
 
 	// Test Save
 	{
-		repository = GetRepository(dir.Path())
+		repository = fixtureGetRepository(t, dir.Path())
 		repository.Restore(save.Id, ".")
 
-		repository = GetRepository(dir.Path())
+		repository = fixtureGetRepository(t, dir.Path())
 
 		fsAssert.Equal(t, repository.head, filesystems.INITIAL_REF_NAME)
 		// should keep index changes, since we are not restoring HEAD.
@@ -444,7 +444,7 @@ func TestRestoreHistoryUnsavedChangesSubdir(t *testing.T) {
 
 		// SAVE 1
 		{
-			repository = GetRepository(dir.Path())
+			repository = fixtureGetRepository(t, dir.Path())
 
 			fixtures.WriteFile(dir.Join("1.txt"), []byte("file 1 (SAVE 0) (SAVE 1)."))
 			fixtures.WriteFile(dir.Join("2.txt"), []byte("file 2 (SAVE 0) (SAVE 1)."))
@@ -485,7 +485,7 @@ func TestRestoreHistoryUnsavedChangesSubdir(t *testing.T) {
 		}
 
 		// Apply index
-		repository = GetRepository(dir.Path())
+		repository = fixtureGetRepository(t, dir.Path())
 
 		repository.IndexFile(dir.Join("9.txt"))
 		repository.IndexFile(dir.Join("2.txt"))
@@ -500,11 +500,11 @@ func TestRestoreHistoryUnsavedChangesSubdir(t *testing.T) {
 
 	// Test Restore
 	{
-		repository = GetRepository(dir.Path())
+		repository = fixtureGetRepository(t, dir.Path())
 
 		repository.Restore(save0.Id, "a")
 
-		repository = GetRepository(dir.Path())
+		repository = fixtureGetRepository(t, dir.Path())
 
 		fsAssert.Equal(t, repository.head, filesystems.INITIAL_REF_NAME)
 		fsAssert.Equal(t, len(repository.index), 6)
@@ -556,7 +556,7 @@ func TestRestoreHistoryFileUnsavedChanges(t *testing.T) {
 
 		// SAVE 1
 		{
-			repository = GetRepository(dir.Path())
+			repository = fixtureGetRepository(t, dir.Path())
 
 			fixtures.WriteFile(dir.Join("0.txt"), []byte("file 0 (SAVE 0) (SAVE 1)."))
 			fixtures.WriteFile(dir.Join("1.txt"), []byte("file 1 (SAVE 0) (SAVE 1)."))
@@ -579,7 +579,7 @@ func TestRestoreHistoryFileUnsavedChanges(t *testing.T) {
 		fixtures.RemoveFile(dir.Join("0.txt"))
 
 		// Apply index
-		repository = GetRepository(dir.Path())
+		repository = fixtureGetRepository(t, dir.Path())
 		repository.IndexFile(dir.Join("3.txt"))
 		repository.IndexFile(dir.Join("2.txt"))
 		repository.RemoveFile(dir.Join("1.txt"))
@@ -588,15 +588,15 @@ func TestRestoreHistoryFileUnsavedChanges(t *testing.T) {
 
 	// Test Save
 	{
-		repository = GetRepository(dir.Path())
+		repository = fixtureGetRepository(t, dir.Path())
 
 		fsAssert.Equal(t, len(repository.index), 3)
 
-		GetRepository(dir.Path()).Restore(save.Id, "0.txt")
-		GetRepository(dir.Path()).Restore(save.Id, "2.txt")
-		GetRepository(dir.Path()).Restore(save.Id, "1.txt")
+		fixtureGetRepository(t, dir.Path()).Restore(save.Id, "0.txt")
+		fixtureGetRepository(t, dir.Path()).Restore(save.Id, "2.txt")
+		fixtureGetRepository(t, dir.Path()).Restore(save.Id, "1.txt")
 
-		repository = GetRepository(dir.Path())
+		repository = fixtureGetRepository(t, dir.Path())
 
 		fsAssert.Equal(t, len(repository.index), 3)
 		fsAssert.Equal(t, repository.index[0].File.Filepath, dir.Join("3.txt"))
@@ -651,7 +651,7 @@ func TestRestoreHistory(t *testing.T) {
 
 		// Save 1 Changes
 
-		repository = GetRepository(dir.Path())
+		repository = fixtureGetRepository(t, dir.Path())
 
 		fixtures.WriteFile(dir.Join("2.txt"), []byte("file 2 (SAVE 0) (SAVE 1)."))
 
@@ -661,7 +661,7 @@ func TestRestoreHistory(t *testing.T) {
 
 		// Save 2 Changes
 
-		repository = GetRepository(dir.Path())
+		repository = fixtureGetRepository(t, dir.Path())
 
 		fixtures.WriteFile(dir.Join("a", "4.txt"), []byte("file 4 (SAVE 0) (SAVE 2)."))
 
@@ -671,7 +671,7 @@ func TestRestoreHistory(t *testing.T) {
 
 		// Save 3 Changes
 
-		repository = GetRepository(dir.Path())
+		repository = fixtureGetRepository(t, dir.Path())
 
 		fixtures.WriteFile(dir.Join("2.txt"), []byte("file 2 (SAVE 0) (SAVE 1) (SAVE 3)."))
 		fixtures.MakeDirs(dir.Join("dir1"), dir.Join("dir1", "dir2"), dir.Join("dir1", "dir2", "dir3"), dir.Join("dir1", "dir2", "dir3", "dir4"))
@@ -690,7 +690,7 @@ func TestRestoreHistory(t *testing.T) {
 
 		// Save 4 Changes
 
-		repository = GetRepository(dir.Path())
+		repository = fixtureGetRepository(t, dir.Path())
 
 		fixtures.WriteFile(dir.Join("1.txt"), []byte("file 1 (SAVE 0) (SAVE 4)."))
 		fixtures.WriteFile(dir.Join("2.txt"), []byte("file 2 (SAVE 0) (SAVE 1) (SAVE 3) (SAVE 4)."))
@@ -712,7 +712,7 @@ func TestRestoreHistory(t *testing.T) {
 
 		// Save 5 Changes
 
-		repository = GetRepository(dir.Path())
+		repository = fixtureGetRepository(t, dir.Path())
 
 		repository.RemoveFile(dir.Join("1.txt"))
 		repository.RemoveFile(dir.Join("2.txt"))
@@ -723,7 +723,7 @@ func TestRestoreHistory(t *testing.T) {
 
 	// Test Save 3
 	{
-		repository = GetRepository(dir.Path())
+		repository = fixtureGetRepository(t, dir.Path())
 		repository.Restore(save3.Id, ".")
 
 		fsAssert.Equal(t, repository.head, filesystems.INITIAL_REF_NAME)
@@ -769,7 +769,7 @@ func TestRestoreHistory(t *testing.T) {
 
 	// Test Save 0
 	{
-		repository = GetRepository(dir.Path())
+		repository = fixtureGetRepository(t, dir.Path())
 		repository.Restore(save0.Id, ".")
 
 		fsAssert.Equal(t, repository.head, filesystems.INITIAL_REF_NAME)
@@ -799,7 +799,7 @@ func TestRestoreHistory(t *testing.T) {
 
 	// Test Save 5
 	{
-		repository = GetRepository(dir.Path())
+		repository = fixtureGetRepository(t, dir.Path())
 		repository.Restore(save5.Id, ".")
 
 		fsAssert.Equal(t, repository.head, filesystems.INITIAL_REF_NAME)
@@ -5,7 +5,5 @@ func (repository *Repository) SaveIndex() error {
 		return &ValidationError{"cannot make changes in detached mode."}
 	}
 
-	repository.fs.SaveIndex(repository.index)
-
-	return nil
+	return repository.fs.SaveIndex(repository.index)
 }
@@ -0,0 +1,62 @@
+package repositories
+
+import (
+	"fmt"
+	"saymow/version-manager/app/pkg/collections"
+	"saymow/version-manager/app/pkg/errors"
+	"saymow/version-manager/app/repositories/directories"
+	"slices"
+)
+
+// isStagedUnder tells whether the change path, or its rename source path, is under dir.
+func isStagedUnder(change *directories.Change, dir *directories.Dir) bool {
+	return dir.IsSubpath(change.GetPath()) || dir.IsSubpath(change.GetSourcePath())
+}
+
+// Unstage removes the index changes of the files, or of the files under the directories, matched by paths.
+// The working directory is never modified, and the objects only referenced by the removed changes are deleted.
+func (repository *Repository) Unstage(paths []string) (err error) {
+	defer errors.Recover(&err)
+
+	if repository.isDetachedMode() {
+		return &ValidationError{"cannot make changes in detached mode."}
+	}
+
+	dirs := []*directories.Dir{}
+	for _, path := range paths {
+		filepath, err := repository.dir.AbsPath(path)
+		if err != nil {
+			return &ValidationError{err.Error()}
+		}
+
+		dir := &directories.Dir{Path: filepath}
+		if !slices.ContainsFunc(repository.index, func(change *directories.Change) bool {
+			return isStagedUnder(change, dir)
+		}) {
+			return &ValidationError{fmt.Sprintf("path \"%s\" did not match any staged changes.", path)}
+		}
+
+		dirs = append(dirs, dir)
+	}
+
+	staleObjects := []string{}
+
+	repository.index = collections.Filter(repository.index, func(change *directories.Change, _ int) bool {
+		if !slices.ContainsFunc(dirs, func(dir *directories.Dir) bool { return isStagedUnder(change, dir) }) {
+			return true
+		}
+
+		switch {
+		case change.ChangeType == directories.Creation || change.ChangeType == directories.Modification || change.ChangeType == directories.Rename:
+			staleObjects = append(staleObjects, change.File.ObjectName)
+		case change.ChangeType == directories.Conflict && change.Conflict.IsObjectTemporary():
+			staleObjects = append(staleObjects, change.Conflict.ObjectName)
+		}
+
+		return false
+	})
+
+	repository.removeUnusedObjects(staleObjects)
+
+	return nil
+}
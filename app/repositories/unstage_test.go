@@ -0,0 +1,67 @@
+package repositories
+
+import (
+	"saymow/version-manager/app/pkg/fixtures"
+	"saymow/version-manager/app/repositories/directories"
+	"saymow/version-manager/app/repositories/filesystems"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnstage(t *testing.T) {
+	dir, repository := fixtureGetBaseProject(t)
+	defer dir.Remove()
+
+	assert.Nil(t, repository.AddFiles([]string{"1.txt", "2.txt", "a", "c"}))
+	repository.SaveIndex()
+	repository.CreateSave("initial save")
+	repository = fixtureGetRepository(t, dir.Path())
+
+	fixtures.WriteFile(dir.Join("1.txt"), []byte("1 new content"))
+	fixtures.WriteFile(dir.Join("a", "4.txt"), []byte("4 new content"))
+	fixtures.WriteFile(dir.Join("a", "b", "6.txt"), []byte("6 new content"))
+	assert.Nil(t, repository.AddFiles([]string{"1.txt", "3.txt", "a"}))
+	assert.Nil(t, repository.RemoveFile("2.txt"))
+
+	object1 := repository.findStagedChange(dir.Join("1.txt")).GetHash()
+	object3 := repository.findStagedChange(dir.Join("3.txt")).GetHash()
+
+	// Files are unstaged, their objects removed and the working directory untouched
+	{
+		assert.Nil(t, repository.Unstage([]string{"1.txt", "2.txt", "3.txt"}))
+		assert.Equal(t, getIndexPaths(repository), []string{dir.Join("a", "4.txt"), dir.Join("a", "b", "6.txt")})
+
+		assert.False(t, fixtures.FileExists(dir.Join(filesystems.REPOSITORY_FOLDER_NAME, filesystems.OBJECTS_FOLDER_NAME, object1)))
+		assert.False(t, fixtures.FileExists(dir.Join(filesystems.REPOSITORY_FOLDER_NAME, filesystems.OBJECTS_FOLDER_NAME, object3)))
+		assert.Equal(t, fixtures.ReadFile(dir.Join("1.txt")), "1 new content")
+		assert.Equal(t, fixtures.ReadFile(dir.Join("3.txt")), "3 content")
+		assert.False(t, fixtures.FileExists(dir.Join("2.txt")))
+
+		status, err := repository.GetStatus()
+		assert.NoError(t, err)
+		assert.Equal(t, status.WorkingDir.ModifiedFilePaths, []string{dir.Join("1.txt")})
+		assert.Equal(t, status.WorkingDir.RemovedFilePaths, []string{dir.Join("2.txt")})
+		assert.Equal(t, status.WorkingDir.UntrackedFilePaths, []string{dir.Join("3.txt")})
+	}
+
+	// Directories unstage the changes under them
+	{
+		assert.Nil(t, repository.Unstage([]string{"a"}))
+		assert.Equal(t, repository.index, []*directories.Change{})
+		assert.Equal(t, fixtures.ReadFile(dir.Join("a", "4.txt")), "4 new content")
+	}
+
+	// Objects still referenced by other changes are kept
+	{
+		fixtures.WriteFile(dir.Join("a", "5.txt"), []byte("4 new content"))
+		assert.Nil(t, repository.AddFiles([]string{"a"}))
+		object4 := repository.findStagedChange(dir.Join("a", "4.txt")).GetHash()
+
+		assert.Nil(t, repository.Unstage([]string{dir.Join("a", "4.txt")}))
+		assert.True(t, fixtures.FileExists(dir.Join(filesystems.REPOSITORY_FOLDER_NAME, filesystems.OBJECTS_FOLDER_NAME, object4)))
+	}
+
+	err := repository.Unstage([]string{"c"})
+	assert.EqualError(t, err, "Validation Error: path \"c\" did not match any staged changes.")
+}
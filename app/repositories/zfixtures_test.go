@@ -2,9 +2,11 @@ package repositories
 
 import (
 	"fmt"
+	"saymow/version-manager/app/pkg/fixtures"
 	"saymow/version-manager/app/repositories/filesystems"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"gotest.tools/v3/fs"
 )
 
@@ -27,7 +29,7 @@ Files:
 %s	(created)
 e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855
 %s	(created)
-e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855`, dir.Join("1.txt"), dir.Join("2.txt")),
+e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855`, "1.txt", "2.txt"),
 			),
 			fs.WithFile(
 				"3f674c71a3596db8f24fd31a85c503ae600898cc03810fcc171781d4f35531d2",
@@ -43,7 +45,7 @@ Files:
 %s	(created)
 e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855
 %s	(modified)
-6f6367cbecfac86af4e749156e1b1046524eff9afbd8a29c964c3b46ebdf7fc2`, dir.Join("3.txt"), dir.Join("1.txt")),
+6f6367cbecfac86af4e749156e1b1046524eff9afbd8a29c964c3b46ebdf7fc2`, "3.txt", "1.txt"),
 			),
 		),
 		fs.WithDir(
@@ -54,14 +56,29 @@ e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855
 		),
 		fs.WithFile(filesystems.REFS_FILE_NAME, fmt.Sprintf("Refs:\r\n\r\n%s\r\n3f674c71a3596db8f24fd31a85c503ae600898cc03810fcc171781d4f35531d2\r\n", filesystems.INITIAL_REF_NAME)),
 		fs.WithFile(filesystems.HEAD_FILE_NAME, filesystems.INITIAL_REF_NAME),
+		fs.WithFile(filesystems.VERSION_FILE_NAME, fmt.Sprint(filesystems.REPOSITORY_VERSION)),
 		fs.WithFile(filesystems.INDEX_FILE_NAME, fmt.Sprintf(`Tracked files:
 	
 %s	(created)
 814f15a360c1a700342d1652e3bd8b9c954ee2ad9c974f6ec88eb92ff2d6b3b3
-%s	(removed)`, dir.Join("4.txt"), dir.Join("2.txt"))),
+%s	(removed)`, "4.txt", "2.txt")),
 	)
 }
 
+func fixtureGetRepository(t *testing.T, root string) *Repository {
+	repository, err := GetRepository(root)
+	assert.NoError(t, err)
+
+	return repository
+}
+
+func fixtureCreateRepository(t *testing.T, root string) *Repository {
+	repository, err := CreateRepository(root)
+	assert.NoError(t, err)
+
+	return repository
+}
+
 func fixtureGetBaseProject(t *testing.T) (*fs.Dir, *Repository) {
 	dir := fs.NewDir(
 		t,
@@ -86,7 +103,7 @@ func fixtureGetBaseProject(t *testing.T) (*fs.Dir, *Repository) {
 		),
 	)
 
-	return dir, CreateRepository(dir.Path())
+	return dir, fixtureCreateRepository(t, dir.Path())
 }
 
 func fixtureGetNewProject(t *testing.T) (*fs.Dir, *Repository) {
@@ -95,7 +112,7 @@ func fixtureGetNewProject(t *testing.T) (*fs.Dir, *Repository) {
 		"project",
 	)
 
-	return dir, CreateRepository(dir.Path())
+	return dir, fixtureCreateRepository(t, dir.Path())
 }
 
 func fixtureGetCustomProject(t *testing.T, makeRepositoryDir func(dir *fs.Dir) fs.PathOp) (*fs.Dir, *Repository) {
@@ -124,5 +141,39 @@ func fixtureGetCustomProject(t *testing.T, makeRepositoryDir func(dir *fs.Dir) f
 
 	fs.Apply(t, dir, makeRepositoryDir(dir))
 
-	return dir, GetRepository(dir.Path())
+	return dir, fixtureGetRepository(t, dir.Path())
+}
+
+// fixtureGetConflictedMerge merges "feature" into master: a.txt conflicts and b.txt is staged with the
+// object of the feature save.
+func fixtureGetConflictedMerge(t *testing.T) (*fs.Dir, *Repository) {
+	dir, repository := fixtureGetNewProject(t)
+
+	fixtures.WriteFile(dir.Join("a.txt"), []byte("a.txt content."))
+	fixtures.WriteFile(dir.Join("b.txt"), []byte("b.txt content."))
+	assert.Nil(t, repository.AddFiles([]string{"a.txt", "b.txt"}))
+	repository.SaveIndex()
+	repository.CreateSave("s0")
+	repository.CreateRef("feature")
+
+	repository = fixtureGetRepository(t, dir.Path())
+	fixtures.WriteFile(dir.Join("a.txt"), []byte("a.txt feature content."))
+	fixtures.WriteFile(dir.Join("b.txt"), []byte("b.txt feature content."))
+	assert.Nil(t, repository.AddFiles([]string{"a.txt", "b.txt"}))
+	repository.SaveIndex()
+	repository.CreateSave("feature save")
+
+	repository = fixtureGetRepository(t, dir.Path())
+	assert.Nil(t, repository.Load(filesystems.INITIAL_REF_NAME))
+	repository = fixtureGetRepository(t, dir.Path())
+	fixtures.WriteFile(dir.Join("a.txt"), []byte("a.txt master content."))
+	assert.Nil(t, repository.AddFiles([]string{"a.txt"}))
+	repository.SaveIndex()
+	repository.CreateSave("master save")
+
+	repository = fixtureGetRepository(t, dir.Path())
+	_, err := repository.Merge("feature")
+	assert.Nil(t, err)
+
+	return dir, fixtureGetRepository(t, dir.Path())
 }
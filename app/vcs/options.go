@@ -0,0 +1,105 @@
+package vcs
+
+import (
+	"io"
+	"log/slog"
+	"saymow/version-manager/app/pkg/vfs"
+	"saymow/version-manager/app/repositories/objectstores"
+	"time"
+)
+
+// Progress reports how many files of an operation were processed. Operation is one of INDEXING_OPERATION,
+// HASHING_OPERATION or RESTORING_OPERATION.
+type Progress struct {
+	Operation string
+	Done      int
+	Total     int
+}
+
+type options struct {
+	root        string
+	files       vfs.FS
+	objects     objectstores.ObjectStore
+	clock       func() time.Time
+	logger      *slog.Logger
+	parallelism int
+	progress    func(Progress)
+}
+
+type Option func(*options)
+
+// WithRoot sets the directory of the repository. Open also accepts any of its subdirectories. Defaults to
+// the working directory.
+func WithRoot(root string) Option {
+	return func(options *options) {
+		options.root = root
+	}
+}
+
+// WithFS sets the file system holding the working directory and the repository. Defaults to the os one,
+// vfs.NewMemory gives repositories that never touch the disk.
+func WithFS(files vfs.FS) Option {
+	return func(options *options) {
+		options.files = files
+	}
+}
+
+// WithObjectStore sets the store of the objects, in place of the repository one. It is not remembered: every
+// program using the repository must set it, prefer "vcs init --object-store" for stores shared through
+// the command line. Objects of the store are never packed nor collected.
+func WithObjectStore(store objectstores.ObjectStore) Option {
+	return func(options *options) {
+		options.objects = store
+	}
+}
+
+// WithClock sets the function giving the creation date of saves. Defaults to time.Now.
+func WithClock(clock func() time.Time) Option {
+	return func(options *options) {
+		options.clock = clock
+	}
+}
+
+// WithLogger sets the logger of the operations. Nothing is logged by default, or when logger is nil.
+func WithLogger(logger *slog.Logger) Option {
+	return func(options *options) {
+		if logger == nil {
+			logger = discardLogger()
+		}
+
+		options.logger = logger
+	}
+}
+
+// WithParallelism bounds the number of files processed concurrently. A non positive parallelism, the
+// default, uses the number of CPUs.
+func WithParallelism(parallelism int) Option {
+	return func(options *options) {
+		options.parallelism = parallelism
+	}
+}
+
+// WithProgress sets a function called after each file indexed, hashed or restored. Calls are serialized.
+func WithProgress(progress func(Progress)) Option {
+	return func(options *options) {
+		options.progress = progress
+	}
+}
+
+func makeOptions(opts []Option) *options {
+	options := &options{
+		files:  vfs.NewOS(),
+		clock:  time.Now,
+		logger: discardLogger(),
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	return options
+}
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
@@ -0,0 +1,195 @@
+package vcs
+
+import (
+	Path "path/filepath"
+	"saymow/version-manager/app/repositories"
+	"saymow/version-manager/app/repositories/diffs"
+	"saymow/version-manager/app/repositories/filesystems"
+	"time"
+)
+
+const (
+	INDEXING_OPERATION  = repositories.INDEXING_OPERATION
+	HASHING_OPERATION   = repositories.HASHING_OPERATION
+	RESTORING_OPERATION = repositories.RESTORING_OPERATION
+)
+
+// The errors returned by the operations, use errors.As to tell them apart.
+type (
+	ValidationError    = repositories.ValidationError
+	NotRepositoryError = repositories.NotRepositoryError
+	InvalidRefError    = repositories.InvalidRefError
+	ConflictError      = repositories.ConflictError
+	CorruptError       = filesystems.CorruptError
+	LockedError        = filesystems.LockedError
+)
+
+type ChangeType string
+
+const (
+	Created    ChangeType = "created"
+	Modified   ChangeType = "modified"
+	Removed    ChangeType = "removed"
+	Renamed    ChangeType = "renamed"
+	Conflicted ChangeType = "conflicted"
+	Untracked  ChangeType = "untracked"
+)
+
+// Change is a file change. Paths are relative to the repository root and slash separated, FromPath is only
+// set for renames and Message only for conflicts.
+type Change struct {
+	Type     ChangeType
+	Path     string
+	FromPath string
+	Message  string
+}
+
+// Status lists the changes of the index, to be saved, and of the working directory, to be added.
+type Status struct {
+	Staged     []Change
+	WorkingDir []Change
+}
+
+// Save is a saved version of the files tree. Refs are the refs pointing to it.
+type Save struct {
+	ID        string
+	Message   string
+	CreatedAt time.Time
+	Parents   []string
+	Refs      []string
+}
+
+// FileDiff is the diff of a file, Type is one of Created, Modified, Removed or Renamed. Paths are as in
+// Change, the mode of a side is empty when the file does not exist on it. Binary files have no hunks.
+type FileDiff struct {
+	Type     ChangeType
+	Path     string
+	FromPath string
+	OldMode  string
+	NewMode  string
+	IsBinary bool
+	Hunks    []*Hunk
+}
+
+// Hunk is a hunk in the unified diff format, its lines are context, deleted or inserted lines.
+type (
+	Hunk     = diffs.UnifiedHunk
+	Line     = diffs.Line
+	LineType = diffs.LineType
+)
+
+const (
+	ContextLine  = diffs.ContextLine
+	DeletedLine  = diffs.DeletedLine
+	InsertedLine = diffs.InsertedLine
+)
+
+// Refs maps the ref names to the save they point to. Head is a ref name, or a save id in detached mode.
+type Refs struct {
+	Head string
+	Refs map[string]string
+}
+
+// MergeResult tells the save HEAD points to after a merge. Conflicted merges leave HEAD unchanged, the
+// conflicts have to be resolved and saved.
+type MergeResult struct {
+	SaveID    string
+	Conflicts []Change
+}
+
+func (status *Status) IsClean() bool {
+	return len(status.Staged)+len(status.WorkingDir) == 0
+}
+
+func relativePath(root string, filepath string) string {
+	relativePath, err := Path.Rel(root, filepath)
+	if err != nil {
+		return Path.ToSlash(filepath)
+	}
+
+	return Path.ToSlash(relativePath)
+}
+
+func makeChanges(root string, changeType ChangeType, filepaths []string) []Change {
+	changes := []Change{}
+
+	for _, filepath := range filepaths {
+		changes = append(changes, Change{Type: changeType, Path: relativePath(root, filepath)})
+	}
+
+	return changes
+}
+
+func makeStatus(root string, status *repositories.Status) *Status {
+	result := &Status{Staged: []Change{}, WorkingDir: []Change{}}
+
+	for _, conflict := range status.Staged.ConflictedFilesPaths {
+		result.Staged = append(result.Staged, Change{
+			Type:    Conflicted,
+			Path:    relativePath(root, conflict.Filepath),
+			Message: conflict.Message,
+		})
+	}
+	result.Staged = append(result.Staged, makeChanges(root, Created, status.Staged.CreatedFilesPaths)...)
+	result.Staged = append(result.Staged, makeChanges(root, Modified, status.Staged.ModifiedFilePaths)...)
+	result.Staged = append(result.Staged, makeChanges(root, Removed, status.Staged.RemovedFilePaths)...)
+	for _, rename := range status.Staged.RenamedFiles {
+		result.Staged = append(result.Staged, Change{
+			Type:     Renamed,
+			Path:     relativePath(root, rename.Filepath),
+			FromPath: relativePath(root, rename.FromFilepath),
+		})
+	}
+
+	result.WorkingDir = append(result.WorkingDir, makeChanges(root, Untracked, status.WorkingDir.UntrackedFilePaths)...)
+	result.WorkingDir = append(result.WorkingDir, makeChanges(root, Modified, status.WorkingDir.ModifiedFilePaths)...)
+	result.WorkingDir = append(result.WorkingDir, makeChanges(root, Removed, status.WorkingDir.RemovedFilePaths)...)
+
+	return result
+}
+
+func makeFileDiffs(root string, fileDiffs []*repositories.FileDiff) []*FileDiff {
+	result := []*FileDiff{}
+
+	for _, fileDiff := range fileDiffs {
+		diff := &FileDiff{
+			Type:     Modified,
+			Path:     relativePath(root, fileDiff.Filepath),
+			IsBinary: fileDiff.IsBinary,
+			Hunks:    fileDiff.Hunks,
+		}
+
+		if fileDiff.OldObjectName != "" {
+			diff.OldMode = fileDiff.OldMode.String()
+		}
+		if fileDiff.NewObjectName != "" {
+			diff.NewMode = fileDiff.NewMode.String()
+		}
+
+		switch {
+		case fileDiff.OldFilepath != "":
+			diff.Type = Renamed
+			diff.FromPath = relativePath(root, fileDiff.OldFilepath)
+		case fileDiff.OldObjectName == "":
+			diff.Type = Created
+		case fileDiff.NewObjectName == "":
+			diff.Type = Removed
+		}
+
+		result = append(result, diff)
+	}
+
+	return result
+}
+
+func makeSave(checkpoint *filesystems.Checkpoint, refs []string) *Save {
+	save := &Save{
+		ID:        checkpoint.Id,
+		Message:   checkpoint.Message,
+		CreatedAt: checkpoint.CreatedAt,
+		Parents:   append([]string{}, checkpoint.Parents...),
+		Refs:      append([]string{}, refs...),
+	}
+
+	return save
+}
@@ -0,0 +1,382 @@
+// Package vcs drives repositories from Go programs, without the command line.
+//
+// Paths arguments are relative to the repository root, or absolute. Every operation reads the repository
+// state from disk, a Repository is cheap to keep around but is not safe for concurrent use. Operations
+// modifying the repository hold its lock, like the vcs commands, see LockedError.
+package vcs
+
+import (
+	"context"
+	"maps"
+	"os"
+	Path "path/filepath"
+	"saymow/version-manager/app/pkg/vfs"
+	"saymow/version-manager/app/repositories"
+	"slices"
+)
+
+type Repository struct {
+	root    string
+	options *options
+}
+
+// Init creates a repository at the root option.
+func Init(ctx context.Context, opts ...Option) (*Repository, error) {
+	options := makeOptions(opts)
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	root, err := resolveRoot(options.root)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := repositories.CreateRepositoryFS(options.files, root); err != nil {
+		return nil, err
+	}
+	options.logger.Info("repository created", "root", root)
+
+	return &Repository{root: root, options: options}, nil
+}
+
+// Open opens the repository containing the root option.
+func Open(ctx context.Context, opts ...Option) (*Repository, error) {
+	options := makeOptions(opts)
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	dir, err := resolveRoot(options.root)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := repositories.FindRootFS(options.files, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Repository{root: root, options: options}, nil
+}
+
+func resolveRoot(root string) (string, error) {
+	if root == "" {
+		return os.Getwd()
+	}
+
+	return Path.Abs(root)
+}
+
+// Root returns the absolute path of the repository root.
+func (repository *Repository) Root() string {
+	return repository.root
+}
+
+// open reads the repository state, hooked to ctx and the options.
+func (repository *Repository) open(ctx context.Context) (*repositories.Repository, error) {
+	return repository.read(ctx, repositories.GetRepositoryFS)
+}
+
+// lock locks the repository and reads its state, the changes must be released with commit.
+func (repository *Repository) lock(ctx context.Context) (*repositories.Repository, error) {
+	return repository.read(ctx, repositories.LockRepositoryFS)
+}
+
+// commit writes the repository files changed by a locked operation and releases the lock, they are
+// discarded when the operation failed.
+func commit(state *repositories.Repository, err error) error {
+	if err != nil {
+		state.Unlock()
+		return err
+	}
+
+	return state.Commit()
+}
+
+func (repository *Repository) read(
+	ctx context.Context,
+	get func(files vfs.FS, root string) (*repositories.Repository, error),
+) (*repositories.Repository, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	state, err := get(repository.options.files, repository.root)
+	if err != nil {
+		return nil, err
+	}
+
+	if repository.options.objects != nil {
+		state.SetObjectStore(repository.options.objects)
+	}
+	state.SetContext(ctx)
+	state.SetClock(repository.options.clock)
+	state.SetParallelism(repository.options.parallelism)
+	if repository.options.progress != nil {
+		state.SetProgress(func(progress repositories.Progress) {
+			repository.options.progress(Progress(progress))
+		})
+	}
+
+	return state, nil
+}
+
+func (repository *Repository) resolvePaths(paths []string) []string {
+	filepaths := []string{}
+
+	for _, path := range paths {
+		filepath := Path.FromSlash(path)
+		if !Path.IsAbs(filepath) {
+			filepath = Path.Join(repository.root, filepath)
+		}
+
+		filepaths = append(filepaths, filepath)
+	}
+
+	return filepaths
+}
+
+func (repository *Repository) Status(ctx context.Context) (*Status, error) {
+	state, err := repository.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := state.GetStatus()
+	if err != nil {
+		return nil, err
+	}
+
+	return makeStatus(repository.root, status), nil
+}
+
+// Add stages the files, or the files under the directories, matched by paths.
+func (repository *Repository) Add(ctx context.Context, paths ...string) error {
+	if len(paths) == 0 {
+		return &ValidationError{Message: "nothing specified, nothing added."}
+	}
+
+	state, err := repository.lock(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = state.AddFiles(repository.resolvePaths(paths))
+	if err == nil {
+		err = state.SaveIndex()
+	}
+	if err := commit(state, err); err != nil {
+		return err
+	}
+	repository.options.logger.Info("files added", "paths", paths)
+
+	return nil
+}
+
+// Remove stages the removal of the files, or the files under the directories, matched by paths and deletes
+// them from the working directory. Files with unsaved modifications are refused.
+func (repository *Repository) Remove(ctx context.Context, paths ...string) error {
+	state, err := repository.lock(ctx)
+	if err != nil {
+		return err
+	}
+
+	// As "vcs rm -r": the files are deleted from the working directory too, and modified files are refused
+	cached, force, recursive := false, false, true
+	err = state.RemoveFiles(repository.resolvePaths(paths), cached, force, recursive)
+	if err == nil {
+		err = state.SaveIndex()
+	}
+	if err := commit(state, err); err != nil {
+		return err
+	}
+	repository.options.logger.Info("files removed", "paths", paths)
+
+	return nil
+}
+
+// Unstage removes the index changes of the files, or of the files under the directories, matched by paths.
+// The working directory is left unchanged.
+func (repository *Repository) Unstage(ctx context.Context, paths ...string) error {
+	if len(paths) == 0 {
+		return &ValidationError{Message: "nothing specified, nothing unstaged."}
+	}
+
+	state, err := repository.lock(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = state.Unstage(repository.resolvePaths(paths))
+	if err == nil {
+		err = state.SaveIndex()
+	}
+	if err := commit(state, err); err != nil {
+		return err
+	}
+	repository.options.logger.Info("files unstaged", "paths", paths)
+
+	return nil
+}
+
+// Save saves the index changes, HEAD is moved to the new save.
+func (repository *Repository) Save(ctx context.Context, message string) (*Save, error) {
+	state, err := repository.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoint, err := state.CreateSave(message)
+	if err := commit(state, err); err != nil {
+		return nil, err
+	}
+	repository.options.logger.Info("save created", "id", checkpoint.Id)
+
+	return makeSave(checkpoint, []string{state.GetRefs().Head}), nil
+}
+
+// Load restores the files tree of ref, a ref name or a save id, to the working directory. HEAD is moved
+// to ref.
+func (repository *Repository) Load(ctx context.Context, ref string) error {
+	state, err := repository.lock(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := commit(state, state.Load(ref)); err != nil {
+		return err
+	}
+	repository.options.logger.Info("ref loaded", "ref", ref)
+
+	return nil
+}
+
+// Restore restores path from ref, "HEAD" restores the index and HEAD version. HEAD is not moved.
+func (repository *Repository) Restore(ctx context.Context, ref string, path string) error {
+	state, err := repository.lock(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := commit(state, state.Restore(ref, repository.resolvePaths([]string{path})[0])); err != nil {
+		return err
+	}
+	repository.options.logger.Info("path restored", "ref", ref, "path", path)
+
+	return nil
+}
+
+// Merge merges the files tree of ref to the current one.
+func (repository *Repository) Merge(ctx context.Context, ref string) (*MergeResult, error) {
+	state, err := repository.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// The conflicts are read while the lock is held, so they are the ones of this merge
+	var status *repositories.Status
+	save, err := state.Merge(ref)
+	if err == nil {
+		status, err = state.GetStatus()
+	}
+	if err := commit(state, err); err != nil {
+		return nil, err
+	}
+
+	result := &MergeResult{SaveID: save.Id, Conflicts: []Change{}}
+	for _, change := range makeStatus(repository.root, status).Staged {
+		if change.Type == Conflicted {
+			result.Conflicts = append(result.Conflicts, change)
+		}
+	}
+	repository.options.logger.Info("ref merged", "ref", ref, "save", save.Id, "conflicts", len(result.Conflicts))
+
+	return result, nil
+}
+
+// CreateRef creates the ref name at the current save, or moves it there, and points HEAD to it.
+func (repository *Repository) CreateRef(ctx context.Context, name string) error {
+	state, err := repository.lock(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := commit(state, state.CreateRef(name)); err != nil {
+		return err
+	}
+	repository.options.logger.Info("ref created", "name", name)
+
+	return nil
+}
+
+func (repository *Repository) Refs(ctx context.Context) (*Refs, error) {
+	state, err := repository.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	refs := state.GetRefs()
+
+	return &Refs{Head: refs.Head, Refs: maps.Clone(refs.Refs)}, nil
+}
+
+// Diff returns the changes of the tracked files in the working directory that are not in the index. Untracked
+// files are not part of it.
+func (repository *Repository) Diff(ctx context.Context) ([]*FileDiff, error) {
+	return repository.diff(ctx, (*repositories.Repository).GetWorkingDirDiff)
+}
+
+// StagedDiff returns the index changes against HEAD.
+func (repository *Repository) StagedDiff(ctx context.Context) ([]*FileDiff, error) {
+	return repository.diff(ctx, (*repositories.Repository).GetStagedDiff)
+}
+
+// SavesDiff returns the changes from the files tree of from to the one of to, refs names or save ids.
+func (repository *Repository) SavesDiff(ctx context.Context, from string, to string) ([]*FileDiff, error) {
+	return repository.diff(ctx, func(state *repositories.Repository) ([]*repositories.FileDiff, error) {
+		return state.GetSavesDiff(from, to)
+	})
+}
+
+func (repository *Repository) diff(
+	ctx context.Context,
+	get func(state *repositories.Repository) ([]*repositories.FileDiff, error),
+) ([]*FileDiff, error) {
+	state, err := repository.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	fileDiffs, err := get(state)
+	if err != nil {
+		return nil, err
+	}
+
+	return makeFileDiffs(repository.root, fileDiffs), nil
+}
+
+// Logs returns the saves reachable from HEAD, most recent first.
+func (repository *Repository) Logs(ctx context.Context) ([]*Save, error) {
+	state, err := repository.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	log, err := state.GetLogs()
+	if err != nil {
+		return nil, err
+	}
+
+	saves := []*Save{}
+	for _, saveLog := range log.History {
+		refs := slices.Clone(saveLog.Refs)
+		slices.Sort(refs)
+
+		saves = append(saves, makeSave(saveLog.Checkpoint, refs))
+	}
+
+	return saves, nil
+}
@@ -0,0 +1,315 @@
+package vcs
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	Path "path/filepath"
+	"saymow/version-manager/app/pkg/vfs"
+	"saymow/version-manager/app/repositories/objectstores"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gotest.tools/v3/fs"
+)
+
+func TestRepository(t *testing.T) {
+	dir := fs.NewDir(
+		t,
+		"project",
+		fs.WithFile("1.txt", "1 content"),
+		fs.WithDir("a", fs.WithFile("2.txt", "2 content")),
+	)
+	defer dir.Remove()
+
+	ctx := context.Background()
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	var logs bytes.Buffer
+
+	repository, err := Init(
+		ctx,
+		WithRoot(dir.Path()),
+		WithClock(func() time.Time { return createdAt }),
+		WithLogger(slog.New(slog.NewTextHandler(&logs, nil))),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, repository.Root(), dir.Path())
+
+	status, err := repository.Status(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, status.WorkingDir, []Change{
+		{Type: Untracked, Path: "1.txt"},
+		{Type: Untracked, Path: "a/2.txt"},
+	})
+
+	assert.Nil(t, repository.Add(ctx, "1.txt", "a"))
+
+	status, err = repository.Status(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, status.Staged, []Change{
+		{Type: Created, Path: "1.txt"},
+		{Type: Created, Path: "a/2.txt"},
+	})
+	assert.Equal(t, status.WorkingDir, []Change{})
+
+	save, err := repository.Save(ctx, "first save")
+	assert.Nil(t, err)
+	assert.Equal(t, save.Message, "first save")
+	assert.True(t, save.CreatedAt.Equal(createdAt))
+	assert.Equal(t, save.Parents, []string{})
+	assert.Equal(t, save.Refs, []string{"master"})
+
+	status, err = repository.Status(ctx)
+	assert.Nil(t, err)
+	assert.True(t, status.IsClean())
+
+	assert.Nil(t, repository.CreateRef(ctx, "feature"))
+	assert.Nil(t, os.WriteFile(dir.Join("3.txt"), []byte("3 content"), 0644))
+	assert.Nil(t, repository.Add(ctx, "3.txt"))
+	featureSave, err := repository.Save(ctx, "feature save")
+	assert.Nil(t, err)
+	assert.Equal(t, featureSave.Parents, []string{save.ID})
+
+	refs, err := repository.Refs(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, refs, &Refs{Head: "feature", Refs: map[string]string{"master": save.ID, "feature": featureSave.ID}})
+
+	saves, err := repository.Logs(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, len(saves), 2)
+	assert.Equal(t, saves[0].ID, featureSave.ID)
+	assert.Equal(t, saves[0].Refs, []string{"feature"})
+	assert.Equal(t, saves[1].ID, save.ID)
+	assert.Equal(t, saves[1].Refs, []string{"master"})
+
+	// Loading moves HEAD and restores the files tree
+	assert.Nil(t, repository.Load(ctx, "master"))
+	_, err = os.Stat(dir.Join("3.txt"))
+	assert.True(t, os.IsNotExist(err))
+
+	merge, err := repository.Merge(ctx, "feature")
+	assert.Nil(t, err)
+	assert.Equal(t, merge, &MergeResult{SaveID: featureSave.ID, Conflicts: []Change{}})
+	assert.FileExists(t, dir.Join("3.txt"))
+
+	assert.Contains(t, logs.String(), "msg=\"ref merged\" ref=feature")
+
+	// Opened from a subdirectory
+	opened, err := Open(ctx, WithRoot(dir.Join("a")))
+	assert.Nil(t, err)
+	assert.Equal(t, opened.Root(), dir.Path())
+
+	assert.Nil(t, opened.Remove(ctx, "1.txt"))
+	assert.NoFileExists(t, dir.Join("1.txt"))
+	assert.Nil(t, opened.Restore(ctx, "HEAD", "1.txt"))
+	assert.FileExists(t, dir.Join("1.txt"))
+}
+
+func TestRepositoryMergeConflicts(t *testing.T) {
+	dir := fs.NewDir(t, "project", fs.WithFile("1.txt", "1 content"))
+	defer dir.Remove()
+
+	ctx := context.Background()
+	repository, err := Init(ctx, WithRoot(dir.Path()))
+	assert.Nil(t, err)
+
+	assert.Nil(t, repository.Add(ctx, "1.txt"))
+	save, err := repository.Save(ctx, "first save")
+	assert.Nil(t, err)
+
+	assert.Nil(t, repository.CreateRef(ctx, "feature"))
+	assert.Nil(t, os.WriteFile(dir.Join("1.txt"), []byte("1 feature content"), 0644))
+	assert.Nil(t, repository.Add(ctx, "1.txt"))
+	_, err = repository.Save(ctx, "feature save")
+	assert.Nil(t, err)
+
+	assert.Nil(t, repository.Load(ctx, "master"))
+	assert.Nil(t, os.WriteFile(dir.Join("1.txt"), []byte("1 master content"), 0644))
+	assert.Nil(t, repository.Add(ctx, "1.txt"))
+	masterSave, err := repository.Save(ctx, "master save")
+	assert.Nil(t, err)
+	assert.Equal(t, masterSave.Parents, []string{save.ID})
+
+	merge, err := repository.Merge(ctx, "feature")
+	assert.Nil(t, err)
+	assert.Equal(t, merge.SaveID, masterSave.ID)
+	assert.Equal(t, len(merge.Conflicts), 1)
+	assert.Equal(t, merge.Conflicts[0].Type, Conflicted)
+	assert.Equal(t, merge.Conflicts[0].Path, "1.txt")
+
+	// The lock was released
+	status, err := repository.Status(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, status.Staged, merge.Conflicts)
+}
+
+func TestRepositoryDiff(t *testing.T) {
+	dir := fs.NewDir(t, "project", fs.WithFile("1.txt", "1 content\n"))
+	defer dir.Remove()
+
+	ctx := context.Background()
+	repository, err := Init(ctx, WithRoot(dir.Path()))
+	assert.Nil(t, err)
+
+	assert.Nil(t, repository.Add(ctx, "1.txt"))
+	save, err := repository.Save(ctx, "first save")
+	assert.Nil(t, err)
+
+	assert.Nil(t, os.WriteFile(dir.Join("1.txt"), []byte("1 updated content\n"), 0644))
+	modified := &FileDiff{
+		Type:    Modified,
+		Path:    "1.txt",
+		OldMode: "100644",
+		NewMode: "100644",
+		Hunks: []*Hunk{{
+			OldStart: 1,
+			OldLines: 1,
+			NewStart: 1,
+			NewLines: 1,
+			Lines: []*Line{
+				{LineType: DeletedLine, Content: "1 content\n"},
+				{LineType: InsertedLine, Content: "1 updated content\n"},
+			},
+		}},
+	}
+
+	fileDiffs, err := repository.Diff(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, fileDiffs, []*FileDiff{modified})
+
+	assert.Nil(t, repository.Add(ctx, "1.txt"))
+	fileDiffs, err = repository.Diff(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, fileDiffs, []*FileDiff{})
+	fileDiffs, err = repository.StagedDiff(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, fileDiffs, []*FileDiff{modified})
+
+	// Unstaged changes are back in the working directory
+	assert.Nil(t, repository.Unstage(ctx, "1.txt"))
+	fileDiffs, err = repository.StagedDiff(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, fileDiffs, []*FileDiff{})
+	status, err := repository.Status(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, status.WorkingDir, []Change{{Type: Modified, Path: "1.txt"}})
+
+	assert.Nil(t, repository.Add(ctx, "1.txt"))
+	updateSave, err := repository.Save(ctx, "update save")
+	assert.Nil(t, err)
+	fileDiffs, err = repository.SavesDiff(ctx, save.ID, updateSave.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, fileDiffs, []*FileDiff{modified})
+
+	var validationErr *ValidationError
+	assert.ErrorAs(t, repository.Unstage(ctx), &validationErr)
+	var invalidRefErr *InvalidRefError
+	_, err = repository.SavesDiff(ctx, "unknown", updateSave.ID)
+	assert.ErrorAs(t, err, &invalidRefErr)
+}
+
+func TestRepositoryErrors(t *testing.T) {
+	dir := fs.NewDir(t, "project", fs.WithFile("1.txt", "1 content"))
+	defer dir.Remove()
+
+	ctx := context.Background()
+
+	_, err := Open(ctx, WithRoot(dir.Path()))
+	var notRepositoryErr *NotRepositoryError
+	assert.ErrorAs(t, err, &notRepositoryErr)
+
+	// A nil logger logs nothing
+	repository, err := Init(ctx, WithRoot(dir.Path()), WithLogger(nil))
+	assert.Nil(t, err)
+
+	var validationErr *ValidationError
+	assert.ErrorAs(t, repository.Add(ctx), &validationErr)
+
+	assert.Nil(t, repository.Add(ctx, "1.txt"))
+	_, err = repository.Save(ctx, "save")
+	assert.Nil(t, err)
+
+	var invalidRefErr *InvalidRefError
+	assert.ErrorAs(t, repository.Load(ctx, "unknown"), &invalidRefErr)
+	assert.Equal(t, invalidRefErr.Ref, "unknown")
+
+	assert.Nil(t, os.WriteFile(dir.Join("1.txt"), []byte("1 updated content"), 0644))
+	var conflictErr *ConflictError
+	assert.ErrorAs(t, repository.Remove(ctx, "1.txt"), &conflictErr)
+}
+
+func TestRepositoryContext(t *testing.T) {
+	dir := fs.NewDir(
+		t,
+		"project",
+		fs.WithFile("1.txt", "1 content"),
+		fs.WithFile("2.txt", "2 content"),
+		fs.WithFile("3.txt", "3 content"),
+	)
+	defer dir.Remove()
+
+	progresses := []Progress{}
+	repository, err := Init(
+		context.Background(),
+		WithRoot(dir.Path()),
+		WithParallelism(2),
+		WithProgress(func(progress Progress) {
+			progresses = append(progresses, progress)
+		}),
+	)
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.ErrorIs(t, repository.Add(ctx, "1.txt"), context.Canceled)
+	_, err = repository.Status(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, len(progresses), 0)
+
+	assert.Nil(t, repository.Add(context.Background(), "1.txt", "2.txt", "3.txt"))
+	assert.Equal(t, len(progresses), 3)
+	for idx, progress := range progresses {
+		assert.Equal(t, progress, Progress{Operation: INDEXING_OPERATION, Done: idx + 1, Total: 3})
+	}
+}
+
+func TestInMemoryRepository(t *testing.T) {
+	ctx := context.Background()
+	files := vfs.NewMemory()
+	root := Path.Join(string(Path.Separator), "project")
+	assert.Nil(t, files.MkdirAll(root, 0755))
+	assert.Nil(t, files.WriteFile(Path.Join(root, "1.txt"), []byte("1 content"), 0644))
+
+	objects := objectstores.NewMemory()
+
+	repository, err := Init(ctx, WithFS(files), WithRoot(root), WithObjectStore(objects))
+	assert.Nil(t, err)
+	assert.Nil(t, repository.Add(ctx, "1.txt"))
+	save, err := repository.Save(ctx, "first save")
+	assert.Nil(t, err)
+
+	infos, err := objects.List()
+	assert.Nil(t, err)
+	assert.Equal(t, len(infos), 1)
+
+	assert.Nil(t, files.WriteFile(Path.Join(root, "1.txt"), []byte("1 updated content"), 0644))
+
+	opened, err := Open(ctx, WithFS(files), WithRoot(root), WithObjectStore(objects))
+	assert.Nil(t, err)
+	status, err := opened.Status(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, status.WorkingDir, []Change{{Type: Modified, Path: "1.txt"}})
+
+	assert.Nil(t, opened.Restore(ctx, save.ID, "1.txt"))
+	content, err := files.ReadFile(Path.Join(root, "1.txt"))
+	assert.Nil(t, err)
+	assert.Equal(t, string(content), "1 content")
+
+	// The repository only exists in memory
+	_, err = Open(ctx, WithRoot(root))
+	var notRepositoryErr *NotRepositoryError
+	assert.ErrorAs(t, err, &notRepositoryErr)
+}